@@ -6,6 +6,7 @@
 package addrmgr
 
 import (
+	"bytes"
 	"container/list"
 	crand "crypto/rand" // for seeding
 	"encoding/base32"
@@ -25,6 +26,7 @@ import (
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/crypto/sha3"
 )
 
 // AddrManager provides a concurrency safe address manager for caching potential
@@ -46,6 +48,29 @@ type AddrManager struct {
 	nNew           int
 	lamtx          sync.Mutex
 	localAddresses map[string]*localAddress
+
+	// asmap, when set, groups addresses by the autonomous system which
+	// announces them instead of by a fixed prefix length.  It is only set
+	// before the address manager is started.
+	asmap *ASMap
+
+	// cjdnsReachable specifies whether the node is connected to the CJDNS
+	// network, in which case addresses in the fc00::/8 range are treated
+	// as CJDNS addresses instead of private IPv6 addresses.  It is only
+	// set before the address manager is started.
+	cjdnsReachable bool
+
+	// triedCollisions houses the good new addresses which would evict an
+	// address from a full tried bucket, keyed by their address key.  The
+	// address which would be evicted is tested before it is replaced.
+	triedCollisions map[string]*triedCollision
+}
+
+// triedCollision describes a good new address which would evict an address
+// from a full tried bucket along with when the collision was found.
+type triedCollision struct {
+	ka    *KnownAddress
+	added time.Time
 }
 
 type serializedKnownAddress struct {
@@ -64,10 +89,14 @@ type serializedAddrManager struct {
 	Addresses    []*serializedKnownAddress
 	NewBuckets   [newBucketCount][]string // string is NetAddressKey
 	TriedBuckets [triedBucketCount][]string
+
+	// ASMapHash identifies the ASN map the buckets were chosen with.  It
+	// is empty when no ASN map was used.
+	ASMapHash string `json:",omitempty"`
 }
 
 type localAddress struct {
-	na    *wire.NetAddress
+	na    *wire.NetAddressV2
 	score AddressPriority
 }
 
@@ -156,11 +185,52 @@ const (
 
 	// serialisationVersion is the current version of the on-disk format.
 	serialisationVersion = 1
+
+	// onionSuffix is the host suffix of Tor onion service addresses.
+	onionSuffix = ".onion"
+
+	// torV2HostLen is the length of a Tor v2 host which is 16 chars of
+	// base32 followed by onionSuffix.
+	torV2HostLen = 16 + len(onionSuffix)
+
+	// torV3HostLen is the length of a Tor v3 host which is 56 chars of
+	// base32 followed by onionSuffix.
+	torV3HostLen = 56 + len(onionSuffix)
+
+	// torV3Version is the version byte encoded in Tor v3 addresses.
+	torV3Version = 0x03
+
+	// torV3ChecksumPrefix is prepended to the public key and version when
+	// calculating the checksum of a Tor v3 address.
+	torV3ChecksumPrefix = ".onion checksum"
+
+	// i2pSuffix is the host suffix of I2P addresses.
+	i2pSuffix = ".b32.i2p"
+
+	// i2pHostLen is the length of an I2P host which is 52 chars of
+	// unpadded base32 followed by i2pSuffix.
+	i2pHostLen = 52 + len(i2pSuffix)
+
+	// maxTriedCollisions is the maximum number of good new addresses
+	// which are waiting for the tried address they would evict to be
+	// tested.
+	maxTriedCollisions = 10
+
+	// triedReplacementTime is how recently a tried address must have
+	// been connected to successfully for it to not be replaced by a
+	// colliding address.  Likewise, a failed connection attempt to it
+	// within this time allows it to be replaced.
+	triedReplacementTime = time.Hour * 4
+
+	// triedCollisionTimeout is the amount of time after which a tried
+	// address which has not been tested is replaced by a colliding
+	// address.
+	triedCollisionTimeout = time.Minute * 40
 )
 
 // updateAddress is a helper function to either update an address already known
 // to the address manager, or to add the address if not already known.
-func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddress) {
+func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddressV2) {
 	// Filter out non-routable addresses. Note that non-routable
 	// also includes invalid and local addresses.
 	if !IsRoutable(netAddr) {
@@ -291,14 +361,14 @@ func (a *AddrManager) pickTried(bucket int) *list.Element {
 	return oldestElem
 }
 
-func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddress) int {
+func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddressV2) int {
 	// bitcoind:
 	// doublesha256(key + sourcegroup + int64(doublesha256(key + group + sourcegroup))%bucket_per_source_group) % num_new_buckets
 
 	data1 := []byte{}
 	data1 = append(data1, a.key[:]...)
-	data1 = append(data1, []byte(GroupKey(netAddr))...)
-	data1 = append(data1, []byte(GroupKey(srcAddr))...)
+	data1 = append(data1, []byte(a.GroupKey(netAddr))...)
+	data1 = append(data1, []byte(a.GroupKey(srcAddr))...)
 	hash1 := chainhash.DoubleHashB(data1)
 	hash64 := binary.LittleEndian.Uint64(hash1)
 	hash64 %= newBucketsPerGroup
@@ -306,14 +376,14 @@ func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddress) int {
 	binary.LittleEndian.PutUint64(hashbuf[:], hash64)
 	data2 := []byte{}
 	data2 = append(data2, a.key[:]...)
-	data2 = append(data2, GroupKey(srcAddr)...)
+	data2 = append(data2, a.GroupKey(srcAddr)...)
 	data2 = append(data2, hashbuf[:]...)
 
 	hash2 := chainhash.DoubleHashB(data2)
 	return int(binary.LittleEndian.Uint64(hash2) % newBucketCount)
 }
 
-func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddress) int {
+func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddressV2) int {
 	// bitcoind hashes this as:
 	// doublesha256(key + group + truncate_to_64bits(doublesha256(key)) % buckets_per_group) % num_buckets
 	data1 := []byte{}
@@ -326,7 +396,7 @@ func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddress) int {
 	binary.LittleEndian.PutUint64(hashbuf[:], hash64)
 	data2 := []byte{}
 	data2 = append(data2, a.key[:]...)
-	data2 = append(data2, GroupKey(netAddr)...)
+	data2 = append(data2, a.GroupKey(netAddr)...)
 	data2 = append(data2, hashbuf[:]...)
 
 	hash2 := chainhash.DoubleHashB(data2)
@@ -364,6 +434,7 @@ func (a *AddrManager) savePeers() {
 	sam := new(serializedAddrManager)
 	sam.Version = serialisationVersion
 	copy(sam.Key[:], a.key[:])
+	sam.ASMapHash = a.asmapHash()
 
 	sam.Addresses = make([]*serializedKnownAddress, len(a.addrIndex))
 	i := 0
@@ -475,6 +546,16 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 		a.addrIndex[NetAddressKey(ka.na)] = ka
 	}
 
+	// The buckets depend on the network groups of the addresses, so they
+	// are chosen again when the addresses were grouped with a different
+	// ASN map.
+	if sam.ASMapHash != a.asmapHash() {
+		log.Infof("ASN map changed, rebucketing %d addresses",
+			len(a.addrIndex))
+		a.rebucket(&sam)
+		return nil
+	}
+
 	for i := range sam.NewBuckets {
 		for _, val := range sam.NewBuckets[i] {
 			ka, ok := a.addrIndex[val]
@@ -520,8 +601,44 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 	return nil
 }
 
+// rebucket places the deserialized addresses into the buckets chosen with the
+// current network grouping.  Tried addresses which no longer fit in their tried
+// bucket are placed in a new bucket instead, and addresses which don't fit in
+// their new bucket are dropped.
+//
+// This function MUST be called with the address manager lock held (for writes).
+func (a *AddrManager) rebucket(sam *serializedAddrManager) {
+	for i := range sam.TriedBuckets {
+		for _, val := range sam.TriedBuckets[i] {
+			ka, ok := a.addrIndex[val]
+			if !ok || ka.tried {
+				continue
+			}
+			bucket := a.getTriedBucket(ka.na)
+			if a.addrTried[bucket].Len() < triedBucketSize {
+				ka.tried = true
+				a.nTried++
+				a.addrTried[bucket].PushBack(ka)
+			}
+		}
+	}
+	for key, ka := range a.addrIndex {
+		if ka.tried {
+			continue
+		}
+		bucket := a.getNewBucket(ka.na, ka.srcAddr)
+		if len(a.addrNew[bucket]) >= newBucketSize {
+			delete(a.addrIndex, key)
+			continue
+		}
+		ka.refs = 1
+		a.nNew++
+		a.addrNew[bucket][key] = ka
+	}
+}
+
 // DeserializeNetAddress converts a given address string to a *wire.NetAddress
-func (a *AddrManager) DeserializeNetAddress(addr string) (*wire.NetAddress, error) {
+func (a *AddrManager) DeserializeNetAddress(addr string) (*wire.NetAddressV2, error) {
 	host, portStr, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
@@ -569,7 +686,7 @@ func (a *AddrManager) Stop() error {
 // AddAddresses adds new addresses to the address manager.  It enforces a max
 // number of addresses and silently ignores duplicate addresses.  It is
 // safe for concurrent access.
-func (a *AddrManager) AddAddresses(addrs []*wire.NetAddress, srcAddr *wire.NetAddress) {
+func (a *AddrManager) AddAddresses(addrs []*wire.NetAddressV2, srcAddr *wire.NetAddressV2) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -581,7 +698,7 @@ func (a *AddrManager) AddAddresses(addrs []*wire.NetAddress, srcAddr *wire.NetAd
 // AddAddress adds a new address to the address manager.  It enforces a max
 // number of addresses and silently ignores duplicate addresses.  It is
 // safe for concurrent access.
-func (a *AddrManager) AddAddress(addr, srcAddr *wire.NetAddress) {
+func (a *AddrManager) AddAddress(addr, srcAddr *wire.NetAddressV2) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -605,7 +722,7 @@ func (a *AddrManager) AddAddressByIP(addrIP string) error {
 	if err != nil {
 		return fmt.Errorf("invalid port %s: %v", portStr, err)
 	}
-	na := wire.NewNetAddressIPPort(ip, uint16(port), 0)
+	na := wire.NewNetAddressV2IPPort(ip, uint16(port), 0)
 	a.AddAddress(na, na) // XXX use correct src address
 	return nil
 }
@@ -634,7 +751,7 @@ func (a *AddrManager) NeedMoreAddresses() bool {
 
 // AddressCache returns the current address cache.  It must be treated as
 // read-only (but since it is a copy now, this is not as dangerous).
-func (a *AddrManager) AddressCache() []*wire.NetAddress {
+func (a *AddrManager) AddressCache() []*wire.NetAddressV2 {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -643,7 +760,7 @@ func (a *AddrManager) AddressCache() []*wire.NetAddress {
 		return nil
 	}
 
-	allAddr := make([]*wire.NetAddress, 0, addrIndexLen)
+	allAddr := make([]*wire.NetAddressV2, 0, addrIndexLen)
 	// Iteration order is undefined here, but we randomise it anyway.
 	for _, v := range a.addrIndex {
 		allAddr = append(allAddr, v.na)
@@ -680,26 +797,57 @@ func (a *AddrManager) reset() {
 	for i := range a.addrTried {
 		a.addrTried[i] = list.New()
 	}
+	a.triedCollisions = make(map[string]*triedCollision)
 }
 
 // HostToNetAddress returns a netaddress given a host address.  If the address
-// is a Tor .onion address this will be taken care of.  Else if the host is
-// not an IP address it will be resolved (via Tor if required).
-func (a *AddrManager) HostToNetAddress(host string, port uint16, services wire.ServiceFlag) (*wire.NetAddress, error) {
-	// Tor address is 16 char base32 + ".onion"
-	var ip net.IP
-	if len(host) == 22 && host[16:] == ".onion" {
-		// go base32 encoding uses capitals (as does the rfc
-		// but Tor and bitcoind tend to user lowercase, so we switch
-		// case here.
+// is a Tor .onion address of either version or an I2P .b32.i2p address this
+// will be taken care of.  Addresses in the fc00::/8 range are treated as CJDNS
+// addresses when the CJDNS network is reachable.  Else if the host is not an IP address it will be resolved (via
+// Tor if required).
+func (a *AddrManager) HostToNetAddress(host string, port uint16, services wire.ServiceFlag) (*wire.NetAddressV2, error) {
+	// go base32 encoding uses capitals (as does the rfc but Tor, I2P and
+	// bitcoind tend to user lowercase, so we switch case here.
+	switch {
+	// Tor v2 address is 16 char base32 + ".onion".
+	case len(host) == torV2HostLen && strings.HasSuffix(host, onionSuffix):
 		data, err := base32.StdEncoding.DecodeString(
 			strings.ToUpper(host[:16]))
 		if err != nil {
 			return nil, err
 		}
-		prefix := []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
-		ip = net.IP(append(prefix, data...))
-	} else if ip = net.ParseIP(host); ip == nil {
+		na := wire.NewNetAddressV2(wire.NetworkTorV2, data, port, services)
+		return na, nil
+
+	// Tor v3 address is 56 char base32 + ".onion".
+	case len(host) == torV3HostLen && strings.HasSuffix(host, onionSuffix):
+		data, err := base32.StdEncoding.DecodeString(
+			strings.ToUpper(host[:56]))
+		if err != nil {
+			return nil, err
+		}
+		pubKey := data[:32]
+		checksum := torV3Checksum(pubKey)
+		if data[34] != torV3Version || !bytes.Equal(data[32:34], checksum) {
+			return nil, fmt.Errorf("invalid tor v3 address %s", host)
+		}
+		na := wire.NewNetAddressV2(wire.NetworkTorV3, pubKey, port,
+			services)
+		return na, nil
+
+	// I2P address is 52 char base32 without padding + ".b32.i2p".
+	case len(host) == i2pHostLen && strings.HasSuffix(host, i2pSuffix):
+		data, err := base32.StdEncoding.WithPadding(base32.NoPadding).
+			DecodeString(strings.ToUpper(host[:52]))
+		if err != nil {
+			return nil, err
+		}
+		na := wire.NewNetAddressV2(wire.NetworkI2P, data, port, services)
+		return na, nil
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
 		ips, err := a.lookupFunc(host)
 		if err != nil {
 			return nil, err
@@ -710,25 +858,55 @@ func (a *AddrManager) HostToNetAddress(host string, port uint16, services wire.S
 		ip = ips[0]
 	}
 
-	return wire.NewNetAddressIPPort(ip, port, services), nil
+	if a.cjdnsReachable && cjdnsNet.Contains(ip) {
+		na := wire.NewNetAddressV2(wire.NetworkCJDNS, ip.To16(), port,
+			services)
+		return na, nil
+	}
+	return wire.NewNetAddressV2IPPort(ip, port, services), nil
 }
 
-// ipString returns a string for the ip from the provided NetAddress. If the
-// ip is in the range used for Tor addresses then it will be transformed into
-// the relevant .onion address.
-func ipString(na *wire.NetAddress) string {
-	if IsOnionCatTor(na) {
-		// We know now that na.IP is long enough.
-		base32 := base32.StdEncoding.EncodeToString(na.IP[6:])
-		return strings.ToLower(base32) + ".onion"
-	}
+// torV3Checksum returns the two byte checksum of the passed Tor v3 public key
+// which is encoded in its .onion address.
+func torV3Checksum(pubKey []byte) []byte {
+	data := make([]byte, 0, len(torV3ChecksumPrefix)+len(pubKey)+1)
+	data = append(data, torV3ChecksumPrefix...)
+	data = append(data, pubKey...)
+	data = append(data, torV3Version)
+	checksum := sha3.Sum256(data)
+	return checksum[:2]
+}
 
-	return na.IP.String()
+// ipString returns a string for the ip from the provided NetAddressV2. If the
+// address belongs to the Tor or I2P networks then it will be transformed into
+// the relevant .onion or .b32.i2p address.
+func ipString(na *wire.NetAddressV2) string {
+	switch {
+	case IsOnionCatTor(na):
+		// We know now that the IP is long enough.
+		base32 := base32.StdEncoding.EncodeToString(na.IP()[6:])
+		return strings.ToLower(base32) + onionSuffix
+
+	case IsTorV3(na):
+		data := make([]byte, 0, 35)
+		data = append(data, na.Addr...)
+		data = append(data, torV3Checksum(na.Addr)...)
+		data = append(data, torV3Version)
+		base32 := base32.StdEncoding.EncodeToString(data)
+		return strings.ToLower(base32) + onionSuffix
+
+	case IsI2P(na):
+		base32 := base32.StdEncoding.WithPadding(base32.NoPadding).
+			EncodeToString(na.Addr)
+		return strings.ToLower(base32) + i2pSuffix
+	}
+
+	return na.IP().String()
 }
 
 // NetAddressKey returns a string key in the form of ip:port for IPv4 addresses
 // or [ip]:port for IPv6 addresses.
-func NetAddressKey(na *wire.NetAddress) string {
+func NetAddressKey(na *wire.NetAddressV2) string {
 	port := strconv.FormatUint(uint64(na.Port), 10)
 
 	return net.JoinHostPort(ipString(na), port)
@@ -775,43 +953,136 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 			factor *= 1.2
 		}
 	} else {
-		// new node.
-		// XXX use a closure/function to avoid repeating this.
-		large := 1 << 30
-		factor := 1.0
-		for {
-			// Pick a random bucket.
-			bucket := a.rand.Intn(len(a.addrNew))
-			if len(a.addrNew[bucket]) == 0 {
-				continue
-			}
-			// Then, a random entry in it.
-			var ka *KnownAddress
-			nth := a.rand.Intn(len(a.addrNew[bucket]))
-			for _, value := range a.addrNew[bucket] {
-				if nth == 0 {
-					ka = value
-				}
-				nth--
+		return a.pickNew()
+	}
+}
+
+// pickNew selects a random address from the new buckets with preference given
+// to ones that have not been used recently.  There must be at least one new
+// address.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) pickNew() *KnownAddress {
+	large := 1 << 30
+	factor := 1.0
+	for {
+		// Pick a random bucket.
+		bucket := a.rand.Intn(len(a.addrNew))
+		if len(a.addrNew[bucket]) == 0 {
+			continue
+		}
+		// Then, a random entry in it.
+		var ka *KnownAddress
+		nth := a.rand.Intn(len(a.addrNew[bucket]))
+		for _, value := range a.addrNew[bucket] {
+			if nth == 0 {
+				ka = value
 			}
-			randval := a.rand.Intn(large)
-			if float64(randval) < (factor * ka.chance() * float64(large)) {
-				log.Tracef("Selected %v from new bucket",
-					NetAddressKey(ka.na))
-				return ka
+			nth--
+		}
+		randval := a.rand.Intn(large)
+		if float64(randval) < (factor * ka.chance() * float64(large)) {
+			log.Tracef("Selected %v from new bucket",
+				NetAddressKey(ka.na))
+			return ka
+		}
+		factor *= 1.2
+	}
+}
+
+// GetFeelerAddress returns an address to test with a short-lived feeler
+// connection.  The tried addresses which would be evicted by a good new
+// address are tested first so they are only replaced when they no longer
+// work.  Otherwise, a new address is tested so it is moved to the tried
+// buckets once it is found to be good.  It returns nil when there is no
+// address to test.
+func (a *AddrManager) GetFeelerAddress() *KnownAddress {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	for _, c := range a.triedCollisions {
+		if old := a.collisionVictim(c.ka); old != nil {
+			log.Tracef("Selected %v which collides with %v in tried "+
+				"bucket", NetAddressKey(old.na),
+				NetAddressKey(c.ka.na))
+			return old
+		}
+	}
+
+	if a.nNew == 0 {
+		return nil
+	}
+	return a.pickNew()
+}
+
+// collisionVictim returns the address which would be evicted from its tried
+// bucket when the passed address is moved to the tried buckets.  It returns
+// nil when there is room for the address in its tried bucket.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) collisionVictim(ka *KnownAddress) *KnownAddress {
+	bucket := a.getTriedBucket(ka.na)
+	if a.addrTried[bucket].Len() < triedBucketSize {
+		return nil
+	}
+	return a.pickTried(bucket).Value.(*KnownAddress)
+}
+
+// ResolveCollisions moves the good new addresses which collide with a tried
+// address to the tried buckets once the tried address they would evict is
+// known to no longer work or was not tested in time.  Collisions with a tried
+// address which still works are discarded.
+func (a *AddrManager) ResolveCollisions() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	now := time.Now()
+	for key, c := range a.triedCollisions {
+		// Discard collisions of addresses which are no longer in the
+		// new buckets.
+		ka := c.ka
+		if ka.tried || a.addrIndex[key] != ka {
+			delete(a.triedCollisions, key)
+			continue
+		}
+
+		old := a.collisionVictim(ka)
+		switch {
+		// There is room in the tried bucket now.
+		case old == nil:
+			a.moveToTried(ka)
+			delete(a.triedCollisions, key)
+
+		// Keep the tried address when it still works.
+		case now.Sub(old.lastsuccess) < triedReplacementTime:
+			log.Tracef("Keeping %s in tried instead of %s",
+				NetAddressKey(old.na), key)
+			delete(a.triedCollisions, key)
+
+		// Replace the tried address when the last attempt to connect to
+		// it failed.  Give attempts which are still in progress time
+		// to finish.
+		case now.Sub(old.lastattempt) < triedReplacementTime:
+			if now.Sub(old.lastattempt) > time.Minute {
+				a.moveToTried(ka)
+				delete(a.triedCollisions, key)
 			}
-			factor *= 1.2
+
+		// Replace the tried address when it was not tested in time.
+		case now.Sub(c.added) > triedCollisionTimeout:
+			a.moveToTried(ka)
+			delete(a.triedCollisions, key)
 		}
 	}
 }
 
-func (a *AddrManager) find(addr *wire.NetAddress) *KnownAddress {
+func (a *AddrManager) find(addr *wire.NetAddressV2) *KnownAddress {
 	return a.addrIndex[NetAddressKey(addr)]
 }
 
 // Attempt increases the given address' attempt counter and updates
 // the last attempt time.
-func (a *AddrManager) Attempt(addr *wire.NetAddress) {
+func (a *AddrManager) Attempt(addr *wire.NetAddressV2) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -829,7 +1100,7 @@ func (a *AddrManager) Attempt(addr *wire.NetAddress) {
 // Connected Marks the given address as currently connected and working at the
 // current time.  The address must already be known to AddrManager else it will
 // be ignored.
-func (a *AddrManager) Connected(addr *wire.NetAddress) {
+func (a *AddrManager) Connected(addr *wire.NetAddressV2) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -852,7 +1123,7 @@ func (a *AddrManager) Connected(addr *wire.NetAddress) {
 // Good marks the given address as good.  To be called after a successful
 // connection and version exchange.  If the address is unknown to the address
 // manager it will be ignored.
-func (a *AddrManager) Good(addr *wire.NetAddress) {
+func (a *AddrManager) Good(addr *wire.NetAddressV2) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -873,11 +1144,33 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 		return
 	}
 
-	// ok, need to move it to tried.
+	// When the tried bucket of the address is full, the address which
+	// would be evicted is tested first, so only remember the collision
+	// for now.
+	addrKey := NetAddressKey(addr)
+	if a.collisionVictim(ka) != nil {
+		if _, ok := a.triedCollisions[addrKey]; ok ||
+			len(a.triedCollisions) >= maxTriedCollisions {
+
+			return
+		}
+		log.Tracef("Address %s collides in tried", addrKey)
+		a.triedCollisions[addrKey] = &triedCollision{ka: ka, added: now}
+		return
+	}
+
+	a.moveToTried(ka)
+}
 
+// moveToTried moves the passed address from the new buckets to the tried
+// buckets, evicting the oldest address of its tried bucket back to the new
+// buckets when it is full.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) moveToTried(ka *KnownAddress) {
 	// remove from all new buckets.
 	// record one of the buckets in question and call it the `first'
-	addrKey := NetAddressKey(addr)
+	addrKey := NetAddressKey(ka.na)
 	oldBucket := -1
 	for i := range a.addrNew {
 		// we check for existence so we can record the first one
@@ -939,7 +1232,7 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 }
 
 // SetServices sets the services for the giiven address to the provided value.
-func (a *AddrManager) SetServices(addr *wire.NetAddress, services wire.ServiceFlag) {
+func (a *AddrManager) SetServices(addr *wire.NetAddressV2, services wire.ServiceFlag) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -957,11 +1250,24 @@ func (a *AddrManager) SetServices(addr *wire.NetAddress, services wire.ServiceFl
 	}
 }
 
+// Services returns the services the given address is known to support.  Zero
+// is returned when the address is not known.
+func (a *AddrManager) Services(addr *wire.NetAddressV2) wire.ServiceFlag {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	ka := a.find(addr)
+	if ka == nil {
+		return 0
+	}
+	return ka.na.Services
+}
+
 // AddLocalAddress adds na to the list of known local addresses to advertise
 // with the given priority.
-func (a *AddrManager) AddLocalAddress(na *wire.NetAddress, priority AddressPriority) error {
+func (a *AddrManager) AddLocalAddress(na *wire.NetAddressV2, priority AddressPriority) error {
 	if !IsRoutable(na) {
-		return fmt.Errorf("address %s is not routable", na.IP)
+		return fmt.Errorf("address %s is not routable", ipString(na))
 	}
 
 	a.lamtx.Lock()
@@ -984,7 +1290,7 @@ func (a *AddrManager) AddLocalAddress(na *wire.NetAddress, priority AddressPrior
 
 // getReachabilityFrom returns the relative reachability of the provided local
 // address to the provided remote address.
-func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
+func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddressV2) int {
 	const (
 		Unreachable = 0
 		Default     = iota
@@ -999,8 +1305,8 @@ func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
 		return Unreachable
 	}
 
-	if IsOnionCatTor(remoteAddr) {
-		if IsOnionCatTor(localAddr) {
+	if IsTor(remoteAddr) {
+		if IsTor(localAddr) {
 			return Private
 		}
 
@@ -1011,6 +1317,20 @@ func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
 		return Default
 	}
 
+	if IsI2P(remoteAddr) {
+		if IsI2P(localAddr) {
+			return Private
+		}
+		return Default
+	}
+
+	if IsCJDNS(remoteAddr) {
+		if IsCJDNS(localAddr) {
+			return Private
+		}
+		return Default
+	}
+
 	if IsRFC4380(remoteAddr) {
 		if !IsRoutable(localAddr) {
 			return Default
@@ -1063,13 +1383,13 @@ func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
 
 // GetBestLocalAddress returns the most appropriate local address to use
 // for the given remote address.
-func (a *AddrManager) GetBestLocalAddress(remoteAddr *wire.NetAddress) *wire.NetAddress {
+func (a *AddrManager) GetBestLocalAddress(remoteAddr *wire.NetAddressV2) *wire.NetAddressV2 {
 	a.lamtx.Lock()
 	defer a.lamtx.Unlock()
 
 	bestreach := 0
 	var bestscore AddressPriority
-	var bestAddress *wire.NetAddress
+	var bestAddress *wire.NetAddressV2
 	for _, la := range a.localAddresses {
 		reach := getReachabilityFrom(la.na, remoteAddr)
 		if reach > bestreach ||
@@ -1080,26 +1400,78 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *wire.NetAddress) *wire.Net
 		}
 	}
 	if bestAddress != nil {
-		log.Debugf("Suggesting address %s:%d for %s:%d", bestAddress.IP,
-			bestAddress.Port, remoteAddr.IP, remoteAddr.Port)
+		log.Debugf("Suggesting address %s for %s",
+			NetAddressKey(bestAddress), NetAddressKey(remoteAddr))
 	} else {
-		log.Debugf("No worthy address for %s:%d", remoteAddr.IP,
-			remoteAddr.Port)
+		log.Debugf("No worthy address for %s", NetAddressKey(remoteAddr))
 
 		// Send something unroutable if nothing suitable.
 		var ip net.IP
-		if !IsIPv4(remoteAddr) && !IsOnionCatTor(remoteAddr) {
+		if !IsIPv4(remoteAddr) && !IsTor(remoteAddr) {
 			ip = net.IPv6zero
 		} else {
 			ip = net.IPv4zero
 		}
 		services := wire.SFNodeNetwork | wire.SFNodeWitness | wire.SFNodeBloom
-		bestAddress = wire.NewNetAddressIPPort(ip, 0, services)
+		bestAddress = wire.NewNetAddressV2IPPort(ip, 0, services)
 	}
 
 	return bestAddress
 }
 
+// SetASMap sets the ASN map used to group addresses by the autonomous system
+// which announces them.  It must be called before the address manager is
+// started.
+func (a *AddrManager) SetASMap(m *ASMap) {
+	a.mtx.Lock()
+	a.asmap = m
+	a.mtx.Unlock()
+}
+
+// SetCJDNSReachable sets whether the node is connected to the CJDNS network.
+// Addresses in the fc00::/8 range are only treated as CJDNS addresses when it
+// is, since they are otherwise indistinguishable from private IPv6 addresses.
+// It must be called before the address manager is started.
+func (a *AddrManager) SetCJDNSReachable(reachable bool) {
+	a.mtx.Lock()
+	a.cjdnsReachable = reachable
+	a.mtx.Unlock()
+}
+
+// asmapHash returns the hash of the ASN map in use, or an empty string when
+// none is.
+func (a *AddrManager) asmapHash() string {
+	if a.asmap == nil {
+		return ""
+	}
+	return a.asmap.Hash()
+}
+
+// GroupKey returns a string representing the network group the passed address
+// is part of.  When an ASN map is in use, addresses it maps are grouped by the
+// autonomous system which announces them.  Otherwise the groups are the same as
+// those of the GroupKey function.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) GroupKey(na *wire.NetAddressV2) string {
+	if asn := a.ASN(na); asn != 0 {
+		return fmt.Sprintf("as%d", asn)
+	}
+	return GroupKey(na)
+}
+
+// ASN returns the number of the autonomous system which announces the passed
+// address according to the ASN map in use.  Zero is returned when no ASN map is
+// in use or the address is not mapped.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) ASN(na *wire.NetAddressV2) uint32 {
+	if a.asmap == nil {
+		return 0
+	}
+	return a.asmap.Lookup(na)
+}
+
 // New returns a new bitcoin address manager.
 // Use Start to begin processing asynchronous address updates.
 func New(dataDir string, lookupFunc func(string) ([]net.IP, error)) *AddrManager {
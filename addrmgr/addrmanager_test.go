@@ -7,7 +7,9 @@ package addrmgr_test
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
 	"reflect"
 	"testing"
 	"time"
@@ -19,7 +21,7 @@ import (
 // naTest is used to describe a test to be performed against the NetAddressKey
 // method.
 type naTest struct {
-	in   wire.NetAddress
+	in   wire.NetAddressV2
 	want string
 }
 
@@ -93,7 +95,7 @@ func addNaTests() {
 
 func addNaTest(ip string, port uint16, want string) {
 	nip := net.ParseIP(ip)
-	na := *wire.NewNetAddressIPPort(nip, port, wire.SFNodeNetwork)
+	na := *wire.NewNetAddressV2IPPort(nip, port, wire.SFNodeNetwork)
 	test := naTest{na, want}
 	naTests = append(naTests, test)
 }
@@ -157,37 +159,37 @@ func TestAddAddressByIP(t *testing.T) {
 
 func TestAddLocalAddress(t *testing.T) {
 	var tests = []struct {
-		address  wire.NetAddress
+		address  wire.NetAddressV2
 		priority addrmgr.AddressPriority
 		valid    bool
 	}{
 		{
-			wire.NetAddress{IP: net.ParseIP("192.168.0.100")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("192.168.0.100"), 0, 0),
 			addrmgr.InterfacePrio,
 			false,
 		},
 		{
-			wire.NetAddress{IP: net.ParseIP("204.124.1.1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("204.124.1.1"), 0, 0),
 			addrmgr.InterfacePrio,
 			true,
 		},
 		{
-			wire.NetAddress{IP: net.ParseIP("204.124.1.1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("204.124.1.1"), 0, 0),
 			addrmgr.BoundPrio,
 			true,
 		},
 		{
-			wire.NetAddress{IP: net.ParseIP("::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("::1"), 0, 0),
 			addrmgr.InterfacePrio,
 			false,
 		},
 		{
-			wire.NetAddress{IP: net.ParseIP("fe80::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("fe80::1"), 0, 0),
 			addrmgr.InterfacePrio,
 			false,
 		},
 		{
-			wire.NetAddress{IP: net.ParseIP("2620:100::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("2620:100::1"), 0, 0),
 			addrmgr.InterfacePrio,
 			true,
 		},
@@ -197,12 +199,12 @@ func TestAddLocalAddress(t *testing.T) {
 		result := amgr.AddLocalAddress(&test.address, test.priority)
 		if result == nil && !test.valid {
 			t.Errorf("TestAddLocalAddress test #%d failed: %s should have "+
-				"been accepted", x, test.address.IP)
+				"been accepted", x, test.address.IP())
 			continue
 		}
 		if result != nil && test.valid {
 			t.Errorf("TestAddLocalAddress test #%d failed: %s should not have "+
-				"been accepted", x, test.address.IP)
+				"been accepted", x, test.address.IP())
 			continue
 		}
 	}
@@ -250,6 +252,29 @@ func TestConnected(t *testing.T) {
 	}
 }
 
+func TestServices(t *testing.T) {
+	n := addrmgr.New("testservices", lookupFunc)
+
+	// Add a new address and get it
+	err := n.AddAddressByIP(someIP + ":8333")
+	if err != nil {
+		t.Fatalf("Adding address failed: %v", err)
+	}
+	na := n.GetAddress().NetAddress()
+
+	services := wire.SFNodeNetwork | wire.SFNodeP2PV2
+	n.SetServices(na, services)
+	if got := n.Services(na); got != services {
+		t.Errorf("Services: got %v, want %v", got, services)
+	}
+
+	unknown := wire.NewNetAddressV2IPPort(net.ParseIP("1.2.3.4"), 8333,
+		wire.SFNodeNetwork)
+	if got := n.Services(unknown); got != 0 {
+		t.Errorf("Services of unknown address: got %v, want 0", got)
+	}
+}
+
 func TestNeedMoreAddresses(t *testing.T) {
 	n := addrmgr.New("testneedmoreaddresses", lookupFunc)
 	addrsToAdd := 1500
@@ -257,7 +282,7 @@ func TestNeedMoreAddresses(t *testing.T) {
 	if !b {
 		t.Errorf("Expected that we need more addresses")
 	}
-	addrs := make([]*wire.NetAddress, addrsToAdd)
+	addrs := make([]*wire.NetAddressV2, addrsToAdd)
 
 	var err error
 	for i := 0; i < addrsToAdd; i++ {
@@ -268,7 +293,7 @@ func TestNeedMoreAddresses(t *testing.T) {
 		}
 	}
 
-	srcAddr := wire.NewNetAddressIPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	srcAddr := wire.NewNetAddressV2IPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
 
 	n.AddAddresses(addrs, srcAddr)
 	numAddrs := n.NumAddresses()
@@ -285,7 +310,7 @@ func TestNeedMoreAddresses(t *testing.T) {
 func TestGood(t *testing.T) {
 	n := addrmgr.New("testgood", lookupFunc)
 	addrsToAdd := 64 * 64
-	addrs := make([]*wire.NetAddress, addrsToAdd)
+	addrs := make([]*wire.NetAddressV2, addrsToAdd)
 
 	var err error
 	for i := 0; i < addrsToAdd; i++ {
@@ -296,7 +321,7 @@ func TestGood(t *testing.T) {
 		}
 	}
 
-	srcAddr := wire.NewNetAddressIPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	srcAddr := wire.NewNetAddressV2IPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
 
 	n.AddAddresses(addrs, srcAddr)
 	for _, addr := range addrs {
@@ -314,6 +339,48 @@ func TestGood(t *testing.T) {
 	}
 }
 
+// TestTriedCollisions ensures good new addresses which would evict an address
+// from a full tried bucket are held back until the tried address is tested and
+// that the tried address is kept when it still works.
+func TestTriedCollisions(t *testing.T) {
+	n := addrmgr.New("testtriedcollisions", lookupFunc)
+
+	// Addresses of a single group are spread over a few tried buckets
+	// only, so adding enough of them fills those buckets.
+	addrsToAdd := 64 * 64
+	addrs := make([]*wire.NetAddressV2, addrsToAdd)
+	for i := 0; i < addrsToAdd; i++ {
+		s := fmt.Sprintf("60.173.%d.%d:8333", i/64, i%64+1)
+		addr, err := n.DeserializeNetAddress(s)
+		if err != nil {
+			t.Fatalf("Failed to turn %s into an address: %v", s, err)
+		}
+		addrs[i] = addr
+		srcAddr := wire.NewNetAddressV2IPPort(
+			net.IPv4(173, byte(i/64), 1, 1), 8333, 0)
+		n.AddAddress(addr, srcAddr)
+	}
+	for _, addr := range addrs {
+		n.Good(addr)
+	}
+	if got := addrmgr.TstNumTriedCollisions(n); got == 0 {
+		t.Fatal("TstNumTriedCollisions: got no collisions")
+	}
+
+	// The feeler address must be the tried address which would be evicted.
+	ka := n.GetFeelerAddress()
+	if ka == nil || !addrmgr.TstKnownAddressTried(ka) {
+		t.Fatalf("GetFeelerAddress: got %v, want tried address", ka)
+	}
+
+	// All of the tried addresses just succeeded, so they must be kept.
+	n.ResolveCollisions()
+	if got := addrmgr.TstNumTriedCollisions(n); got != 0 {
+		t.Fatalf("TstNumTriedCollisions: got %d collisions after "+
+			"resolving, want 0", got)
+	}
+}
+
 func TestGetAddress(t *testing.T) {
 	n := addrmgr.New("testgetaddress", lookupFunc)
 
@@ -331,8 +398,8 @@ func TestGetAddress(t *testing.T) {
 	if ka == nil {
 		t.Fatalf("Did not get an address where there is one in the pool")
 	}
-	if ka.NetAddress().IP.String() != someIP {
-		t.Errorf("Wrong IP: got %v, want %v", ka.NetAddress().IP.String(), someIP)
+	if ka.NetAddress().IP().String() != someIP {
+		t.Errorf("Wrong IP: got %v, want %v", ka.NetAddress().IP().String(), someIP)
 	}
 
 	// Mark this as a good address and get it
@@ -341,8 +408,8 @@ func TestGetAddress(t *testing.T) {
 	if ka == nil {
 		t.Fatalf("Did not get an address where there is one in the pool")
 	}
-	if ka.NetAddress().IP.String() != someIP {
-		t.Errorf("Wrong IP: got %v, want %v", ka.NetAddress().IP.String(), someIP)
+	if ka.NetAddress().IP().String() != someIP {
+		t.Errorf("Wrong IP: got %v, want %v", ka.NetAddress().IP().String(), someIP)
 	}
 
 	numAddrs := n.NumAddresses()
@@ -352,51 +419,51 @@ func TestGetAddress(t *testing.T) {
 }
 
 func TestGetBestLocalAddress(t *testing.T) {
-	localAddrs := []wire.NetAddress{
-		{IP: net.ParseIP("192.168.0.100")},
-		{IP: net.ParseIP("::1")},
-		{IP: net.ParseIP("fe80::1")},
-		{IP: net.ParseIP("2001:470::1")},
+	localAddrs := []wire.NetAddressV2{
+		*wire.NewNetAddressV2IPPort(net.ParseIP("192.168.0.100"), 0, 0),
+		*wire.NewNetAddressV2IPPort(net.ParseIP("::1"), 0, 0),
+		*wire.NewNetAddressV2IPPort(net.ParseIP("fe80::1"), 0, 0),
+		*wire.NewNetAddressV2IPPort(net.ParseIP("2001:470::1"), 0, 0),
 	}
 
 	var tests = []struct {
-		remoteAddr wire.NetAddress
-		want0      wire.NetAddress
-		want1      wire.NetAddress
-		want2      wire.NetAddress
-		want3      wire.NetAddress
+		remoteAddr wire.NetAddressV2
+		want0      wire.NetAddressV2
+		want1      wire.NetAddressV2
+		want2      wire.NetAddressV2
+		want3      wire.NetAddressV2
 	}{
 		{
 			// Remote connection from public IPv4
-			wire.NetAddress{IP: net.ParseIP("204.124.8.1")},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.ParseIP("204.124.8.100")},
-			wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43:25::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("204.124.8.1"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("204.124.8.100"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("fd87:d87e:eb43:25::1"), 0, 0),
 		},
 		{
 			// Remote connection from private IPv4
-			wire.NetAddress{IP: net.ParseIP("172.16.0.254")},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.IPv4zero},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("172.16.0.254"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
 		},
 		{
 			// Remote connection from public IPv6
-			wire.NetAddress{IP: net.ParseIP("2602:100:abcd::102")},
-			wire.NetAddress{IP: net.IPv6zero},
-			wire.NetAddress{IP: net.ParseIP("2001:470::1")},
-			wire.NetAddress{IP: net.ParseIP("2001:470::1")},
-			wire.NetAddress{IP: net.ParseIP("2001:470::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("2602:100:abcd::102"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv6zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("2001:470::1"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("2001:470::1"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("2001:470::1"), 0, 0),
 		},
 		/* XXX
 		{
 			// Remote connection from Tor
-			wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43::100")},
-			wire.NetAddress{IP: net.IPv4zero},
-			wire.NetAddress{IP: net.ParseIP("204.124.8.100")},
-			wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43:25::1")},
+			*wire.NewNetAddressV2IPPort(net.ParseIP("fd87:d87e:eb43::100"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.IPv4zero, 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("204.124.8.100"), 0, 0),
+			*wire.NewNetAddressV2IPPort(net.ParseIP("fd87:d87e:eb43:25::1"), 0, 0),
 		},
 		*/
 	}
@@ -406,9 +473,9 @@ func TestGetBestLocalAddress(t *testing.T) {
 	// Test against default when there's no address
 	for x, test := range tests {
 		got := amgr.GetBestLocalAddress(&test.remoteAddr)
-		if !test.want0.IP.Equal(got.IP) {
+		if !test.want0.IP().Equal(got.IP()) {
 			t.Errorf("TestGetBestLocalAddress test1 #%d failed for remote address %s: want %s got %s",
-				x, test.remoteAddr.IP, test.want1.IP, got.IP)
+				x, test.remoteAddr.IP(), test.want1.IP(), got.IP())
 			continue
 		}
 	}
@@ -420,37 +487,37 @@ func TestGetBestLocalAddress(t *testing.T) {
 	// Test against want1
 	for x, test := range tests {
 		got := amgr.GetBestLocalAddress(&test.remoteAddr)
-		if !test.want1.IP.Equal(got.IP) {
+		if !test.want1.IP().Equal(got.IP()) {
 			t.Errorf("TestGetBestLocalAddress test1 #%d failed for remote address %s: want %s got %s",
-				x, test.remoteAddr.IP, test.want1.IP, got.IP)
+				x, test.remoteAddr.IP(), test.want1.IP(), got.IP())
 			continue
 		}
 	}
 
 	// Add a public IP to the list of local addresses.
-	localAddr := wire.NetAddress{IP: net.ParseIP("204.124.8.100")}
+	localAddr := *wire.NewNetAddressV2IPPort(net.ParseIP("204.124.8.100"), 0, 0)
 	amgr.AddLocalAddress(&localAddr, addrmgr.InterfacePrio)
 
 	// Test against want2
 	for x, test := range tests {
 		got := amgr.GetBestLocalAddress(&test.remoteAddr)
-		if !test.want2.IP.Equal(got.IP) {
+		if !test.want2.IP().Equal(got.IP()) {
 			t.Errorf("TestGetBestLocalAddress test2 #%d failed for remote address %s: want %s got %s",
-				x, test.remoteAddr.IP, test.want2.IP, got.IP)
+				x, test.remoteAddr.IP(), test.want2.IP(), got.IP())
 			continue
 		}
 	}
 	/*
 		// Add a Tor generated IP address
-		localAddr = wire.NetAddress{IP: net.ParseIP("fd87:d87e:eb43:25::1")}
+		localAddr = *wire.NewNetAddressV2IPPort(net.ParseIP("fd87:d87e:eb43:25::1"), 0, 0)
 		amgr.AddLocalAddress(&localAddr, addrmgr.ManualPrio)
 
 		// Test against want3
 		for x, test := range tests {
 			got := amgr.GetBestLocalAddress(&test.remoteAddr)
-			if !test.want3.IP.Equal(got.IP) {
+			if !test.want3.IP().Equal(got.IP()) {
 				t.Errorf("TestGetBestLocalAddress test3 #%d failed for remote address %s: want %s got %s",
-					x, test.remoteAddr.IP, test.want3.IP, got.IP)
+					x, test.remoteAddr.IP(), test.want3.IP(), got.IP())
 				continue
 			}
 		}
@@ -470,3 +537,139 @@ func TestNetAddressKey(t *testing.T) {
 	}
 
 }
+
+func TestHostToNetAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		cjdns   bool
+		network wire.NetworkID
+		valid   bool
+	}{
+		{
+			name:    "ipv4",
+			host:    someIP,
+			network: wire.NetworkIPv4,
+			valid:   true,
+		},
+		{
+			name:    "ipv6",
+			host:    "2620:100::1",
+			network: wire.NetworkIPv6,
+			valid:   true,
+		},
+		{
+			name:    "tor v2",
+			host:    "aaaaaaaaaaaaaaaa.onion",
+			network: wire.NetworkTorV2,
+			valid:   true,
+		},
+		{
+			name:    "tor v3",
+			host:    "2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion",
+			network: wire.NetworkTorV3,
+			valid:   true,
+		},
+		{
+			name:  "tor v3 bad checksum",
+			host:  "2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wia.onion",
+			valid: false,
+		},
+		{
+			name:    "i2p",
+			host:    "ukeu3k5oycgaauneqgtnvselmt4yemvoilkln7jpvamvfx7dnkdq.b32.i2p",
+			network: wire.NetworkI2P,
+			valid:   true,
+		},
+		{
+			name:    "cjdns",
+			host:    "fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa",
+			cjdns:   true,
+			network: wire.NetworkCJDNS,
+			valid:   true,
+		},
+		{
+			name:    "cjdns unreachable",
+			host:    "fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa",
+			network: wire.NetworkIPv6,
+			valid:   true,
+		},
+		{
+			name:  "unresolvable",
+			host:  "example.com",
+			valid: false,
+		},
+	}
+
+	for _, test := range tests {
+		amgr := addrmgr.New("testhosttonetaddress", lookupFunc)
+		amgr.SetCJDNSReachable(test.cjdns)
+		na, err := amgr.HostToNetAddress(test.host, 8333, 0)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s: expected error for %s", test.name,
+					test.host)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if na.Network != test.network {
+			t.Errorf("%s: wrong network - got %v, want %v",
+				test.name, na.Network, test.network)
+			continue
+		}
+
+		// Ensure the address key converts back to the same host.
+		want := net.JoinHostPort(test.host, "8333")
+		if key := addrmgr.NetAddressKey(na); key != want {
+			t.Errorf("%s: wrong key - got %s, want %s", test.name,
+				key, want)
+		}
+	}
+}
+
+func TestSavePeersOverlayAddresses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testsavepeers")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	hosts := []string{
+		"2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion",
+		"ukeu3k5oycgaauneqgtnvselmt4yemvoilkln7jpvamvfx7dnkdq.b32.i2p",
+		"fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa",
+	}
+
+	n := addrmgr.New(dir, lookupFunc)
+	n.SetCJDNSReachable(true)
+	n.Start()
+	srcAddr := wire.NewNetAddressV2IPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	for _, host := range hosts {
+		na, err := n.HostToNetAddress(host, 8333, wire.SFNodeNetwork)
+		if err != nil {
+			t.Fatalf("Failed to turn %s into an address: %v", host, err)
+		}
+		n.AddAddress(na, srcAddr)
+	}
+	if numAddrs := n.NumAddresses(); numAddrs != len(hosts) {
+		t.Fatalf("Wrong number of addresses: got %d, want %d", numAddrs,
+			len(hosts))
+	}
+	if err := n.Stop(); err != nil {
+		t.Fatalf("Address Manager failed to stop: %v", err)
+	}
+
+	// Ensure the addresses are loaded back from the peers file.
+	n = addrmgr.New(dir, lookupFunc)
+	n.SetCJDNSReachable(true)
+	n.Start()
+	defer n.Stop()
+	if numAddrs := n.NumAddresses(); numAddrs != len(hosts) {
+		t.Fatalf("Wrong number of loaded addresses: got %d, want %d",
+			numAddrs, len(hosts))
+	}
+}
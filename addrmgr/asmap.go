@@ -0,0 +1,334 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+	"net"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// The ASN map is a compressed binary trie mapping IP prefixes to autonomous
+// system numbers in the format used by Bitcoin Core.  It is a program for a
+// small interpreter which consumes the bits of an IPv6 address, or of an IPv4
+// address mapped into IPv6, from the most significant bit on.  Each instruction
+// starts with a variable length type followed by its variable length argument.
+const (
+	// asmapReturn returns its ASN argument.
+	asmapReturn = 0
+
+	// asmapJump consumes one bit of the address and skips the number of
+	// bits of the program given by its argument when it is set.
+	asmapJump = 1
+
+	// asmapMatch consumes the bits of its argument after the leading one
+	// and returns the default ASN when they don't match the address.
+	asmapMatch = 2
+
+	// asmapDefault sets the ASN which is returned by failed matches.
+	asmapDefault = 3
+
+	// asmapInvalid is returned by decodeBits when the program ends before
+	// a value does.
+	asmapInvalid = 0xffffffff
+)
+
+var (
+	// asmapTypeBitSizes, asmapASNBitSizes, asmapMatchBitSizes and
+	// asmapJumpBitSizes are the mantissa sizes of the variable length
+	// encodings of the instruction types and their arguments.
+	asmapTypeBitSizes  = []uint8{0, 0, 1}
+	asmapASNBitSizes   = []uint8{15, 16, 17, 18, 19, 20, 21, 22, 23, 24}
+	asmapMatchBitSizes = []uint8{1, 2, 3, 4, 5, 6, 7, 8}
+	asmapJumpBitSizes  = []uint8{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
+		17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30}
+)
+
+// ASMap maps IP addresses to the autonomous system (AS) which announces them so
+// addresses can be grouped by the network operator instead of by a fixed prefix
+// length.
+type ASMap struct {
+	bits []bool
+	hash string
+}
+
+// asmapReader reads the values of an ASN map program.
+type asmapReader struct {
+	bits []bool
+	pos  int
+}
+
+// decodeBits decodes a variable length value starting at minVal.  Each size
+// but the last is preceded by a bit telling whether the value is too large for
+// a mantissa of that size.  asmapInvalid is returned when the program ends
+// before the value does.
+func (r *asmapReader) decodeBits(minVal uint32, sizes []uint8) uint32 {
+	val := minVal
+	for i, size := range sizes {
+		var bit bool
+		if i != len(sizes)-1 {
+			if r.pos == len(r.bits) {
+				break
+			}
+			bit = r.bits[r.pos]
+			r.pos++
+		}
+		if bit {
+			val += 1 << size
+			continue
+		}
+		for b := uint8(0); b < size; b++ {
+			if r.pos == len(r.bits) {
+				return asmapInvalid
+			}
+			if r.bits[r.pos] {
+				val += 1 << (size - 1 - b)
+			}
+			r.pos++
+		}
+		return val
+	}
+	return asmapInvalid
+}
+
+func (r *asmapReader) decodeType() uint32 {
+	return r.decodeBits(0, asmapTypeBitSizes)
+}
+
+func (r *asmapReader) decodeASN() uint32 {
+	return r.decodeBits(1, asmapASNBitSizes)
+}
+
+func (r *asmapReader) decodeMatch() uint32 {
+	return r.decodeBits(2, asmapMatchBitSizes)
+}
+
+func (r *asmapReader) decodeJump() uint32 {
+	return r.decodeBits(17, asmapJumpBitSizes)
+}
+
+// sanityCheckASMap returns whether or not the passed program returns an ASN
+// for every address with the passed number of bits.  Addresses can then be
+// looked up without checking for the program ending early.
+func sanityCheckASMap(program []bool, addrBits int) bool {
+	type jumpTarget struct {
+		pos      int
+		addrBits int
+	}
+
+	r := asmapReader{bits: program}
+	var jumps []jumpTarget
+	prevOp := uint32(asmapJump)
+	hadIncompleteMatch := false
+	for r.pos != len(r.bits) {
+		// Jumping into the middle of the previous instruction is
+		// invalid.
+		if len(jumps) > 0 && r.pos >= jumps[len(jumps)-1].pos {
+			return false
+		}
+
+		switch op := r.decodeType(); op {
+		case asmapReturn:
+			// A return right after a default could be a single
+			// return.
+			if prevOp == asmapDefault {
+				return false
+			}
+			if r.decodeASN() == asmapInvalid {
+				return false
+			}
+			if len(jumps) == 0 {
+				// Nothing is left to execute, so only up to 7
+				// zero bits of padding may remain.
+				if len(r.bits)-r.pos > 7 {
+					return false
+				}
+				for ; r.pos != len(r.bits); r.pos++ {
+					if r.bits[r.pos] {
+						return false
+					}
+				}
+				return true
+			}
+
+			// Continue as if the last jump was taken, which must
+			// lead to the next instruction or it is unreachable.
+			target := jumps[len(jumps)-1]
+			if r.pos != target.pos {
+				return false
+			}
+			addrBits = target.addrBits
+			jumps = jumps[:len(jumps)-1]
+			prevOp = asmapJump
+
+		case asmapJump:
+			jump := r.decodeJump()
+			if jump == asmapInvalid {
+				return false
+			}
+			if int64(jump) > int64(len(r.bits)-r.pos) {
+				return false
+			}
+			if addrBits == 0 {
+				return false
+			}
+			addrBits--
+			target := r.pos + int(jump)
+			if len(jumps) > 0 && target >= jumps[len(jumps)-1].pos {
+				return false
+			}
+			jumps = append(jumps, jumpTarget{target, addrBits})
+			prevOp = asmapJump
+
+		case asmapMatch:
+			match := r.decodeMatch()
+			if match == asmapInvalid {
+				return false
+			}
+			matchLen := bits.Len32(match) - 1
+
+			// Only one match of a sequence may match less than 8
+			// bits.
+			if prevOp != asmapMatch {
+				hadIncompleteMatch = false
+			}
+			if matchLen < 8 && hadIncompleteMatch {
+				return false
+			}
+			hadIncompleteMatch = matchLen < 8
+			if addrBits < matchLen {
+				return false
+			}
+			addrBits -= matchLen
+			prevOp = asmapMatch
+
+		case asmapDefault:
+			// Successive defaults could be a single default.
+			if prevOp == asmapDefault {
+				return false
+			}
+			if r.decodeASN() == asmapInvalid {
+				return false
+			}
+			prevOp = asmapDefault
+
+		default:
+			return false
+		}
+	}
+
+	// The program ended without returning.
+	return false
+}
+
+// DecodeASMap decodes an ASN map in the binary format used by Bitcoin Core.
+// An error is returned when the map does not return an ASN for every address.
+func DecodeASMap(data []byte) (*ASMap, error) {
+	program := make([]bool, 0, len(data)*8)
+	for _, b := range data {
+		for bit := uint(0); bit < 8; bit++ {
+			program = append(program, (b>>bit)&1 == 1)
+		}
+	}
+	if !sanityCheckASMap(program, 128) {
+		return nil, errors.New("malformed ASN map")
+	}
+	return &ASMap{
+		bits: program,
+		hash: chainhash.HashH(data).String(),
+	}, nil
+}
+
+// LoadASMap reads and decodes the ASN map stored in the passed file.
+func LoadASMap(path string) (*ASMap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := DecodeASMap(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// Hash returns the hash of the encoded ASN map which identifies it.
+func (m *ASMap) Hash() string {
+	return m.hash
+}
+
+// lookupIP returns the ASN of the passed 16-byte IP address, or 0 when it is
+// not mapped.
+func (m *ASMap) lookupIP(ip net.IP) uint32 {
+	r := asmapReader{bits: m.bits}
+	addrBits := len(ip) * 8
+	ipBit := func() bool {
+		i := len(ip)*8 - addrBits
+		return ip[i/8]>>(7-uint(i%8))&1 == 1
+	}
+
+	// The program has been checked to return for every address, so it
+	// only needs to be interpreted.
+	var defaultASN uint32
+	for {
+		switch r.decodeType() {
+		case asmapReturn:
+			return r.decodeASN()
+
+		case asmapJump:
+			jump := r.decodeJump()
+			if ipBit() {
+				r.pos += int(jump)
+			}
+			addrBits--
+
+		case asmapMatch:
+			match := r.decodeMatch()
+			matchLen := bits.Len32(match) - 1
+			for bit := 0; bit < matchLen; bit++ {
+				want := (match>>uint(matchLen-1-bit))&1 == 1
+				if ipBit() != want {
+					return defaultASN
+				}
+				addrBits--
+			}
+
+		case asmapDefault:
+			defaultASN = r.decodeASN()
+		}
+	}
+}
+
+// Lookup returns the ASN of the passed address, or 0 when it is not a routable
+// IPv4 or IPv6 address or it is not mapped.  IPv4 addresses tunneled over IPv6
+// are looked up by their IPv4 address.
+func (m *ASMap) Lookup(na *wire.NetAddressV2) uint32 {
+	if isOverlay(na) || IsOnionCatTor(na) || !IsRoutable(na) {
+		return 0
+	}
+
+	ip := netIP(na).To16()
+	var v4 net.IP
+	switch {
+	case IsRFC6145(na) || IsRFC6052(na):
+		v4 = ip[12:16]
+	case IsRFC3964(na):
+		v4 = ip[2:6]
+	case IsRFC4380(na):
+		v4 = make(net.IP, 4)
+		for i, b := range ip[12:16] {
+			v4[i] = b ^ 0xff
+		}
+	}
+	if v4 != nil {
+		ip = net.IPv4(v4[0], v4[1], v4[2], v4[3]).To16()
+	}
+	return m.lookupIP(ip)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/btcsuite/btcd/addrmgr"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// asmapBuilder assembles ASN map programs for the tests.
+type asmapBuilder struct {
+	bits []bool
+}
+
+// encode appends val in the variable length encoding with the passed minimum
+// value and mantissa sizes.
+func (b *asmapBuilder) encode(val, minVal uint32, sizes []uint8) {
+	val -= minVal
+	for i, size := range sizes {
+		last := i == len(sizes)-1
+		if !last && val >= 1<<size {
+			b.bits = append(b.bits, true)
+			val -= 1 << size
+			continue
+		}
+		if !last {
+			b.bits = append(b.bits, false)
+		}
+		for bit := int(size) - 1; bit >= 0; bit-- {
+			b.bits = append(b.bits, (val>>uint(bit))&1 == 1)
+		}
+		return
+	}
+}
+
+func (b *asmapBuilder) ret(asn uint32) {
+	b.encode(0, 0, []uint8{0, 0, 1})
+	b.encode(asn, 1, []uint8{15, 16, 17, 18, 19, 20, 21, 22, 23, 24})
+}
+
+func (b *asmapBuilder) jump(offset uint32) {
+	b.encode(1, 0, []uint8{0, 0, 1})
+	b.encode(offset, 17, []uint8{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30})
+}
+
+// match appends instructions matching the passed bytes.
+func (b *asmapBuilder) match(bytes ...byte) {
+	for _, v := range bytes {
+		b.encode(2, 0, []uint8{0, 0, 1})
+		b.encode(0x100|uint32(v), 2, []uint8{1, 2, 3, 4, 5, 6, 7, 8})
+	}
+}
+
+// bytes returns the program packed with the least significant bit first.
+func (b *asmapBuilder) bytes() []byte {
+	data := make([]byte, (len(b.bits)+7)/8)
+	for i, bit := range b.bits {
+		if bit {
+			data[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return data
+}
+
+// TestASMap ensures ASN maps in the format used by Bitcoin Core are decoded and
+// looked up correctly, and that malformed maps are rejected.
+func TestASMap(t *testing.T) {
+	// Map 1.0.0.0/9 to AS 100 and 1.128.0.0/9 to AS 200.  All other
+	// addresses fail to match and are unmapped.
+	var b asmapBuilder
+	b.match(0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 1)
+	b.jump(17)
+	b.ret(100)
+	b.ret(200)
+	m, err := addrmgr.DecodeASMap(b.bytes())
+	if err != nil {
+		t.Fatalf("DecodeASMap: %v", err)
+	}
+
+	tests := []struct {
+		ip  string
+		asn uint32
+	}{
+		{"1.2.3.4", 100},
+		{"1.200.3.4", 200},
+		{"2.2.3.4", 0},
+		{"2001:470::1", 0},
+		{"10.0.0.1", 0},         // not routable
+		{"2002:102:304::", 100}, // 6to4 tunnel of 1.2.3.4
+	}
+	for _, test := range tests {
+		na := wire.NewNetAddressV2IPPort(net.ParseIP(test.ip), 8333, 0)
+		if asn := m.Lookup(na); asn != test.asn {
+			t.Errorf("Lookup(%s): got %d, want %d", test.ip, asn,
+				test.asn)
+		}
+	}
+
+	// Programs which don't return for every address are rejected.
+	var bad asmapBuilder
+	bad.match(1)
+	if _, err := addrmgr.DecodeASMap(bad.bytes()); err == nil {
+		t.Error("DecodeASMap: program without return accepted")
+	}
+	bad = asmapBuilder{}
+	bad.jump(17)
+	bad.ret(100)
+	if _, err := addrmgr.DecodeASMap(bad.bytes()); err == nil {
+		t.Error("DecodeASMap: program jumping past its end accepted")
+	}
+
+	// The address manager groups mapped addresses by their ASN.
+	amgr := addrmgr.New("testasmap", nil)
+	amgr.SetASMap(m)
+	na1 := wire.NewNetAddressV2IPPort(net.ParseIP("1.2.3.4"), 8333, 0)
+	na2 := wire.NewNetAddressV2IPPort(net.ParseIP("1.100.3.4"), 8333, 0)
+	na3 := wire.NewNetAddressV2IPPort(net.ParseIP("2.2.3.4"), 8333, 0)
+	if amgr.GroupKey(na1) != "as100" || amgr.GroupKey(na1) != amgr.GroupKey(na2) {
+		t.Errorf("GroupKey: got %s and %s, want as100", amgr.GroupKey(na1),
+			amgr.GroupKey(na2))
+	}
+	if amgr.GroupKey(na3) != addrmgr.GroupKey(na3) {
+		t.Errorf("GroupKey: got %s for unmapped address, want %s",
+			amgr.GroupKey(na3), addrmgr.GroupKey(na3))
+	}
+}
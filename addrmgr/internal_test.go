@@ -18,8 +18,18 @@ func TstKnownAddressChance(ka *KnownAddress) float64 {
 	return ka.chance()
 }
 
-func TstNewKnownAddress(na *wire.NetAddress, attempts int,
+func TstNewKnownAddress(na *wire.NetAddressV2, attempts int,
 	lastattempt, lastsuccess time.Time, tried bool, refs int) *KnownAddress {
 	return &KnownAddress{na: na, attempts: attempts, lastattempt: lastattempt,
 		lastsuccess: lastsuccess, tried: tried, refs: refs}
 }
+
+func TstKnownAddressTried(ka *KnownAddress) bool {
+	return ka.tried
+}
+
+func TstNumTriedCollisions(a *AddrManager) int {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return len(a.triedCollisions)
+}
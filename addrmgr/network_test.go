@@ -16,7 +16,7 @@ import (
 // address based on RFCs work as intended.
 func TestIPTypes(t *testing.T) {
 	type ipTest struct {
-		in       wire.NetAddress
+		in       wire.NetAddressV2
 		rfc1918  bool
 		rfc2544  bool
 		rfc3849  bool
@@ -39,7 +39,7 @@ func TestIPTypes(t *testing.T) {
 		rfc4193, rfc4380, rfc4843, rfc4862, rfc5737, rfc6052, rfc6145, rfc6598,
 		local, valid, routable bool) ipTest {
 		nip := net.ParseIP(ip)
-		na := *wire.NewNetAddressIPPort(nip, 8333, wire.SFNodeNetwork)
+		na := *wire.NewNetAddressV2IPPort(nip, 8333, wire.SFNodeNetwork)
 		test := ipTest{na, rfc1918, rfc2544, rfc3849, rfc3927, rfc3964, rfc4193, rfc4380,
 			rfc4843, rfc4862, rfc5737, rfc6052, rfc6145, rfc6598, local, valid, routable}
 		return test
@@ -89,55 +89,55 @@ func TestIPTypes(t *testing.T) {
 	t.Logf("Running %d tests", len(tests))
 	for _, test := range tests {
 		if rv := addrmgr.IsRFC1918(&test.in); rv != test.rfc1918 {
-			t.Errorf("IsRFC1918 %s\n got: %v want: %v", test.in.IP, rv, test.rfc1918)
+			t.Errorf("IsRFC1918 %s\n got: %v want: %v", test.in.IP(), rv, test.rfc1918)
 		}
 
 		if rv := addrmgr.IsRFC3849(&test.in); rv != test.rfc3849 {
-			t.Errorf("IsRFC3849 %s\n got: %v want: %v", test.in.IP, rv, test.rfc3849)
+			t.Errorf("IsRFC3849 %s\n got: %v want: %v", test.in.IP(), rv, test.rfc3849)
 		}
 
 		if rv := addrmgr.IsRFC3927(&test.in); rv != test.rfc3927 {
-			t.Errorf("IsRFC3927 %s\n got: %v want: %v", test.in.IP, rv, test.rfc3927)
+			t.Errorf("IsRFC3927 %s\n got: %v want: %v", test.in.IP(), rv, test.rfc3927)
 		}
 
 		if rv := addrmgr.IsRFC3964(&test.in); rv != test.rfc3964 {
-			t.Errorf("IsRFC3964 %s\n got: %v want: %v", test.in.IP, rv, test.rfc3964)
+			t.Errorf("IsRFC3964 %s\n got: %v want: %v", test.in.IP(), rv, test.rfc3964)
 		}
 
 		if rv := addrmgr.IsRFC4193(&test.in); rv != test.rfc4193 {
-			t.Errorf("IsRFC4193 %s\n got: %v want: %v", test.in.IP, rv, test.rfc4193)
+			t.Errorf("IsRFC4193 %s\n got: %v want: %v", test.in.IP(), rv, test.rfc4193)
 		}
 
 		if rv := addrmgr.IsRFC4380(&test.in); rv != test.rfc4380 {
-			t.Errorf("IsRFC4380 %s\n got: %v want: %v", test.in.IP, rv, test.rfc4380)
+			t.Errorf("IsRFC4380 %s\n got: %v want: %v", test.in.IP(), rv, test.rfc4380)
 		}
 
 		if rv := addrmgr.IsRFC4843(&test.in); rv != test.rfc4843 {
-			t.Errorf("IsRFC4843 %s\n got: %v want: %v", test.in.IP, rv, test.rfc4843)
+			t.Errorf("IsRFC4843 %s\n got: %v want: %v", test.in.IP(), rv, test.rfc4843)
 		}
 
 		if rv := addrmgr.IsRFC4862(&test.in); rv != test.rfc4862 {
-			t.Errorf("IsRFC4862 %s\n got: %v want: %v", test.in.IP, rv, test.rfc4862)
+			t.Errorf("IsRFC4862 %s\n got: %v want: %v", test.in.IP(), rv, test.rfc4862)
 		}
 
 		if rv := addrmgr.IsRFC6052(&test.in); rv != test.rfc6052 {
-			t.Errorf("isRFC6052 %s\n got: %v want: %v", test.in.IP, rv, test.rfc6052)
+			t.Errorf("isRFC6052 %s\n got: %v want: %v", test.in.IP(), rv, test.rfc6052)
 		}
 
 		if rv := addrmgr.IsRFC6145(&test.in); rv != test.rfc6145 {
-			t.Errorf("IsRFC1918 %s\n got: %v want: %v", test.in.IP, rv, test.rfc6145)
+			t.Errorf("IsRFC1918 %s\n got: %v want: %v", test.in.IP(), rv, test.rfc6145)
 		}
 
 		if rv := addrmgr.IsLocal(&test.in); rv != test.local {
-			t.Errorf("IsLocal %s\n got: %v want: %v", test.in.IP, rv, test.local)
+			t.Errorf("IsLocal %s\n got: %v want: %v", test.in.IP(), rv, test.local)
 		}
 
 		if rv := addrmgr.IsValid(&test.in); rv != test.valid {
-			t.Errorf("IsValid %s\n got: %v want: %v", test.in.IP, rv, test.valid)
+			t.Errorf("IsValid %s\n got: %v want: %v", test.in.IP(), rv, test.valid)
 		}
 
 		if rv := addrmgr.IsRoutable(&test.in); rv != test.routable {
-			t.Errorf("IsRoutable %s\n got: %v want: %v", test.in.IP, rv, test.routable)
+			t.Errorf("IsRoutable %s\n got: %v want: %v", test.in.IP(), rv, test.routable)
 		}
 	}
 }
@@ -192,7 +192,7 @@ func TestGroupKey(t *testing.T) {
 
 	for i, test := range tests {
 		nip := net.ParseIP(test.ip)
-		na := *wire.NewNetAddressIPPort(nip, 8333, wire.SFNodeNetwork)
+		na := *wire.NewNetAddressV2IPPort(nip, 8333, wire.SFNodeNetwork)
 		if key := addrmgr.GroupKey(&na); key != test.expected {
 			t.Errorf("TestGroupKey #%d (%s): unexpected group key "+
 				"- got '%s', want '%s'", i, test.name,
@@ -200,3 +200,80 @@ func TestGroupKey(t *testing.T) {
 		}
 	}
 }
+
+// TestOverlayTypes ensures the functions which determine the type and group of
+// addresses of the Tor v3, I2P and CJDNS overlay networks work as intended.
+func TestOverlayTypes(t *testing.T) {
+	key := make([]byte, 32)
+	key[0] = 0x35
+	cjdns := net.ParseIP("fc32:17ea:e415:c3bf:9808:149d:b5a2:c9aa")
+	ula := net.ParseIP("fd32:17ea:e415:c3bf:9808:149d:b5a2:c9aa")
+
+	tests := []struct {
+		name     string
+		in       *wire.NetAddressV2
+		tor      bool
+		i2p      bool
+		cjdns    bool
+		routable bool
+		group    string
+	}{
+		{
+			name:     "tor v3",
+			in:       wire.NewNetAddressV2(wire.NetworkTorV3, key, 8333, 0),
+			tor:      true,
+			routable: true,
+			group:    "torv3:5",
+		},
+		{
+			name:     "i2p",
+			in:       wire.NewNetAddressV2(wire.NetworkI2P, key, 0, 0),
+			i2p:      true,
+			routable: true,
+			group:    "i2p:5",
+		},
+		{
+			name:     "cjdns",
+			in:       wire.NewNetAddressV2(wire.NetworkCJDNS, cjdns, 8333, 0),
+			cjdns:    true,
+			routable: true,
+			group:    "cjdns:2",
+		},
+		{
+			name:  "cjdns outside fc00::/8",
+			in:    wire.NewNetAddressV2(wire.NetworkCJDNS, ula, 8333, 0),
+			group: "unroutable",
+		},
+		{
+			name:  "tor v3 wrong size",
+			in:    wire.NewNetAddressV2(wire.NetworkTorV3, key[:16], 8333, 0),
+			group: "unroutable",
+		},
+		{
+			name:  "unknown network",
+			in:    wire.NewNetAddressV2(wire.NetworkID(0x42), key, 8333, 0),
+			group: "unroutable",
+		},
+	}
+
+	for _, test := range tests {
+		if rv := addrmgr.IsTor(test.in); rv != test.tor {
+			t.Errorf("IsTor %s\n got: %v want: %v", test.name, rv, test.tor)
+		}
+		if rv := addrmgr.IsI2P(test.in); rv != test.i2p {
+			t.Errorf("IsI2P %s\n got: %v want: %v", test.name, rv, test.i2p)
+		}
+		if rv := addrmgr.IsCJDNS(test.in); rv != test.cjdns {
+			t.Errorf("IsCJDNS %s\n got: %v want: %v", test.name, rv,
+				test.cjdns)
+		}
+		if rv := addrmgr.IsRoutable(test.in); rv != test.routable {
+			t.Errorf("IsRoutable %s\n got: %v want: %v", test.name, rv,
+				test.routable)
+		}
+		if key := addrmgr.GroupKey(test.in); key != test.group {
+			t.Errorf("GroupKey %s\n got: %v want: %v", test.name, key,
+				test.group)
+		}
+	}
+}
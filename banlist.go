@@ -0,0 +1,257 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// banListFilename is the name of the file in the data directory which
+	// houses the banned subnets.
+	banListFilename = "banlist.json"
+
+	// banReasonMisbehaving is the reason recorded for peers which were
+	// banned automatically for exceeding the ban score threshold.
+	banReasonMisbehaving = "node misbehaving"
+
+	// banReasonManual is the reason recorded for subnets which were
+	// banned through the setban RPC.
+	banReasonManual = "manually added"
+)
+
+// banEntry describes a single banned subnet.
+type banEntry struct {
+	Subnet  string    `json:"subnet"`
+	Reason  string    `json:"reason"`
+	Created time.Time `json:"created"`
+	Until   time.Time `json:"until"`
+
+	ipNet *net.IPNet
+}
+
+// banList houses the banned subnets and persists them to a file so they
+// survive restarts.
+type banList struct {
+	mtx      sync.Mutex
+	filePath string
+	entries  map[string]*banEntry
+}
+
+// parseBanSubnet parses the passed IP address or CIDR subnet into the network
+// it covers.  Single addresses cover a network with only that address.
+func parseBanSubnet(subnet string) (*net.IPNet, error) {
+	if strings.Contains(subnet, "/") {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, err
+		}
+		return ipNet, nil
+	}
+
+	ip := net.ParseIP(subnet)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address or subnet %q", subnet)
+	}
+	bits := net.IPv6len * 8
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = net.IPv4len * 8
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// newBanList returns a ban list which persists its subnets to a file in the
+// passed directory.  Any bans already stored there are loaded.
+func newBanList(dataDir string) *banList {
+	bl := &banList{
+		filePath: filepath.Join(dataDir, banListFilename),
+		entries:  make(map[string]*banEntry),
+	}
+	if err := bl.load(); err != nil {
+		srvrLog.Errorf("Failed to load ban list %s: %v", bl.filePath, err)
+		bl.entries = make(map[string]*banEntry)
+	}
+	return bl
+}
+
+// load reads the bans stored in the ban list file, dropping any which have
+// expired.  A missing file is not an error.  It is only called while creating
+// the ban list.
+func (bl *banList) load() error {
+	data, err := ioutil.ReadFile(bl.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []*banEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		if !now.Before(entry.Until) {
+			continue
+		}
+		entry.ipNet, err = parseBanSubnet(entry.Subnet)
+		if err != nil {
+			return err
+		}
+		bl.entries[entry.ipNet.String()] = entry
+	}
+	srvrLog.Infof("Loaded %d banned subnets from file '%s'",
+		len(bl.entries), bl.filePath)
+	return nil
+}
+
+// save writes the bans to the ban list file.
+//
+// This function MUST be called with the ban list lock held (for reads).
+func (bl *banList) save() {
+	entries := make([]*banEntry, 0, len(bl.entries))
+	for _, entry := range bl.entries {
+		entries = append(entries, entry)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		srvrLog.Errorf("Failed to encode ban list: %v", err)
+		return
+	}
+
+	// Write to a temporary file first so a crash can't leave a partially
+	// written ban list behind.
+	tmpPath := bl.filePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		srvrLog.Errorf("Failed to write ban list %s: %v", tmpPath, err)
+		return
+	}
+	if err := os.Rename(tmpPath, bl.filePath); err != nil {
+		srvrLog.Errorf("Failed to write ban list %s: %v", bl.filePath, err)
+	}
+}
+
+// sweep removes the expired bans and reports whether any were removed.
+//
+// This function MUST be called with the ban list lock held (for writes).
+func (bl *banList) sweep() bool {
+	now := time.Now()
+	var swept bool
+	for key, entry := range bl.entries {
+		if !now.Before(entry.Until) {
+			srvrLog.Infof("Subnet %s is no longer banned", entry.Subnet)
+			delete(bl.entries, key)
+			swept = true
+		}
+	}
+	return swept
+}
+
+// Add bans the passed subnet until the passed time for the passed reason.  An
+// existing ban of the same subnet is only extended, never shortened.
+//
+// This function is safe for concurrent access.
+func (bl *banList) Add(ipNet *net.IPNet, until time.Time, reason string) {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	key := ipNet.String()
+	if entry, ok := bl.entries[key]; ok && !until.After(entry.Until) {
+		return
+	}
+	bl.entries[key] = &banEntry{
+		Subnet:  key,
+		Reason:  reason,
+		Created: time.Now(),
+		Until:   until,
+		ipNet:   ipNet,
+	}
+	bl.sweep()
+	bl.save()
+}
+
+// Remove unbans the passed subnet.  It returns false when the subnet is not
+// banned.
+//
+// This function is safe for concurrent access.
+func (bl *banList) Remove(ipNet *net.IPNet) bool {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	key := ipNet.String()
+	if _, ok := bl.entries[key]; !ok {
+		return false
+	}
+	delete(bl.entries, key)
+	bl.sweep()
+	bl.save()
+	return true
+}
+
+// Clear unbans all subnets.
+//
+// This function is safe for concurrent access.
+func (bl *banList) Clear() {
+	bl.mtx.Lock()
+	bl.entries = make(map[string]*banEntry)
+	bl.save()
+	bl.mtx.Unlock()
+}
+
+// IsBanned returns whether or not the passed IP address is covered by any of
+// the banned subnets, along with the time the longest matching ban ends.
+//
+// This function is safe for concurrent access.
+func (bl *banList) IsBanned(ip net.IP) (bool, time.Time) {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	if bl.sweep() {
+		bl.save()
+	}
+
+	var banned bool
+	var until time.Time
+	for _, entry := range bl.entries {
+		if entry.ipNet.Contains(ip) && entry.Until.After(until) {
+			banned = true
+			until = entry.Until
+		}
+	}
+	return banned, until
+}
+
+// Entries returns a copy of the bans which have not expired ordered by their
+// subnet.
+//
+// This function is safe for concurrent access.
+func (bl *banList) Entries() []banEntry {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+
+	if bl.sweep() {
+		bl.save()
+	}
+
+	entries := make([]banEntry, 0, len(bl.entries))
+	for _, entry := range bl.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Subnet < entries[j].Subnet
+	})
+	return entries
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestBanList ensures banned subnets cover the addresses within them, survive
+// reloading the ban list from disk, and expire.
+func TestBanList(t *testing.T) {
+	// Logging is not set up for tests.
+	setLogLevel("SRVR", "off")
+
+	dataDir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	subnet, err := parseBanSubnet("10.1.0.0/16")
+	if err != nil {
+		t.Fatalf("parseBanSubnet: %v", err)
+	}
+	single, err := parseBanSubnet("192.168.1.1")
+	if err != nil {
+		t.Fatalf("parseBanSubnet: %v", err)
+	}
+	if single.String() != "192.168.1.1/32" {
+		t.Fatalf("parseBanSubnet: got %v, want 192.168.1.1/32", single)
+	}
+	if _, err := parseBanSubnet("not an address"); err == nil {
+		t.Fatal("parseBanSubnet: invalid subnet accepted")
+	}
+
+	bl := newBanList(dataDir)
+	until := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	bl.Add(subnet, until, banReasonManual)
+	bl.Add(single, time.Now().Add(-time.Second), banReasonMisbehaving)
+
+	tests := []struct {
+		ip     string
+		banned bool
+	}{
+		{"10.1.2.3", true},
+		{"10.2.0.1", false},
+		{"192.168.1.1", false},
+	}
+	check := func(bl *banList) {
+		t.Helper()
+		for _, test := range tests {
+			banned, _ := bl.IsBanned(net.ParseIP(test.ip))
+			if banned != test.banned {
+				t.Fatalf("IsBanned(%s): got %v, want %v", test.ip,
+					banned, test.banned)
+			}
+		}
+	}
+	check(bl)
+
+	// The unexpired ban must be loaded again with its details.
+	bl = newBanList(dataDir)
+	check(bl)
+	entries := bl.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("Entries: got %d bans, want 1", len(entries))
+	}
+	if entries[0].Subnet != "10.1.0.0/16" ||
+		entries[0].Reason != banReasonManual ||
+		!entries[0].Until.Equal(until) {
+
+		t.Fatalf("Entries: unexpected ban %+v", entries[0])
+	}
+
+	if !bl.Remove(subnet) {
+		t.Fatal("Remove: banned subnet not removed")
+	}
+	if bl.Remove(subnet) {
+		t.Fatal("Remove: unbanned subnet removed")
+	}
+	if banned, _ := newBanList(dataDir).IsBanned(net.ParseIP("10.1.2.3")); banned {
+		t.Fatal("IsBanned: removed ban loaded from disk")
+	}
+}
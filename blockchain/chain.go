@@ -8,6 +8,7 @@ package blockchain
 import (
 	"container/list"
 	"fmt"
+	"math/big"
 	"sync"
 	"time"
 
@@ -67,6 +68,7 @@ type BestState struct {
 	NumTxns     uint64         // The number of txns in the block.
 	TotalTxns   uint64         // The total number of txns in the chain.
 	MedianTime  time.Time      // Median time as per CalcPastMedianTime.
+	ChainWork   *big.Int       // The total work of the chain up to the block.
 }
 
 // newBestState returns a new best stats instance for the given parameters.
@@ -82,6 +84,7 @@ func newBestState(node *blockNode, blockSize, blockWeight, numTxns,
 		NumTxns:     numTxns,
 		TotalTxns:   totalTxns,
 		MedianTime:  medianTime,
+		ChainWork:   new(big.Int).Set(node.workSum),
 	}
 }
 
@@ -974,7 +977,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// In the case the block is determined to be invalid due to a
 		// rule violation, mark it as invalid and mark all of its
 		// descendants as having an invalid ancestor.
-		err = b.checkConnectBlock(n, block, view, nil)
+		err = b.checkConnectBlock(n, block, view, nil, BFNone)
 		if err != nil {
 			if _, ok := err.(RuleError); ok {
 				b.index.SetStatusFlags(n, statusValidateFailed)
@@ -1110,7 +1113,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 		view.SetBestHash(parentHash)
 		stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
 		if !fastAdd {
-			err := b.checkConnectBlock(node, block, view, &stxos)
+			err := b.checkConnectBlock(node, block, view, &stxos, flags)
 			if err == nil {
 				b.index.SetStatusFlags(node, statusValid)
 			} else if _, ok := err.(RuleError); ok {
@@ -1219,6 +1222,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 // factors are used to guess, but the key factors that allow the chain to
 // believe it is current are:
 //  - Latest block height is after the latest checkpoint (if enabled)
+//  - Latest block has at least the minimum chain work of the network
 //  - Latest block has a timestamp newer than 24 hours ago
 //
 // This function MUST be called with the chain state lock held (for reads).
@@ -1230,6 +1234,13 @@ func (b *BlockChain) isCurrent() bool {
 		return false
 	}
 
+	// Not current if the latest main (best) chain has less work than the
+	// best chain is known to have.
+	minWork := b.chainParams.MinimumChainWork
+	if minWork != nil && b.bestChain.Tip().workSum.Cmp(minWork) < 0 {
+		return false
+	}
+
 	// Not current if the latest best block has a timestamp before 24 hours
 	// ago.
 	//
@@ -1243,6 +1254,7 @@ func (b *BlockChain) isCurrent() bool {
 // factors are used to guess, but the key factors that allow the chain to
 // believe it is current are:
 //  - Latest block height is after the latest checkpoint (if enabled)
+//  - Latest block has at least the minimum chain work of the network
 //  - Latest block has a timestamp newer than 24 hours ago
 //
 // This function is safe for concurrent access.
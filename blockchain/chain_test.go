@@ -5,6 +5,7 @@
 package blockchain
 
 import (
+	"math/big"
 	"reflect"
 	"testing"
 	"time"
@@ -964,3 +965,46 @@ func TestIntervalBlockHashes(t *testing.T) {
 		}
 	}
 }
+
+// TestIsCurrentMinimumChainWork ensures the chain is not considered current
+// while the best chain has less than the minimum chain work of the network.
+func TestIsCurrentMinimumChainWork(t *testing.T) {
+	// Construct a recent best chain with a single block on top of the
+	// genesis block.
+	params := chaincfg.RegressionNetParams
+	chain := newFakeChain(&params)
+	node := newFakeNode(chain.bestChain.Tip(), 1, params.PowLimitBits,
+		time.Now())
+	chain.index.AddNode(node)
+	chain.bestChain.SetTip(node)
+	workSum := node.workSum
+
+	tests := []struct {
+		name    string
+		minWork *big.Int
+		want    bool
+	}{
+		{
+			name:    "no minimum chain work",
+			minWork: nil,
+			want:    true,
+		},
+		{
+			name:    "exactly the minimum chain work",
+			minWork: new(big.Int).Set(workSum),
+			want:    true,
+		},
+		{
+			name:    "below the minimum chain work",
+			minWork: new(big.Int).Add(workSum, big.NewInt(1)),
+			want:    false,
+		},
+	}
+	for _, test := range tests {
+		params.MinimumChainWork = test.minWork
+		if got := chain.IsCurrent(); got != test.want {
+			t.Errorf("%s: unexpected result -- got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
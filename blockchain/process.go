@@ -29,6 +29,13 @@ const (
 	// not be performed.
 	BFNoPoWCheck
 
+	// BFAssumeValid may be set to indicate the scripts of the block do not
+	// need to be validated since it is already known to be an ancestor of
+	// the assumed valid block on a chain with enough work.  All other
+	// checks are still performed.  This is primarily used for
+	// headers-first mode.
+	BFAssumeValid
+
 	// BFNone is a convenience value to specifically indicate no flags.
 	BFNone BehaviorFlags = 0
 )
@@ -12,6 +12,7 @@ import (
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 )
@@ -148,6 +149,118 @@ func TestCheckConnectBlockTemplate(t *testing.T) {
 	}
 }
 
+// TestAssumeValidScripts ensures the scripts of a block are checked unless
+// the block is processed as an ancestor of the assumed valid block, in which
+// case only the script checks are skipped.
+func TestAssumeValidScripts(t *testing.T) {
+	// Create a new database and chain instance to run tests against.
+	params := &chaincfg.RegressionNetParams
+	chain, teardownFunc, err := chainSetup("assumevalidscripts", params)
+	if err != nil {
+		t.Errorf("Failed to setup chain instance: %v", err)
+		return
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+
+	// createBlock returns a solved block on top of the passed block with a
+	// coinbase paying to the passed script along with the passed
+	// transactions.  The extra nonce makes otherwise identical blocks
+	// unique.
+	createBlock := func(prev *wire.MsgBlock, height int32, extraNonce byte, pkScript []byte, txns ...*wire.MsgTx) *btcutil.Block {
+		coinbase := wire.NewMsgTx(1)
+		coinbase.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+				wire.MaxPrevOutIndex),
+			SignatureScript: []byte{txscript.OP_0, extraNonce},
+			Sequence:        wire.MaxTxInSequenceNum,
+		})
+		coinbase.AddTxOut(wire.NewTxOut(CalcBlockSubsidy(height,
+			params), pkScript))
+
+		block := wire.NewMsgBlock(&wire.BlockHeader{
+			Version:   4,
+			PrevBlock: prev.BlockHash(),
+			Timestamp: prev.Header.Timestamp.Add(time.Minute),
+			Bits:      params.PowLimitBits,
+		})
+		block.AddTransaction(coinbase)
+		for _, tx := range txns {
+			block.AddTransaction(tx)
+		}
+		utilBlock := btcutil.NewBlock(block)
+		merkles := BuildMerkleTreeStore(utilBlock.Transactions(), false)
+		block.Header.MerkleRoot = *merkles[len(merkles)-1]
+
+		target := CompactToBig(block.Header.Bits)
+		for {
+			hash := block.Header.BlockHash()
+			if HashToBig(&hash).Cmp(target) <= 0 {
+				break
+			}
+			block.Header.Nonce++
+		}
+		return btcutil.NewBlock(block)
+	}
+
+	// Create a block with a coinbase output which can't be spent and a
+	// block which spends it anyways.
+	genesis := params.GenesisBlock
+	block1 := createBlock(genesis, 1, 0, []byte{txscript.OP_FALSE})
+	_, _, err = chain.ProcessBlock(block1, BFNone)
+	if err != nil {
+		t.Fatalf("ProcessBlock: unexpected error processing block 1: %v",
+			err)
+	}
+	coinbaseHash := block1.Transactions()[0].Hash()
+	spend := wire.NewMsgTx(1)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(coinbaseHash, 0), nil, nil))
+	spend.AddTxOut(wire.NewTxOut(1e8, []byte{txscript.OP_TRUE}))
+
+	// The invalid spend is rejected when the block is not known to be an
+	// ancestor of the assumed valid block.
+	block2 := createBlock(block1.MsgBlock(), 2, 0,
+		[]byte{txscript.OP_TRUE}, spend)
+	_, _, err = chain.ProcessBlock(block2, BFNone)
+	if rerr, ok := err.(RuleError); !ok ||
+		rerr.ErrorCode != ErrScriptValidation {
+
+		t.Fatalf("ProcessBlock: got error %v, want %v", err,
+			ErrScriptValidation)
+	}
+
+	// All other checks are still performed for ancestors of the assumed
+	// valid block.
+	overspend := spend.Copy()
+	overspend.TxOut[0].Value = 1e10
+	badBlock := createBlock(block1.MsgBlock(), 2, 1,
+		[]byte{txscript.OP_TRUE}, overspend)
+	_, _, err = chain.ProcessBlock(badBlock, BFAssumeValid)
+	if rerr, ok := err.(RuleError); !ok ||
+		rerr.ErrorCode != ErrSpendTooHigh {
+
+		t.Fatalf("ProcessBlock: got error %v, want %v", err,
+			ErrSpendTooHigh)
+	}
+
+	// The same spend is accepted without checking its script once the
+	// block is known to be an ancestor of the assumed valid block.
+	block2a := createBlock(block1.MsgBlock(), 2, 2,
+		[]byte{txscript.OP_TRUE}, spend)
+	isMainChain, _, err := chain.ProcessBlock(block2a, BFAssumeValid)
+	if err != nil {
+		t.Fatalf("ProcessBlock: unexpected error processing assumed "+
+			"valid block: %v", err)
+	}
+	if !isMainChain {
+		t.Fatalf("ProcessBlock: assumed valid block is not on the " +
+			"main chain")
+	}
+}
+
 // TestCheckBlockSanity tests the CheckBlockSanity function to ensure it works
 // as expected.
 func TestCheckBlockSanity(t *testing.T) {
@@ -0,0 +1,282 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcec
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// EllswiftPubKeyLen is the length of a public key encoded with ElligatorSwift.
+const EllswiftPubKeyLen = 64
+
+var (
+	// ellswiftC is sqrt(-3) mod p which is used by the ElligatorSwift
+	// mapping.
+	ellswiftC = fromHex("0A2D2BA93507F1DF233770C2A797962CC61F6D15DA14ECD47D8D27AE1CD5F852")
+
+	// ellswiftK is (sqrt(-3) - 1) / 2 mod p which is used by the
+	// ElligatorSwift inverse mapping.
+	ellswiftK = fromHex("851695D49A83F8EF919BB86153CBCB16630FB68AED0A766A3EC693D68E6AFA40")
+
+	// errEllswiftNoPreimage is returned internally when a field element
+	// has no ElligatorSwift preimage for the chosen u and case.
+	errEllswiftNoPreimage = errors.New("no ElligatorSwift preimage")
+)
+
+// fieldSqrt returns a square root of a modulo the field prime of the curve
+// along with whether or not a is actually a square.
+func fieldSqrt(curve *KoblitzCurve, a *big.Int) (*big.Int, bool) {
+	p := curve.Params().P
+	r := new(big.Int).Exp(a, curve.QPlus1Div4(), p)
+	r2 := new(big.Int).Mul(r, r)
+	r2.Mod(r2, p)
+	return r, r2.Cmp(new(big.Int).Mod(a, p)) == 0
+}
+
+// fieldInverse returns the multiplicative inverse of a modulo the field prime
+// of the curve.  The inverse of zero is zero.
+func fieldInverse(curve *KoblitzCurve, a *big.Int) *big.Int {
+	p := curve.Params().P
+	return new(big.Int).Exp(a, new(big.Int).Sub(p, big.NewInt(2)), p)
+}
+
+// isValidX returns whether or not x is the x coordinate of a point on the
+// curve.
+func isValidX(curve *KoblitzCurve, x *big.Int) bool {
+	p := curve.Params().P
+	y2 := new(big.Int).Mul(x, x)
+	y2.Mul(y2, x)
+	y2.Add(y2, curve.Params().B)
+	y2.Mod(y2, p)
+	_, ok := fieldSqrt(curve, y2)
+	return ok
+}
+
+// xSwiftEC maps the pair of field elements u and t to the x coordinate of a
+// point on the curve as defined by the ElligatorSwift paper.  Every pair of
+// field elements maps to a valid x coordinate.
+func xSwiftEC(curve *KoblitzCurve, u, t *big.Int) *big.Int {
+	p := curve.Params().P
+	b := curve.Params().B
+	mod := func(v *big.Int) *big.Int { return v.Mod(v, p) }
+
+	u = new(big.Int).Mod(u, p)
+	t = new(big.Int).Mod(t, p)
+	if u.Sign() == 0 {
+		u.SetInt64(1)
+	}
+	if t.Sign() == 0 {
+		t.SetInt64(1)
+	}
+
+	// g(u) = u^3 + 7
+	u2 := mod(new(big.Int).Mul(u, u))
+	gu := mod(new(big.Int).Add(mod(new(big.Int).Mul(u2, u)), b))
+	t2 := mod(new(big.Int).Mul(t, t))
+	if mod(new(big.Int).Add(gu, t2)).Sign() == 0 {
+		t = mod(t.Lsh(t, 1))
+		t2 = mod(new(big.Int).Mul(t, t))
+	}
+
+	// X = (u^3 + 7 - t^2) / (2t)
+	// Y = (X + t) / (sqrt(-3) * u)
+	x := mod(new(big.Int).Sub(gu, t2))
+	x.Mul(x, fieldInverse(curve, mod(new(big.Int).Lsh(t, 1))))
+	mod(x)
+	y := mod(new(big.Int).Add(x, t))
+	y.Mul(y, fieldInverse(curve, mod(new(big.Int).Mul(ellswiftC, u))))
+	mod(y)
+
+	// Try u + 4Y^2 first, then (-X/Y - u) / 2 and (X/Y - u) / 2.
+	x3 := mod(new(big.Int).Mul(y, y))
+	x3.Lsh(x3, 2)
+	mod(x3.Add(x3, u))
+	if isValidX(curve, x3) {
+		return x3
+	}
+
+	xy := mod(new(big.Int).Mul(x, fieldInverse(curve, y)))
+	half := fieldInverse(curve, big.NewInt(2))
+	x1 := mod(new(big.Int).Neg(xy))
+	mod(x1.Sub(x1, u))
+	mod(x1.Mul(x1, half))
+	if isValidX(curve, x1) {
+		return x1
+	}
+
+	x2 := mod(new(big.Int).Sub(xy, u))
+	mod(x2.Mul(x2, half))
+	return x2
+}
+
+// xSwiftECInv returns a t such that xSwiftEC(u, t) is x.  The variant selects
+// which of the up to eight preimages is returned as defined by the BIP0324
+// reference implementation.  errEllswiftNoPreimage is returned when the
+// selected preimage does not exist.
+func xSwiftECInv(curve *KoblitzCurve, x, u *big.Int, variant int) (*big.Int, error) {
+	p := curve.Params().P
+	b := curve.Params().B
+	mod := func(v *big.Int) *big.Int { return v.Mod(v, p) }
+
+	u2 := mod(new(big.Int).Mul(u, u))
+	gu := mod(new(big.Int).Add(mod(new(big.Int).Mul(u2, u)), b))
+
+	var s, v *big.Int
+	if variant&2 == 0 {
+		// The x coordinate must not be reachable through the
+		// u + 4Y^2 branch which takes precedence.
+		if isValidX(curve, mod(new(big.Int).Sub(new(big.Int).Neg(x), u))) {
+			return nil, errEllswiftNoPreimage
+		}
+
+		// s = -(u^3 + 7) / (u^2 + uv + v^2)
+		v = new(big.Int).Set(x)
+		d := mod(new(big.Int).Mul(u, v))
+		d.Add(d, u2)
+		d.Add(d, mod(new(big.Int).Mul(v, v)))
+		mod(d)
+		if d.Sign() == 0 {
+			return nil, errEllswiftNoPreimage
+		}
+		s = mod(new(big.Int).Neg(gu))
+		mod(s.Mul(s, fieldInverse(curve, d)))
+	} else {
+		// s = x - u
+		s = mod(new(big.Int).Sub(x, u))
+		if s.Sign() == 0 {
+			return nil, errEllswiftNoPreimage
+		}
+
+		// r = sqrt(-s * (4(u^3 + 7) + 3su^2))
+		q := mod(new(big.Int).Lsh(gu, 2))
+		su2 := mod(new(big.Int).Mul(s, u2))
+		q.Add(q, su2.Mul(su2, big.NewInt(3)))
+		mod(q)
+		q.Mul(q, new(big.Int).Neg(s))
+		r, ok := fieldSqrt(curve, mod(q))
+		if !ok {
+			return nil, errEllswiftNoPreimage
+		}
+		if variant&1 != 0 && r.Sign() == 0 {
+			return nil, errEllswiftNoPreimage
+		}
+
+		// v = (r/s - u) / 2
+		v = mod(new(big.Int).Mul(r, fieldInverse(curve, s)))
+		mod(v.Sub(v, u))
+		mod(v.Mul(v, fieldInverse(curve, big.NewInt(2))))
+	}
+
+	w, ok := fieldSqrt(curve, s)
+	if !ok {
+		return nil, errEllswiftNoPreimage
+	}
+
+	// Bit 0 of the variant selects between the two roots of the quadratic
+	// and bit 2 selects the sign of the result:
+	//
+	//   variant&5 == 0: t = -w * (u * (1 - sqrt(-3)) / 2 + v)
+	//   variant&5 == 1: t =  w * (u * (1 + sqrt(-3)) / 2 + v)
+	//   variant&5 == 4: t =  w * (u * (1 - sqrt(-3)) / 2 + v)
+	//   variant&5 == 5: t = -w * (u * (1 + sqrt(-3)) / 2 + v)
+	//
+	// Since (1 - sqrt(-3)) / 2 is -k and (1 + sqrt(-3)) / 2 is k + 1, the
+	// first and third cases are w * (uk - v) with opposite signs.
+	var t *big.Int
+	if variant&1 == 0 {
+		t = mod(new(big.Int).Mul(u, ellswiftK))
+		mod(t.Sub(t, v))
+	} else {
+		t = mod(new(big.Int).Add(ellswiftK, big.NewInt(1)))
+		mod(t.Mul(t, u))
+		mod(t.Add(t, v))
+	}
+	mod(t.Mul(t, w))
+	if variant&4 != 0 {
+		mod(t.Neg(t))
+	}
+	return t, nil
+}
+
+// EllswiftEncode returns the 64 byte ElligatorSwift encoding of the passed
+// public key using randomness from the passed reader.  The encoding is
+// indistinguishable from uniformly random bytes which makes it suitable for
+// key exchanges which must not be identifiable by observers.
+func EllswiftEncode(pubKey *PublicKey, rnd io.Reader) ([EllswiftPubKeyLen]byte, error) {
+	var enc [EllswiftPubKeyLen]byte
+	curve := S256()
+	p := curve.Params().P
+
+	var buf [33]byte
+	for {
+		// Pick a random u along with which of the preimages of the x
+		// coordinate to try.  Retry with a new u when the preimage
+		// does not exist, which happens roughly half of the time.
+		if _, err := io.ReadFull(rnd, buf[:]); err != nil {
+			return enc, err
+		}
+		u := new(big.Int).SetBytes(buf[:32])
+		u.Mod(u, p)
+		if u.Sign() == 0 {
+			continue
+		}
+		t, err := xSwiftECInv(curve, pubKey.X, u, int(buf[32]&7))
+		if err != nil {
+			continue
+		}
+
+		// The y coordinate of the point is not encoded by the x
+		// coordinate alone, so pick the t with the matching parity.
+		if t.Bit(0) != pubKey.Y.Bit(0) {
+			t.Sub(p, t)
+		}
+		copy(enc[:32], paddedAppend(32, nil, u.Bytes()))
+		copy(enc[32:], paddedAppend(32, nil, t.Bytes()))
+		return enc, nil
+	}
+}
+
+// EllswiftDecode returns the public key encoded by the passed 64 byte
+// ElligatorSwift encoding.  Every 64 byte string decodes to a valid public
+// key.
+func EllswiftDecode(enc *[EllswiftPubKeyLen]byte) *PublicKey {
+	curve := S256()
+	u := new(big.Int).SetBytes(enc[:32])
+	t := new(big.Int).SetBytes(enc[32:])
+	x := xSwiftEC(curve, u, t)
+
+	// The parity of the y coordinate is taken from t.
+	t.Mod(t, curve.Params().P)
+	y, _ := decompressPoint(curve, x, t.Bit(0) == 1)
+	return &PublicKey{Curve: curve, X: x, Y: y}
+}
+
+// NewEllswiftKey generates a new private key along with the ElligatorSwift
+// encoding of its public key.
+func NewEllswiftKey() (*PrivateKey, [EllswiftPubKeyLen]byte, error) {
+	privKey, err := NewPrivateKey(S256())
+	if err != nil {
+		return nil, [EllswiftPubKeyLen]byte{}, err
+	}
+	enc, err := EllswiftEncode(privKey.PubKey(), rand.Reader)
+	if err != nil {
+		return nil, [EllswiftPubKeyLen]byte{}, err
+	}
+	return privKey, enc, nil
+}
+
+// EllswiftECDHXOnly returns the x coordinate of the shared secret point
+// computed from the passed private key and the ElligatorSwift encoded public
+// key of the other party.
+func EllswiftECDHXOnly(privKey *PrivateKey, theirs *[EllswiftPubKeyLen]byte) [32]byte {
+	var x [32]byte
+	pubKey := EllswiftDecode(theirs)
+	sx, _ := pubKey.Curve.ScalarMult(pubKey.X, pubKey.Y, privKey.D.Bytes())
+	copy(x[:], paddedAppend(32, nil, sx.Bytes()))
+	return x
+}
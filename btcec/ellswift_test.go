@@ -0,0 +1,512 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcec
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// TestEllswiftConstants ensures the constants used by the ElligatorSwift
+// mapping have the expected values.
+func TestEllswiftConstants(t *testing.T) {
+	curve := S256()
+	p := curve.Params().P
+
+	// c^2 must be -3.
+	c2 := new(big.Int).Mul(ellswiftC, ellswiftC)
+	c2.Mod(c2, p)
+	minus3 := new(big.Int).Sub(p, big.NewInt(3))
+	if c2.Cmp(minus3) != 0 {
+		t.Fatalf("sqrt(-3) squared is %x, want %x", c2, minus3)
+	}
+
+	// 2k + 1 must be c.
+	k := new(big.Int).Lsh(ellswiftK, 1)
+	k.Add(k, big.NewInt(1))
+	k.Mod(k, p)
+	if k.Cmp(ellswiftC) != 0 {
+		t.Fatalf("2k + 1 is %x, want %x", k, ellswiftC)
+	}
+}
+
+// TestXSwiftECInv ensures every preimage found by the inverse mapping maps
+// back to the original x coordinate.
+func TestXSwiftECInv(t *testing.T) {
+	curve := S256()
+	for i := 0; i < 32; i++ {
+		privKey, err := NewPrivateKey(curve)
+		if err != nil {
+			t.Fatalf("private key generation error: %v", err)
+		}
+		x := privKey.PubKey().X
+
+		var buf [32]byte
+		if _, err := rand.Read(buf[:]); err != nil {
+			t.Fatalf("unable to read random bytes: %v", err)
+		}
+		u := new(big.Int).SetBytes(buf[:])
+		u.Mod(u, curve.Params().P)
+
+		for variant := 0; variant < 8; variant++ {
+			tv, err := xSwiftECInv(curve, x, u, variant)
+			if err == errEllswiftNoPreimage {
+				continue
+			}
+			if err != nil {
+				t.Fatalf("xSwiftECInv: unexpected error %v", err)
+			}
+			got := xSwiftEC(curve, u, tv)
+			if got.Cmp(x) != 0 {
+				t.Fatalf("xSwiftEC(u, xSwiftECInv(%x, u, %d)) is "+
+					"%x", x, variant, got)
+			}
+		}
+	}
+}
+
+// TestXSwiftECInvVectors ensures the inverse mapping returns the expected
+// preimage, or no preimage, for every variant of the xswiftec_inv test vectors
+// from BIP0324.
+func TestXSwiftECInvVectors(t *testing.T) {
+	tests := []struct {
+		u, x string
+		t    [8]string // Empty when there is no preimage.
+	}{
+		{
+			u: "05ff6bdad900fc3261bc7fe34e2fb0f569f06e091ae437d3a52e9da0cbfb9590",
+			x: "80cdf63774ec7022c89a5a8558e373a279170285e0ab27412dbce510bdfe23fc",
+			t: [8]string{
+				"",
+				"",
+				"45654798ece071ba79286d04f7f3eb1c3f1d17dd883610f2ad2efd82a287466b",
+				"0aeaa886f6b76c7158452418cbf5033adc5747e9e9b5d3b2303db96936528557",
+				"",
+				"",
+				"ba9ab867131f8e4586d792fb080c14e3c0e2e82277c9ef0d52d1027c5d78b5c4",
+				"f51557790948938ea7badbe7340afcc523a8b816164a2c4dcfc24695c9ad76d8",
+			},
+		},
+		{
+			u: "1737a85f4c8d146cec96e3ffdca76d9903dcf3bd53061868d478c78c63c2aa9e",
+			x: "39e48dd150d2f429be088dfd5b61882e7e8407483702ae9a5ab35927b15f85ea",
+			t: [8]string{
+				"1be8cc0b04be0c681d0c6a68f733f82c6c896e0c8a262fcd392918e303a7abf4",
+				"605b5814bf9b8cb066667c9e5480d22dc5b6c92f14b4af3ee0a9eb83b03685e3",
+				"",
+				"",
+				"e41733f4fb41f397e2f3959708cc07d3937691f375d9d032c6d6e71bfc58503b",
+				"9fa4a7eb4064734f99998361ab7f2dd23a4936d0eb4b50c11f56147b4fc9764c",
+				"",
+				"",
+			},
+		},
+		{
+			u: "1aaa1ccebf9c724191033df366b36f691c4d902c228033ff4516d122b2564f68",
+			x: "c75541259d3ba98f207eaa30c69634d187d0b6da594e719e420f4898638fc5b0",
+			t: [8]string{
+				"",
+				"",
+				"",
+				"",
+				"",
+				"",
+				"",
+				"",
+			},
+		},
+		{
+			u: "2323a1d079b0fd72fc8bb62ec34230a815cb0596c2bfac998bd6b84260f5dc26",
+			x: "239342dfb675500a34a196310b8d87d54f49dcac9da50c1743ceab41a7b249ff",
+			t: [8]string{
+				"f63580b8aa49c4846de56e39e1b3e73f171e881eba8c66f614e67e5c975dfc07",
+				"b6307b332e699f1cf77841d90af25365404deb7fed5edb3090db49e642a156b6",
+				"",
+				"",
+				"09ca7f4755b63b7b921a91c61e4c18c0e8e177e145739909eb1981a268a20028",
+				"49cf84ccd19660e30887be26f50dac9abfb2148012a124cf6f24b618bd5ea579",
+				"",
+				"",
+			},
+		},
+		{
+			u: "3edd7b3980e2f2f34d1409a207069f881fda5f96f08027ac4465b63dc278d672",
+			x: "053a98de4a27b1961155822b3a3121f03b2a14458bd80eb4a560c4c7a85c149c",
+			t: [8]string{
+				"",
+				"",
+				"b3dae4b7dcf858e4c6968057cef2b156465431526538199cf52dc1b2d62fda30",
+				"4aa77dd55d6b6d3cfa10cc9d0fe42f79232e4575661049ae36779c1d0c666d88",
+				"",
+				"",
+				"4c251b482307a71b39697fa8310d4ea9b9abcead9ac7e6630ad23e4c29d021ff",
+				"b558822aa29492c305ef3362f01bd086dcd1ba8a99efb651c98863e1f3998ea7",
+			},
+		},
+	}
+
+	curve := S256()
+	for i, test := range tests {
+		u := fromHex(test.u)
+		x := fromHex(test.x)
+		for variant, want := range test.t {
+			var got string
+			tv, err := xSwiftECInv(curve, x, u, variant)
+			switch {
+			case err == nil:
+				got = hex.EncodeToString(paddedAppend(32, nil, tv.Bytes()))
+			case err != errEllswiftNoPreimage:
+				t.Fatalf("xSwiftECInv #%d variant %d: unexpected "+
+					"error %v", i, variant, err)
+			}
+			if got != want {
+				t.Errorf("xSwiftECInv #%d variant %d: got %q, want %q",
+					i, variant, got, want)
+			}
+		}
+	}
+}
+
+// TestEllswiftDecodeVectors ensures ElligatorSwift encodings decode to the
+// expected x coordinates of the ellswift_decode test vectors from BIP0324.
+func TestEllswiftDecodeVectors(t *testing.T) {
+	tests := []struct {
+		enc string
+		x   string
+	}{
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+				"01d3475bf7655b0fb2d852921035b2ef607f49069b97454e6795251062741771",
+			"b5da00b73cd6560520e7c364086e7cd23a34bf60d0e707be9fc34d4cd5fdfa2c",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+				"82277c4a71f9d22e66ece523f8fa08741a7c0912c66a69ce68514bfd3515b49f",
+			"f482f2e241753ad0fb89150d8491dc1e34ff0b8acfbb442cfe999e2e5e6fd1d2",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+				"8421cc930e77c9f514b6915c3dbe2a94c6d8f690b5b739864ba6789fb8a55dd0",
+			"9f59c40275f5085a006f05dae77eb98c6fd0db1ab4a72ac47eae90a4fc9e57e0",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+				"bde70df51939b94c9c24979fa7dd04ebd9b3572da7802290438af2a681895441",
+			"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa9fffffd6b",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+				"d19c182d2759cd99824228d94799f8c6557c38a1c0d6779b9d4b729c6f1ccc42",
+			"70720db7e238d04121f5b1afd8cc5ad9d18944c6bdc94881f502b7a3af3aecff",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"edd1fd3e327ce90cc7a3542614289aee9682003e9cf7dcc9cf2ca9743be5aa0c",
+		},
+		{
+			"0a2d2ba93507f1df233770c2a797962cc61f6d15da14ecd47d8d27ae1cd5f853" +
+				"0000000000000000000000000000000000000000000000000000000000000000",
+			"532167c11200b08c0e84a354e74dcc40f8b25f4fe686e30869526366278a0688",
+		},
+		{
+			"0a2d2ba93507f1df233770c2a797962cc61f6d15da14ecd47d8d27ae1cd5f853" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"532167c11200b08c0e84a354e74dcc40f8b25f4fe686e30869526366278a0688",
+		},
+		{
+			"0ffde9ca81d751e9cdaffc1a50779245320b28996dbaf32f822f20117c22fbd6" +
+				"c74d99efceaa550f1ad1c0f43f46e7ff1ee3bd0162b7bf55f2965da9c3450646",
+			"74e880b3ffd18fe3cddf7902522551ddf97fa4a35a3cfda8197f947081a57b8f",
+		},
+		{
+			"0ffde9ca81d751e9cdaffc1a50779245320b28996dbaf32f822f20117c22fbd6" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff156ca896",
+			"377b643fce2271f64e5c8101566107c1be4980745091783804f654781ac9217c",
+		},
+		{
+			"123658444f32be8f02ea2034afa7ef4bbe8adc918ceb49b12773b625f490b368" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff8dc5fe11",
+			"ed16d65cf3a9538fcb2c139f1ecbc143ee14827120cbc2659e667256800b8142",
+		},
+		{
+			"146f92464d15d36e35382bd3ca5b0f976c95cb08acdcf2d5b3570617990839d7" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff3145e93b",
+			"0d5cd840427f941f65193079ab8e2e83024ef2ee7ca558d88879ffd879fb6657",
+		},
+		{
+			"15fdf5cf09c90759add2272d574d2bb5fe1429f9f3c14c65e3194bf61b82aa73" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff04cfd906",
+			"16d0e43946aec93f62d57eb8cde68951af136cf4b307938dd1447411e07bffe1",
+		},
+		{
+			"1f67edf779a8a649d6def60035f2fa22d022dd359079a1a144073d84f19b92d5" +
+				"0000000000000000000000000000000000000000000000000000000000000000",
+			"025661f9aba9d15c3118456bbe980e3e1b8ba2e047c737a4eb48a040bb566f6c",
+		},
+		{
+			"1f67edf779a8a649d6def60035f2fa22d022dd359079a1a144073d84f19b92d5" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"025661f9aba9d15c3118456bbe980e3e1b8ba2e047c737a4eb48a040bb566f6c",
+		},
+		{
+			"1fe1e5ef3fceb5c135ab7741333ce5a6e80d68167653f6b2b24bcbcfaaaff507" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"98bec3b2a351fa96cfd191c1778351931b9e9ba9ad1149f6d9eadca80981b801",
+		},
+		{
+			"4056a34a210eec7892e8820675c860099f857b26aad85470ee6d3cf1304a9dcf" +
+				"375e70374271f20b13c9986ed7d3c17799698cfc435dbed3a9f34b38c823c2b4",
+			"868aac2003b29dbcad1a3e803855e078a89d16543ac64392d122417298cec76e",
+		},
+		{
+			"4197ec3723c654cfdd32ab075506648b2ff5070362d01a4fff14b336b78f963f" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffb3ab1e95",
+			"ba5a6314502a8952b8f456e085928105f665377a8ce27726a5b0eb7ec1ac0286",
+		},
+		{
+			"47eb3e208fedcdf8234c9421e9cd9a7ae873bfbdbc393723d1ba1e1e6a8e6b24" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff7cd12cb1",
+			"d192d52007e541c9807006ed0468df77fd214af0a795fe119359666fdcf08f7c",
+		},
+		{
+			"5eb9696a2336fe2c3c666b02c755db4c0cfd62825c7b589a7b7bb442e141c1d6" +
+				"93413f0052d49e64abec6d5831d66c43612830a17df1fe4383db896468100221",
+			"ef6e1da6d6c7627e80f7a7234cb08a022c1ee1cf29e4d0f9642ae924cef9eb38",
+		},
+		{
+			"7bf96b7b6da15d3476a2b195934b690a3a3de3e8ab8474856863b0de3af90b0e" +
+				"0000000000000000000000000000000000000000000000000000000000000000",
+			"50851dfc9f418c314a437295b24feeea27af3d0cd2308348fda6e21c463e46ff",
+		},
+		{
+			"7bf96b7b6da15d3476a2b195934b690a3a3de3e8ab8474856863b0de3af90b0e" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"50851dfc9f418c314a437295b24feeea27af3d0cd2308348fda6e21c463e46ff",
+		},
+		{
+			"943c2f775108b737fe65a9531e19f2fc2a197f5603e3a2881d1d83e4008f9125" +
+				"0000000000000000000000000000000000000000000000000000000000000000",
+			"311c61f0ab2f32b7b1f0223fa72f0a78752b8146e46107f8876dd9c4f92b2942",
+		},
+		{
+			"943c2f775108b737fe65a9531e19f2fc2a197f5603e3a2881d1d83e4008f9125" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"311c61f0ab2f32b7b1f0223fa72f0a78752b8146e46107f8876dd9c4f92b2942",
+		},
+		{
+			"a0f18492183e61e8063e573606591421b06bc3513631578a73a39c1c3306239f" +
+				"2f32904f0d2a33ecca8a5451705bb537d3bf44e071226025cdbfd249fe0f7ad6",
+			"97a09cf1a2eae7c494df3c6f8a9445bfb8c09d60832f9b0b9d5eabe25fbd14b9",
+		},
+		{
+			"a1ed0a0bd79d8a23cfe4ec5fef5ba5cccfd844e4ff5cb4b0f2e71627341f1c5b" +
+				"17c499249e0ac08d5d11ea1c2c8ca7001616559a7994eadec9ca10fb4b8516dc",
+			"65a89640744192cdac64b2d21ddf989cdac7500725b645bef8e2200ae39691f2",
+		},
+		{
+			"ba94594a432721aa3580b84c161d0d134bc354b690404d7cd4ec57c16d3fbe98" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffea507dd7",
+			"5e0d76564aae92cb347e01a62afd389a9aa401c76c8dd227543dc9cd0efe685a",
+		},
+		{
+			"bcaf7219f2f6fbf55fe5e062dce0e48c18f68103f10b8198e974c184750e1be3" +
+				"932016cbf69c4471bd1f656c6a107f1973de4af7086db897277060e25677f19a",
+			"2d97f96cac882dfe73dc44db6ce0f1d31d6241358dd5d74eb3d3b50003d24c2b",
+		},
+		{
+			"bcaf7219f2f6fbf55fe5e062dce0e48c18f68103f10b8198e974c184750e1be3" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff6507d09a",
+			"e7008afe6e8cbd5055df120bd748757c686dadb41cce75e4addcc5e02ec02b44",
+		},
+		{
+			"c5981bae27fd84401c72a155e5707fbb811b2b620645d1028ea270cbe0ee225d" +
+				"4b62aa4dca6506c1acdbecc0552569b4b21436a5692e25d90d3bc2eb7ce24078",
+			"948b40e7181713bc018ec1702d3d054d15746c59a7020730dd13ecf985a010d7",
+		},
+		{
+			"c894ce48bfec433014b931a6ad4226d7dbd8eaa7b6e3faa8d0ef94052bcf8cff" +
+				"336eeb3919e2b4efb746c7f71bbca7e9383230fbbc48ffafe77e8bcc69542471",
+			"f1c91acdc2525330f9b53158434a4d43a1c547cff29f15506f5da4eb4fe8fa5a",
+		},
+		{
+			"cbb0deab125754f1fdb2038b0434ed9cb3fb53ab735391129994a535d925f673" +
+				"0000000000000000000000000000000000000000000000000000000000000000",
+			"872d81ed8831d9998b67cb7105243edbf86c10edfebb786c110b02d07b2e67cd",
+		},
+		{
+			"d917b786dac35670c330c9c5ae5971dfb495c8ae523ed97ee2420117b171f41e" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff2001f6f6",
+			"e45b71e110b831f2bdad8651994526e58393fde4328b1ec04d59897142584691",
+		},
+		{
+			"e28bd8f5929b467eb70e04332374ffb7e7180218ad16eaa46b7161aa679eb426" +
+				"0000000000000000000000000000000000000000000000000000000000000000",
+			"66b8c980a75c72e598d383a35a62879f844242ad1e73ff12edaa59f4e58632b5",
+		},
+		{
+			"e28bd8f5929b467eb70e04332374ffb7e7180218ad16eaa46b7161aa679eb426" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"66b8c980a75c72e598d383a35a62879f844242ad1e73ff12edaa59f4e58632b5",
+		},
+		{
+			"e7ee5814c1706bf8a89396a9b032bc014c2cac9c121127dbf6c99278f8bb53d1" +
+				"dfd04dbcda8e352466b6fcd5f2dea3e17d5e133115886eda20db8a12b54de71b",
+			"e842c6e3529b234270a5e97744edc34a04d7ba94e44b6d2523c9cf0195730a50",
+		},
+		{
+			"f292e46825f9225ad23dc057c1d91c4f57fcb1386f29ef10481cb1d22518593f" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff7011c989",
+			"3cea2c53b8b0170166ac7da67194694adacc84d56389225e330134dab85a4d55",
+		},
+		{
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f" +
+				"01d3475bf7655b0fb2d852921035b2ef607f49069b97454e6795251062741771",
+			"b5da00b73cd6560520e7c364086e7cd23a34bf60d0e707be9fc34d4cd5fdfa2c",
+		},
+		{
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f" +
+				"4218f20ae6c646b363db68605822fb14264ca8d2587fdd6fbc750d587e76a7ee",
+			"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa9fffffd6b",
+		},
+		{
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f" +
+				"82277c4a71f9d22e66ece523f8fa08741a7c0912c66a69ce68514bfd3515b49f",
+			"f482f2e241753ad0fb89150d8491dc1e34ff0b8acfbb442cfe999e2e5e6fd1d2",
+		},
+		{
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f" +
+				"8421cc930e77c9f514b6915c3dbe2a94c6d8f690b5b739864ba6789fb8a55dd0",
+			"9f59c40275f5085a006f05dae77eb98c6fd0db1ab4a72ac47eae90a4fc9e57e0",
+		},
+		{
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f" +
+				"d19c182d2759cd99824228d94799f8c6557c38a1c0d6779b9d4b729c6f1ccc42",
+			"70720db7e238d04121f5b1afd8cc5ad9d18944c6bdc94881f502b7a3af3aecff",
+		},
+		{
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"edd1fd3e327ce90cc7a3542614289aee9682003e9cf7dcc9cf2ca9743be5aa0c",
+		},
+		{
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff2664bbd5",
+			"50873db31badcc71890e4f67753a65757f97aaa7dd5f1e82b753ace32219064b",
+		},
+		{
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff7028de7d",
+			"1eea9cc59cfcf2fa151ac6c274eea4110feb4f7b68c5965732e9992e976ef68e",
+		},
+		{
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f" +
+				"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffcbcfb7e7",
+			"12303941aedc208880735b1f1795c8e55be520ea93e103357b5d2adb7ed59b8e",
+		},
+		{
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffff3113ad9",
+			"7eed6b70e7b0767c7d7feac04e57aa2a12fef5e0f48f878fcbb88b3b6b5e0783",
+		},
+		{
+			"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff13cea4a7" +
+				"0000000000000000000000000000000000000000000000000000000000000000",
+			"649984435b62b4a25d40c6133e8d9ab8c53d4b059ee8a154a3be0fcf4e892edb",
+		},
+		{
+			"ffffffffffffffffffffffffffffffffffffffffffffffffffffffff13cea4a7" +
+				"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+			"649984435b62b4a25d40c6133e8d9ab8c53d4b059ee8a154a3be0fcf4e892edb",
+		},
+	}
+
+	for i, test := range tests {
+		b, err := hex.DecodeString(test.enc)
+		if err != nil {
+			t.Fatalf("#%d: invalid encoding: %v", i, err)
+		}
+		var enc [EllswiftPubKeyLen]byte
+		copy(enc[:], b)
+		pubKey := EllswiftDecode(&enc)
+		got := hex.EncodeToString(paddedAppend(32, nil, pubKey.X.Bytes()))
+		if got != test.x {
+			t.Errorf("EllswiftDecode #%d: got x %s, want %s", i, got,
+				test.x)
+		}
+		if !S256().IsOnCurve(pubKey.X, pubKey.Y) {
+			t.Errorf("EllswiftDecode #%d is not on the curve", i)
+		}
+	}
+}
+
+// TestEllswiftEncodeDecode ensures public keys survive a round trip through
+// the ElligatorSwift encoding and that arbitrary encodings decode to points on
+// the curve.
+func TestEllswiftEncodeDecode(t *testing.T) {
+	for i := 0; i < 32; i++ {
+		privKey, enc, err := NewEllswiftKey()
+		if err != nil {
+			t.Fatalf("NewEllswiftKey: unexpected error %v", err)
+		}
+		pubKey := EllswiftDecode(&enc)
+		if !pubKey.IsEqual(privKey.PubKey()) {
+			t.Fatalf("EllswiftDecode: got %x, want %x",
+				pubKey.SerializeCompressed(),
+				privKey.PubKey().SerializeCompressed())
+		}
+	}
+
+	// Random, all zero and all 0xff encodings must all decode to valid
+	// points.
+	var encs [][EllswiftPubKeyLen]byte
+	for i := 0; i < 32; i++ {
+		var enc [EllswiftPubKeyLen]byte
+		if _, err := rand.Read(enc[:]); err != nil {
+			t.Fatalf("unable to read random bytes: %v", err)
+		}
+		encs = append(encs, enc)
+	}
+	var zero, ones [EllswiftPubKeyLen]byte
+	for i := range ones {
+		ones[i] = 0xff
+	}
+	encs = append(encs, zero, ones)
+
+	// The all zero encoding decodes to a known x coordinate from the
+	// BIP0324 test vectors.
+	wantX := fromHex("EDD1FD3E327CE90CC7A3542614289AEE9682003E9CF7DCC9CF2CA9743BE5AA0C")
+	if x := EllswiftDecode(&zero).X; x.Cmp(wantX) != 0 {
+		t.Fatalf("EllswiftDecode(0): got x %x, want %x", x, wantX)
+	}
+	for _, enc := range encs {
+		pubKey := EllswiftDecode(&enc)
+		if !S256().IsOnCurve(pubKey.X, pubKey.Y) {
+			t.Fatalf("EllswiftDecode(%x) is not on the curve", enc)
+		}
+	}
+}
+
+// TestEllswiftECDHXOnly ensures both parties of an ElligatorSwift key exchange
+// derive the same secret.
+func TestEllswiftECDHXOnly(t *testing.T) {
+	privKey1, enc1, err := NewEllswiftKey()
+	if err != nil {
+		t.Fatalf("NewEllswiftKey: unexpected error %v", err)
+	}
+	privKey2, enc2, err := NewEllswiftKey()
+	if err != nil {
+		t.Fatalf("NewEllswiftKey: unexpected error %v", err)
+	}
+
+	secret1 := EllswiftECDHXOnly(privKey1, &enc2)
+	secret2 := EllswiftECDHXOnly(privKey2, &enc1)
+	if secret1 != secret2 {
+		t.Fatalf("ECDH failed, secrets mismatch - first: %x, second: %x",
+			secret1, secret2)
+	}
+}
@@ -46,6 +46,15 @@ func NewAddNodeCmd(addr string, subCmd AddNodeSubCmd) *AddNodeCmd {
 	}
 }
 
+// ClearBannedCmd defines the clearbanned JSON-RPC command.
+type ClearBannedCmd struct{}
+
+// NewClearBannedCmd returns a new instance which can be used to issue a
+// clearbanned JSON-RPC command.
+func NewClearBannedCmd() *ClearBannedCmd {
+	return &ClearBannedCmd{}
+}
+
 // TransactionInput represents the inputs to a transaction.  Specifically a
 // transaction hash and output number pair.
 type TransactionInput struct {
@@ -100,6 +109,45 @@ func NewDecodeScriptCmd(hexScript string) *DecodeScriptCmd {
 	}
 }
 
+// EstimateSmartFeeMode defines the type used in the estimatesmartfee
+// JSON-RPC command for the estimate mode field.
+type EstimateSmartFeeMode string
+
+const (
+	// EstimateModeUnset indicates the default estimate mode should be
+	// used, which is conservative.
+	EstimateModeUnset EstimateSmartFeeMode = "UNSET"
+
+	// EstimateModeEconomical indicates the estimate should be based on
+	// recent confirmations only, so it responds quickly to drops in fees.
+	EstimateModeEconomical EstimateSmartFeeMode = "ECONOMICAL"
+
+	// EstimateModeConservative indicates the estimate should also be
+	// based on confirmations over longer periods, so it is less likely to
+	// be too low.
+	EstimateModeConservative EstimateSmartFeeMode = "CONSERVATIVE"
+)
+
+// EstimateSmartFeeCmd defines the estimatesmartfee JSON-RPC command.
+type EstimateSmartFeeCmd struct {
+	ConfTarget   int64
+	EstimateMode *EstimateSmartFeeMode `jsonrpcdefault:"\"CONSERVATIVE\""`
+}
+
+// NewEstimateSmartFeeCmd returns a new instance which can be used to issue an
+// estimatesmartfee JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewEstimateSmartFeeCmd(confTarget int64,
+	mode *EstimateSmartFeeMode) *EstimateSmartFeeCmd {
+
+	return &EstimateSmartFeeCmd{
+		ConfTarget:   confTarget,
+		EstimateMode: mode,
+	}
+}
+
 // GetAddedNodeInfoCmd defines the getaddednodeinfo JSON-RPC command.
 type GetAddedNodeInfoCmd struct {
 	DNS  bool
@@ -366,6 +414,42 @@ func NewGetInfoCmd() *GetInfoCmd {
 	return &GetInfoCmd{}
 }
 
+// GetMempoolAncestorsCmd defines the getmempoolancestors JSON-RPC command.
+type GetMempoolAncestorsCmd struct {
+	TxID    string
+	Verbose *bool `jsonrpcdefault:"false"`
+}
+
+// NewGetMempoolAncestorsCmd returns a new instance which can be used to issue
+// a getmempoolancestors JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetMempoolAncestorsCmd(txHash string, verbose *bool) *GetMempoolAncestorsCmd {
+	return &GetMempoolAncestorsCmd{
+		TxID:    txHash,
+		Verbose: verbose,
+	}
+}
+
+// GetMempoolDescendantsCmd defines the getmempooldescendants JSON-RPC command.
+type GetMempoolDescendantsCmd struct {
+	TxID    string
+	Verbose *bool `jsonrpcdefault:"false"`
+}
+
+// NewGetMempoolDescendantsCmd returns a new instance which can be used to
+// issue a getmempooldescendants JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetMempoolDescendantsCmd(txHash string, verbose *bool) *GetMempoolDescendantsCmd {
+	return &GetMempoolDescendantsCmd{
+		TxID:    txHash,
+		Verbose: verbose,
+	}
+}
+
 // GetMempoolEntryCmd defines the getmempoolentry JSON-RPC command.
 type GetMempoolEntryCmd struct {
 	TxID string
@@ -571,6 +655,15 @@ func NewInvalidateBlockCmd(blockHash string) *InvalidateBlockCmd {
 	}
 }
 
+// ListBannedCmd defines the listbanned JSON-RPC command.
+type ListBannedCmd struct{}
+
+// NewListBannedCmd returns a new instance which can be used to issue a
+// listbanned JSON-RPC command.
+func NewListBannedCmd() *ListBannedCmd {
+	return &ListBannedCmd{}
+}
+
 // PingCmd defines the ping JSON-RPC command.
 type PingCmd struct{}
 
@@ -593,6 +686,23 @@ func NewPreciousBlockCmd(blockHash string) *PreciousBlockCmd {
 	}
 }
 
+// PrioritiseTransactionCmd defines the prioritisetransaction JSON-RPC command.
+type PrioritiseTransactionCmd struct {
+	TxID          string
+	PriorityDelta float64
+	FeeDelta      int64
+}
+
+// NewPrioritiseTransactionCmd returns a new instance which can be used to issue
+// a prioritisetransaction JSON-RPC command.
+func NewPrioritiseTransactionCmd(txID string, priorityDelta float64, feeDelta int64) *PrioritiseTransactionCmd {
+	return &PrioritiseTransactionCmd{
+		TxID:          txID,
+		PriorityDelta: priorityDelta,
+		FeeDelta:      feeDelta,
+	}
+}
+
 // ReconsiderBlockCmd defines the reconsiderblock JSON-RPC command.
 type ReconsiderBlockCmd struct {
 	BlockHash string
@@ -606,6 +716,15 @@ func NewReconsiderBlockCmd(blockHash string) *ReconsiderBlockCmd {
 	}
 }
 
+// SaveMempoolCmd defines the savemempool JSON-RPC command.
+type SaveMempoolCmd struct{}
+
+// NewSaveMempoolCmd returns a new instance which can be used to issue a
+// savemempool JSON-RPC command.
+func NewSaveMempoolCmd() *SaveMempoolCmd {
+	return &SaveMempoolCmd{}
+}
+
 // SearchRawTransactionsCmd defines the searchrawtransactions JSON-RPC command.
 type SearchRawTransactionsCmd struct {
 	Address     string
@@ -652,6 +771,42 @@ func NewSendRawTransactionCmd(hexTx string, allowHighFees *bool) *SendRawTransac
 	}
 }
 
+// SetBanSubCmd defines the type used in the setban JSON-RPC command for the
+// sub command field.
+type SetBanSubCmd string
+
+const (
+	// SBAdd indicates the specified subnet should be banned.
+	SBAdd SetBanSubCmd = "add"
+
+	// SBRemove indicates the specified subnet should be unbanned.
+	SBRemove SetBanSubCmd = "remove"
+)
+
+// SetBanCmd defines the setban JSON-RPC command.
+type SetBanCmd struct {
+	Subnet   string
+	SubCmd   SetBanSubCmd `jsonrpcusage:"\"add|remove\""`
+	BanTime  *int64       `jsonrpcdefault:"0"`
+	Absolute *bool        `jsonrpcdefault:"false"`
+}
+
+// NewSetBanCmd returns a new instance which can be used to issue a setban
+// JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewSetBanCmd(subnet string, subCmd SetBanSubCmd, banTime *int64,
+	absolute *bool) *SetBanCmd {
+
+	return &SetBanCmd{
+		Subnet:   subnet,
+		SubCmd:   subCmd,
+		BanTime:  banTime,
+		Absolute: absolute,
+	}
+}
+
 // SetGenerateCmd defines the setgenerate JSON-RPC command.
 type SetGenerateCmd struct {
 	Generate     bool
@@ -704,6 +859,32 @@ func NewSubmitBlockCmd(hexBlock string, options *SubmitBlockOptions) *SubmitBloc
 	}
 }
 
+// SubmitPackageCmd defines the submitpackage JSON-RPC command.
+type SubmitPackageCmd struct {
+	RawTxs []string
+}
+
+// NewSubmitPackageCmd returns a new instance which can be used to issue a
+// submitpackage JSON-RPC command.
+func NewSubmitPackageCmd(rawTxs []string) *SubmitPackageCmd {
+	return &SubmitPackageCmd{
+		RawTxs: rawTxs,
+	}
+}
+
+// TestMempoolAcceptCmd defines the testmempoolaccept JSON-RPC command.
+type TestMempoolAcceptCmd struct {
+	RawTxs []string
+}
+
+// NewTestMempoolAcceptCmd returns a new instance which can be used to issue a
+// testmempoolaccept JSON-RPC command.
+func NewTestMempoolAcceptCmd(rawTxs []string) *TestMempoolAcceptCmd {
+	return &TestMempoolAcceptCmd{
+		RawTxs: rawTxs,
+	}
+}
+
 // UptimeCmd defines the uptime JSON-RPC command.
 type UptimeCmd struct{}
 
@@ -778,9 +959,11 @@ func init() {
 	flags := UsageFlag(0)
 
 	MustRegisterCmd("addnode", (*AddNodeCmd)(nil), flags)
+	MustRegisterCmd("clearbanned", (*ClearBannedCmd)(nil), flags)
 	MustRegisterCmd("createrawtransaction", (*CreateRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decoderawtransaction", (*DecodeRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decodescript", (*DecodeScriptCmd)(nil), flags)
+	MustRegisterCmd("estimatesmartfee", (*EstimateSmartFeeCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
 	MustRegisterCmd("getbestblockhash", (*GetBestBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblock", (*GetBlockCmd)(nil), flags)
@@ -797,6 +980,8 @@ func init() {
 	MustRegisterCmd("getgenerate", (*GetGenerateCmd)(nil), flags)
 	MustRegisterCmd("gethashespersec", (*GetHashesPerSecCmd)(nil), flags)
 	MustRegisterCmd("getinfo", (*GetInfoCmd)(nil), flags)
+	MustRegisterCmd("getmempoolancestors", (*GetMempoolAncestorsCmd)(nil), flags)
+	MustRegisterCmd("getmempooldescendants", (*GetMempoolDescendantsCmd)(nil), flags)
 	MustRegisterCmd("getmempoolentry", (*GetMempoolEntryCmd)(nil), flags)
 	MustRegisterCmd("getmempoolinfo", (*GetMempoolInfoCmd)(nil), flags)
 	MustRegisterCmd("getmininginfo", (*GetMiningInfoCmd)(nil), flags)
@@ -812,14 +997,20 @@ func init() {
 	MustRegisterCmd("getwork", (*GetWorkCmd)(nil), flags)
 	MustRegisterCmd("help", (*HelpCmd)(nil), flags)
 	MustRegisterCmd("invalidateblock", (*InvalidateBlockCmd)(nil), flags)
+	MustRegisterCmd("listbanned", (*ListBannedCmd)(nil), flags)
 	MustRegisterCmd("ping", (*PingCmd)(nil), flags)
 	MustRegisterCmd("preciousblock", (*PreciousBlockCmd)(nil), flags)
+	MustRegisterCmd("prioritisetransaction", (*PrioritiseTransactionCmd)(nil), flags)
 	MustRegisterCmd("reconsiderblock", (*ReconsiderBlockCmd)(nil), flags)
+	MustRegisterCmd("savemempool", (*SaveMempoolCmd)(nil), flags)
 	MustRegisterCmd("searchrawtransactions", (*SearchRawTransactionsCmd)(nil), flags)
 	MustRegisterCmd("sendrawtransaction", (*SendRawTransactionCmd)(nil), flags)
+	MustRegisterCmd("setban", (*SetBanCmd)(nil), flags)
 	MustRegisterCmd("setgenerate", (*SetGenerateCmd)(nil), flags)
 	MustRegisterCmd("stop", (*StopCmd)(nil), flags)
 	MustRegisterCmd("submitblock", (*SubmitBlockCmd)(nil), flags)
+	MustRegisterCmd("submitpackage", (*SubmitPackageCmd)(nil), flags)
+	MustRegisterCmd("testmempoolaccept", (*TestMempoolAcceptCmd)(nil), flags)
 	MustRegisterCmd("uptime", (*UptimeCmd)(nil), flags)
 	MustRegisterCmd("validateaddress", (*ValidateAddressCmd)(nil), flags)
 	MustRegisterCmd("verifychain", (*VerifyChainCmd)(nil), flags)
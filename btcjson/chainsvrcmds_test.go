@@ -22,6 +22,10 @@ import (
 func TestChainSvrCmds(t *testing.T) {
 	t.Parallel()
 
+	estimateModePtr := func(mode btcjson.EstimateSmartFeeMode) *btcjson.EstimateSmartFeeMode {
+		return &mode
+	}
+
 	testID := int(1)
 	tests := []struct {
 		name         string
@@ -41,6 +45,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"addnode","params":["127.0.0.1","remove"],"id":1}`,
 			unmarshalled: &btcjson.AddNodeCmd{Addr: "127.0.0.1", SubCmd: btcjson.ANRemove},
 		},
+		{
+			name: "clearbanned",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("clearbanned")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewClearBannedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"clearbanned","params":[],"id":1}`,
+			unmarshalled: &btcjson.ClearBannedCmd{},
+		},
 		{
 			name: "createrawtransaction",
 			newCmd: func() (interface{}, error) {
@@ -103,6 +118,35 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"decodescript","params":["00"],"id":1}`,
 			unmarshalled: &btcjson.DecodeScriptCmd{HexScript: "00"},
 		},
+		{
+			name: "estimatesmartfee",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("estimatesmartfee", 6)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewEstimateSmartFeeCmd(6, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatesmartfee","params":[6],"id":1}`,
+			unmarshalled: &btcjson.EstimateSmartFeeCmd{
+				ConfTarget:   6,
+				EstimateMode: estimateModePtr(btcjson.EstimateModeConservative),
+			},
+		},
+		{
+			name: "estimatesmartfee optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("estimatesmartfee", 6, btcjson.EstimateModeEconomical)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewEstimateSmartFeeCmd(6,
+					estimateModePtr(btcjson.EstimateModeEconomical))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatesmartfee","params":[6,"ECONOMICAL"],"id":1}`,
+			unmarshalled: &btcjson.EstimateSmartFeeCmd{
+				ConfTarget:   6,
+				EstimateMode: estimateModePtr(btcjson.EstimateModeEconomical),
+			},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -416,6 +460,62 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getinfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetInfoCmd{},
 		},
+		{
+			name: "getmempoolancestors",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempoolancestors", "txhash")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolAncestorsCmd("txhash", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolancestors","params":["txhash"],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolAncestorsCmd{
+				TxID:    "txhash",
+				Verbose: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "getmempoolancestors optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempoolancestors", "txhash", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolAncestorsCmd("txhash", btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolancestors","params":["txhash",true],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolAncestorsCmd{
+				TxID:    "txhash",
+				Verbose: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "getmempooldescendants",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempooldescendants", "txhash")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolDescendantsCmd("txhash", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempooldescendants","params":["txhash"],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolDescendantsCmd{
+				TxID:    "txhash",
+				Verbose: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "getmempooldescendants optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempooldescendants", "txhash", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolDescendantsCmd("txhash", btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempooldescendants","params":["txhash",true],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolDescendantsCmd{
+				TxID:    "txhash",
+				Verbose: btcjson.Bool(true),
+			},
+		},
 		{
 			name: "getmempoolentry",
 			newCmd: func() (interface{}, error) {
@@ -703,6 +803,17 @@ func TestChainSvrCmds(t *testing.T) {
 				Command: btcjson.String("getblock"),
 			},
 		},
+		{
+			name: "listbanned",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listbanned")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListBannedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"listbanned","params":[],"id":1}`,
+			unmarshalled: &btcjson.ListBannedCmd{},
+		},
 		{
 			name: "invalidateblock",
 			newCmd: func() (interface{}, error) {
@@ -740,6 +851,21 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "0123",
 			},
 		},
+		{
+			name: "prioritisetransaction",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("prioritisetransaction", "123", 0.0, int64(10000))
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewPrioritiseTransactionCmd("123", 0, 10000)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"prioritisetransaction","params":["123",0,10000],"id":1}`,
+			unmarshalled: &btcjson.PrioritiseTransactionCmd{
+				TxID:          "123",
+				PriorityDelta: 0,
+				FeeDelta:      10000,
+			},
+		},
 		{
 			name: "reconsiderblock",
 			newCmd: func() (interface{}, error) {
@@ -753,6 +879,17 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "savemempool",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("savemempool")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSaveMempoolCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"savemempool","params":[],"id":1}`,
+			unmarshalled: &btcjson.SaveMempoolCmd{},
+		},
 		{
 			name: "searchrawtransactions",
 			newCmd: func() (interface{}, error) {
@@ -920,6 +1057,39 @@ func TestChainSvrCmds(t *testing.T) {
 				AllowHighFees: btcjson.Bool(false),
 			},
 		},
+		{
+			name: "setban",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setban", "10.0.0.0/8", btcjson.SBAdd)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetBanCmd("10.0.0.0/8", btcjson.SBAdd, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["10.0.0.0/8","add"],"id":1}`,
+			unmarshalled: &btcjson.SetBanCmd{
+				Subnet:   "10.0.0.0/8",
+				SubCmd:   btcjson.SBAdd,
+				BanTime:  btcjson.Int64(0),
+				Absolute: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "setban optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setban", "1.2.3.4", btcjson.SBAdd, 1600000000, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetBanCmd("1.2.3.4", btcjson.SBAdd,
+					btcjson.Int64(1600000000), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["1.2.3.4","add",1600000000,true],"id":1}`,
+			unmarshalled: &btcjson.SetBanCmd{
+				Subnet:   "1.2.3.4",
+				SubCmd:   btcjson.SBAdd,
+				BanTime:  btcjson.Int64(1600000000),
+				Absolute: btcjson.Bool(true),
+			},
+		},
 		{
 			name: "setgenerate",
 			newCmd: func() (interface{}, error) {
@@ -992,6 +1162,32 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "submitpackage",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("submitpackage", []string{"1122", "3344"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSubmitPackageCmd([]string{"1122", "3344"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"submitpackage","params":[["1122","3344"]],"id":1}`,
+			unmarshalled: &btcjson.SubmitPackageCmd{
+				RawTxs: []string{"1122", "3344"},
+			},
+		},
+		{
+			name: "testmempoolaccept",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("testmempoolaccept", []string{"1122"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewTestMempoolAcceptCmd([]string{"1122"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"testmempoolaccept","params":[["1122"]],"id":1}`,
+			unmarshalled: &btcjson.TestMempoolAcceptCmd{
+				RawTxs: []string{"1122"},
+			},
+		},
 		{
 			name: "uptime",
 			newCmd: func() (interface{}, error) {
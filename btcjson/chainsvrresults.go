@@ -63,6 +63,14 @@ type DecodeScriptResult struct {
 	P2sh      string   `json:"p2sh,omitempty"`
 }
 
+// EstimateSmartFeeResult models the data returned from the estimatesmartfee
+// command.
+type EstimateSmartFeeResult struct {
+	FeeRate *float64 `json:"feerate,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+	Blocks  int64    `json:"blocks"`
+}
+
 // GetAddedNodeInfoResultAddr models the data of the addresses portion of the
 // getaddednodeinfo command.
 type GetAddedNodeInfoResultAddr struct {
@@ -176,27 +184,32 @@ type GetBlockTemplateResult struct {
 // GetMempoolEntryResult models the data returned from the getmempoolentry
 // command.
 type GetMempoolEntryResult struct {
-	Size             int32    `json:"size"`
-	Fee              float64  `json:"fee"`
-	ModifiedFee      float64  `json:"modifiedfee"`
-	Time             int64    `json:"time"`
-	Height           int64    `json:"height"`
-	StartingPriority float64  `json:"startingpriority"`
-	CurrentPriority  float64  `json:"currentpriority"`
-	DescendantCount  int64    `json:"descendantcount"`
-	DescendantSize   int64    `json:"descendantsize"`
-	DescendantFees   float64  `json:"descendantfees"`
-	AncestorCount    int64    `json:"ancestorcount"`
-	AncestorSize     int64    `json:"ancestorsize"`
-	AncestorFees     float64  `json:"ancestorfees"`
-	Depends          []string `json:"depends"`
+	Size              int32    `json:"size"`
+	Fee               float64  `json:"fee"`
+	ModifiedFee       float64  `json:"modifiedfee"`
+	Time              int64    `json:"time"`
+	Height            int64    `json:"height"`
+	StartingPriority  float64  `json:"startingpriority"`
+	CurrentPriority   float64  `json:"currentpriority"`
+	DescendantCount   int64    `json:"descendantcount"`
+	DescendantSize    int64    `json:"descendantsize"`
+	DescendantFees    float64  `json:"descendantfees"`
+	AncestorCount     int64    `json:"ancestorcount"`
+	AncestorSize      int64    `json:"ancestorsize"`
+	AncestorFees      float64  `json:"ancestorfees"`
+	Depends           []string `json:"depends"`
+	Vsize             int32    `json:"vsize"`
+	BIP125Replaceable bool     `json:"bip125-replaceable"`
 }
 
 // GetMempoolInfoResult models the data returned from the getmempoolinfo
 // command.
 type GetMempoolInfoResult struct {
-	Size  int64 `json:"size"`
-	Bytes int64 `json:"bytes"`
+	Size          int64   `json:"size"`
+	Bytes         int64   `json:"bytes"`
+	MaxMempool    int64   `json:"maxmempool"`
+	MempoolMinFee float64 `json:"mempoolminfee"`
+	MinRelayTxFee float64 `json:"minrelaytxfee"`
 }
 
 // NetworksResult models the networks data from the getnetworkinfo command.
@@ -257,20 +270,44 @@ type GetPeerInfoResult struct {
 	BanScore       int32   `json:"banscore"`
 	FeeFilter      int64   `json:"feefilter"`
 	SyncNode       bool    `json:"syncnode"`
+	ConnectionType string  `json:"connection_type"`
+	MappedAS       uint32  `json:"mapped_as,omitempty"`
 }
 
+// These constants define the connection types of the peers returned by the
+// getpeerinfo command.
+const (
+	// ConnTypeInbound is the connection type of peers which connected to
+	// us.
+	ConnTypeInbound = "inbound"
+
+	// ConnTypeOutboundFullRelay is the connection type of automatic
+	// outbound peers which relay blocks, transactions and addresses.
+	ConnTypeOutboundFullRelay = "outbound-full-relay"
+
+	// ConnTypeBlockRelayOnly is the connection type of automatic outbound
+	// peers which only relay blocks.
+	ConnTypeBlockRelayOnly = "block-relay-only"
+
+	// ConnTypeManual is the connection type of outbound peers which were
+	// added by the user.
+	ConnTypeManual = "manual"
+)
+
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
 // command when the verbose flag is set.  When the verbose flag is not set,
 // getrawmempool returns an array of transaction hashes.
 type GetRawMempoolVerboseResult struct {
-	Size             int32    `json:"size"`
-	Vsize            int32    `json:"vsize"`
-	Fee              float64  `json:"fee"`
-	Time             int64    `json:"time"`
-	Height           int64    `json:"height"`
-	StartingPriority float64  `json:"startingpriority"`
-	CurrentPriority  float64  `json:"currentpriority"`
-	Depends          []string `json:"depends"`
+	Size              int32    `json:"size"`
+	Vsize             int32    `json:"vsize"`
+	Fee               float64  `json:"fee"`
+	ModifiedFee       float64  `json:"modifiedfee"`
+	Time              int64    `json:"time"`
+	Height            int64    `json:"height"`
+	StartingPriority  float64  `json:"startingpriority"`
+	CurrentPriority   float64  `json:"currentpriority"`
+	Depends           []string `json:"depends"`
+	BIP125Replaceable bool     `json:"bip125-replaceable"`
 }
 
 // ScriptPubKeyResult models the scriptPubKey data of a tx script.  It is
@@ -299,6 +336,16 @@ type GetNetTotalsResult struct {
 	TimeMillis     int64  `json:"timemillis"`
 }
 
+// ListBannedResult models the data returned from the listbanned command.
+type ListBannedResult struct {
+	Address       string `json:"address"`
+	BanCreated    int64  `json:"ban_created"`
+	BannedUntil   int64  `json:"banned_until"`
+	BanDuration   int64  `json:"ban_duration"`
+	TimeRemaining int64  `json:"time_remaining"`
+	BanReason     string `json:"ban_reason"`
+}
+
 // ScriptSig models a signature script.  It is defined separately since it only
 // applies to non-coinbase.  Therefore the field in the Vin structure needs
 // to be a pointer.
@@ -533,6 +580,43 @@ type SearchRawTransactionsResult struct {
 	Blocktime     int64        `json:"blocktime,omitempty"`
 }
 
+// SubmitPackageTxFees models the fees of a transaction in the results of the
+// submitpackage command.
+type SubmitPackageTxFees struct {
+	Base float64 `json:"base"`
+}
+
+// SubmitPackageTxResult models the result for a single transaction of the
+// package submitted with the submitpackage command.
+type SubmitPackageTxResult struct {
+	TxID  string              `json:"txid"`
+	Vsize int32               `json:"vsize"`
+	Fees  SubmitPackageTxFees `json:"fees"`
+}
+
+// SubmitPackageResult models the data returned from the submitpackage command.
+type SubmitPackageResult struct {
+	PackageMsg string                           `json:"package_msg"`
+	TxResults  map[string]SubmitPackageTxResult `json:"tx-results"`
+}
+
+// TestMempoolAcceptFees models the fees of a transaction in the results of the
+// testmempoolaccept command.
+type TestMempoolAcceptFees struct {
+	Base float64 `json:"base"`
+}
+
+// TestMempoolAcceptResult models the data returned from the testmempoolaccept
+// command for each of the tested transactions.
+type TestMempoolAcceptResult struct {
+	TxID         string                 `json:"txid"`
+	WTxID        string                 `json:"wtxid"`
+	Allowed      bool                   `json:"allowed"`
+	Vsize        int32                  `json:"vsize"`
+	Fees         *TestMempoolAcceptFees `json:"fees,omitempty"`
+	RejectReason string                 `json:"reject-reason,omitempty"`
+}
+
 // TxRawDecodeResult models the data from the decoderawtransaction command.
 type TxRawDecodeResult struct {
 	Txid     string `json:"txid"`
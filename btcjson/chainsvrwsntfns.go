@@ -75,6 +75,12 @@ const (
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantTxAcceptedNtfnMethod = "relevanttxaccepted"
+
+	// TxRemovedNtfnMethod is the method used for notifications from the
+	// chain server that a transaction has been removed from the mempool by
+	// the mempool itself, such as when it expired or was evicted from the
+	// full mempool.
+	TxRemovedNtfnMethod = "txremoved"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
@@ -285,6 +291,21 @@ func NewRelevantTxAcceptedNtfn(txHex string) *RelevantTxAcceptedNtfn {
 	return &RelevantTxAcceptedNtfn{Transaction: txHex}
 }
 
+// TxRemovedNtfn defines the txremoved JSON-RPC notification.
+type TxRemovedNtfn struct {
+	TxID   string
+	Reason string
+}
+
+// NewTxRemovedNtfn returns a new instance which can be used to issue a
+// txremoved JSON-RPC notification.
+func NewTxRemovedNtfn(txHash string, reason string) *TxRemovedNtfn {
+	return &TxRemovedNtfn{
+		TxID:   txHash,
+		Reason: reason,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -301,4 +322,5 @@ func init() {
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(TxRemovedNtfnMethod, (*TxRemovedNtfn)(nil), flags)
 }
@@ -225,6 +225,20 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Transaction: "001122",
 			},
 		},
+		{
+			name: "txremoved",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("txremoved", "123", "expiry")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewTxRemovedNtfn("123", "expiry")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txremoved","params":["123","expiry"],"id":null}`,
+			unmarshalled: &btcjson.TxRemovedNtfn{
+				TxID:   "123",
+				Reason: "expiry",
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
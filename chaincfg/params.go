@@ -181,6 +181,20 @@ type Params struct {
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints []Checkpoint
 
+	// AssumeValid is the hash of a block which, along with all of its
+	// ancestors, is assumed to have valid scripts.  The scripts of these
+	// blocks are not validated when they are downloaded on a chain with
+	// enough work built on top of the block.  It is nil when no block is
+	// assumed to be valid.
+	AssumeValid *chainhash.Hash
+
+	// MinimumChainWork is the minimum amount of total work the best chain
+	// is known to have.  Blocks are not downloaded from a header chain
+	// which has less work since it can't possibly be the best chain, and
+	// the chain is not considered current while it has less work.  It is
+	// nil when there is no minimum.
+	MinimumChainWork *big.Int
+
 	// These fields are related to voting on consensus rule changes as
 	// defined by BIP0009.
 	//
@@ -274,6 +288,12 @@ var MainNetParams = Params{
 		{382320, newHashFromStr("00000000000000000a8dc6ed5b133d0eb2fd6af56203e4159789b092defd8ab2")},
 	},
 
+	// Block 506067.
+	AssumeValid: newHashFromStr("0000000000000000005214481d2d96f898e3d5416e43359c145944a909d242e0"),
+
+	// Total work of the chain at block 506067.
+	MinimumChainWork: newBigIntFromHex("f91c579d57cad4bc5278cc"),
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
@@ -441,6 +461,12 @@ var TestNet3Params = Params{
 		{1000007, newHashFromStr("00000000001ccb893d8a1f25b70ad173ce955e5f50124261bbbc50379a612ddf")},
 	},
 
+	// Block 1261130.
+	AssumeValid: newHashFromStr("000000000000056c49030c174179b52a928c870e6e8a822c75973b7970cfbd01"),
+
+	// Total work of the chain at block 1261130.
+	MinimumChainWork: newBigIntFromHex("2830dab7f76dbb7d63"),
+
 	// Consensus rule change deployments.
 	//
 	// The miner confirmation window is defined as:
@@ -693,6 +719,17 @@ func newHashFromStr(hexStr string) *chainhash.Hash {
 	return hash
 }
 
+// newBigIntFromHex converts the passed big-endian hex string into a big.Int.
+// Like newHashFromStr, it panics on an error since it must only be called
+// with hard-coded, and therefore known good, values.
+func newBigIntFromHex(hexStr string) *big.Int {
+	n, ok := new(big.Int).SetString(hexStr, 16)
+	if !ok {
+		panic("invalid hex in source file: " + hexStr)
+	}
+	return n
+}
+
 func init() {
 	// Register all default networks when the package is initialized.
 	mustRegister(&MainNetParams)
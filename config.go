@@ -28,6 +28,7 @@ import (
 	_ "github.com/btcsuite/btcd/database/ffldb"
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/zmtp"
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/go-socks/socks"
 	flags "github.com/jessevdk/go-flags"
@@ -40,6 +41,7 @@ const (
 	defaultLogDirname            = "logs"
 	defaultLogFilename           = "btcd.log"
 	defaultMaxPeers              = 125
+	defaultMaxBlockRelayOnly     = 2
 	defaultBanDuration           = time.Hour * 24
 	defaultBanThreshold          = 100
 	defaultConnectTimeout        = time.Second * 30
@@ -60,6 +62,13 @@ const (
 	defaultGenerate              = false
 	defaultMaxOrphanTransactions = 100
 	defaultMaxOrphanTxSize       = 100000
+	defaultMaxMempool            = mempool.DefaultMaxPoolSize / 1000000
+	defaultMempoolExpiry         = uint(mempool.DefaultExpiryAge / time.Hour)
+	maxMempoolMin                = 5
+	defaultLimitAncestorCount    = mempool.DefaultMaxAncestorCount
+	defaultLimitAncestorSize     = mempool.DefaultMaxAncestorSize / 1000
+	defaultLimitDescendantCount  = mempool.DefaultMaxDescendantCount
+	defaultLimitDescendantSize   = mempool.DefaultMaxDescendantSize / 1000
 	defaultSigCacheMaxSize       = 100000
 	sampleConfigFilename         = "sample-btcd.conf"
 	defaultTxIndex               = false
@@ -102,10 +111,12 @@ type config struct {
 	DisableListen        bool          `long:"nolisten" description:"Disable listening for incoming connections -- NOTE: Listening is automatically disabled if the --connect or --proxy options are used without also specifying listen interfaces via --listen"`
 	Listeners            []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8333, testnet: 18333)"`
 	MaxPeers             int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
+	MaxBlockRelayOnly    int           `long:"maxblockrelayonly" description:"Max number of outbound block relay only peers to connect to in addition to the other outbound peers"`
 	DisableBanning       bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
 	Whitelists           []string      `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
+	ASMap                string        `long:"asmap" description:"Group peers by the autonomous system which announces them using the ASN map in this file, in the format used by Bitcoin Core.  Relative paths are relative to the data directory"`
 	RPCUser              string        `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 	RPCPass              string        `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCLimitUser         string        `long:"rpclimituser" description:"Username for limited RPC connections"`
@@ -117,8 +128,14 @@ type config struct {
 	RPCMaxWebsockets     int           `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
 	RPCMaxConcurrentReqs int           `long:"rpcmaxconcurrentreqs" description:"Max number of concurrent RPC requests that may be processed concurrently"`
 	RPCQuirks            bool          `long:"rpcquirks" description:"Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
+	REST                 bool          `long:"rest" description:"Serve the unauthenticated REST interface on the RPC listeners"`
 	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
 	DisableTLS           bool          `long:"notls" description:"Disable TLS for the RPC server -- NOTE: This is only allowed if the RPC server is bound to localhost"`
+	ZMQPubHashBlock      []string      `long:"zmqpubhashblock" description:"Publish the hash of every new block on the given ZMQ endpoint (eg. tcp://127.0.0.1:28332)"`
+	ZMQPubHashTx         []string      `long:"zmqpubhashtx" description:"Publish the hash of every new transaction on the given ZMQ endpoint"`
+	ZMQPubRawBlock       []string      `long:"zmqpubrawblock" description:"Publish every new block on the given ZMQ endpoint"`
+	ZMQPubRawTx          []string      `long:"zmqpubrawtx" description:"Publish every new transaction on the given ZMQ endpoint"`
+	ZMQPubSequence       []string      `long:"zmqpubsequence" description:"Publish block connections and disconnections and mempool additions and removals on the given ZMQ endpoint"`
 	DisableDNSSeed       bool          `long:"nodnsseed" description:"Disable DNS seeding for peers"`
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
 	Proxy                string        `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
@@ -128,12 +145,15 @@ type config struct {
 	OnionProxyUser       string        `long:"onionuser" description:"Username for onion proxy server"`
 	OnionProxyPass       string        `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
 	NoOnion              bool          `long:"noonion" description:"Disable connecting to tor hidden services"`
+	I2PProxy             string        `long:"i2pproxy" description:"Connect to I2P destinations via SOCKS5 proxy (eg. 127.0.0.1:4447)"`
+	CJDNSReachable       bool          `long:"cjdnsreachable" description:"Treat fc00::/8 addresses as CJDNS addresses -- Only set this if the node is connected to the CJDNS network"`
 	TorIsolation         bool          `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
 	TestNet3             bool          `long:"testnet" description:"Use the test network"`
 	RegressionTest       bool          `long:"regtest" description:"Use the regression test network"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation test network"`
 	AddCheckpoints       []string      `long:"addcheckpoint" description:"Add a custom checkpoint.  Format: '<height>:<hash>'"`
 	DisableCheckpoints   bool          `long:"nocheckpoints" description:"Disable built-in checkpoints.  Don't do this unless you know what you're doing."`
+	AssumeValid          string        `long:"assumevalid" description:"Skip script validation of the ancestors of this block once enough work is built on top of it.  Defaults to the block of the active network.  Use 0 to validate the scripts of all blocks."`
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
@@ -144,6 +164,13 @@ type config struct {
 	NoRelayPriority      bool          `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
 	TrickleInterval      time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MaxMempool           uint          `long:"maxmempool" description:"Max size in megabytes of the transactions in the memory pool -- The transactions with the lowest fee rates are evicted when it is exceeded"`
+	MempoolExpiry        uint          `long:"mempoolexpiry" description:"Remove transactions which have not been mined for this number of hours from the memory pool -- 0 to keep them until they are mined"`
+	MempoolFullRBF       bool          `long:"mempoolfullrbf" description:"Accept transactions replacing conflicting transactions in the memory pool which do not signal BIP125 replaceability"`
+	LimitAncestorCount   uint          `long:"limitancestorcount" description:"Do not accept transactions into the memory pool which have more than this number of unconfirmed ancestors including themselves -- 0 for no limit"`
+	LimitAncestorSize    uint          `long:"limitancestorsize" description:"Do not accept transactions into the memory pool whose unconfirmed ancestors including themselves exceed this virtual size in kilobytes -- 0 for no limit"`
+	LimitDescendantCount uint          `long:"limitdescendantcount" description:"Do not accept transactions into the memory pool which would give an unconfirmed ancestor more than this number of descendants including itself -- 0 for no limit"`
+	LimitDescendantSize  uint          `long:"limitdescendantsize" description:"Do not accept transactions into the memory pool which would give an unconfirmed ancestor descendants exceeding this virtual size in kilobytes including itself -- 0 for no limit"`
 	Generate             bool          `long:"generate" description:"Generate (mine) bitcoins using the CPU"`
 	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
 	BlockMinSize         uint32        `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
@@ -154,6 +181,8 @@ type config struct {
 	UserAgentComments    []string      `long:"uacomment" description:"Comment to add to the user agent -- See BIP 14 for more information."`
 	NoPeerBloomFilters   bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
 	NoCFilters           bool          `long:"nocfilters" description:"Disable committed filtering (CF) support"`
+	NoV2Transport        bool          `long:"nov2transport" description:"Disable the encrypted v2 peer transport (BIP0324)"`
+	RequireV2Transport   bool          `long:"requirev2transport" description:"Only make outbound connections using the encrypted v2 peer transport (BIP0324) without falling back to the unencrypted v1 transport"`
 	DropCfIndex          bool          `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
 	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
@@ -165,8 +194,10 @@ type config struct {
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
 	lookup               func(string) ([]net.IP, error)
 	oniondial            func(string, string, time.Duration) (net.Conn, error)
+	i2pdial              func(string, string, time.Duration) (net.Conn, error)
 	dial                 func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
+	assumeValid          *chainhash.Hash
 	miningAddrs          []btcutil.Address
 	minRelayTxFee        btcutil.Amount
 	whitelists           []*net.IPNet
@@ -406,6 +437,7 @@ func loadConfig() (*config, []string, error) {
 		ConfigFile:           defaultConfigFile,
 		DebugLevel:           defaultLogLevel,
 		MaxPeers:             defaultMaxPeers,
+		MaxBlockRelayOnly:    defaultMaxBlockRelayOnly,
 		BanDuration:          defaultBanDuration,
 		BanThreshold:         defaultBanThreshold,
 		RPCMaxClients:        defaultMaxRPCClients,
@@ -425,6 +457,12 @@ func loadConfig() (*config, []string, error) {
 		BlockMaxWeight:       defaultBlockMaxWeight,
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
+		MaxMempool:           defaultMaxMempool,
+		MempoolExpiry:        defaultMempoolExpiry,
+		LimitAncestorCount:   defaultLimitAncestorCount,
+		LimitAncestorSize:    defaultLimitAncestorSize,
+		LimitDescendantCount: defaultLimitDescendantCount,
+		LimitDescendantSize:  defaultLimitDescendantSize,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
 		Generate:             defaultGenerate,
 		TxIndex:              defaultTxIndex,
@@ -584,6 +622,14 @@ func loadConfig() (*config, []string, error) {
 	cfg.DataDir = cleanAndExpandPath(cfg.DataDir)
 	cfg.DataDir = filepath.Join(cfg.DataDir, netName(activeNetParams))
 
+	// Relative ASN map paths are relative to the data directory.
+	if cfg.ASMap != "" {
+		cfg.ASMap = cleanAndExpandPath(cfg.ASMap)
+		if !filepath.IsAbs(cfg.ASMap) {
+			cfg.ASMap = filepath.Join(cfg.DataDir, cfg.ASMap)
+		}
+	}
+
 	// Append the network type to the log directory so it is "namespaced"
 	// per network in the same fashion as the data directory.
 	cfg.LogDir = cleanAndExpandPath(cfg.LogDir)
@@ -720,8 +766,21 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
-	// The RPC server is disabled if no username or password is provided.
-	if (cfg.RPCUser == "" || cfg.RPCPass == "") &&
+	// The REST interface is served by the RPC server.
+	if cfg.REST && cfg.DisableRPC {
+		str := "%s: the --rest and --norpc options can't be used " +
+			"together -- the REST interface is served by the RPC " +
+			"server"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The RPC server is disabled if no username or password is provided
+	// unless it is needed to serve the REST interface.  JSON-RPC requests
+	// are rejected in that case since none can be authenticated.
+	if !cfg.REST && (cfg.RPCUser == "" || cfg.RPCPass == "") &&
 		(cfg.RPCLimitUser == "" || cfg.RPCLimitPass == "") {
 		cfg.DisableRPC = true
 	}
@@ -752,6 +811,21 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the ZMQ endpoints.
+	zmqEndpoints := [][]string{cfg.ZMQPubHashBlock, cfg.ZMQPubHashTx,
+		cfg.ZMQPubRawBlock, cfg.ZMQPubRawTx, cfg.ZMQPubSequence}
+	for _, endpoints := range zmqEndpoints {
+		for _, endpoint := range endpoints {
+			if _, _, err := zmtp.ParseEndpoint(endpoint); err != nil {
+				str := "%s: invalid ZMQ endpoint: %v"
+				err := fmt.Errorf(str, funcName, err)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+		}
+	}
+
 	// Validate the the minrelaytxfee.
 	cfg.minRelayTxFee, err = btcutil.NewAmount(cfg.MinRelayTxFee)
 	if err != nil {
@@ -789,6 +863,15 @@ func loadConfig() (*config, []string, error) {
 	}
 
 	// Limit the max orphan count to a sane vlue.
+	if cfg.MaxBlockRelayOnly < 0 {
+		str := "%s: The maxblockrelayonly option may not be less " +
+			"than 0 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxBlockRelayOnly)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	if cfg.MaxOrphanTxs < 0 {
 		str := "%s: The maxorphantx option may not be less than 0 " +
 			"-- parsed [%d]"
@@ -798,6 +881,16 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Limit the max mempool size to a sane value.
+	if cfg.MaxMempool < maxMempoolMin {
+		str := "%s: The maxmempool option may not be less than %d " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, maxMempoolMin, cfg.MaxMempool)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
 	cfg.BlockMinSize = minUint32(cfg.BlockMinSize, cfg.BlockMaxSize)
@@ -952,6 +1045,16 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --nov2transport and --requirev2transport do not mix.
+	if cfg.NoV2Transport && cfg.RequireV2Transport {
+		err := fmt.Errorf("%s: the --nov2transport and "+
+			"--requirev2transport options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check the checkpoints for syntax errors.
 	cfg.addCheckpoints, err = parseCheckpoints(cfg.AddCheckpoints)
 	if err != nil {
@@ -962,6 +1065,22 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Check the assumed valid block hash for syntax errors.  It defaults to
+	// the one of the active network while 0 disables it.
+	cfg.assumeValid = activeNetParams.AssumeValid
+	if cfg.AssumeValid == "0" {
+		cfg.assumeValid = nil
+	} else if cfg.AssumeValid != "" {
+		cfg.assumeValid, err = chainhash.NewHashFromStr(cfg.AssumeValid)
+		if err != nil {
+			str := "%s: Error parsing assumevalid block hash: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
@@ -1076,6 +1195,29 @@ func loadConfig() (*config, []string, error) {
 		}
 	}
 
+	// Setup I2P address dial function.  I2P destinations can only be
+	// reached through an I2P router, so connecting to them results in an
+	// error unless a proxy for them is specified.
+	if cfg.I2PProxy != "" {
+		_, _, err := net.SplitHostPort(cfg.I2PProxy)
+		if err != nil {
+			str := "%s: I2P proxy address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, cfg.I2PProxy, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+
+		cfg.i2pdial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+			proxy := &socks.Proxy{Addr: cfg.I2PProxy}
+			return proxy.DialTimeout(network, addr, timeout)
+		}
+	} else {
+		cfg.i2pdial = func(a, b string, t time.Duration) (net.Conn, error) {
+			return nil, errors.New("i2p has not been configured")
+		}
+	}
+
 	// Warn about missing config file only after all other configuration is
 	// done.  This prevents the warning on help messages and invalid
 	// options.  Note this should go directly before the return.
@@ -1157,12 +1299,17 @@ func createDefaultConfigFile(destinationPath string) error {
 // dial function depending on the address and configuration options.  For
 // example, .onion addresses will be dialed using the onion specific proxy if
 // one was specified, but will otherwise use the normal dial function (which
-// could itself use a proxy or not).
+// could itself use a proxy or not).  I2P addresses are always dialed using the
+// I2P specific proxy.
 func btcdDial(addr net.Addr) (net.Conn, error) {
 	if strings.Contains(addr.String(), ".onion:") {
 		return cfg.oniondial(addr.Network(), addr.String(),
 			defaultConnectTimeout)
 	}
+	if strings.Contains(addr.String(), ".b32.i2p:") {
+		return cfg.i2pdial(addr.Network(), addr.String(),
+			defaultConnectTimeout)
+	}
 	return cfg.dial(addr.Network(), addr.String(), defaultConnectTimeout)
 }
 
@@ -1171,12 +1318,16 @@ func btcdDial(addr net.Addr) (net.Conn, error) {
 // be resolved using tor when the --proxy flag was specified unless --noonion
 // was also specified in which case the normal system DNS resolver will be used.
 //
-// Any attempt to resolve a tor address (.onion) will return an error since they
-// are not intended to be resolved outside of the tor proxy.
+// Any attempt to resolve a tor address (.onion) or an I2P address (.b32.i2p)
+// will return an error since they are not intended to be resolved outside of
+// their proxies.
 func btcdLookup(host string) ([]net.IP, error) {
 	if strings.HasSuffix(host, ".onion") {
 		return nil, fmt.Errorf("attempt to resolve tor address %s", host)
 	}
+	if strings.HasSuffix(host, ".b32.i2p") {
+		return nil, fmt.Errorf("attempt to resolve i2p address %s", host)
+	}
 
 	return cfg.lookup(host)
 }
@@ -35,6 +35,10 @@ var (
 	// defaultTargetOutbound is the default number of outbound connections to
 	// maintain.
 	defaultTargetOutbound = uint32(8)
+
+	// defaultFeelerInterval is the default duration between feeler
+	// connections.
+	defaultFeelerInterval = time.Minute * 2
 )
 
 // ConnState represents the state of the requested connection.
@@ -53,13 +57,22 @@ const (
 )
 
 // ConnReq is the connection request to a network address. If permanent, the
-// connection will be retried on disconnection.
+// connection will be retried on disconnection.  Block relay only connections
+// are maintained separately from the other outbound connections and are
+// expected to only be used for relaying blocks.  Feeler connections are
+// short-lived connections which are only used to test whether an address
+// works, so they are never retried and don't count toward any target.  Manual
+// connections are the ones requested by the user rather than made to reach
+// the outbound targets.
 type ConnReq struct {
 	// The following variables must only be used atomically.
 	id uint64
 
-	Addr      net.Addr
-	Permanent bool
+	Addr           net.Addr
+	Permanent      bool
+	BlockRelayOnly bool
+	Feeler         bool
+	Manual         bool
 
 	conn       net.Conn
 	state      ConnState
@@ -124,6 +137,11 @@ type Config struct {
 	// maintain. Defaults to 8.
 	TargetOutbound uint32
 
+	// TargetBlockRelayOnly is the number of block relay only outbound
+	// network connections to maintain in addition to TargetOutbound.
+	// Defaults to 0.
+	TargetBlockRelayOnly uint32
+
 	// RetryDuration is the duration to wait before retrying connection
 	// requests. Defaults to 5s.
 	RetryDuration time.Duration
@@ -140,6 +158,14 @@ type Config struct {
 	// to.  If nil, no new connections will be made automatically.
 	GetNewAddress func() (net.Addr, error)
 
+	// GetFeelerAddress is a way to get an address to test with a feeler
+	// connection.  If nil, no feeler connections will be made.
+	GetFeelerAddress func() (net.Addr, error)
+
+	// FeelerInterval is the duration between feeler connections.
+	// Defaults to 2 minutes.
+	FeelerInterval time.Duration
+
 	// Dial connects to the address on the named network. It cannot be nil.
 	Dial func(net.Addr) (net.Conn, error)
 }
@@ -194,6 +220,9 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
 	}
+	if c.Feeler {
+		return
+	}
 	if c.Permanent {
 		c.retryCount++
 		d := time.Duration(c.retryCount) * cm.cfg.RetryDuration
@@ -211,10 +240,10 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 				"-- retrying connection in: %v", maxFailedAttempts,
 				cm.cfg.RetryDuration)
 			time.AfterFunc(cm.cfg.RetryDuration, func() {
-				cm.NewConnReq()
+				cm.newConnReq(c.BlockRelayOnly)
 			})
 		} else {
-			go cm.NewConnReq()
+			go cm.newConnReq(c.BlockRelayOnly)
 		}
 	}
 }
@@ -309,21 +338,34 @@ out:
 				}
 
 				// All internal state has been cleaned up, if
-				// this connection is being removed, we will
-				// make no further attempts with this request.
-				if !msg.retry {
+				// this connection is being removed or is a
+				// feeler, we will make no further attempts with
+				// this request.
+				if !msg.retry || connReq.Feeler {
 					connReq.updateState(ConnDisconnected)
 					continue
 				}
 
 				// Otherwise, we will attempt a reconnection if
-				// we do not have enough peers, or if this is a
-				// persistent peer. The connection request is
-				// re added to the pending map, so that
-				// subsequent processing of connections and
-				// failures do not ignore the request.
-				if uint32(len(conns)) < cm.cfg.TargetOutbound ||
-					connReq.Permanent {
+				// we do not have enough peers of the same kind,
+				// or if this is a persistent peer. The
+				// connection request is re added to the pending
+				// map, so that subsequent processing of
+				// connections and failures do not ignore the
+				// request.
+				var numConns uint32
+				for _, c := range conns {
+					if !c.Feeler &&
+						c.BlockRelayOnly == connReq.BlockRelayOnly {
+
+						numConns++
+					}
+				}
+				target := cm.cfg.TargetOutbound
+				if connReq.BlockRelayOnly {
+					target = cm.cfg.TargetBlockRelayOnly
+				}
+				if numConns < target || connReq.Permanent {
 
 					connReq.updateState(ConnPending)
 					log.Debugf("Reconnecting to %v",
@@ -344,6 +386,10 @@ out:
 				connReq.updateState(ConnFailing)
 				log.Debugf("Failed to connect to %v: %v",
 					connReq, msg.err)
+				if connReq.Feeler {
+					delete(pending, connReq.id)
+					continue
+				}
 				cm.handleFailedConn(connReq)
 			}
 
@@ -359,6 +405,12 @@ out:
 // NewConnReq creates a new connection request and connects to the
 // corresponding address.
 func (cm *ConnManager) NewConnReq() {
+	cm.newConnReq(false)
+}
+
+// newConnReq creates a new connection request, which is block relay only as
+// specified, and connects to the corresponding address.
+func (cm *ConnManager) newConnReq(blockRelayOnly bool) {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
 	}
@@ -366,7 +418,7 @@ func (cm *ConnManager) NewConnReq() {
 		return
 	}
 
-	c := &ConnReq{}
+	c := &ConnReq{BlockRelayOnly: blockRelayOnly}
 	atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
 
 	// Submit a request of a pending connection attempt to the connection
@@ -478,6 +530,32 @@ func (cm *ConnManager) Remove(id uint64) {
 	}
 }
 
+// feelerHandler periodically makes a feeler connection to an address provided
+// by GetFeelerAddress.  It must be run as a goroutine.
+func (cm *ConnManager) feelerHandler() {
+	ticker := time.NewTicker(cm.cfg.FeelerInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			addr, err := cm.cfg.GetFeelerAddress()
+			if err != nil {
+				log.Debugf("No feeler address: %v", err)
+				continue
+			}
+			go cm.Connect(&ConnReq{Addr: addr, Feeler: true})
+
+		case <-cm.quit:
+			break out
+		}
+	}
+
+	cm.wg.Done()
+	log.Trace("Feeler handler done")
+}
+
 // listenHandler accepts incoming connections on a given listener.  It must be
 // run as a goroutine.
 func (cm *ConnManager) listenHandler(listener net.Listener) {
@@ -521,6 +599,14 @@ func (cm *ConnManager) Start() {
 	for i := atomic.LoadUint64(&cm.connReqCount); i < uint64(cm.cfg.TargetOutbound); i++ {
 		go cm.NewConnReq()
 	}
+	for i := uint32(0); i < cm.cfg.TargetBlockRelayOnly; i++ {
+		go cm.newConnReq(true)
+	}
+
+	if cm.cfg.GetFeelerAddress != nil {
+		cm.wg.Add(1)
+		go cm.feelerHandler()
+	}
 }
 
 // Wait blocks until the connection manager halts gracefully.
@@ -560,6 +646,9 @@ func New(cfg *Config) (*ConnManager, error) {
 	if cfg.TargetOutbound == 0 {
 		cfg.TargetOutbound = defaultTargetOutbound
 	}
+	if cfg.FeelerInterval <= 0 {
+		cfg.FeelerInterval = defaultFeelerInterval
+	}
 	cm := ConnManager{
 		cfg:      *cfg, // Copy so caller can't mutate
 		requests: make(chan interface{}),
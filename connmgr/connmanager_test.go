@@ -216,6 +216,127 @@ func TestTargetOutbound(t *testing.T) {
 	cmgr.Stop()
 }
 
+// TestTargetBlockRelayOnly tests the target number of block relay only
+// outbound connections is maintained in addition to the target number of other
+// outbound connections, including after a block relay only connection is
+// disconnected.
+func TestTargetBlockRelayOnly(t *testing.T) {
+	targetOutbound := uint32(3)
+	targetBlockRelayOnly := uint32(2)
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound:       targetOutbound,
+		TargetBlockRelayOnly: targetBlockRelayOnly,
+		RetryDuration:        time.Millisecond,
+		Dial:                 mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	var blockRelayOnly []*ConnReq
+	for i := uint32(0); i < targetOutbound+targetBlockRelayOnly; i++ {
+		c := <-connected
+		if c.BlockRelayOnly {
+			blockRelayOnly = append(blockRelayOnly, c)
+		}
+	}
+	if uint32(len(blockRelayOnly)) != targetBlockRelayOnly {
+		t.Fatalf("target block relay only: got %d connections, want %d",
+			len(blockRelayOnly), targetBlockRelayOnly)
+	}
+
+	// A disconnected block relay only connection must be replaced by a new
+	// block relay only connection.
+	cmgr.Disconnect(blockRelayOnly[0].ID())
+	select {
+	case c := <-connected:
+		if !c.BlockRelayOnly {
+			t.Fatalf("target block relay only: got connection %v "+
+				"which is not block relay only", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("target block relay only: connection was not replaced")
+	}
+
+	select {
+	case c := <-connected:
+		t.Fatalf("target block relay only: got unexpected connection - %v",
+			c.Addr)
+	case <-time.After(time.Millisecond):
+		break
+	}
+	cmgr.Stop()
+}
+
+// TestFeelerConnections tests feeler connections are made periodically to the
+// addresses provided by GetFeelerAddress and that they are not retried once
+// they are disconnected.
+func TestFeelerConnections(t *testing.T) {
+	connected := make(chan *ConnReq)
+	disconnected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		FeelerInterval: time.Millisecond * 10,
+		RetryDuration:  time.Millisecond,
+		Dial:           mockDialer,
+		GetFeelerAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+		OnDisconnection: func(c *ConnReq) {
+			disconnected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+
+	var c *ConnReq
+	select {
+	case c = <-connected:
+	case <-time.After(time.Second):
+		t.Fatal("feeler connection: no connection was made")
+	}
+	if !c.Feeler {
+		t.Fatalf("feeler connection: got connection %v which is not a "+
+			"feeler", c)
+	}
+
+	// A disconnected feeler connection must not be retried.
+	cmgr.Disconnect(c.ID())
+	timeout := time.After(time.Millisecond * 100)
+	for {
+		select {
+		case <-disconnected:
+			continue
+		case gotConnected := <-connected:
+			if gotConnected.ID() == c.ID() {
+				t.Fatalf("feeler connection: %v was retried",
+					gotConnected)
+			}
+			continue
+		case <-timeout:
+		}
+		break
+	}
+	cmgr.Stop()
+}
+
 // TestRetryPermanent tests that permanent connection requests are retried.
 //
 // We make a permanent connection request using Connect, disconnect it using
@@ -34,6 +34,9 @@ Application Options:
       --listen=             Add an interface/port to listen for connections
                             (default all interfaces port: 8333, testnet: 18333)
       --maxpeers=           Max number of inbound and outbound peers (125)
+      --maxblockrelayonly=  Max number of outbound block relay only peers to
+                            connect to in addition to the other outbound peers
+                            (2)
       --nobanning           Disable banning of misbehaving peers
       --banduration=        How long to ban misbehaving peers.  Valid time units
                             are {s, m, h}.  Minimum 1 second (24h0m0s)
@@ -41,6 +44,10 @@ Application Options:
                             banning misbehaving peers.
       --whitelist=          Add an IP network or IP that will not be banned.
                             (eg. 192.168.1.0/24 or ::1)
+      --asmap=              Group peers by the autonomous system which
+                            announces them using the ASN map in this file, in
+                            the format used by Bitcoin Core.  Relative paths
+                            are relative to the data directory
   -u, --rpcuser=            Username for RPC connections
   -P, --rpcpass=            Password for RPC connections
       --rpclimituser=       Username for limited RPC connections
@@ -55,11 +62,23 @@ Application Options:
       --rpcquirks           Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE:
                             Discouraged unless interoperability issues need to
                             be worked around
+      --rest                Serve the unauthenticated REST interface on the RPC
+                            listeners
       --norpc               Disable built-in RPC server -- NOTE: The RPC server
                             is disabled by default if no rpcuser/rpcpass or
                             rpclimituser/rpclimitpass is specified
       --notls               Disable TLS for the RPC server -- NOTE: This is only
                             allowed if the RPC server is bound to localhost
+      --zmqpubhashblock=    Publish the hash of every new block on the given ZMQ
+                            endpoint (eg. tcp://127.0.0.1:28332)
+      --zmqpubhashtx=       Publish the hash of every new transaction on the
+                            given ZMQ endpoint
+      --zmqpubrawblock=     Publish every new block on the given ZMQ endpoint
+      --zmqpubrawtx=        Publish every new transaction on the given ZMQ
+                            endpoint
+      --zmqpubsequence=     Publish block connections and disconnections and
+                            mempool additions and removals on the given ZMQ
+                            endpoint
       --nodnsseed           Disable DNS seeding for peers
       --externalip=         Add an ip to the list of local addresses we claim to
                             listen on to peers
@@ -71,6 +90,11 @@ Application Options:
       --onionuser=          Username for onion proxy server
       --onionpass=          Password for onion proxy server
       --noonion             Disable connecting to tor hidden services
+      --i2pproxy=           Connect to I2P destinations via SOCKS5 proxy
+                            (eg. 127.0.0.1:4447)
+      --cjdnsreachable      Treat fc00::/8 addresses as CJDNS addresses -- Only
+                            set this if the node is connected to the CJDNS
+                            network
       --torisolation        Enable Tor stream isolation by randomizing user
                             credentials for each connection.
       --testnet             Use the test network
@@ -79,6 +103,10 @@ Application Options:
       --addcheckpoint=      Add a custom checkpoint.  Format: '<height>:<hash>'
       --nocheckpoints       Disable built-in checkpoints.  Don't do this unless
                             you know what you're doing.
+      --assumevalid=        Skip script validation of the ancestors of this
+                            block once enough work is built on top of it.
+                            Defaults to the block of the active network.  Use 0
+                            to validate the scripts of all blocks.
       --uacomment=          Comment to add to the user agent --
                             See BIP 14 for more information.
       --dbtype=             Database backend to use for the Block Chain (ffldb)
@@ -100,6 +128,31 @@ Application Options:
                             high priority for relaying
       --maxorphantx=        Max number of orphan transactions to keep in memory
                             (100)
+      --maxmempool=         Max size in megabytes of the transactions in the
+                            memory pool -- The transactions with the lowest fee
+                            rates are evicted when it is exceeded (300)
+      --mempoolexpiry=      Remove transactions which have not been mined for
+                            this number of hours from the memory pool -- 0 to
+                            keep them until they are mined (336)
+      --mempoolfullrbf      Accept transactions replacing conflicting
+                            transactions in the memory pool which do not signal
+                            BIP125 replaceability
+      --limitancestorcount= Do not accept transactions into the memory pool
+                            which have more than this number of unconfirmed
+                            ancestors including themselves -- 0 for no limit
+                            (25)
+      --limitancestorsize=  Do not accept transactions into the memory pool
+                            whose unconfirmed ancestors including themselves
+                            exceed this virtual size in kilobytes -- 0 for no
+                            limit (101)
+      --limitdescendantcount= Do not accept transactions into the memory pool
+                            which would give an unconfirmed ancestor more than
+                            this number of descendants including itself -- 0
+                            for no limit (25)
+      --limitdescendantsize= Do not accept transactions into the memory pool
+                            which would give an unconfirmed ancestor
+                            descendants exceeding this virtual size in
+                            kilobytes including itself -- 0 for no limit (101)
       --generate            Generate (mine) bitcoins using the CPU
       --miningaddr=         Add the specified payment address to the list of
                             addresses to use for generated blocks -- At least
@@ -113,6 +166,10 @@ Application Options:
                             when creating a block (50000)
       --nopeerbloomfilters  Disable bloom filtering support.
       --nocfilters          Disable committed filtering (CF) support.
+      --nov2transport       Disable the encrypted v2 peer transport (BIP0324)
+      --requirev2transport  Only make outbound connections using the encrypted
+                            v2 peer transport (BIP0324) without falling back
+                            to the unencrypted v1 transport
       --sigcachemaxsize=    The maximum number of entries in the signature
                             verification cache.
       --blocksonly          Do not accept transactions from remote peers.
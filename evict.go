@@ -0,0 +1,176 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	// evictProtectNetGroup is the number of inbound peers with distinct
+	// network groups which are protected from eviction.
+	evictProtectNetGroup = 4
+
+	// evictProtectPing is the number of inbound peers with the lowest ping
+	// times which are protected from eviction.
+	evictProtectPing = 8
+
+	// evictProtectTx is the number of inbound peers which most recently
+	// relayed a new transaction which are protected from eviction.
+	evictProtectTx = 4
+
+	// evictProtectBlock is the number of inbound peers which most recently
+	// relayed a new block which are protected from eviction.
+	evictProtectBlock = 4
+)
+
+// evictionCandidate houses the information about an inbound peer which is used
+// to decide whether or not it is protected from eviction.
+type evictionCandidate struct {
+	id            int32
+	connected     time.Time
+	pingMicros    int64
+	lastBlockTime time.Time
+	lastTxTime    time.Time
+	netGroup      string
+	keyedNetGroup uint64
+}
+
+// protectCandidates sorts the passed candidates from the least to the most
+// deserving of protection according to the passed function and returns the
+// remaining candidates once up to count of the most deserving ones are
+// protected.
+func protectCandidates(candidates []evictionCandidate, count int,
+	less func(a, b *evictionCandidate) bool) []evictionCandidate {
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return less(&candidates[i], &candidates[j])
+	})
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+	return candidates[:len(candidates)-count]
+}
+
+// selectPeerToEvict chooses the inbound peer to evict among the passed
+// candidates in order to make room for a new inbound peer.  An attacker can
+// easily make many connections, but it is much harder to also be close to us,
+// relay useful transactions and blocks, stay connected for a long time, and be
+// spread across many network groups.  So the candidates which are the best at
+// any of those are protected, and then the newest peer of the network group
+// with the most remaining candidates is evicted.  False is returned when every
+// candidate is protected.
+func selectPeerToEvict(candidates []evictionCandidate) (int32, bool) {
+	// Protect the peers in a few network groups chosen with a salt unknown
+	// to the peers so an attacker can't predict which groups to use.
+	candidates = protectCandidates(candidates, evictProtectNetGroup,
+		func(a, b *evictionCandidate) bool {
+			return a.keyedNetGroup < b.keyedNetGroup
+		})
+
+	// Protect the peers with the lowest ping times.  A ping time of zero
+	// means no ping has completed yet.
+	candidates = protectCandidates(candidates, evictProtectPing,
+		func(a, b *evictionCandidate) bool {
+			if a.pingMicros == 0 || b.pingMicros == 0 {
+				return a.pingMicros == 0 && b.pingMicros != 0
+			}
+			return a.pingMicros > b.pingMicros
+		})
+
+	// Protect the peers which most recently relayed new transactions and
+	// blocks.
+	candidates = protectCandidates(candidates, evictProtectTx,
+		func(a, b *evictionCandidate) bool {
+			return a.lastTxTime.Before(b.lastTxTime)
+		})
+	candidates = protectCandidates(candidates, evictProtectBlock,
+		func(a, b *evictionCandidate) bool {
+			return a.lastBlockTime.Before(b.lastBlockTime)
+		})
+
+	// Protect the half of the remaining peers which have been connected
+	// the longest.
+	candidates = protectCandidates(candidates, len(candidates)/2,
+		func(a, b *evictionCandidate) bool {
+			return a.connected.After(b.connected)
+		})
+	if len(candidates) == 0 {
+		return 0, false
+	}
+
+	// Find the network group with the most remaining peers, preferring the
+	// one with the newest peer on ties, and evict its newest peer.
+	groups := make(map[string][]*evictionCandidate)
+	var evictGroup []*evictionCandidate
+	for i := range candidates {
+		c := &candidates[i]
+		groups[c.netGroup] = append(groups[c.netGroup], c)
+	}
+	newest := func(group []*evictionCandidate) *evictionCandidate {
+		n := group[0]
+		for _, c := range group[1:] {
+			if c.connected.After(n.connected) {
+				n = c
+			}
+		}
+		return n
+	}
+	for _, group := range groups {
+		if len(group) > len(evictGroup) || (len(group) == len(evictGroup) &&
+			newest(group).connected.After(newest(evictGroup).connected)) {
+
+			evictGroup = group
+		}
+	}
+	return newest(evictGroup).id, true
+}
+
+// keyedNetGroup returns the passed network group keyed with the secret
+// eviction salt of the server.
+func (s *server) keyedNetGroup(netGroup string) uint64 {
+	buf := make([]byte, 8, 8+len(netGroup))
+	binary.LittleEndian.PutUint64(buf, s.evictionSalt)
+	buf = append(buf, netGroup...)
+	return binary.LittleEndian.Uint64(chainhash.HashB(buf))
+}
+
+// evictInboundPeer disconnects one of the inbound peers chosen by
+// selectPeerToEvict to make room for a new inbound peer.  Whitelisted peers
+// are never evicted.  It returns whether or not a peer was evicted.  It is
+// invoked from the peerHandler goroutine.
+func (s *server) evictInboundPeer(state *peerState) bool {
+	candidates := make([]evictionCandidate, 0, len(state.inboundPeers))
+	for _, sp := range state.inboundPeers {
+		if sp.isWhitelisted || !sp.Connected() {
+			continue
+		}
+		netGroup := s.addrManager.GroupKey(sp.NA())
+		candidates = append(candidates, evictionCandidate{
+			id:            sp.ID(),
+			connected:     sp.TimeConnected(),
+			pingMicros:    sp.LastPingMicros(),
+			lastBlockTime: time.Unix(atomic.LoadInt64(&sp.lastBlockTime), 0),
+			lastTxTime:    time.Unix(atomic.LoadInt64(&sp.lastTxTime), 0),
+			netGroup:      netGroup,
+			keyedNetGroup: s.keyedNetGroup(netGroup),
+		})
+	}
+
+	id, ok := selectPeerToEvict(candidates)
+	if !ok {
+		return false
+	}
+	sp := state.inboundPeers[id]
+	srvrLog.Infof("Evicting inbound peer %s to make room for a new "+
+		"inbound peer", sp)
+	sp.Disconnect()
+	return true
+}
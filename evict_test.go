@@ -0,0 +1,86 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestSelectPeerToEvict ensures the inbound peer chosen for eviction is never
+// one of the protected peers and that it is the newest peer of the network
+// group with the most unprotected peers.
+func TestSelectPeerToEvict(t *testing.T) {
+	now := time.Now()
+
+	// Too few candidates are all protected.
+	var candidates []evictionCandidate
+	for i := 0; i < evictProtectNetGroup; i++ {
+		candidates = append(candidates, evictionCandidate{
+			id:            int32(i),
+			connected:     now,
+			netGroup:      "attacker",
+			keyedNetGroup: uint64(i),
+		})
+	}
+	if id, ok := selectPeerToEvict(candidates); ok {
+		t.Fatalf("selectPeerToEvict: evicted peer %d, want none", id)
+	}
+
+	// Create many peers from the same network group which connected
+	// recently, along with a few honest peers which are each better than
+	// the others in one of the ways which protect them.
+	candidates = candidates[:0]
+	id := int32(0)
+	for i := 0; i < 40; i++ {
+		candidates = append(candidates, evictionCandidate{
+			id:         id,
+			connected:  now.Add(time.Duration(i) * time.Second),
+			pingMicros: 500000,
+			netGroup:   "attacker",
+		})
+		id++
+	}
+	protected := make(map[int32]struct{})
+	addHonest := func(c evictionCandidate) {
+		c.id = id
+		c.netGroup = fmt.Sprintf("honest%d", id)
+		if c.connected.IsZero() {
+			c.connected = now
+		}
+		if c.pingMicros == 0 {
+			c.pingMicros = 500000
+		}
+		candidates = append(candidates, c)
+		protected[id] = struct{}{}
+		id++
+	}
+	for i := 0; i < evictProtectNetGroup; i++ {
+		addHonest(evictionCandidate{keyedNetGroup: uint64(1000 + i)})
+	}
+	for i := 0; i < evictProtectPing; i++ {
+		addHonest(evictionCandidate{pingMicros: int64(100 + i)})
+	}
+	for i := 0; i < evictProtectTx; i++ {
+		addHonest(evictionCandidate{lastTxTime: now})
+	}
+	for i := 0; i < evictProtectBlock; i++ {
+		addHonest(evictionCandidate{lastBlockTime: now})
+	}
+
+	evicted, ok := selectPeerToEvict(candidates)
+	if !ok {
+		t.Fatal("selectPeerToEvict: no peer evicted")
+	}
+	if _, ok := protected[evicted]; ok {
+		t.Fatalf("selectPeerToEvict: evicted protected peer %d", evicted)
+	}
+
+	// The newest attacker peer must be the one evicted.
+	if evicted != 39 {
+		t.Fatalf("selectPeerToEvict: evicted peer %d, want 39", evicted)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// feeFilterCheckInterval is the interval between checks for whether
+	// peers should be sent an updated fee filter.
+	feeFilterCheckInterval = 30 * time.Second
+
+	// avgFeeFilterInterval is the average interval between the fee filters
+	// sent to a peer.
+	avgFeeFilterInterval = 10 * time.Minute
+
+	// maxFeeFilterChangeDelay is the maximum delay before a fee filter
+	// which changed significantly is sent to a peer.
+	maxFeeFilterChangeDelay = 5 * time.Minute
+)
+
+// handleFeeFilterUpdate sends the minimum fee rate transactions must pay to be
+// accepted into the memory pool to peers in feefilter messages, so they don't
+// announce transactions which would be rejected.  Each peer is sent the fee
+// filter at random intervals averaging avgFeeFilterInterval, or sooner when it
+// changed significantly, to avoid revealing exactly when the memory pool
+// changes.  It is invoked from the peerHandler goroutine.
+func (s *server) handleFeeFilterUpdate(state *peerState) {
+	if cfg.BlocksOnly {
+		return
+	}
+
+	// Ask peers not to announce any transactions while the chain is being
+	// synced, since they can't be validated yet.
+	minFee := int64(s.txMemPool.MinFeeRate())
+	if !s.syncManager.IsCurrent() {
+		minFee = btcutil.MaxSatoshi
+	}
+
+	now := time.Now()
+	state.forAllPeers(func(sp *serverPeer) {
+		if sp.blockRelayOnly || sp.feeler || sp.relayTxDisabled() ||
+			!sp.Connected() ||
+			sp.ProtocolVersion() < wire.FeeFilterVersion {
+
+			return
+		}
+
+		if now.Before(sp.nextFeeFilter) {
+			changed := minFee < sp.sentFeeFilter*3/4 ||
+				minFee > sp.sentFeeFilter*4/3
+			if changed && sp.nextFeeFilter.Sub(now) > maxFeeFilterChangeDelay {
+				delay := rand.Int63n(int64(maxFeeFilterChangeDelay))
+				sp.nextFeeFilter = now.Add(time.Duration(delay))
+			}
+			return
+		}
+
+		if minFee != sp.sentFeeFilter {
+			sp.QueueMessage(wire.NewMsgFeeFilter(minFee), nil)
+			sp.sentFeeFilter = minFee
+		}
+		delay := rand.ExpFloat64() * float64(avgFeeFilterInterval)
+		sp.nextFeeFilter = now.Add(time.Duration(delay))
+	})
+}
@@ -0,0 +1,336 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// DefaultMaxAncestorCount is the default maximum number of transactions
+	// in the pool a transaction may depend on, including itself.
+	DefaultMaxAncestorCount = 25
+
+	// DefaultMaxAncestorSize is the default maximum total virtual size of a
+	// transaction together with the transactions in the pool it depends on.
+	DefaultMaxAncestorSize = 101000
+
+	// DefaultMaxDescendantCount is the default maximum number of transactions
+	// in the pool which may depend on a transaction, including itself.
+	DefaultMaxDescendantCount = 25
+
+	// DefaultMaxDescendantSize is the default maximum total virtual size of
+	// a transaction together with the transactions in the pool which
+	// depend on it.
+	DefaultMaxDescendantSize = 101000
+)
+
+// ancestors returns the descriptors of all of the transactions in the pool the
+// passed transaction depends on, directly or indirectly.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) ancestors(tx *btcutil.Tx) []*TxDesc {
+	var descs []*TxDesc
+	visited := map[chainhash.Hash]struct{}{*tx.Hash(): {}}
+	queue := []*btcutil.Tx{tx}
+	for len(queue) > 0 {
+		tx := queue[0]
+		queue = queue[1:]
+
+		for _, txIn := range tx.MsgTx().TxIn {
+			parentHash := txIn.PreviousOutPoint.Hash
+			if _, ok := visited[parentHash]; ok {
+				continue
+			}
+			parent, ok := mp.pool[parentHash]
+			if !ok {
+				continue
+			}
+			visited[parentHash] = struct{}{}
+
+			descs = append(descs, parent)
+			queue = append(queue, parent.Tx)
+		}
+	}
+	return descs
+}
+
+// descendants returns the descriptors of all of the transactions in the pool
+// which descend from the passed transaction.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) descendants(tx *btcutil.Tx) []*TxDesc {
+	var descs []*TxDesc
+	visited := map[chainhash.Hash]struct{}{*tx.Hash(): {}}
+	queue := []*btcutil.Tx{tx}
+	for len(queue) > 0 {
+		tx := queue[0]
+		queue = queue[1:]
+
+		prevOut := wire.OutPoint{Hash: *tx.Hash()}
+		for i := range tx.MsgTx().TxOut {
+			prevOut.Index = uint32(i)
+			redeemer, ok := mp.outpoints[prevOut]
+			if !ok {
+				continue
+			}
+			if _, ok := visited[*redeemer.Hash()]; ok {
+				continue
+			}
+			visited[*redeemer.Hash()] = struct{}{}
+
+			descs = append(descs, mp.pool[*redeemer.Hash()])
+			queue = append(queue, redeemer)
+		}
+	}
+	return descs
+}
+
+// packageStats returns the number of transactions, total virtual size and
+// total modified fees of the passed transaction together with the passed
+// related transactions.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) packageStats(txD *TxDesc, related []*TxDesc) (int64, int64, int64) {
+	count := int64(1 + len(related))
+	size := GetTxVirtualSize(txD.Tx)
+	fees := mp.modifiedFee(txD)
+	for _, desc := range related {
+		size += GetTxVirtualSize(desc.Tx)
+		fees += mp.modifiedFee(desc)
+	}
+	return count, size, fees
+}
+
+// recalcPackageStats recalculates the ancestor and descendant counts, sizes
+// and fees of the passed transactions from scratch.  It walks the ancestors and
+// descendants of every passed transaction, so it is only used when the stats
+// can't be updated along the affected edges.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) recalcPackageStats(descs []*TxDesc) {
+	for _, txD := range descs {
+		txD.AncestorCount, txD.AncestorSize, txD.AncestorFees =
+			mp.packageStats(txD, mp.ancestors(txD.Tx))
+		txD.DescendantCount, txD.DescendantSize, txD.DescendantFees =
+			mp.packageStats(txD, mp.descendants(txD.Tx))
+	}
+}
+
+// shiftPackageStats adds the passed count, size and fees to the descendant
+// stats of the passed ancestors and to the ancestor stats of the passed
+// descendants.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func shiftPackageStats(ancestors, descendants []*TxDesc, count, size, fees int64) {
+	for _, ancestor := range ancestors {
+		ancestor.DescendantCount += count
+		ancestor.DescendantSize += size
+		ancestor.DescendantFees += fees
+	}
+	for _, descendant := range descendants {
+		descendant.AncestorCount += count
+		descendant.AncestorSize += size
+		descendant.AncestorFees += fees
+	}
+}
+
+// addPackageStats sets the ancestor and descendant counts, sizes and fees of
+// the passed transaction, which was just added to the pool, and updates those
+// of the passed ancestors and descendants it has in the pool.
+//
+// A transaction with both ancestors and descendants in the pool, which only
+// happens when transactions of disconnected blocks are added back, may join
+// ancestors and descendants which were already related through other
+// transactions, so their stats are recalculated instead.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addPackageStats(txD *TxDesc, ancestors, descendants []*TxDesc) {
+	txD.AncestorCount, txD.AncestorSize, txD.AncestorFees =
+		mp.packageStats(txD, ancestors)
+	txD.DescendantCount, txD.DescendantSize, txD.DescendantFees =
+		mp.packageStats(txD, descendants)
+	if len(ancestors) > 0 && len(descendants) > 0 {
+		mp.recalcPackageStats(append(ancestors, descendants...))
+		return
+	}
+	shiftPackageStats(ancestors, descendants, 1,
+		GetTxVirtualSize(txD.Tx), mp.modifiedFee(txD))
+}
+
+// removePackageStats updates the ancestor and descendant counts, sizes and fees
+// of the passed ancestors and descendants of the passed transaction, which was
+// just removed from the pool.  Like addPackageStats, the stats are
+// recalculated when the transaction had both ancestors and descendants in the
+// pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) removePackageStats(txD *TxDesc, ancestors, descendants []*TxDesc) {
+	if len(ancestors) > 0 && len(descendants) > 0 {
+		mp.recalcPackageStats(append(ancestors, descendants...))
+		return
+	}
+	shiftPackageStats(ancestors, descendants, -1,
+		-GetTxVirtualSize(txD.Tx), -mp.modifiedFee(txD))
+}
+
+// checkPackageLimits ensures adding the passed transaction to the pool would
+// not give it, or any of the transactions in the pool it depends on, more
+// ancestors or descendants than allowed by the policy.  Limits which are zero
+// are not enforced.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) checkPackageLimits(tx *btcutil.Tx) error {
+	policy := &mp.cfg.Policy
+	txHash := tx.Hash()
+	txSize := GetTxVirtualSize(tx)
+	ancestors := mp.ancestors(tx)
+
+	ancestorCount := int64(1 + len(ancestors))
+	if policy.MaxAncestorCount > 0 && ancestorCount > policy.MaxAncestorCount {
+		str := fmt.Sprintf("transaction %v has %d unconfirmed ancestors "+
+			"including itself which is more than the limit of %d",
+			txHash, ancestorCount, policy.MaxAncestorCount)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+	ancestorSize := txSize
+	for _, ancestor := range ancestors {
+		ancestorSize += GetTxVirtualSize(ancestor.Tx)
+	}
+	if policy.MaxAncestorSize > 0 && ancestorSize > policy.MaxAncestorSize {
+		str := fmt.Sprintf("transaction %v has unconfirmed ancestors "+
+			"with a virtual size of %d including itself which is "+
+			"more than the limit of %d", txHash, ancestorSize,
+			policy.MaxAncestorSize)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	for _, ancestor := range ancestors {
+		if policy.MaxDescendantCount > 0 &&
+			ancestor.DescendantCount+1 > policy.MaxDescendantCount {
+
+			str := fmt.Sprintf("transaction %v would give unconfirmed "+
+				"transaction %v more than the limit of %d "+
+				"descendants including itself", txHash,
+				ancestor.Tx.Hash(), policy.MaxDescendantCount)
+			return txRuleError(wire.RejectNonstandard, str)
+		}
+		if policy.MaxDescendantSize > 0 &&
+			ancestor.DescendantSize+txSize > policy.MaxDescendantSize {
+
+			str := fmt.Sprintf("transaction %v would give unconfirmed "+
+				"transaction %v descendants with a virtual size "+
+				"of more than the limit of %d including itself",
+				txHash, ancestor.Tx.Hash(),
+				policy.MaxDescendantSize)
+			return txRuleError(wire.RejectNonstandard, str)
+		}
+	}
+
+	return nil
+}
+
+// mempoolEntry returns the getmempoolentry result for the passed transaction.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) mempoolEntry(txD *TxDesc) *btcjson.GetMempoolEntryResult {
+	// Calculate the current priority based on the inputs to the
+	// transaction.  Use zero if one or more of the input transactions
+	// can't be found for some reason.
+	tx := txD.Tx
+	var currentPriority float64
+	utxos, err := mp.fetchInputUtxos(tx)
+	if err == nil {
+		currentPriority = mining.CalcPriority(tx.MsgTx(), utxos,
+			mp.cfg.BestHeight()+1)
+	}
+
+	entry := &btcjson.GetMempoolEntryResult{
+		Size:              int32(tx.MsgTx().SerializeSize()),
+		Vsize:             int32(GetTxVirtualSize(tx)),
+		Fee:               btcutil.Amount(txD.Fee).ToBTC(),
+		ModifiedFee:       btcutil.Amount(mp.modifiedFee(txD)).ToBTC(),
+		Time:              txD.Added.Unix(),
+		Height:            int64(txD.Height),
+		StartingPriority:  txD.StartingPriority,
+		CurrentPriority:   currentPriority,
+		DescendantCount:   txD.DescendantCount,
+		DescendantSize:    txD.DescendantSize,
+		DescendantFees:    btcutil.Amount(txD.DescendantFees).ToBTC(),
+		AncestorCount:     txD.AncestorCount,
+		AncestorSize:      txD.AncestorSize,
+		AncestorFees:      btcutil.Amount(txD.AncestorFees).ToBTC(),
+		Depends:           make([]string, 0),
+		BIP125Replaceable: mp.signalsReplacement(tx, nil),
+	}
+	for _, txIn := range tx.MsgTx().TxIn {
+		hash := &txIn.PreviousOutPoint.Hash
+		if mp.haveTransaction(hash) {
+			entry.Depends = append(entry.Depends, hash.String())
+		}
+	}
+	return entry
+}
+
+// MempoolEntry returns the details of the passed transaction in the pool,
+// including the counts, sizes and fees of its ancestors and descendants.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolEntry(txHash *chainhash.Hash) (*btcjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	txD, exists := mp.pool[*txHash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+	return mp.mempoolEntry(txD), nil
+}
+
+// MempoolAncestors returns the details of all of the transactions in the pool
+// the passed transaction depends on, keyed by their hashes.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolAncestors(txHash *chainhash.Hash) (map[string]*btcjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	txD, exists := mp.pool[*txHash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+	ancestors := mp.ancestors(txD.Tx)
+	result := make(map[string]*btcjson.GetMempoolEntryResult, len(ancestors))
+	for _, ancestor := range ancestors {
+		result[ancestor.Tx.Hash().String()] = mp.mempoolEntry(ancestor)
+	}
+	return result, nil
+}
+
+// MempoolDescendants returns the details of all of the transactions in the pool
+// which depend on the passed transaction, keyed by their hashes.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolDescendants(txHash *chainhash.Hash) (map[string]*btcjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	txD, exists := mp.pool[*txHash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+	descendants := mp.descendants(txD.Tx)
+	result := make(map[string]*btcjson.GetMempoolEntryResult, len(descendants))
+	for _, descendant := range descendants {
+		result[descendant.Tx.Hash().String()] = mp.mempoolEntry(descendant)
+	}
+	return result, nil
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestPackageStats ensures the ancestor and descendant counts, sizes and fees of
+// the transactions in the pool are kept up to date as transactions are added
+// and removed, and that the package limits are enforced.
+func TestPackageStats(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	pool := harness.txPool
+	pool.cfg.Policy.MaxAncestorCount = 3
+	pool.cfg.Policy.MaxDescendantCount = 3
+
+	createTx := func(input spendableOutput, fee btcutil.Amount) *btcutil.Tx {
+		t.Helper()
+		tx, err := harness.CreateSignedTxWithFee([]spendableOutput{input},
+			2, fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+	accept := func(tx *btcutil.Tx) {
+		t.Helper()
+		if _, err := pool.ProcessTransaction(tx, false, false, 0); err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+	}
+	checkStats := func(tx *btcutil.Tx, ancestors, descendants []*btcutil.Tx) {
+		t.Helper()
+		txD := pool.pool[*tx.Hash()]
+		wantStats := func(related []*btcutil.Tx) (int64, int64, int64) {
+			count := int64(1 + len(related))
+			size := GetTxVirtualSize(tx)
+			fees := txD.Fee
+			for _, relatedTx := range related {
+				size += GetTxVirtualSize(relatedTx)
+				fees += pool.pool[*relatedTx.Hash()].Fee
+			}
+			return count, size, fees
+		}
+		count, size, fees := wantStats(ancestors)
+		if txD.AncestorCount != count || txD.AncestorSize != size ||
+			txD.AncestorFees != fees {
+
+			t.Fatalf("transaction %v: got ancestor stats %d/%d/%d, "+
+				"want %d/%d/%d", tx.Hash(), txD.AncestorCount,
+				txD.AncestorSize, txD.AncestorFees, count, size,
+				fees)
+		}
+		count, size, fees = wantStats(descendants)
+		if txD.DescendantCount != count || txD.DescendantSize != size ||
+			txD.DescendantFees != fees {
+
+			t.Fatalf("transaction %v: got descendant stats %d/%d/%d, "+
+				"want %d/%d/%d", tx.Hash(), txD.DescendantCount,
+				txD.DescendantSize, txD.DescendantFees, count,
+				size, fees)
+		}
+	}
+
+	// Create a parent with two children, one of which has a child of its
+	// own.
+	parent := createTx(outputs[0], 1000)
+	child1 := createTx(txOutToSpendableOut(parent, 0), 2000)
+	child2 := createTx(txOutToSpendableOut(parent, 1), 3000)
+	grandchild := createTx(txOutToSpendableOut(child1, 0), 4000)
+	for _, tx := range []*btcutil.Tx{parent, child1, child2} {
+		accept(tx)
+	}
+
+	// The parent already has the maximum number of descendants.
+	_, err = pool.ProcessTransaction(grandchild, false, false, 0)
+	if code, _ := extractRejectCode(err); code != wire.RejectNonstandard {
+		t.Fatalf("ProcessTransaction: got %v, want descendant limit "+
+			"rejection", err)
+	}
+	testPoolMembership(tc, grandchild, false, false)
+	pool.cfg.Policy.MaxDescendantCount = 0
+	accept(grandchild)
+	checkStats(parent, nil, []*btcutil.Tx{child1, child2, grandchild})
+	checkStats(child1, []*btcutil.Tx{parent}, []*btcutil.Tx{grandchild})
+	checkStats(child2, []*btcutil.Tx{parent}, nil)
+	checkStats(grandchild, []*btcutil.Tx{parent, child1}, nil)
+
+	// A chain of more than the maximum number of ancestors is rejected.
+	_, err = pool.ProcessTransaction(createTx(txOutToSpendableOut(
+		grandchild, 0), 5000), false, false, 0)
+	if code, _ := extractRejectCode(err); code != wire.RejectNonstandard {
+		t.Fatalf("ProcessTransaction: got %v, want ancestor limit "+
+			"rejection", err)
+	}
+
+	// Removing the parent as if it had been mined updates the statistics of
+	// its descendants.
+	pool.RemoveTransaction(parent, false)
+	checkStats(child1, nil, []*btcutil.Tx{grandchild})
+	checkStats(child2, nil, nil)
+	checkStats(grandchild, []*btcutil.Tx{child1}, nil)
+
+	// Removing a transaction along with its descendants updates the
+	// statistics of its ancestors.
+	pool.RemoveTransaction(grandchild, true)
+	checkStats(child1, nil, nil)
+
+	// The entries returned for the RPC server reflect the statistics.
+	entry, err := pool.MempoolEntry(child1.Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: unexpected error: %v", err)
+	}
+	if entry.AncestorCount != 1 || entry.DescendantCount != 1 {
+		t.Fatalf("MempoolEntry: got ancestor count %d and descendant "+
+			"count %d, want 1 and 1", entry.AncestorCount,
+			entry.DescendantCount)
+	}
+	if _, err := pool.MempoolAncestors(parent.Hash()); err == nil {
+		t.Fatalf("MempoolAncestors: did not fail for a transaction " +
+			"which is not in the pool")
+	}
+}
+
+// TestPackageStatsUpdates ensures the ancestor and descendant stats which are
+// updated along the affected edges as transactions are added, removed and
+// prioritised match the stats calculated from scratch, including for
+// transactions related through more than one path and for transactions added
+// back between their ancestors and descendants.
+func TestPackageStatsUpdates(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	pool := harness.txPool
+
+	createTx := func(inputs []spendableOutput, fee btcutil.Amount) *btcutil.Tx {
+		t.Helper()
+		tx, err := harness.CreateSignedTxWithFee(inputs, 2, fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+	accept := func(tx *btcutil.Tx) {
+		t.Helper()
+		_, _, err := pool.MaybeAcceptTransaction(tx, false, false)
+		if err != nil {
+			t.Fatalf("MaybeAcceptTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+	}
+	checkStats := func(step string) {
+		t.Helper()
+		for hash, txD := range pool.pool {
+			count, size, fees := pool.packageStats(txD,
+				pool.ancestors(txD.Tx))
+			if txD.AncestorCount != count || txD.AncestorSize != size ||
+				txD.AncestorFees != fees {
+
+				t.Fatalf("%s: transaction %v: got ancestor stats "+
+					"%d/%d/%d, want %d/%d/%d", step, hash,
+					txD.AncestorCount, txD.AncestorSize,
+					txD.AncestorFees, count, size, fees)
+			}
+			count, size, fees = pool.packageStats(txD,
+				pool.descendants(txD.Tx))
+			if txD.DescendantCount != count ||
+				txD.DescendantSize != size ||
+				txD.DescendantFees != fees {
+
+				t.Fatalf("%s: transaction %v: got descendant stats "+
+					"%d/%d/%d, want %d/%d/%d", step, hash,
+					txD.DescendantCount, txD.DescendantSize,
+					txD.DescendantFees, count, size, fees)
+			}
+		}
+	}
+
+	// Create a parent with two children which are both spent by a single
+	// grandchild, so the grandchild descends from the parent twice.  The
+	// second child has another child which only descends from the parent
+	// through it.
+	parent := createTx(outputs[:1], 1000)
+	child1 := createTx([]spendableOutput{txOutToSpendableOut(parent, 0)}, 2000)
+	child2 := createTx([]spendableOutput{txOutToSpendableOut(parent, 1)}, 3000)
+	grandchild := createTx([]spendableOutput{
+		txOutToSpendableOut(child1, 0),
+		txOutToSpendableOut(child2, 0),
+	}, 4000)
+	grandchild2 := createTx([]spendableOutput{
+		txOutToSpendableOut(child2, 1),
+	}, 5000)
+	for _, tx := range []*btcutil.Tx{parent, child1, child2, grandchild,
+		grandchild2} {
+
+		accept(tx)
+	}
+	checkStats("add")
+
+	pool.PrioritiseTransaction(child1.Hash(), 500)
+	checkStats("prioritise")
+
+	// Remove a child as if it had been mined without its parent, which
+	// leaves one of its children related to the parent through the other
+	// child but not the other, and add it back as if its block had been
+	// disconnected.
+	pool.RemoveTransaction(child2, false)
+	checkStats("remove between ancestors and descendants")
+	accept(child2)
+	checkStats("add between ancestors and descendants")
+
+	// Remove the parent as if it had been mined and add it back as if its
+	// block had been disconnected.
+	pool.RemoveTransaction(parent, false)
+	checkStats("remove without ancestors")
+	accept(parent)
+	checkStats("add without ancestors")
+
+	pool.RemoveTransaction(grandchild, true)
+	checkStats("remove without descendants")
+	pool.RemoveTransaction(parent, true)
+	if len(pool.pool) != 0 {
+		t.Fatalf("RemoveTransaction: %d transactions left in the pool",
+			len(pool.pool))
+	}
+}
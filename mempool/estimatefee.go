@@ -178,6 +178,9 @@ type FeeEstimator struct {
 	// Transactions that have been removed from the bins. This allows us to
 	// revert in case of an orphaned block.
 	dropped []*registeredBlock
+
+	// The bucketed confirmation data used by EstimateSmartFee.
+	smart *smartFeeEstimator
 }
 
 // NewFeeEstimator creates a FeeEstimator for which at most maxRollback blocks
@@ -192,6 +195,7 @@ func NewFeeEstimator(maxRollback, minRegisteredBlocks uint32) *FeeEstimator {
 		maxReplacements:     estimateFeeMaxReplacements,
 		observed:            make(map[chainhash.Hash]*observedTransaction),
 		dropped:             make([]*registeredBlock, 0, maxRollback),
+		smart:               newSmartFeeEstimator(),
 	}
 }
 
@@ -207,9 +211,8 @@ func (ef *FeeEstimator) ObserveTransaction(t *TxDesc) {
 	}
 
 	hash := *t.Tx.Hash()
+	size := uint32(GetTxVirtualSize(t.Tx))
 	if _, ok := ef.observed[hash]; !ok {
-		size := uint32(GetTxVirtualSize(t.Tx))
-
 		ef.observed[hash] = &observedTransaction{
 			hash:     hash,
 			feeRate:  NewSatoshiPerByte(btcutil.Amount(t.Fee), size),
@@ -217,6 +220,19 @@ func (ef *FeeEstimator) ObserveTransaction(t *TxDesc) {
 			mined:    mining.UnminedHeight,
 		}
 	}
+
+	feeRate := float64(t.Fee) * bytePerKb / float64(size)
+	ef.smart.observeTransaction(hash, t.Height, feeRate)
+}
+
+// RemoveTransaction is called when a transaction leaves the mempool without
+// being mined, such as when it expires, is evicted or is replaced, so it is no
+// longer tracked by the smart fee estimator.
+func (ef *FeeEstimator) RemoveTransaction(hash *chainhash.Hash) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	ef.smart.removeTx(*hash, false)
 }
 
 // RegisterBlock informs the fee estimator of a new block to take into account.
@@ -237,6 +253,9 @@ func (ef *FeeEstimator) RegisterBlock(block *btcutil.Block) error {
 	ef.lastKnownHeight = height
 	ef.numBlocksRegistered++
 
+	// Record the confirmations for EstimateSmartFee.
+	ef.smart.registerBlock(height, block.Transactions())
+
 	// Randomly order txs in block.
 	transactions := make(map[*btcutil.Tx]struct{})
 	for _, t := range block.Transactions() {
@@ -578,7 +597,7 @@ func (ef *FeeEstimator) EstimateFee(numBlocks uint32) (BtcPerKilobyte, error) {
 // we use a version number. If the version number changes, it does not make
 // sense to try to upgrade a previous version to a new version. Instead, just
 // start fee estimation over.
-const estimateFeeSaveVersion = 1
+const estimateFeeSaveVersion = 2
 
 func deserializeRegisteredBlock(r io.Reader, txs map[uint32]*observedTransaction) (*registeredBlock, error) {
 	var lenTransactions uint32
@@ -671,6 +690,9 @@ func (ef *FeeEstimator) Save() FeeEstimatorState {
 		registered.serialize(w, observed)
 	}
 
+	// Smart fee estimation data.
+	ef.smart.serialize(w)
+
 	// Commit the tx and return.
 	return FeeEstimatorState(w.Bytes())
 }
@@ -745,5 +767,11 @@ func RestoreFeeEstimator(data FeeEstimatorState) (*FeeEstimator, error) {
 		}
 	}
 
+	// Read smart fee estimation data.
+	ef.smart, err = deserializeSmartFeeEstimator(r)
+	if err != nil {
+		return nil, err
+	}
+
 	return ef, nil
 }
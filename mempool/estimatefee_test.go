@@ -26,6 +26,7 @@ func newTestFeeEstimator(binSize, maxReplacements, maxRollback uint32) *FeeEstim
 		maxReplacements:     int32(maxReplacements),
 		observed:            make(map[chainhash.Hash]*observedTransaction),
 		dropped:             make([]*registeredBlock, 0, maxRollback),
+		smart:               newSmartFeeEstimator(),
 	}
 }
 
@@ -0,0 +1,646 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// minSmartFeeBucket and maxSmartFeeBucket are the lowest and highest
+	// fee rates in satoshi per kilobyte which get their own bucket in the
+	// smart fee estimator.  Higher fee rates share a final bucket.
+	minSmartFeeBucket = 1000
+	maxSmartFeeBucket = 1e7
+
+	// smartFeeBucketSpacing is the ratio between the fee rates of
+	// consecutive buckets.
+	smartFeeBucketSpacing = 1.05
+
+	// The short, medium and long time horizons track confirmations for the
+	// given number of periods, each spanning the given number of blocks.
+	// The decay is applied to all of the horizon's counts for every block,
+	// so the counts approximate the transactions seen in the last
+	// 1/(1-decay) blocks.
+	shortHorizonPeriods  = 12
+	shortHorizonScale    = 1
+	shortHorizonDecay    = 0.962
+	mediumHorizonPeriods = 24
+	mediumHorizonScale   = 2
+	mediumHorizonDecay   = 0.9952
+	longHorizonPeriods   = 42
+	longHorizonScale     = 24
+	longHorizonDecay     = 0.99931
+
+	// halfSuccessPct, successPct and doubleSuccessPct are the fractions of
+	// transactions in a range of buckets which must have confirmed within
+	// half of, exactly and double the confirmation target respectively for
+	// the range to satisfy the target.
+	halfSuccessPct   = 0.6
+	successPct       = 0.85
+	doubleSuccessPct = 0.95
+
+	// sufficientShortTxs and sufficientFeeTxs are the average number of
+	// transactions per block a range of buckets must have confirmed on
+	// the short and the medium or long horizons for it to be used in an
+	// estimate.
+	sufficientShortTxs = 0.5
+	sufficientFeeTxs   = 0.1
+
+	// MaxSmartFeeTarget is the largest confirmation target, in blocks,
+	// which can be passed to EstimateSmartFee.
+	MaxSmartFeeTarget = longHorizonPeriods * longHorizonScale
+)
+
+// smartFeeBuckets holds the highest fee rate in satoshi per kilobyte of each
+// of the fee rate buckets used by the smart fee estimator.
+var smartFeeBuckets = func() []float64 {
+	var buckets []float64
+	for feeRate := float64(minSmartFeeBucket); feeRate <= maxSmartFeeBucket; feeRate *= smartFeeBucketSpacing {
+		buckets = append(buckets, feeRate)
+	}
+	return append(buckets, math.Inf(1))
+}()
+
+// feeRateStats tracks how quickly transactions in each fee rate bucket are
+// confirmed over a single time horizon.  All counts other than those of the
+// transactions still in the mempool decay exponentially with every block.
+type feeRateStats struct {
+	decay float64
+	scale int
+
+	// feeRateSum and txCount hold the sum of the fee rates and the number
+	// of the confirmed transactions in each bucket.
+	feeRateSum []float64
+	txCount    []float64
+
+	// confirmed holds, for every period and bucket, the number of
+	// transactions which confirmed within that many periods, while failed
+	// holds the number which left the mempool after that many periods
+	// without confirming.
+	confirmed [][]float64
+	failed    [][]float64
+
+	// unconfirmed holds the number of transactions in each bucket which
+	// are still in the mempool indexed by the height they entered at,
+	// modulo the number of blocks the horizon spans.  oldUnconfirmed holds
+	// those which have been in the mempool for longer than that.
+	unconfirmed    [][]int
+	oldUnconfirmed []int
+}
+
+// newFeeRateStats returns a new feeRateStats which tracks confirmations for
+// the given number of periods of scale blocks each.
+func newFeeRateStats(periods, scale int, decay float64) *feeRateStats {
+	numBuckets := len(smartFeeBuckets)
+	s := &feeRateStats{
+		decay:          decay,
+		scale:          scale,
+		feeRateSum:     make([]float64, numBuckets),
+		txCount:        make([]float64, numBuckets),
+		confirmed:      make([][]float64, periods),
+		failed:         make([][]float64, periods),
+		unconfirmed:    make([][]int, periods*scale),
+		oldUnconfirmed: make([]int, numBuckets),
+	}
+	for i := 0; i < periods; i++ {
+		s.confirmed[i] = make([]float64, numBuckets)
+		s.failed[i] = make([]float64, numBuckets)
+	}
+	for i := range s.unconfirmed {
+		s.unconfirmed[i] = make([]int, numBuckets)
+	}
+	return s
+}
+
+// maxConfirms returns the largest confirmation target the stats can answer
+// for.
+func (s *feeRateStats) maxConfirms() int {
+	return len(s.confirmed) * s.scale
+}
+
+// unconfirmedIndex returns the index in unconfirmed of the transactions which
+// entered the mempool at the given height.
+func (s *feeRateStats) unconfirmedIndex(height int32) int {
+	n := int32(len(s.unconfirmed))
+	return int((height%n + n) % n)
+}
+
+// newTx records a transaction in the given bucket entering the mempool at the
+// given height.
+func (s *feeRateStats) newTx(height int32, bucket int) {
+	s.unconfirmed[s.unconfirmedIndex(height)][bucket]++
+}
+
+// clearCurrent moves the transactions which entered the mempool too long ago
+// to be told apart from the slot used by the given new height to the old
+// unconfirmed transactions.
+func (s *feeRateStats) clearCurrent(height int32) {
+	unconfirmed := s.unconfirmed[s.unconfirmedIndex(height)]
+	for bucket, count := range unconfirmed {
+		s.oldUnconfirmed[bucket] += count
+		unconfirmed[bucket] = 0
+	}
+}
+
+// decayAverages applies the decay of the stats to all of its counts.
+func (s *feeRateStats) decayAverages() {
+	for bucket := range s.txCount {
+		s.feeRateSum[bucket] *= s.decay
+		s.txCount[bucket] *= s.decay
+		for period := range s.confirmed {
+			s.confirmed[period][bucket] *= s.decay
+			s.failed[period][bucket] *= s.decay
+		}
+	}
+}
+
+// record records a transaction in the given bucket with the given fee rate
+// which confirmed after blocksToConfirm blocks.
+func (s *feeRateStats) record(blocksToConfirm, bucket int, feeRate float64) {
+	if blocksToConfirm < 1 {
+		return
+	}
+	periodsToConfirm := (blocksToConfirm + s.scale - 1) / s.scale
+	for period := periodsToConfirm - 1; period < len(s.confirmed); period++ {
+		s.confirmed[period][bucket]++
+	}
+	s.txCount[bucket]++
+	s.feeRateSum[bucket] += feeRate
+}
+
+// removeTx removes a transaction in the given bucket which entered the mempool
+// at entryHeight from the unconfirmed transactions.  Unless it was removed
+// because it was included in a block, it is counted as having failed to
+// confirm within every full period it spent in the mempool.
+func (s *feeRateStats) removeTx(entryHeight, bestHeight int32, bucket int,
+	inBlock bool) {
+
+	blocksAgo := int(bestHeight - entryHeight)
+	if blocksAgo < 0 {
+		return
+	}
+
+	if blocksAgo >= len(s.unconfirmed) {
+		if s.oldUnconfirmed[bucket] > 0 {
+			s.oldUnconfirmed[bucket]--
+		}
+	} else {
+		unconfirmed := s.unconfirmed[s.unconfirmedIndex(entryHeight)]
+		if unconfirmed[bucket] > 0 {
+			unconfirmed[bucket]--
+		}
+	}
+
+	if !inBlock && blocksAgo >= s.scale {
+		periodsAgo := blocksAgo / s.scale
+		for period := 0; period < periodsAgo && period < len(s.failed); period++ {
+			s.failed[period][bucket]++
+		}
+	}
+}
+
+// estimateMedianFee returns the fee rate in satoshi per kilobyte for which at
+// least successBreakPoint of the transactions confirmed within confTarget
+// blocks, or -1 when there is not enough data to tell.
+//
+// Starting from the highest fee rate, buckets are grouped together until the
+// group holds at least sufficientTxs transactions per block.  The estimate is
+// the median fee rate of the lowest group to meet the success break point.
+func (s *feeRateStats) estimateMedianFee(confTarget int, sufficientTxs,
+	successBreakPoint float64, bestHeight int32) float64 {
+
+	period := (confTarget+s.scale-1)/s.scale - 1
+	maxConfirms := s.maxConfirms()
+	maxBucket := len(smartFeeBuckets) - 1
+
+	var confirmed, total, failed float64
+	var extra int
+	curNear, bestNear, bestFar := maxBucket, maxBucket, maxBucket
+	foundAnswer := false
+	newRange := true
+	for bucket := maxBucket; bucket >= 0; bucket-- {
+		if newRange {
+			curNear = bucket
+			newRange = false
+		}
+		confirmed += s.confirmed[period][bucket]
+		total += s.txCount[bucket]
+		failed += s.failed[period][bucket]
+
+		// Transactions still in the mempool which have already been
+		// waiting for longer than the target count against it.
+		for confs := confTarget; confs < maxConfirms; confs++ {
+			index := s.unconfirmedIndex(bestHeight - int32(confs))
+			extra += s.unconfirmed[index][bucket]
+		}
+		extra += s.oldUnconfirmed[bucket]
+
+		if total < sufficientTxs/(1-s.decay) {
+			continue
+		}
+		if confirmed/(total+failed+float64(extra)) < successBreakPoint {
+			continue
+		}
+
+		foundAnswer = true
+		bestNear, bestFar = curNear, bucket
+		confirmed, total, failed, extra = 0, 0, 0, 0
+		newRange = true
+	}
+	if !foundAnswer {
+		return -1
+	}
+
+	// The exact fee rates of the transactions aren't kept, so use the
+	// average fee rate of the bucket holding the median transaction.
+	var txSum float64
+	for bucket := bestFar; bucket <= bestNear; bucket++ {
+		txSum += s.txCount[bucket]
+	}
+	if txSum == 0 {
+		return -1
+	}
+	txSum /= 2
+	for bucket := bestFar; bucket <= bestNear; bucket++ {
+		if s.txCount[bucket] < txSum {
+			txSum -= s.txCount[bucket]
+			continue
+		}
+		return s.feeRateSum[bucket] / s.txCount[bucket]
+	}
+	return -1
+}
+
+// serialize writes the decaying counts of the stats to w.  The transactions
+// still in the mempool are not saved.
+func (s *feeRateStats) serialize(w io.Writer) {
+	binary.Write(w, binary.BigEndian, uint32(len(s.confirmed)))
+	binary.Write(w, binary.BigEndian, s.feeRateSum)
+	binary.Write(w, binary.BigEndian, s.txCount)
+	for period := range s.confirmed {
+		binary.Write(w, binary.BigEndian, s.confirmed[period])
+		binary.Write(w, binary.BigEndian, s.failed[period])
+	}
+}
+
+// deserialize reads the decaying counts written by serialize from r.
+func (s *feeRateStats) deserialize(r io.Reader) error {
+	var periods uint32
+	if err := binary.Read(r, binary.BigEndian, &periods); err != nil {
+		return err
+	}
+	if int(periods) != len(s.confirmed) {
+		return fmt.Errorf("Incorrect number of periods: expected %d "+
+			"found %d", len(s.confirmed), periods)
+	}
+
+	if err := binary.Read(r, binary.BigEndian, s.feeRateSum); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, s.txCount); err != nil {
+		return err
+	}
+	for period := range s.confirmed {
+		err := binary.Read(r, binary.BigEndian, s.confirmed[period])
+		if err != nil {
+			return err
+		}
+		err = binary.Read(r, binary.BigEndian, s.failed[period])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackedTransaction is a mempool transaction whose confirmation is tracked
+// by the smart fee estimator.
+type trackedTransaction struct {
+	height  int32
+	bucket  int
+	feeRate float64
+}
+
+// smartFeeEstimator tracks how long transactions take to confirm by fee rate
+// bucket over a short, medium and long time horizon in order to estimate the
+// fee rate needed to confirm within a target number of blocks.
+//
+// Like the rest of the FeeEstimator, it relies on the FeeEstimator's lock.
+// Blocks which are disconnected are not unrecorded, since a reorganization
+// has little effect on the decaying counts.
+type smartFeeEstimator struct {
+	// bestHeight is the height of the last block recorded.  firstHeight
+	// is the height of the first block which confirmed a tracked
+	// transaction, or zero if there has been none.
+	bestHeight  int32
+	firstHeight int32
+
+	short  *feeRateStats
+	medium *feeRateStats
+	long   *feeRateStats
+
+	tracked map[chainhash.Hash]trackedTransaction
+}
+
+// newSmartFeeEstimator returns a new smart fee estimator which hasn't seen
+// any transactions.
+func newSmartFeeEstimator() *smartFeeEstimator {
+	return &smartFeeEstimator{
+		short: newFeeRateStats(shortHorizonPeriods, shortHorizonScale,
+			shortHorizonDecay),
+		medium: newFeeRateStats(mediumHorizonPeriods,
+			mediumHorizonScale, mediumHorizonDecay),
+		long: newFeeRateStats(longHorizonPeriods, longHorizonScale,
+			longHorizonDecay),
+		tracked: make(map[chainhash.Hash]trackedTransaction),
+	}
+}
+
+// horizons returns the stats of all of the time horizons.
+func (s *smartFeeEstimator) horizons() []*feeRateStats {
+	return []*feeRateStats{s.short, s.medium, s.long}
+}
+
+// observeTransaction starts tracking a transaction with the given fee rate in
+// satoshi per kilobyte which entered the mempool at the given height.
+// Transactions which didn't enter at the height of the last block recorded,
+// such as those from disconnected blocks, are ignored.
+func (s *smartFeeEstimator) observeTransaction(hash chainhash.Hash,
+	height int32, feeRate float64) {
+
+	if height != s.bestHeight {
+		return
+	}
+	if _, ok := s.tracked[hash]; ok {
+		return
+	}
+
+	bucket := sort.SearchFloat64s(smartFeeBuckets, feeRate)
+	for _, stats := range s.horizons() {
+		stats.newTx(height, bucket)
+	}
+	s.tracked[hash] = trackedTransaction{
+		height:  height,
+		bucket:  bucket,
+		feeRate: feeRate,
+	}
+}
+
+// removeTx stops tracking a transaction and returns it, if it was tracked.
+func (s *smartFeeEstimator) removeTx(hash chainhash.Hash,
+	inBlock bool) (trackedTransaction, bool) {
+
+	tx, ok := s.tracked[hash]
+	if !ok {
+		return tx, false
+	}
+	for _, stats := range s.horizons() {
+		stats.removeTx(tx.height, s.bestHeight, tx.bucket, inBlock)
+	}
+	delete(s.tracked, hash)
+	return tx, true
+}
+
+// registerBlock records the confirmation of the tracked transactions in a new
+// block at the given height.  Blocks which aren't higher than the last one
+// recorded are ignored.
+func (s *smartFeeEstimator) registerBlock(height int32,
+	transactions []*btcutil.Tx) {
+
+	if height <= s.bestHeight {
+		return
+	}
+	s.bestHeight = height
+
+	for _, stats := range s.horizons() {
+		stats.clearCurrent(height)
+		stats.decayAverages()
+	}
+
+	var counted int
+	for _, t := range transactions {
+		tx, ok := s.removeTx(*t.Hash(), true)
+		if !ok {
+			continue
+		}
+		blocksToConfirm := int(height - tx.height)
+		if blocksToConfirm <= 0 {
+			continue
+		}
+		for _, stats := range s.horizons() {
+			stats.record(blocksToConfirm, tx.bucket, tx.feeRate)
+		}
+		counted++
+	}
+	if s.firstHeight == 0 && counted > 0 {
+		s.firstHeight = height
+	}
+
+	// Transactions which haven't confirmed within the long horizon have
+	// most likely left the mempool, so count them as having failed.
+	for hash, tx := range s.tracked {
+		if int(height-tx.height) > s.long.maxConfirms() {
+			s.removeTx(hash, false)
+		}
+	}
+}
+
+// maxUsableTarget returns the largest confirmation target there is enough
+// history to answer for.
+func (s *smartFeeEstimator) maxUsableTarget() int {
+	if s.firstHeight == 0 {
+		return 0
+	}
+	target := int(s.bestHeight-s.firstHeight) / 2
+	if target > s.long.maxConfirms() {
+		target = s.long.maxConfirms()
+	}
+	return target
+}
+
+// estimateCombinedFee returns the fee rate estimate for the given target from
+// the shortest horizon which covers it.  When checkShorterHorizon is set, the
+// estimates for the longest targets of the shorter horizons are used instead
+// if they are lower.
+func (s *smartFeeEstimator) estimateCombinedFee(confTarget int,
+	successThreshold float64, checkShorterHorizon bool) float64 {
+
+	if confTarget < 1 || confTarget > s.long.maxConfirms() {
+		return -1
+	}
+
+	var estimate float64
+	switch {
+	case confTarget <= s.short.maxConfirms():
+		estimate = s.short.estimateMedianFee(confTarget,
+			sufficientShortTxs, successThreshold, s.bestHeight)
+	case confTarget <= s.medium.maxConfirms():
+		estimate = s.medium.estimateMedianFee(confTarget,
+			sufficientFeeTxs, successThreshold, s.bestHeight)
+	default:
+		estimate = s.long.estimateMedianFee(confTarget,
+			sufficientFeeTxs, successThreshold, s.bestHeight)
+	}
+	if !checkShorterHorizon {
+		return estimate
+	}
+
+	if confTarget > s.medium.maxConfirms() {
+		mediumMax := s.medium.estimateMedianFee(s.medium.maxConfirms(),
+			sufficientFeeTxs, successThreshold, s.bestHeight)
+		if mediumMax > 0 && (estimate == -1 || mediumMax < estimate) {
+			estimate = mediumMax
+		}
+	}
+	if confTarget > s.short.maxConfirms() {
+		shortMax := s.short.estimateMedianFee(s.short.maxConfirms(),
+			sufficientShortTxs, successThreshold, s.bestHeight)
+		if shortMax > 0 && (estimate == -1 || shortMax < estimate) {
+			estimate = shortMax
+		}
+	}
+	return estimate
+}
+
+// estimateConservativeFee returns the highest fee rate estimate for the given
+// doubled target of the medium and long horizons, so that the estimate isn't
+// lowered by a recent drop in fee rates.
+func (s *smartFeeEstimator) estimateConservativeFee(doubleTarget int) float64 {
+	estimate := float64(-1)
+	if doubleTarget <= s.short.maxConfirms() {
+		estimate = s.medium.estimateMedianFee(doubleTarget,
+			sufficientFeeTxs, doubleSuccessPct, s.bestHeight)
+	}
+	if doubleTarget <= s.medium.maxConfirms() {
+		longEstimate := s.long.estimateMedianFee(doubleTarget,
+			sufficientFeeTxs, doubleSuccessPct, s.bestHeight)
+		if longEstimate > estimate {
+			estimate = longEstimate
+		}
+	}
+	return estimate
+}
+
+// estimateSmartFee returns the fee rate in satoshi per kilobyte needed to
+// confirm within confTarget blocks along with the target the estimate was
+// made for.
+func (s *smartFeeEstimator) estimateSmartFee(confTarget int,
+	conservative bool) (float64, int, error) {
+
+	if confTarget < 1 || confTarget > MaxSmartFeeTarget {
+		return -1, 0, fmt.Errorf("confirmation target must be between "+
+			"1 and %d", MaxSmartFeeTarget)
+	}
+
+	// A transaction can't be expected to confirm in the very next block,
+	// and targets which the estimator hasn't been running long enough to
+	// have seen are lowered to the largest it has.
+	if confTarget == 1 {
+		confTarget = 2
+	}
+	if maxTarget := s.maxUsableTarget(); confTarget > maxTarget {
+		confTarget = maxTarget
+	}
+	if confTarget <= 1 {
+		return -1, 0, errors.New("insufficient data or no feerate found")
+	}
+
+	// The estimate must meet a lower success rate within half the target
+	// and a higher one within double the target as well.
+	estimate := s.estimateCombinedFee(confTarget/2, halfSuccessPct, true)
+	actualEstimate := s.estimateCombinedFee(confTarget, successPct, true)
+	if actualEstimate > estimate {
+		estimate = actualEstimate
+	}
+	doubleEstimate := s.estimateCombinedFee(2*confTarget,
+		doubleSuccessPct, !conservative)
+	if doubleEstimate > estimate {
+		estimate = doubleEstimate
+	}
+	if conservative || estimate == -1 {
+		consEstimate := s.estimateConservativeFee(2 * confTarget)
+		if consEstimate > estimate {
+			estimate = consEstimate
+		}
+	}
+	if estimate < 0 {
+		return -1, confTarget, errors.New("insufficient data or no " +
+			"feerate found")
+	}
+	return estimate, confTarget, nil
+}
+
+// serialize writes the state of the smart fee estimator to w.  The
+// transactions it tracks are not saved since they are only meaningful for the
+// mempool they were seen in.
+func (s *smartFeeEstimator) serialize(w io.Writer) {
+	binary.Write(w, binary.BigEndian, s.bestHeight)
+	binary.Write(w, binary.BigEndian, s.firstHeight)
+	binary.Write(w, binary.BigEndian, uint32(len(smartFeeBuckets)))
+	for _, stats := range s.horizons() {
+		stats.serialize(w)
+	}
+}
+
+// deserializeSmartFeeEstimator reads a smart fee estimator written by
+// serialize from r.
+func deserializeSmartFeeEstimator(r io.Reader) (*smartFeeEstimator, error) {
+	s := newSmartFeeEstimator()
+	if err := binary.Read(r, binary.BigEndian, &s.bestHeight); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &s.firstHeight); err != nil {
+		return nil, err
+	}
+
+	var numBuckets uint32
+	if err := binary.Read(r, binary.BigEndian, &numBuckets); err != nil {
+		return nil, err
+	}
+	if int(numBuckets) != len(smartFeeBuckets) {
+		return nil, fmt.Errorf("Incorrect number of fee rate buckets: "+
+			"expected %d found %d", len(smartFeeBuckets), numBuckets)
+	}
+
+	for _, stats := range s.horizons() {
+		if err := stats.deserialize(r); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// EstimateSmartFee estimates the fee rate needed for a transaction to begin
+// confirmation within confTarget blocks, which must be between 1 and
+// MaxSmartFeeTarget.  Conservative estimates also require the fee rate to
+// have succeeded over the longer time horizons, so they are slower to follow
+// a drop in fee rates than economical ones.
+//
+// The confirmation target the estimate was made for is returned along with
+// it.  A target of one block is raised to two, and targets longer than the
+// estimator has been tracking blocks for are lowered to the longest it can
+// answer for.
+func (ef *FeeEstimator) EstimateSmartFee(confTarget uint32,
+	conservative bool) (BtcPerKilobyte, uint32, error) {
+
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	feeRate, target, err := ef.smart.estimateSmartFee(int(confTarget),
+		conservative)
+	if err != nil {
+		return -1, uint32(target), err
+	}
+	return BtcPerKilobyte(feeRate * btcPerSatoshi), uint32(target), nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"math"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestEstimateSmartFee ensures the smart fee estimator answers with the fee
+// rate of the transactions which confirm quickly, adjusts the confirmation
+// target to what it has enough history for, and keeps its data across a save
+// and restore.
+func TestEstimateSmartFee(t *testing.T) {
+	ef := newTestFeeEstimator(5, 3, 1)
+	eft := estimateFeeTester{ef: ef, t: t}
+
+	// Nothing can be estimated before any blocks have been seen.
+	if _, _, err := ef.EstimateSmartFee(2, false); err == nil {
+		t.Fatalf("EstimateSmartFee: got estimate without any blocks")
+	}
+	if _, _, err := ef.EstimateSmartFee(0, false); err == nil {
+		t.Fatalf("EstimateSmartFee: accepted target of zero blocks")
+	}
+	if _, _, err := ef.EstimateSmartFee(MaxSmartFeeTarget+1, false); err == nil {
+		t.Fatalf("EstimateSmartFee: accepted target beyond %d blocks",
+			MaxSmartFeeTarget)
+	}
+
+	// Every block confirms the transactions paying a high fee which
+	// entered the mempool since the last one, while those paying a low fee
+	// are left unconfirmed.
+	const highFee, lowFee = btcutil.Amount(500), btcutil.Amount(20)
+	var fast *TxDesc
+	for i := 0; i < 40; i++ {
+		var block []*wire.MsgTx
+		for j := 0; j < 10; j++ {
+			fast = eft.testTx(highFee)
+			ef.ObserveTransaction(fast)
+			ef.ObserveTransaction(eft.testTx(lowFee))
+			block = append(block, fast.Tx.MsgTx())
+		}
+		eft.newBlock(block)
+	}
+
+	// The fee rates are averaged from decaying sums, so allow for rounding.
+	expected := expectedFeePerKilobyte(fast)
+	matches := func(feeRate BtcPerKilobyte) bool {
+		return math.Abs(float64(feeRate-expected)) < 1e-12
+	}
+
+	tests := []struct {
+		target       uint32
+		conservative bool
+		wantTarget   uint32
+	}{
+		{target: 1, wantTarget: 2},
+		{target: 6, wantTarget: 6},
+		{target: 6, conservative: true, wantTarget: 6},
+		{target: MaxSmartFeeTarget, wantTarget: 19},
+	}
+	for _, test := range tests {
+		feeRate, target, err := ef.EstimateSmartFee(test.target,
+			test.conservative)
+		if err != nil {
+			t.Fatalf("EstimateSmartFee(%d, %v): unexpected error: %v",
+				test.target, test.conservative, err)
+		}
+		if target != test.wantTarget {
+			t.Fatalf("EstimateSmartFee(%d, %v): got target %d, want %d",
+				test.target, test.conservative, target,
+				test.wantTarget)
+		}
+		if !matches(feeRate) {
+			t.Fatalf("EstimateSmartFee(%d, %v): got fee rate %f, want "+
+				"%f", test.target, test.conservative, feeRate,
+				expected)
+		}
+	}
+
+	// The estimates must survive a save and restore.
+	restored, err := RestoreFeeEstimator(ef.Save())
+	if err != nil {
+		t.Fatalf("RestoreFeeEstimator: unexpected error: %v", err)
+	}
+	feeRate, target, err := restored.EstimateSmartFee(6, true)
+	if err != nil || target != 6 || !matches(feeRate) {
+		t.Fatalf("EstimateSmartFee: got fee rate %f for target %d and "+
+			"error %v after restore, want %f for target 6", feeRate,
+			target, err, expected)
+	}
+}
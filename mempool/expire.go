@@ -0,0 +1,47 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"time"
+)
+
+// DefaultExpiryAge is the default time after which transactions which have not
+// been mined are removed from the main pool.
+const DefaultExpiryAge = 14 * 24 * time.Hour
+
+// ExpireTransactions removes the transactions which entered the main pool
+// longer than the expiry age ago, along with all of the transactions which
+// depend on them, and calls OnTxRemoved for each of them.  It returns the
+// number of transactions removed.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ExpireTransactions() int {
+	expiryAge := mp.cfg.Policy.ExpiryAge
+	if expiryAge <= 0 {
+		return 0
+	}
+
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	cutoff := time.Now().Add(-expiryAge)
+	numTxs := len(mp.pool)
+	for _, txD := range mp.pool {
+		// Transactions which depend on an expired transaction may
+		// already have been removed along with it.
+		if !txD.Added.Before(cutoff) || !mp.isTransactionInPool(txD.Tx.Hash()) {
+			continue
+		}
+		mp.evictTransaction(txD, RemovalExpiry)
+	}
+
+	numExpired := numTxs - len(mp.pool)
+	if numExpired > 0 {
+		log.Infof("Expired %d transactions from the mempool which were "+
+			"not mined within %v", numExpired, expiryAge)
+	}
+	return numExpired
+}
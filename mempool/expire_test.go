@@ -0,0 +1,82 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestExpireTransactions ensures transactions which have been in the pool for
+// longer than the expiry age are removed along with their descendants, that
+// the removals are reported with the expiry reason, and that the fee estimator
+// stops tracking them.
+func TestExpireTransactions(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	removed := make(map[*btcutil.Tx]RemovalReason)
+	pool := harness.txPool
+	pool.cfg.Policy.ExpiryAge = time.Hour
+	pool.cfg.OnTxRemoved = func(tx *btcutil.Tx, reason RemovalReason) {
+		removed[tx] = reason
+	}
+	estimator := newTestFeeEstimator(5, 3, 1)
+	estimator.smart.bestHeight = harness.chain.BestHeight()
+	pool.cfg.FeeEstimator = estimator
+
+	// Only the parent is old enough to expire, but its child must go with
+	// it.
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	for _, tx := range chainedTxns {
+		acceptedTxs, err := pool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+		acceptedTxs[0].Added = time.Now()
+	}
+	pool.pool[*chainedTxns[1].Hash()].Added = time.Now().Add(-2 * time.Hour)
+
+	if n := pool.ExpireTransactions(); n != 2 {
+		t.Fatalf("ExpireTransactions: got %d removed transactions, "+
+			"want 2", n)
+	}
+	testPoolMembership(tc, chainedTxns[0], false, true)
+	for _, tx := range chainedTxns[1:] {
+		testPoolMembership(tc, tx, false, false)
+		if reason, ok := removed[tx]; !ok || reason != RemovalExpiry {
+			t.Fatalf("OnTxRemoved: transaction %v not reported as "+
+				"expired", tx.Hash())
+		}
+	}
+	if len(removed) != 2 {
+		t.Fatalf("OnTxRemoved: got %d removals, want 2", len(removed))
+	}
+
+	// The fee estimator stops tracking the removed transactions.
+	tracked := estimator.smart.tracked
+	if _, ok := tracked[*chainedTxns[0].Hash()]; !ok || len(tracked) != 1 {
+		t.Fatalf("RemoveTransaction: got %d tracked transactions, "+
+			"want only %v", len(tracked), chainedTxns[0].Hash())
+	}
+
+	// Nothing is removed when no transaction has expired.
+	if n := pool.ExpireTransactions(); n != 0 {
+		t.Fatalf("ExpireTransactions: got %d removed transactions, "+
+			"want 0", n)
+	}
+}
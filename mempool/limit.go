@@ -0,0 +1,272 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// DefaultMaxPoolSize is the default maximum total serialized size in
+	// bytes of the transactions in the main pool.
+	DefaultMaxPoolSize = 300 * 1000 * 1000
+
+	// rollingFeeHalfLife is the time it takes the rolling minimum fee to
+	// halve while the pool is at least half full.  It decays faster when
+	// the pool is less full.
+	rollingFeeHalfLife = 12 * time.Hour
+
+	// rollingFeeDecayInterval is the minimum time between updates of the
+	// decaying rolling minimum fee.
+	rollingFeeDecayInterval = 10 * time.Second
+)
+
+// trimToSize evicts the transactions with the lowest descendant package fee
+// rates, together with their descendants, until the main pool is no larger
+// than the maximum pool size.  The rolling minimum fee is raised above the
+// highest fee rate evicted by the minimum relay fee so the evicted
+// transactions can't simply be relayed back into the pool.
+//
+// The package fee rates are calculated once before evicting, so the fee
+// rates of the ancestors of evicted transactions are not recalculated.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) trimToSize() {
+	maxSize := mp.cfg.Policy.MaxPoolSize
+	if maxSize <= 0 || mp.poolSize <= maxSize {
+		return
+	}
+
+	type evictionCandidate struct {
+		txD     *TxDesc
+		feeRate float64
+	}
+	candidates := make([]evictionCandidate, 0, len(mp.pool))
+	for _, txD := range mp.pool {
+		candidates = append(candidates, evictionCandidate{
+			txD: txD,
+			feeRate: float64(txD.DescendantFees) * 1000 /
+				float64(txD.DescendantSize),
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].feeRate < candidates[j].feeRate
+	})
+
+	numTxs := len(mp.pool)
+	var maxFeeRate float64
+	for _, candidate := range candidates {
+		if mp.poolSize <= maxSize {
+			break
+		}
+		tx := candidate.txD.Tx
+		if !mp.isTransactionInPool(tx.Hash()) {
+			continue
+		}
+
+		log.Debugf("Evicting transaction %v with package fee rate %.0f "+
+			"satoshi/kB from the full mempool", tx.Hash(),
+			candidate.feeRate)
+		mp.evictTransaction(candidate.txD, RemovalSizeLimit)
+		maxFeeRate = math.Max(maxFeeRate, candidate.feeRate)
+	}
+
+	feeRate := maxFeeRate + float64(mp.cfg.Policy.MinRelayTxFee)
+	if feeRate > mp.rollingMinFee {
+		mp.rollingMinFee = feeRate
+		mp.rollingFeeUpdated = time.Now()
+		mp.rollingFeeBumpHeight = mp.cfg.BestHeight()
+	}
+	log.Infof("Evicted %d transactions from the full mempool, minimum "+
+		"fee rate is now %.0f satoshi/kB", numTxs-len(mp.pool),
+		mp.rollingMinFee)
+}
+
+// replacementTrimmed returns whether trimming the pool to the maximum pool size
+// after the passed conflicts, along with their descendants, are replaced by
+// the passed transaction paying the passed fee would evict the transaction
+// itself.  It follows the order in which trimToSize evicts transactions
+// without modifying the pool, so a replacement which would not survive is
+// rejected before the transactions it replaces are evicted.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) replacementTrimmed(tx *btcutil.Tx, fee int64, conflicts []*TxDesc) bool {
+	maxSize := mp.cfg.Policy.MaxPoolSize
+	if maxSize <= 0 {
+		return false
+	}
+
+	// Determine the size of the pool once the replaced transactions are
+	// removed and the replacement is added.
+	removed := make(map[chainhash.Hash]*TxDesc)
+	for _, conflict := range conflicts {
+		for _, txD := range append(mp.descendants(conflict.Tx), conflict) {
+			removed[*txD.Tx.Hash()] = txD
+		}
+	}
+	poolSize := mp.poolSize + int64(tx.MsgTx().SerializeSize())
+	for _, txD := range removed {
+		poolSize -= int64(txD.Tx.MsgTx().SerializeSize())
+	}
+	if poolSize <= maxSize {
+		return false
+	}
+
+	// Adjust the descendant package fees and sizes of the transactions
+	// which remain in the pool for the removed transactions and the
+	// replacement, as they will be once the replacement is added.
+	type packageStats struct {
+		fees, size int64
+	}
+	adjusted := make(map[chainhash.Hash]*packageStats)
+	adjust := func(txD *TxDesc, fees, size int64) {
+		stats, ok := adjusted[*txD.Tx.Hash()]
+		if !ok {
+			stats = &packageStats{txD.DescendantFees, txD.DescendantSize}
+			adjusted[*txD.Tx.Hash()] = stats
+		}
+		stats.fees += fees
+		stats.size += size
+	}
+	for _, txD := range removed {
+		for _, ancestor := range mp.ancestors(txD.Tx) {
+			if _, ok := removed[*ancestor.Tx.Hash()]; ok {
+				continue
+			}
+			adjust(ancestor, -mp.modifiedFee(txD),
+				-GetTxVirtualSize(txD.Tx))
+		}
+	}
+	txHash := tx.Hash()
+	txFee := fee + mp.feeDeltas[*txHash]
+	txSize := GetTxVirtualSize(tx)
+	ancestors := mp.ancestors(tx)
+	isAncestor := make(map[chainhash.Hash]struct{}, len(ancestors))
+	for _, ancestor := range ancestors {
+		isAncestor[*ancestor.Tx.Hash()] = struct{}{}
+		adjust(ancestor, txFee, txSize)
+	}
+
+	type evictionCandidate struct {
+		txD     *TxDesc
+		feeRate float64
+	}
+	candidates := make([]evictionCandidate, 0, len(mp.pool)+1)
+	for hash, txD := range mp.pool {
+		if _, ok := removed[hash]; ok {
+			continue
+		}
+		fees, size := txD.DescendantFees, txD.DescendantSize
+		if stats, ok := adjusted[hash]; ok {
+			fees, size = stats.fees, stats.size
+		}
+		candidates = append(candidates, evictionCandidate{
+			txD:     txD,
+			feeRate: float64(fees) * 1000 / float64(size),
+		})
+	}
+	candidates = append(candidates, evictionCandidate{
+		feeRate: float64(txFee) * 1000 / float64(txSize),
+	})
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].feeRate < candidates[j].feeRate
+	})
+
+	// Evict the candidates along with their descendants until the pool
+	// is small enough.  The candidate without a descriptor is the
+	// replacement.
+	evicted := make(map[chainhash.Hash]struct{})
+	for _, candidate := range candidates {
+		if poolSize <= maxSize {
+			break
+		}
+		if candidate.txD == nil {
+			return true
+		}
+		hash := *candidate.txD.Tx.Hash()
+		if _, ok := evicted[hash]; ok {
+			continue
+		}
+		if _, ok := isAncestor[hash]; ok {
+			return true
+		}
+		for _, txD := range append(mp.descendants(candidate.txD.Tx),
+			candidate.txD) {
+
+			hash := *txD.Tx.Hash()
+			if _, ok := removed[hash]; ok {
+				continue
+			}
+			if _, ok := evicted[hash]; ok {
+				continue
+			}
+			evicted[hash] = struct{}{}
+			poolSize -= int64(txD.Tx.MsgTx().SerializeSize())
+		}
+	}
+	return false
+}
+
+// rollingMinFeeRate returns the rolling minimum fee rate in satoshi/kB, or zero
+// when the pool has not been full recently.  Once a block has been connected
+// since it was last raised, the rolling minimum fee decays exponentially and
+// is reset to zero when it falls below half the minimum relay fee.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) rollingMinFeeRate() int64 {
+	if mp.rollingMinFee == 0 {
+		return 0
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(mp.rollingFeeUpdated)
+	if mp.cfg.BestHeight() > mp.rollingFeeBumpHeight &&
+		elapsed > rollingFeeDecayInterval {
+
+		halfLife := rollingFeeHalfLife
+		maxSize := mp.cfg.Policy.MaxPoolSize
+		switch {
+		case mp.poolSize < maxSize/4:
+			halfLife /= 4
+		case mp.poolSize < maxSize/2:
+			halfLife /= 2
+		}
+		mp.rollingMinFee /= math.Pow(2, elapsed.Seconds()/
+			halfLife.Seconds())
+		mp.rollingFeeUpdated = now
+
+		minRelayTxFee := float64(mp.cfg.Policy.MinRelayTxFee)
+		if mp.rollingMinFee < minRelayTxFee/2 {
+			mp.rollingMinFee = 0
+			return 0
+		}
+	}
+
+	if mp.rollingMinFee < float64(mp.cfg.Policy.MinRelayTxFee) {
+		return int64(mp.cfg.Policy.MinRelayTxFee)
+	}
+	return int64(mp.rollingMinFee)
+}
+
+// MinFeeRate returns the minimum fee rate in satoshi/kB transactions must pay
+// to be relayed into the pool.  It is the minimum relay fee unless the pool
+// has recently been full, in which case it is the rolling minimum fee.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MinFeeRate() btcutil.Amount {
+	mp.mtx.Lock()
+	feeRate := mp.rollingMinFeeRate()
+	mp.mtx.Unlock()
+
+	if feeRate < int64(mp.cfg.Policy.MinRelayTxFee) {
+		return mp.cfg.Policy.MinRelayTxFee
+	}
+	return btcutil.Amount(feeRate)
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestPoolSizeLimit ensures the transactions with the lowest descendant package
+// fee rates are evicted when the pool grows beyond its maximum size, that the
+// rolling minimum fee then rejects transactions paying as little as the
+// evicted ones, and that it decays after a block.
+func TestPoolSizeLimit(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// Add a coinbase with several outputs to spend independently.
+	coinbase, err := harness.CreateCoinbaseTx(1, 4)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, 1)
+	var outputs []spendableOutput
+	for i := uint32(0); i < 4; i++ {
+		outputs = append(outputs, txOutToSpendableOut(coinbase, i))
+	}
+
+	createTx := func(input spendableOutput, fee btcutil.Amount) *btcutil.Tx {
+		t.Helper()
+		tx, err := harness.CreateSignedTxWithFee([]spendableOutput{input},
+			1, fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+	pool := harness.txPool
+	accept := func(tx *btcutil.Tx) {
+		t.Helper()
+		if _, err := pool.ProcessTransaction(tx, false, false, 0); err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+	}
+
+	// The low fee parent is protected from eviction by its high fee child,
+	// which leaves the medium fee transaction with the lowest package fee
+	// rate.
+	low := createTx(outputs[0], 1000)
+	child := createTx(txOutToSpendableOut(low, 0), 10000)
+	medium := createTx(outputs[1], 3000)
+	for _, tx := range []*btcutil.Tx{low, child, medium} {
+		accept(tx)
+	}
+	if pool.MinFeeRate() != pool.cfg.Policy.MinRelayTxFee {
+		t.Fatalf("MinFeeRate: got %v before the pool was full, want %v",
+			pool.MinFeeRate(), pool.cfg.Policy.MinRelayTxFee)
+	}
+
+	pool.cfg.Policy.MaxPoolSize = pool.poolSize
+	high := createTx(outputs[2], 20000)
+	accept(high)
+	testPoolMembership(tc, low, false, true)
+	testPoolMembership(tc, child, false, true)
+	testPoolMembership(tc, medium, false, false)
+	testPoolMembership(tc, high, false, true)
+
+	// Transactions paying the fee rate of the evicted transaction are now
+	// rejected.
+	mediumFeeRate := 3000 * 1000 / GetTxVirtualSize(medium)
+	if int64(pool.MinFeeRate()) <= mediumFeeRate {
+		t.Fatalf("MinFeeRate: got %v, want more than %v",
+			pool.MinFeeRate(), mediumFeeRate)
+	}
+	_, err = pool.ProcessTransaction(createTx(outputs[3], 3000), false,
+		false, 0)
+	if code, _ := extractRejectCode(err); code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessTransaction: got %v, want insufficient fee "+
+			"rejection", err)
+	}
+
+	// The rolling minimum fee only decays once a block has been connected.
+	pool.rollingFeeUpdated = time.Now().Add(-2 * rollingFeeHalfLife)
+	minFeeRate := pool.MinFeeRate()
+	if minFeeRate <= btcutil.Amount(mediumFeeRate) {
+		t.Fatalf("MinFeeRate: decayed to %v without a block", minFeeRate)
+	}
+	harness.chain.SetHeight(harness.chain.BestHeight() + 1)
+	if decayed := pool.MinFeeRate(); decayed > minFeeRate/3 {
+		t.Fatalf("MinFeeRate: got %v after two half-lives, want at "+
+			"most %v", decayed, minFeeRate/3)
+	}
+}
+
+// TestReplacementSizeLimit ensures a replacement which would be evicted from a
+// full pool right away is rejected without evicting the transactions it
+// replaces, while one paying enough to stay in the pool is accepted.
+func TestReplacementSizeLimit(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// Add a coinbase with several outputs to spend independently.
+	coinbase, err := harness.CreateCoinbaseTx(1, 2)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, 1)
+	outputs := []spendableOutput{
+		txOutToSpendableOut(coinbase, 0),
+		txOutToSpendableOut(coinbase, 1),
+	}
+
+	createTx := func(input spendableOutput, numOutputs uint32,
+		fee btcutil.Amount) *btcutil.Tx {
+
+		t.Helper()
+		tx, err := harness.CreateReplaceableTx([]spendableOutput{input},
+			numOutputs, fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+	pool := harness.txPool
+	original := createTx(outputs[0], 1, 1000)
+	other := createTx(outputs[1], 1, 20000)
+	for _, tx := range []*btcutil.Tx{original, other} {
+		_, err := pool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+	}
+
+	// The replacement is larger than the transaction it replaces, so the
+	// pool is trimmed after adding it.  It has the lowest fee rate, so it
+	// would be evicted right away.
+	pool.cfg.Policy.MaxPoolSize = pool.poolSize
+	replacement := createTx(outputs[0], 2, 2000)
+	_, err = pool.ProcessTransaction(replacement, false, false, 0)
+	if code, _ := extractRejectCode(err); code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessTransaction: got %v, want insufficient fee "+
+			"rejection", err)
+	}
+	testPoolMembership(tc, original, false, true)
+	testPoolMembership(tc, other, false, true)
+	testPoolMembership(tc, replacement, false, false)
+
+	// A replacement paying more than the other transaction evicts it
+	// instead.
+	replacement = createTx(outputs[0], 2, 50000)
+	_, err = pool.ProcessTransaction(replacement, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid "+
+			"replacement %v", err)
+	}
+	testPoolMembership(tc, original, false, false)
+	testPoolMembership(tc, other, false, false)
+	testPoolMembership(tc, replacement, false, true)
+}
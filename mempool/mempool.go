@@ -93,6 +93,20 @@ type Config struct {
 	// FeeEstimatator provides a feeEstimator. If it is not nil, the mempool
 	// records all new transactions it observes into the feeEstimator.
 	FeeEstimator *FeeEstimator
+
+	// OnTxAdded defines the optional function to call when a transaction
+	// is added to the pool, including transactions added back to the pool
+	// when a block is disconnected and transactions loaded from the
+	// mempool dump.  It is called with the mempool lock held, so it must
+	// not call back into the pool.
+	OnTxAdded func(txD *TxDesc)
+
+	// OnTxRemoved defines the optional function to call when a transaction
+	// is removed from the pool for any reason other than being mined, such
+	// as when it expires or is evicted from the full pool, along with the
+	// reason.  It is called with the mempool lock held, so it must not call
+	// back into the pool.
+	OnTxRemoved func(tx *btcutil.Tx, reason RemovalReason)
 }
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -133,6 +147,84 @@ type Policy struct {
 	// MinRelayTxFee defines the minimum transaction fee in BTC/kB to be
 	// considered a non-zero fee.
 	MinRelayTxFee btcutil.Amount
+
+	// MaxPoolSize is the maximum total serialized size in bytes of the
+	// transactions in the main pool.  The transactions with the lowest
+	// descendant package fee rates are evicted when it is exceeded.  Zero
+	// means the size is not limited.
+	MaxPoolSize int64
+
+	// ExpiryAge is the time after which transactions which have not been
+	// mined are removed from the main pool, along with the transactions
+	// which depend on them, by ExpireTransactions.  Zero means
+	// transactions never expire.
+	ExpiryAge time.Duration
+
+	// FullRBF defines whether transactions which conflict with transactions
+	// in the pool may replace them even when neither the conflicting
+	// transactions nor their ancestors signal BIP125 replaceability.
+	FullRBF bool
+
+	// MaxAncestorCount and MaxAncestorSize are the maximum number of
+	// transactions and total virtual size of a transaction together with
+	// the transactions in the pool it depends on.  Zero means the limit is
+	// not enforced.
+	MaxAncestorCount int64
+	MaxAncestorSize  int64
+
+	// MaxDescendantCount and MaxDescendantSize are the maximum number of
+	// transactions and total virtual size of a transaction in the pool
+	// together with the transactions in the pool which depend on it.  Zero
+	// means the limit is not enforced.
+	MaxDescendantCount int64
+	MaxDescendantSize  int64
+}
+
+// RemovalReason describes why the pool removed a transaction on its own.
+type RemovalReason int
+
+const (
+	// RemovalExpiry indicates the transaction, or a transaction it depends
+	// on, has been in the pool for longer than the expiry age.
+	RemovalExpiry RemovalReason = iota
+
+	// RemovalSizeLimit indicates the transaction was evicted from the full
+	// pool because it had one of the lowest descendant package fee rates,
+	// or depended on such a transaction.
+	RemovalSizeLimit
+
+	// RemovalReplaced indicates the transaction was replaced by a
+	// conflicting transaction paying a higher fee under the BIP125
+	// replacement rules, or depended on such a transaction.
+	RemovalReplaced
+
+	// RemovalConflict indicates the transaction, or a transaction it
+	// depends on, spent an output which was also spent by a transaction in
+	// a newly connected block.
+	RemovalConflict
+
+	// RemovalPackageRejected indicates the transaction was added to the
+	// pool as part of a package which was rejected once another of its
+	// transactions turned out to be invalid, or it depended on such a
+	// transaction.
+	RemovalPackageRejected
+)
+
+// Map of removal reasons back to their constant names for pretty printing.
+var removalReasonStrings = map[RemovalReason]string{
+	RemovalExpiry:          "expiry",
+	RemovalSizeLimit:       "sizelimit",
+	RemovalReplaced:        "replaced",
+	RemovalConflict:        "conflict",
+	RemovalPackageRejected: "packagerejected",
+}
+
+// String returns the RemovalReason in human-readable form.
+func (r RemovalReason) String() string {
+	if s, ok := removalReasonStrings[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown RemovalReason (%d)", int(r))
 }
 
 // TxDesc is a descriptor containing a transaction in the mempool along with
@@ -143,6 +235,21 @@ type TxDesc struct {
 	// StartingPriority is the priority of the transaction when it was added
 	// to the pool.
 	StartingPriority float64
+
+	// AncestorCount, AncestorSize and AncestorFees are the number of
+	// transactions, total virtual size and total fees of the transaction
+	// together with all of the transactions in the pool it depends on.
+	AncestorCount int64
+	AncestorSize  int64
+	AncestorFees  int64
+
+	// DescendantCount, DescendantSize and DescendantFees are the number of
+	// transactions, total virtual size and total fees of the transaction
+	// together with all of the transactions in the pool which depend on
+	// it.
+	DescendantCount int64
+	DescendantSize  int64
+	DescendantFees  int64
 }
 
 // orphanTx is normal transaction that references an ancestor transaction
@@ -164,12 +271,36 @@ type TxPool struct {
 	mtx           sync.RWMutex
 	cfg           Config
 	pool          map[chainhash.Hash]*TxDesc
+	poolWitness   map[chainhash.Hash]*TxDesc
 	orphans       map[chainhash.Hash]*orphanTx
+	orphanWitness map[chainhash.Hash]*orphanTx
 	orphansByPrev map[wire.OutPoint]map[chainhash.Hash]*btcutil.Tx
 	outpoints     map[wire.OutPoint]*btcutil.Tx
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
 
+	// feeDeltas houses the adjustments, in satoshi, to the fees of
+	// transactions by their hash.  Transactions need not be in the pool
+	// to have a fee delta, and the deltas are kept in the mempool dump.
+	feeDeltas map[chainhash.Hash]int64
+
+	// feeRejects houses recently rejected transactions which paid too low
+	// a fee, by their hash, so they can be accepted together with a child
+	// paying for them when it arrives.
+	feeRejects map[chainhash.Hash]*btcutil.Tx
+
+	// poolSize is the total serialized size of the transactions in the
+	// main pool.
+	poolSize int64
+
+	// rollingMinFee is the fee rate in satoshi/kB transactions must pay to
+	// enter the pool after it was trimmed to its maximum size.  It decays
+	// once blocks have been connected since it was last raised.  See
+	// rollingMinFeeRate.
+	rollingMinFee        float64
+	rollingFeeUpdated    time.Time
+	rollingFeeBumpHeight int32
+
 	// nextExpireScan is the time after which the orphan pool will be
 	// scanned in order to evict orphans.  This is NOT a hard deadline as
 	// the scan will only run when an orphan is added to the pool as opposed
@@ -219,6 +350,7 @@ func (mp *TxPool) removeOrphan(tx *btcutil.Tx, removeRedeemers bool) {
 
 	// Remove the transaction from the orphan pool.
 	delete(mp.orphans, *txHash)
+	delete(mp.orphanWitness, *otx.tx.WitnessHash())
 }
 
 // RemoveOrphan removes the passed orphan transaction from the orphan pool and
@@ -315,11 +447,13 @@ func (mp *TxPool) addOrphan(tx *btcutil.Tx, tag Tag) {
 	// orphan if space is still needed.
 	mp.limitNumOrphans()
 
-	mp.orphans[*tx.Hash()] = &orphanTx{
+	otx := &orphanTx{
 		tx:         tx,
 		tag:        tag,
 		expiration: time.Now().Add(orphanTTL),
 	}
+	mp.orphans[*tx.Hash()] = otx
+	mp.orphanWitness[*tx.WitnessHash()] = otx
 	for _, txIn := range tx.MsgTx().TxIn {
 		if _, exists := mp.orphansByPrev[txIn.PreviousOutPoint]; !exists {
 			mp.orphansByPrev[txIn.PreviousOutPoint] =
@@ -434,6 +568,18 @@ func (mp *TxPool) haveTransaction(hash *chainhash.Hash) bool {
 	return mp.isTransactionInPool(hash) || mp.isOrphanInPool(hash)
 }
 
+// haveTransactionByWitnessHash returns whether or not a transaction with the
+// passed witness hash already exists in the main pool or in the orphan pool.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) haveTransactionByWitnessHash(hash *chainhash.Hash) bool {
+	if _, exists := mp.poolWitness[*hash]; exists {
+		return true
+	}
+	_, exists := mp.orphanWitness[*hash]
+	return exists
+}
+
 // HaveTransaction returns whether or not the passed transaction already exists
 // in the main pool or in the orphan pool.
 //
@@ -447,6 +593,22 @@ func (mp *TxPool) HaveTransaction(hash *chainhash.Hash) bool {
 	return haveTx
 }
 
+// HaveTransactionByWitnessHash returns whether or not a transaction with the
+// passed witness hash already exists in the main pool or in the orphan pool.
+// Unlike the transaction hash, the witness hash commits to the witness data,
+// so a transaction with the same hash but a different witness is not
+// reported.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) HaveTransactionByWitnessHash(hash *chainhash.Hash) bool {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	haveTx := mp.haveTransactionByWitnessHash(hash)
+	mp.mtx.RUnlock()
+
+	return haveTx
+}
+
 // removeTransaction is the internal function which implements the public
 // RemoveTransaction.  See the comment for RemoveTransaction for more details.
 //
@@ -471,15 +633,75 @@ func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 			mp.cfg.AddrIndex.RemoveUnconfirmedTx(txHash)
 		}
 
-		// Mark the referenced outpoints as unspent by the pool.
-		for _, txIn := range txDesc.Tx.MsgTx().TxIn {
-			delete(mp.outpoints, txIn.PreviousOutPoint)
-		}
-		delete(mp.pool, *txHash)
+		mp.unlinkTransaction(txDesc)
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 	}
 }
 
+// linkTransaction adds the passed transaction descriptor to the pool, marks
+// the outpoints it references as spent by the pool and updates the package
+// statistics of the transactions related to it.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) linkTransaction(txD *TxDesc) {
+	tx := txD.Tx
+	mp.pool[*tx.Hash()] = txD
+	mp.poolWitness[*tx.WitnessHash()] = txD
+	mp.poolSize += int64(tx.MsgTx().SerializeSize())
+	for _, txIn := range tx.MsgTx().TxIn {
+		mp.outpoints[txIn.PreviousOutPoint] = tx
+	}
+	mp.addPackageStats(txD, mp.ancestors(tx), mp.descendants(tx))
+}
+
+// unlinkTransaction reverses linkTransaction for the passed transaction
+// descriptor, which must be in the pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) unlinkTransaction(txD *TxDesc) {
+	// Gather the transactions whose package statistics change once the
+	// transaction is removed.
+	tx := txD.Tx
+	ancestors := mp.ancestors(tx)
+	descendants := mp.descendants(tx)
+
+	// Mark the referenced outpoints as unspent by the pool.
+	for _, txIn := range tx.MsgTx().TxIn {
+		delete(mp.outpoints, txIn.PreviousOutPoint)
+	}
+	delete(mp.pool, *tx.Hash())
+	delete(mp.poolWitness, *tx.WitnessHash())
+	mp.poolSize -= int64(tx.MsgTx().SerializeSize())
+	mp.removePackageStats(txD, ancestors, descendants)
+}
+
+// evictTransaction removes the passed transaction along with all of the
+// transactions which depend on it from the pool for the passed reason.  The
+// fee estimator stops tracking each of them since they weren't mined, and
+// OnTxRemoved is called for each of them.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) evictTransaction(txD *TxDesc, reason RemovalReason) {
+	removed := append([]*TxDesc{txD}, mp.descendants(txD.Tx)...)
+	mp.removeTransaction(txD.Tx, true)
+	for _, desc := range removed {
+		log.Debugf("Removed transaction %v from the mempool (%v)",
+			desc.Tx.Hash(), reason)
+
+		// Transactions which conflict with a block can't be mined, so
+		// their fee deltas are of no use anymore.
+		if reason == RemovalConflict {
+			delete(mp.feeDeltas, *desc.Tx.Hash())
+		}
+		if mp.cfg.FeeEstimator != nil {
+			mp.cfg.FeeEstimator.RemoveTransaction(desc.Tx.Hash())
+		}
+		if mp.cfg.OnTxRemoved != nil {
+			mp.cfg.OnTxRemoved(desc.Tx, reason)
+		}
+	}
+}
+
 // RemoveTransaction removes the passed transaction from the mempool. When the
 // removeRedeemers flag is set, any transactions that redeem outputs from the
 // removed transaction will also be removed recursively from the mempool, as
@@ -497,16 +719,20 @@ func (mp *TxPool) RemoveTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 // passed transaction from the memory pool.  Removing those transactions then
 // leads to removing all transactions which rely on them, recursively.  This is
 // necessary when a block is connected to the main chain because the block may
-// contain transactions which were previously unknown to the memory pool.
+// contain transactions which were previously unknown to the memory pool.  The
+// fee deltas of the passed transaction and of the removed transactions are
+// cleared since none of them can be mined anymore.
 //
 // This function is safe for concurrent access.
 func (mp *TxPool) RemoveDoubleSpends(tx *btcutil.Tx) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
+	delete(mp.feeDeltas, *tx.Hash())
 	for _, txIn := range tx.MsgTx().TxIn {
 		if txRedeemer, ok := mp.outpoints[txIn.PreviousOutPoint]; ok {
 			if !txRedeemer.Hash().IsEqual(tx.Hash()) {
-				mp.removeTransaction(txRedeemer, true)
+				mp.evictTransaction(mp.pool[*txRedeemer.Hash()],
+					RemovalConflict)
 			}
 		}
 	}
@@ -532,10 +758,7 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 		StartingPriority: mining.CalcPriority(tx.MsgTx(), utxoView, height),
 	}
 
-	mp.pool[*tx.Hash()] = txD
-	for _, txIn := range tx.MsgTx().TxIn {
-		mp.outpoints[txIn.PreviousOutPoint] = tx
-	}
+	mp.linkTransaction(txD)
 	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 
 	// Add unconfirmed address index entries associated with the transaction
@@ -549,26 +772,39 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 		mp.cfg.FeeEstimator.ObserveTransaction(txD)
 	}
 
+	if mp.cfg.OnTxAdded != nil {
+		mp.cfg.OnTxAdded(txD)
+	}
+
 	return txD
 }
 
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
-// Note it does not check for double spends against transactions already in the
-// main chain.
+// Spending them is only allowed when every such transaction may be replaced
+// under the BIP125 rules, in which case true is returned to indicate the
+// transaction is a potential replacement.  Note it does not check for double
+// spends against transactions already in the main chain.
 //
 // This function MUST be called with the mempool lock held (for reads).
-func (mp *TxPool) checkPoolDoubleSpend(tx *btcutil.Tx) error {
+func (mp *TxPool) checkPoolDoubleSpend(tx *btcutil.Tx) (bool, error) {
+	var isReplacement bool
+	cache := make(map[chainhash.Hash]struct{})
 	for _, txIn := range tx.MsgTx().TxIn {
-		if txR, exists := mp.outpoints[txIn.PreviousOutPoint]; exists {
+		txR, exists := mp.outpoints[txIn.PreviousOutPoint]
+		if !exists {
+			continue
+		}
+		if !mp.cfg.Policy.FullRBF && !mp.signalsReplacement(txR, cache) {
 			str := fmt.Sprintf("output %v already spent by "+
 				"transaction %v in the memory pool",
 				txIn.PreviousOutPoint, txR.Hash())
-			return txRuleError(wire.RejectDuplicate, str)
+			return false, txRuleError(wire.RejectDuplicate, str)
 		}
+		isReplacement = true
 	}
 
-	return nil
+	return isReplacement, nil
 }
 
 // CheckSpend checks whether the passed outpoint is already spent by a
@@ -631,12 +867,84 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash) (*btcutil.Tx, error)
 	return nil, fmt.Errorf("transaction is not in the pool")
 }
 
-// maybeAcceptTransaction is the internal function which implements the public
-// MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
-// more details.
+// FetchTransactionByWitnessHash returns the transaction with the passed witness
+// hash from the transaction pool.  This only fetches from the main transaction
+// pool and does not include orphans.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FetchTransactionByWitnessHash(wtxHash *chainhash.Hash) (*btcutil.Tx, error) {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	txDesc, exists := mp.poolWitness[*wtxHash]
+	mp.mtx.RUnlock()
+
+	if exists {
+		return txDesc.Tx, nil
+	}
+
+	return nil, fmt.Errorf("transaction is not in the pool")
+}
+
+// modifiedFee returns the fee of the passed transaction adjusted by the fee
+// delta it was prioritised with, if any.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) modifiedFee(txD *TxDesc) int64 {
+	return txD.Fee + mp.feeDeltas[*txD.Tx.Hash()]
+}
+
+// PrioritiseTransaction adds the passed delta, in satoshi, to the fee delta of
+// the transaction with the passed hash.  The fee delta adjusts the fee of the
+// transaction when deciding whether to accept it to the pool, when evicting
+// transactions from a full pool and when selecting transactions for block
+// templates, without changing the fee the transaction actually pays.  The
+// transaction need not be in the pool, in which case the fee delta applies
+// once it is added.  Fee deltas are kept in the mempool dump until the
+// transaction is mined or conflicts with a mined transaction.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) PrioritiseTransaction(txHash *chainhash.Hash, delta int64) {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	mp.feeDeltas[*txHash] += delta
+	if mp.feeDeltas[*txHash] == 0 {
+		delete(mp.feeDeltas, *txHash)
+	}
+
+	// Update the modified fees of the packages the transaction is part of
+	// when it's in the pool.
+	if txD, exists := mp.pool[*txHash]; exists {
+		txD.AncestorFees += delta
+		txD.DescendantFees += delta
+		shiftPackageStats(mp.ancestors(txD.Tx), mp.descendants(txD.Tx),
+			0, 0, delta)
+		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+	}
+
+	log.Debugf("Prioritised transaction %v with a fee delta of %d "+
+		"(total %d)", txHash, delta, mp.feeDeltas[*txHash])
+}
+
+// txValidation houses the details of a transaction which passed validation that
+// are needed to add it to the pool.
+type txValidation struct {
+	utxoView  *blockchain.UtxoViewpoint
+	height    int32
+	fee       int64
+	conflicts []*TxDesc
+}
+
+// validateTransaction performs all of the policy and consensus checks required
+// to accept the passed transaction to the pool without modifying the pool.
+// Only the penny-flooding rate limiter is updated when the rateLimit flag is
+// set.  See maybeAcceptTransaction for the meaning of the flags.
+//
+// If the transaction is an orphan, each unknown referenced parent is
+// returned.  Otherwise the details needed to add the transaction are returned.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+func (mp *TxPool) validateTransaction(tx *btcutil.Tx, isNew, rateLimit, rejectDupOrphans, inPackage bool) ([]*chainhash.Hash, *txValidation, error) {
 	txHash := tx.Hash()
 
 	// If a transaction has iwtness data, and segwit isn't active yet, If
@@ -720,11 +1028,24 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	// at this point.  There is a more in-depth check that happens later
 	// after fetching the referenced transaction inputs from the main chain
 	// which examines the actual spend data and prevents double spends.
-	err = mp.checkPoolDoubleSpend(tx)
+	//
+	// Transactions which only double spend transactions that may be
+	// replaced under the BIP125 rules are potential replacements and are
+	// validated against the transactions they conflict with below.
+	isReplacement, err := mp.checkPoolDoubleSpend(tx)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// Replacements can't be part of a package since the transactions they
+	// evict could not be restored if another transaction of the package is
+	// rejected.
+	if inPackage && isReplacement {
+		str := fmt.Sprintf("package transaction %v double spends "+
+			"transactions in the memory pool", txHash)
+		return nil, nil, txRuleError(wire.RejectDuplicate, str)
+	}
+
 	// Fetch all of the unspent transaction outputs referenced by the inputs
 	// to this transaction.  This function also attempts to fetch the
 	// transaction itself to be used for detecting a duplicate transaction
@@ -839,6 +1160,10 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 		return nil, nil, txRuleError(wire.RejectNonstandard, str)
 	}
 
+	// The fee checks below use the fee of the transaction adjusted by the
+	// fee delta it was prioritised with, if any.
+	modifiedFee := txFee + mp.feeDeltas[*txHash]
+
 	// Don't allow transactions with fees too low to get into a mined block.
 	//
 	// Most miners allow a free transaction area in blocks they mine to go
@@ -853,18 +1178,39 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	serializedSize := GetTxVirtualSize(tx)
 	minFee := calcMinRequiredTxRelayFee(serializedSize,
 		mp.cfg.Policy.MinRelayTxFee)
-	if serializedSize >= (DefaultBlockPrioritySize-1000) && txFee < minFee {
+	if !inPackage && serializedSize >= (DefaultBlockPrioritySize-1000) &&
+		modifiedFee < minFee {
+
 		str := fmt.Sprintf("transaction %v has %d fees which is under "+
-			"the required amount of %d", txHash, txFee,
+			"the required amount of %d", txHash, modifiedFee,
 			minFee)
 		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
 	}
 
+	// Don't allow transactions which pay less than the rolling minimum fee
+	// rate of a pool which has recently been full, since they would be the
+	// first to be evicted again.  Transactions which are being added back
+	// to the memory pool from blocks that have been disconnected during a
+	// reorg are exempted.
+	rollingFeeRate := mp.rollingMinFeeRate()
+	if !inPackage && isNew && rollingFeeRate > 0 {
+		rollingFee := calcMinRequiredTxRelayFee(serializedSize,
+			btcutil.Amount(rollingFeeRate))
+		if modifiedFee < rollingFee {
+			str := fmt.Sprintf("transaction %v has %d fees which is "+
+				"under the mempool minimum fee of %d", txHash,
+				modifiedFee, rollingFee)
+			return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
+	}
+
 	// Require that free transactions have sufficient priority to be mined
 	// in the next block.  Transactions which are being added back to the
 	// memory pool from blocks that have been disconnected during a reorg
 	// are exempted.
-	if isNew && !mp.cfg.Policy.DisableRelayPriority && txFee < minFee {
+	if !inPackage && isNew && !mp.cfg.Policy.DisableRelayPriority &&
+		modifiedFee < minFee {
+
 		currentPriority := mining.CalcPriority(tx.MsgTx(), utxoView,
 			nextBlockHeight)
 		if currentPriority <= mining.MinHighPriority {
@@ -877,7 +1223,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 
 	// Free-to-relay transactions are rate limited here to prevent
 	// penny-flooding with tiny transactions as a form of attack.
-	if rateLimit && txFee < minFee {
+	if !inPackage && rateLimit && modifiedFee < minFee {
 		nowUnix := time.Now().Unix()
 		// Decay passed data with an exponentially decaying ~10 minute
 		// window - matches bitcoind handling.
@@ -899,6 +1245,23 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 			mp.cfg.Policy.FreeTxRelayLimit*10*1000)
 	}
 
+	// Don't allow transactions which would create chains of unconfirmed
+	// transactions longer or larger than allowed by the policy.
+	err = mp.checkPackageLimits(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Ensure a transaction which double spends transactions in the pool
+	// satisfies the BIP125 rules for replacing them.
+	var conflicts []*TxDesc
+	if isReplacement {
+		conflicts, err = mp.validateReplacement(tx, modifiedFee)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Verify crypto signatures for each input and reject the transaction if
 	// any don't verify.
 	err = blockchain.ValidateTransactionScripts(tx, utxoView,
@@ -911,8 +1274,69 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 		return nil, nil, err
 	}
 
+	return nil, &txValidation{
+		utxoView:  utxoView,
+		height:    bestHeight,
+		fee:       txFee,
+		conflicts: conflicts,
+	}, nil
+}
+
+// maybeAcceptTransaction is the internal function which implements the public
+// MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
+// more details.
+//
+// The inPackage flag indicates the transaction is accepted as part of a
+// package whose combined fee rate has already been checked, so the fee checks
+// of the individual transaction are skipped and the pool is not trimmed.  The
+// caller is responsible for trimming the pool once the whole package has been
+// added.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejectDupOrphans, inPackage bool) ([]*chainhash.Hash, *TxDesc, error) {
+	txHash := tx.Hash()
+	missingParents, v, err := mp.validateTransaction(tx, isNew, rateLimit,
+		rejectDupOrphans, inPackage)
+	if err != nil || len(missingParents) > 0 {
+		return missingParents, nil, err
+	}
+
+	// Reject a replacement which would be evicted from a full pool right
+	// away, since the transactions it replaces could not be restored.
+	if !inPackage && len(v.conflicts) > 0 &&
+		mp.replacementTrimmed(tx, v.fee, v.conflicts) {
+
+		str := fmt.Sprintf("transaction %v was not accepted because "+
+			"the mempool is full", txHash)
+		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
+	// Remove the transactions being replaced along with their descendants
+	// before adding the replacement.
+	txFeePerKB := v.fee * 1000 / GetTxVirtualSize(tx)
+	for _, conflict := range v.conflicts {
+		if !mp.isTransactionInPool(conflict.Tx.Hash()) {
+			continue
+		}
+		log.Debugf("Replacing transaction %v (fee rate %v satoshi/kB) "+
+			"with %v (fee rate %v satoshi/kB)", conflict.Tx.Hash(),
+			conflict.FeePerKB, txHash, txFeePerKB)
+		mp.evictTransaction(conflict, RemovalReplaced)
+	}
+
 	// Add to transaction pool.
-	txD := mp.addTransaction(utxoView, tx, bestHeight, txFee)
+	txD := mp.addTransaction(v.utxoView, tx, v.height, v.fee)
+
+	// Evict the transactions with the lowest fee rates when the pool has
+	// grown too large, which may include the transaction itself.
+	if !inPackage {
+		mp.trimToSize()
+	}
+	if !mp.isTransactionInPool(txHash) {
+		str := fmt.Sprintf("transaction %v was not accepted because "+
+			"the mempool is full", txHash)
+		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
 
 	log.Debugf("Accepted transaction %v (pool size: %v)", txHash,
 		len(mp.pool))
@@ -934,12 +1358,40 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 func (mp *TxPool) MaybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit bool) ([]*chainhash.Hash, *TxDesc, error) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true)
+	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true,
+		false)
 	mp.mtx.Unlock()
 
 	return hashes, txD, err
 }
 
+// TestAcceptTransaction performs all of the policy and consensus checks
+// MaybeAcceptTransaction performs on the passed transaction against the
+// current contents of the pool without adding it, evicting the transactions it
+// would replace or relaying it.  It returns the fee paid by the transaction
+// when it would be accepted.  Transactions spending outputs which are not in
+// the main chain or the pool are rejected as orphans.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) TestAcceptTransaction(tx *btcutil.Tx) (int64, error) {
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	missingParents, v, err := mp.validateTransaction(tx, true, false,
+		false, false)
+	if err != nil {
+		return 0, err
+	}
+	if len(missingParents) > 0 {
+		str := fmt.Sprintf("orphan transaction %v references "+
+			"outputs of unknown or fully-spent "+
+			"transaction %v", tx.Hash(), missingParents[0])
+		return 0, txRuleError(wire.RejectDuplicate, str)
+	}
+	return v.fee, nil
+}
+
 // processOrphans is the internal function which implements the public
 // ProcessOrphans.  See the comment for ProcessOrphans for more details.
 //
@@ -977,7 +1429,7 @@ func (mp *TxPool) processOrphans(acceptedTx *btcutil.Tx) []*TxDesc {
 			// Potentially accept an orphan into the tx pool.
 			for _, tx := range orphans {
 				missing, txD, err := mp.maybeAcceptTransaction(
-					tx, true, true, false)
+					tx, true, true, false, false)
 				if err != nil {
 					// The orphan is now invalid, so there
 					// is no way any other orphans which
@@ -1061,8 +1513,19 @@ func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, allowOrphan, rateLimit bool
 
 	// Potentially accept the transaction to the memory pool.
 	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, rateLimit,
-		true)
+		true, false)
 	if err != nil {
+		// A transaction paying too low a fee may still be accepted
+		// together with an orphan which pays for it.  Otherwise it's
+		// kept so it can be reconsidered when such a child arrives.
+		if isFeeRejection(err) && !mp.isTransactionInPool(tx.Hash()) {
+			if acceptedTxs := mp.acceptWithOrphanChild(tx,
+				rateLimit); acceptedTxs != nil {
+
+				return acceptedTxs, nil
+			}
+			mp.addFeeReject(tx)
+		}
 		return nil, err
 	}
 
@@ -1082,8 +1545,16 @@ func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, allowOrphan, rateLimit bool
 		return acceptedTxs, nil
 	}
 
-	// The transaction is an orphan (has inputs missing).  Reject
-	// it if the flag to allow orphans is not set.
+	// The transaction is an orphan (has inputs missing).  It may still be
+	// accepted together with its parents when they were rejected for
+	// paying too low a fee.
+	acceptedTxs := mp.acceptWithRejectedParents(tx, missingParents,
+		rateLimit)
+	if acceptedTxs != nil {
+		return acceptedTxs, nil
+	}
+
+	// Reject the orphan if the flag to allow orphans is not set.
 	if !allowOrphan {
 		// Only use the first missing parent transaction in
 		// the error message.
@@ -1162,7 +1633,11 @@ func (mp *TxPool) MiningDescs() []*mining.TxDesc {
 	descs := make([]*mining.TxDesc, len(mp.pool))
 	i := 0
 	for _, desc := range mp.pool {
-		descs[i] = &desc.TxDesc
+		// Copy the descriptor so the fee delta of the transaction can
+		// be set without racing with later prioritisations.
+		miningDesc := desc.TxDesc
+		miningDesc.FeeDelta = mp.feeDeltas[*desc.Tx.Hash()]
+		descs[i] = &miningDesc
 		i++
 	}
 	mp.mtx.RUnlock()
@@ -1195,14 +1670,16 @@ func (mp *TxPool) RawMempoolVerbose() map[string]*btcjson.GetRawMempoolVerboseRe
 		}
 
 		mpd := &btcjson.GetRawMempoolVerboseResult{
-			Size:             int32(tx.MsgTx().SerializeSize()),
-			Vsize:            int32(GetTxVirtualSize(tx)),
-			Fee:              btcutil.Amount(desc.Fee).ToBTC(),
-			Time:             desc.Added.Unix(),
-			Height:           int64(desc.Height),
-			StartingPriority: desc.StartingPriority,
-			CurrentPriority:  currentPriority,
-			Depends:          make([]string, 0),
+			Size:              int32(tx.MsgTx().SerializeSize()),
+			Vsize:             int32(GetTxVirtualSize(tx)),
+			Fee:               btcutil.Amount(desc.Fee).ToBTC(),
+			ModifiedFee:       btcutil.Amount(mp.modifiedFee(desc)).ToBTC(),
+			Time:              desc.Added.Unix(),
+			Height:            int64(desc.Height),
+			StartingPriority:  desc.StartingPriority,
+			CurrentPriority:   currentPriority,
+			Depends:           make([]string, 0),
+			BIP125Replaceable: mp.signalsReplacement(tx, nil),
 		}
 		for _, txIn := range tx.MsgTx().TxIn {
 			hash := &txIn.PreviousOutPoint.Hash
@@ -1232,9 +1709,13 @@ func New(cfg *Config) *TxPool {
 	return &TxPool{
 		cfg:            *cfg,
 		pool:           make(map[chainhash.Hash]*TxDesc),
+		poolWitness:    make(map[chainhash.Hash]*TxDesc),
 		orphans:        make(map[chainhash.Hash]*orphanTx),
+		orphanWitness:  make(map[chainhash.Hash]*orphanTx),
 		orphansByPrev:  make(map[wire.OutPoint]map[chainhash.Hash]*btcutil.Tx),
 		nextExpireScan: time.Now().Add(orphanExpireScanInterval),
 		outpoints:      make(map[wire.OutPoint]*btcutil.Tx),
+		feeDeltas:      make(map[chainhash.Hash]int64),
+		feeRejects:     make(map[chainhash.Hash]*btcutil.Tx),
 	}
 }
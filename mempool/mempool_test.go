@@ -188,12 +188,34 @@ func (p *poolHarness) CreateCoinbaseTx(blockHeight int32, numOutputs uint32) (*b
 // total input amount.  All outputs will be to the payment script associated
 // with the harness and all inputs are assumed to do the same.
 func (p *poolHarness) CreateSignedTx(inputs []spendableOutput, numOutputs uint32) (*btcutil.Tx, error) {
-	// Calculate the total input amount and split it amongst the requested
-	// number of outputs.
+	return p.CreateSignedTxWithFee(inputs, numOutputs, 0)
+}
+
+// CreateSignedTxWithFee creates a new signed transaction like CreateSignedTx,
+// except that the provided fee is deducted from the total input amount before
+// it is split amongst the outputs.
+func (p *poolHarness) CreateSignedTxWithFee(inputs []spendableOutput, numOutputs uint32, fee btcutil.Amount) (*btcutil.Tx, error) {
+	return p.createSignedTx(inputs, numOutputs, fee, wire.MaxTxInSequenceNum)
+}
+
+// CreateReplaceableTx creates a new signed transaction like
+// CreateSignedTxWithFee, except that its inputs signal that it can be replaced
+// as defined by BIP125.
+func (p *poolHarness) CreateReplaceableTx(inputs []spendableOutput, numOutputs uint32, fee btcutil.Amount) (*btcutil.Tx, error) {
+	return p.createSignedTx(inputs, numOutputs, fee, MaxRBFSequence)
+}
+
+// createSignedTx creates a new signed transaction which spends the provided
+// inputs with the provided sequence number, deducts the provided fee and
+// splits the remaining amount amongst the requested number of outputs.
+func (p *poolHarness) createSignedTx(inputs []spendableOutput, numOutputs uint32, fee btcutil.Amount, sequence uint32) (*btcutil.Tx, error) {
+	// Calculate the total input amount less the fee and split it amongst
+	// the requested number of outputs.
 	var totalInput btcutil.Amount
 	for _, input := range inputs {
 		totalInput += input.amount
 	}
+	totalInput -= fee
 	amountPerOutput := int64(totalInput) / int64(numOutputs)
 	remainder := int64(totalInput) - amountPerOutput*int64(numOutputs)
 
@@ -202,7 +224,7 @@ func (p *poolHarness) CreateSignedTx(inputs []spendableOutput, numOutputs uint32
 		tx.AddTxIn(&wire.TxIn{
 			PreviousOutPoint: input.outPoint,
 			SignatureScript:  nil,
-			Sequence:         wire.MaxTxInSequenceNum,
+			Sequence:         sequence,
 		})
 	}
 	for i := uint32(0); i < numOutputs; i++ {
@@ -866,3 +888,332 @@ func TestCheckSpend(t *testing.T) {
 		t.Fatalf("Unexpeced spend found in pool: %v", spend)
 	}
 }
+
+// TestWitnessHashLookup ensures transactions in both the main pool and the
+// orphan pool can be looked up by their witness hash and that the lookups are
+// updated as transactions move between and are removed from the pools.
+func TestWitnessHashLookup(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	parent, child := chainedTxns[0], chainedTxns[1]
+
+	// Add the child first so it ends up in the orphan pool.  Orphans are
+	// known by their witness hash but can't be fetched.
+	_, err = harness.txPool.ProcessTransaction(child, true, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid orphan %v",
+			err)
+	}
+	if !harness.txPool.HaveTransactionByWitnessHash(child.WitnessHash()) {
+		t.Fatalf("HaveTransactionByWitnessHash: orphan %v not found",
+			child.WitnessHash())
+	}
+	_, err = harness.txPool.FetchTransactionByWitnessHash(child.WitnessHash())
+	if err == nil {
+		t.Fatalf("FetchTransactionByWitnessHash: fetched orphan %v",
+			child.WitnessHash())
+	}
+
+	// Add the parent which moves the child to the main pool.
+	_, err = harness.txPool.ProcessTransaction(parent, true, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid "+
+			"transaction %v", err)
+	}
+	for _, tx := range chainedTxns {
+		fetched, err := harness.txPool.FetchTransactionByWitnessHash(
+			tx.WitnessHash())
+		if err != nil {
+			t.Fatalf("FetchTransactionByWitnessHash: unexpected "+
+				"error %v", err)
+		}
+		if fetched != tx {
+			t.Fatalf("FetchTransactionByWitnessHash: got %v, want "+
+				"%v", fetched.Hash(), tx.Hash())
+		}
+	}
+
+	// Removing the parent along with its redeemers must remove both from
+	// the witness hash lookup.
+	harness.txPool.RemoveTransaction(parent, true)
+	for _, tx := range chainedTxns {
+		if harness.txPool.HaveTransactionByWitnessHash(tx.WitnessHash()) {
+			t.Fatalf("HaveTransactionByWitnessHash: removed "+
+				"transaction %v still found", tx.WitnessHash())
+		}
+	}
+}
+
+// TestOnTxAdded ensures OnTxAdded is called for every transaction added to the
+// pool, whichever way it is added, in the order the pool changes relative to
+// the OnTxRemoved calls, and not for transactions which are only tested.
+func TestOnTxAdded(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	pool := harness.txPool
+	var events []string
+	pool.cfg.OnTxAdded = func(txD *TxDesc) {
+		events = append(events, "A "+txD.Tx.Hash().String())
+	}
+	pool.cfg.OnTxRemoved = func(tx *btcutil.Tx, reason RemovalReason) {
+		events = append(events, "R "+tx.Hash().String())
+	}
+
+	parent, err := harness.CreateReplaceableTx(spendableOuts[:1], 1, 1000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	child, err := harness.CreateSignedTxWithFee([]spendableOutput{
+		txOutToSpendableOut(parent, 0)}, 1, 1000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	replacement, err := harness.CreateSignedTxWithFee(spendableOuts[:1],
+		1, 5000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+
+	// Add the parent as if it were relayed and the child as if it were
+	// added back to the pool when its block was disconnected, test the
+	// replacement and finally replace them both.
+	_, err = pool.ProcessTransaction(parent, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid "+
+			"transaction %v", err)
+	}
+	_, _, err = pool.MaybeAcceptTransaction(child, false, false)
+	if err != nil {
+		t.Fatalf("MaybeAcceptTransaction: failed to accept valid "+
+			"transaction %v", err)
+	}
+	if _, err := pool.TestAcceptTransaction(replacement); err != nil {
+		t.Fatalf("TestAcceptTransaction: unexpected error: %v", err)
+	}
+	_, err = pool.ProcessTransaction(replacement, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid "+
+			"transaction %v", err)
+	}
+
+	wantEvents := []string{
+		"A " + parent.Hash().String(),
+		"A " + child.Hash().String(),
+		"R " + parent.Hash().String(),
+		"R " + child.Hash().String(),
+		"A " + replacement.Hash().String(),
+	}
+	if !reflect.DeepEqual(events, wantEvents) {
+		t.Fatalf("OnTxAdded: got events %v, want %v", events,
+			wantEvents)
+	}
+}
+
+// TestTestAcceptTransaction ensures testing whether a transaction would be
+// accepted reports the fee of valid transactions and the rejection of invalid
+// ones without changing the pool.
+func TestTestAcceptTransaction(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	tx, err := harness.CreateSignedTxWithFee(spendableOuts[:1], 1, 1000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	fee, err := harness.txPool.TestAcceptTransaction(tx)
+	if err != nil {
+		t.Fatalf("TestAcceptTransaction: unexpected error: %v", err)
+	}
+	if fee != 1000 {
+		t.Fatalf("TestAcceptTransaction: got fee %d, want 1000", fee)
+	}
+	testPoolMembership(tc, tx, false, false)
+
+	// A transaction spending the output of one which is not in the pool is
+	// rejected as an orphan and not added to the orphan pool.
+	child, err := harness.CreateSignedTxWithFee([]spendableOutput{
+		txOutToSpendableOut(tx, 0)}, 1, 1000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = harness.txPool.TestAcceptTransaction(child)
+	if code, _ := extractRejectCode(err); code != wire.RejectDuplicate {
+		t.Fatalf("TestAcceptTransaction: got %v, want orphan rejection",
+			err)
+	}
+	testPoolMembership(tc, child, false, false)
+
+	// A transaction double spending one in the pool which doesn't signal
+	// replaceability is rejected.
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid "+
+			"transaction %v", err)
+	}
+	doubleSpend, err := harness.CreateSignedTxWithFee(spendableOuts[:1], 1,
+		5000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = harness.txPool.TestAcceptTransaction(doubleSpend)
+	if code, _ := extractRejectCode(err); code != wire.RejectDuplicate {
+		t.Fatalf("TestAcceptTransaction: got %v, want double spend "+
+			"rejection", err)
+	}
+	testPoolMembership(tc, tx, false, true)
+}
+
+// TestPrioritiseTransaction ensures fee deltas apply to transactions both
+// before and after they are added to the pool, and are reflected in the package
+// statistics, the mining descriptors and the verbose mempool output.
+func TestPrioritiseTransaction(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// Raise the mempool minimum fee as if the pool had recently been full so
+	// transactions without fees are rejected.
+	pool := harness.txPool
+	pool.rollingMinFee = 10000
+	pool.rollingFeeUpdated = time.Now()
+	pool.rollingFeeBumpHeight = harness.chain.BestHeight()
+
+	tx, err := harness.CreateSignedTxWithFee(spendableOuts[:1], 1, 0)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = pool.ProcessTransaction(tx, false, false, 0)
+	if code, _ := extractRejectCode(err); code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessTransaction: got %v, want insufficient fee "+
+			"rejection", err)
+	}
+
+	// A fee delta set before the transaction is in the pool lets it in.
+	pool.PrioritiseTransaction(tx.Hash(), 10000)
+	_, err = pool.ProcessTransaction(tx, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept prioritised "+
+			"transaction: %v", err)
+	}
+	testPoolMembership(tc, tx, false, true)
+
+	// The fee delta is reflected everywhere the modified fee is used while
+	// the actual fee is unchanged.
+	pool.PrioritiseTransaction(tx.Hash(), 5000)
+	txD := pool.pool[*tx.Hash()]
+	if txD.Fee != 0 || txD.AncestorFees != 15000 || txD.DescendantFees != 15000 {
+		t.Fatalf("PrioritiseTransaction: got fee %d, ancestor fees %d "+
+			"and descendant fees %d, want 0, 15000 and 15000",
+			txD.Fee, txD.AncestorFees, txD.DescendantFees)
+	}
+	miningDescs := pool.MiningDescs()
+	if len(miningDescs) != 1 || miningDescs[0].FeeDelta != 15000 {
+		t.Fatalf("MiningDescs: fee delta of 15000 not set")
+	}
+	verbose := pool.RawMempoolVerbose()[tx.Hash().String()]
+	if verbose.Fee != 0 || verbose.ModifiedFee != 0.00015 {
+		t.Fatalf("RawMempoolVerbose: got fee %v and modified fee %v, "+
+			"want 0 and 0.00015", verbose.Fee, verbose.ModifiedFee)
+	}
+
+	// Fee deltas which cancel out are forgotten.
+	pool.PrioritiseTransaction(tx.Hash(), -15000)
+	if _, ok := pool.feeDeltas[*tx.Hash()]; ok {
+		t.Fatalf("PrioritiseTransaction: fee delta of zero not removed")
+	}
+	if txD.AncestorFees != 0 {
+		t.Fatalf("PrioritiseTransaction: got ancestor fees %d, want 0",
+			txD.AncestorFees)
+	}
+}
+
+// TestFeeDeltasClearedByBlock ensures the fee deltas of transactions which are
+// mined or conflict with a mined transaction are forgotten.
+func TestFeeDeltasClearedByBlock(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	pool := harness.txPool
+
+	// Add a coinbase with several outputs to spend independently.
+	coinbase, err := harness.CreateCoinbaseTx(1, 3)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, 1)
+	var spendableOuts []spendableOutput
+	for i := uint32(0); i < 3; i++ {
+		spendableOuts = append(spendableOuts,
+			txOutToSpendableOut(coinbase, i))
+	}
+
+	// Create a transaction in the pool which is mined later on, another one
+	// which conflicts with a mined transaction which is not in the pool,
+	// and a transaction which is neither.
+	mined, err := harness.CreateSignedTx(spendableOuts[:1], 1)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	conflict, err := harness.CreateSignedTx(spendableOuts[1:2], 1)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	minedConflict, err := harness.CreateSignedTx(spendableOuts[1:2], 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	unrelated, err := harness.CreateSignedTx(spendableOuts[2:3], 1)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	for _, tx := range []*btcutil.Tx{mined, conflict, unrelated} {
+		_, err := pool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction: %v", err)
+		}
+	}
+	for _, tx := range []*btcutil.Tx{mined, conflict, minedConflict, unrelated} {
+		pool.PrioritiseTransaction(tx.Hash(), 1000)
+	}
+
+	// Remove the transactions of a block containing the mined transactions
+	// from the pool the same way the sync manager does.
+	for _, tx := range []*btcutil.Tx{mined, minedConflict} {
+		pool.RemoveTransaction(tx, false)
+		pool.RemoveDoubleSpends(tx)
+	}
+	if pool.HaveTransaction(conflict.Hash()) {
+		t.Fatalf("RemoveDoubleSpends: conflicting transaction still " +
+			"in pool")
+	}
+	if len(pool.feeDeltas) != 1 || pool.feeDeltas[*unrelated.Hash()] != 1000 {
+		t.Fatalf("RemoveDoubleSpends: got fee deltas %v, want only "+
+			"the one of %v", pool.feeDeltas, unrelated.Hash())
+	}
+}
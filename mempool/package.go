@@ -0,0 +1,500 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// MaxPackageCount is the maximum number of transactions a package may
+	// contain.
+	MaxPackageCount = 25
+
+	// MaxPackageSize is the maximum total virtual size of the transactions
+	// of a package.
+	MaxPackageSize = 101000
+
+	// maxFeeRejects is the maximum number of transactions rejected for
+	// paying too low a fee which are kept so they can be reconsidered
+	// together with a child paying for them.
+	maxFeeRejects = 100
+)
+
+// checkPackage ensures the passed transactions form a package which may be
+// validated together.  In addition to the checks of checkPackageTopology, the
+// package must consist of a child along with its parents, meaning the last
+// transaction directly spends all of the other ones.
+func checkPackage(txns []*btcutil.Tx) error {
+	err := checkPackageTopology(txns)
+	if err != nil {
+		return err
+	}
+
+	child := txns[len(txns)-1]
+	parents := make(map[chainhash.Hash]struct{})
+	for _, txIn := range child.MsgTx().TxIn {
+		parents[txIn.PreviousOutPoint.Hash] = struct{}{}
+	}
+	for _, tx := range txns[:len(txns)-1] {
+		if _, ok := parents[*tx.Hash()]; !ok {
+			str := fmt.Sprintf("package transaction %v is not a "+
+				"parent of the last transaction %v", tx.Hash(),
+				child.Hash())
+			return txRuleError(wire.RejectNonstandard, str)
+		}
+	}
+
+	return nil
+}
+
+// checkPackageTopology ensures the passed transactions may be validated in
+// order as a package.  The package must contain at most MaxPackageCount
+// transactions with a total virtual size of at most MaxPackageSize, must not
+// contain duplicate or conflicting transactions, and must be sorted so every
+// transaction comes after the transactions of the package it spends.
+func checkPackageTopology(txns []*btcutil.Tx) error {
+	if len(txns) == 0 {
+		return txRuleError(wire.RejectInvalid, "package is empty")
+	}
+	if len(txns) > MaxPackageCount {
+		str := fmt.Sprintf("package contains %d transactions which is "+
+			"more than the maximum of %d", len(txns), MaxPackageCount)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	var size int64
+	positions := make(map[chainhash.Hash]int, len(txns))
+	for i, tx := range txns {
+		if _, ok := positions[*tx.Hash()]; ok {
+			str := fmt.Sprintf("package contains transaction %v more "+
+				"than once", tx.Hash())
+			return txRuleError(wire.RejectInvalid, str)
+		}
+		positions[*tx.Hash()] = i
+		size += GetTxVirtualSize(tx)
+	}
+	if size > MaxPackageSize {
+		str := fmt.Sprintf("package has a virtual size of %d which is "+
+			"more than the maximum of %d", size, MaxPackageSize)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	spent := make(map[wire.OutPoint]*btcutil.Tx)
+	for i, tx := range txns {
+		for _, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			if other, ok := spent[prevOut]; ok {
+				str := fmt.Sprintf("package transactions %v and %v "+
+					"both spend output %v", other.Hash(),
+					tx.Hash(), prevOut)
+				return txRuleError(wire.RejectInvalid, str)
+			}
+			spent[prevOut] = tx
+
+			if pos, ok := positions[prevOut.Hash]; ok && pos >= i {
+				str := fmt.Sprintf("package transaction %v comes "+
+					"before transaction %v which spends it",
+					tx.Hash(), prevOut.Hash)
+				return txRuleError(wire.RejectInvalid, str)
+			}
+		}
+	}
+
+	return nil
+}
+
+// packageFees returns the total modified fees of the passed transactions,
+// which must be sorted so every transaction comes after the transactions it
+// spends.  The inputs of each transaction are looked up in the outputs of the
+// transactions before it, the pool and the main chain.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) packageFees(txns []*btcutil.Tx) (int64, error) {
+	var fees int64
+	packageTxns := make(map[chainhash.Hash]*btcutil.Tx, len(txns))
+	for _, tx := range txns {
+		utxoView, err := mp.fetchInputUtxos(tx)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			if parent, ok := packageTxns[prevOut.Hash]; ok {
+				txOuts := parent.MsgTx().TxOut
+				if prevOut.Index >= uint32(len(txOuts)) {
+					str := fmt.Sprintf("package transaction "+
+						"%v spends output %v which does "+
+						"not exist", tx.Hash(), prevOut)
+					return 0, txRuleError(wire.RejectInvalid,
+						str)
+				}
+				fees += txOuts[prevOut.Index].Value
+				continue
+			}
+
+			entry := utxoView.LookupEntry(prevOut)
+			if entry == nil || entry.IsSpent() {
+				str := fmt.Sprintf("package transaction %v "+
+					"references outputs of unknown or "+
+					"fully-spent transaction %v", tx.Hash(),
+					prevOut.Hash)
+				return 0, txRuleError(wire.RejectDuplicate, str)
+			}
+			fees += entry.Amount()
+		}
+		for _, txOut := range tx.MsgTx().TxOut {
+			fees -= txOut.Value
+		}
+		fees += mp.feeDeltas[*tx.Hash()]
+		packageTxns[*tx.Hash()] = tx
+	}
+
+	return fees, nil
+}
+
+// isFeeRejection returns whether the passed error rejects a transaction for
+// paying too low a fee, in which case it may still be accepted as part of a
+// package.
+func isFeeRejection(err error) bool {
+	code, found := extractRejectCode(err)
+	return found && code == wire.RejectInsufficientFee
+}
+
+// processPackage is the internal function which implements the public
+// ProcessPackage.  See the comment for ProcessPackage for more details.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) processPackage(txns []*btcutil.Tx, rateLimit bool) ([]*TxDesc, error) {
+	err := checkPackage(txns)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attempt to accept each transaction on its own first, so transactions
+	// paying enough fees are not used to pay for the others.  Transactions
+	// which pay too low a fee, or which spend such transactions, are
+	// validated together below.
+	var accepted, deferred []*btcutil.Tx
+	for _, tx := range txns {
+		if mp.isTransactionInPool(tx.Hash()) {
+			continue
+		}
+
+		missing, _, err := mp.maybeAcceptTransaction(tx, true, rateLimit,
+			false, false)
+		switch {
+		case err == nil && len(missing) == 0:
+			accepted = append(accepted, tx)
+		case err == nil, isFeeRejection(err):
+			deferred = append(deferred, tx)
+		default:
+			return nil, err
+		}
+	}
+
+	if len(deferred) > 0 {
+		// The deferred transactions must pay at least the minimum
+		// relay fee, and the mempool minimum fee of a pool which has
+		// recently been full, for their combined size.
+		fees, err := mp.packageFees(deferred)
+		if err != nil {
+			return nil, err
+		}
+		var size int64
+		for _, tx := range deferred {
+			size += GetTxVirtualSize(tx)
+		}
+		minFeeRate := mp.cfg.Policy.MinRelayTxFee
+		if rollingFeeRate := btcutil.Amount(mp.rollingMinFeeRate()); rollingFeeRate > minFeeRate {
+			minFeeRate = rollingFeeRate
+		}
+		minFee := calcMinRequiredTxRelayFee(size, minFeeRate)
+		if fees < minFee {
+			str := fmt.Sprintf("package of %d transactions has %d "+
+				"fees which is under the required amount of %d",
+				len(deferred), fees, minFee)
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
+
+		// Add the deferred transactions, evicting them all again when
+		// one of them turns out to be invalid so none of them are
+		// left in the pool without the others paying for them.
+		rollback := func() {
+			for _, tx := range deferred {
+				txD, exists := mp.pool[*tx.Hash()]
+				if exists {
+					mp.evictTransaction(txD,
+						RemovalPackageRejected)
+				}
+			}
+		}
+		for _, tx := range deferred {
+			missing, _, err := mp.maybeAcceptTransaction(tx, true,
+				false, false, true)
+			if err == nil && len(missing) > 0 {
+				str := fmt.Sprintf("package transaction %v "+
+					"references outputs of unknown or "+
+					"fully-spent transaction %v", tx.Hash(),
+					missing[0])
+				err = txRuleError(wire.RejectDuplicate, str)
+			}
+			if err != nil {
+				rollback()
+				return nil, err
+			}
+		}
+
+		// Evict the transactions with the lowest fee rates when the
+		// pool has grown too large now the package has been added.
+		mp.trimToSize()
+		for _, tx := range deferred {
+			if !mp.isTransactionInPool(tx.Hash()) {
+				rollback()
+				str := fmt.Sprintf("package transaction %v was "+
+					"not accepted because the mempool is "+
+					"full", tx.Hash())
+				return nil, txRuleError(wire.RejectInsufficientFee,
+					str)
+			}
+		}
+		accepted = append(accepted, deferred...)
+	}
+
+	// Accept any orphans which depend on the transactions of the package,
+	// some of which may have been orphans themselves.
+	acceptedTxs := make([]*TxDesc, 0, len(accepted))
+	for _, tx := range accepted {
+		mp.removeOrphan(tx, false)
+		delete(mp.feeRejects, *tx.Hash())
+		acceptedTxs = append(acceptedTxs, mp.pool[*tx.Hash()])
+	}
+	for _, tx := range accepted {
+		acceptedTxs = append(acceptedTxs, mp.processOrphans(tx)...)
+	}
+
+	log.Debugf("Accepted package of %d transactions (pool size: %v)",
+		len(txns), len(mp.pool))
+
+	return acceptedTxs, nil
+}
+
+// ProcessPackage validates the passed transactions together as a package and
+// adds them to the memory pool.  The package must consist of a child along
+// with its parents, sorted so every transaction comes after the transactions
+// it spends.  Transactions which are already in the pool are skipped and the
+// remaining ones are first validated on their own.  The transactions which are
+// rejected for paying too low a fee are then validated together, so a child
+// paying a high fee can pay for a parent whose fee rate is below the minimum.
+// Transactions of a package may not replace transactions in the pool.
+//
+// It returns a slice of transactions added to the mempool, which includes the
+// transactions of the package that were not in the pool yet followed by any
+// orphans that were accepted as a result.  When the package is rejected, the
+// transactions which were accepted on their own remain in the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ProcessPackage(txns []*btcutil.Tx, rateLimit bool) ([]*TxDesc, error) {
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	return mp.processPackage(txns, rateLimit)
+}
+
+// TestAcceptResult describes whether a transaction tested by
+// TestAcceptPackage would be accepted to the memory pool.
+type TestAcceptResult struct {
+	// Fee is the fee paid by the transaction when it would be accepted.
+	Fee int64
+
+	// Err is the reason the transaction would be rejected, or nil when it
+	// would be accepted.
+	Err error
+}
+
+// TestAcceptPackage performs all of the policy and consensus checks
+// MaybeAcceptTransaction performs on each of the passed transactions in turn
+// without adding them to the pool, evicting the transactions they would
+// replace or relaying them.  Each transaction is tested against the current
+// contents of the pool along with the transactions before it which would be
+// accepted, so a transaction may spend the outputs of those.  Every
+// transaction must pay the required fees on its own.
+//
+// The transactions must be sorted so every transaction comes after the
+// transactions it spends and are subject to the same count, size and conflict
+// limits as a package passed to ProcessPackage, although they need not consist
+// of a child along with its parents.  When they violate those limits, every
+// result holds the same error.  Unlike TestAcceptTransaction, transactions
+// which would replace transactions in the pool are rejected when more than
+// one transaction is passed.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) TestAcceptPackage(txns []*btcutil.Tx) []TestAcceptResult {
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	results := make([]TestAcceptResult, len(txns))
+	if err := checkPackageTopology(txns); err != nil {
+		for i := range results {
+			results[i].Err = err
+		}
+		return results
+	}
+
+	// Transactions which would be accepted are linked into the pool without
+	// notifying anyone so the transactions spending them can be tested.
+	// They are all unlinked again, in reverse order, before returning.
+	var staged []*TxDesc
+	defer func() {
+		for i := len(staged) - 1; i >= 0; i-- {
+			mp.unlinkTransaction(staged[i])
+		}
+	}()
+	for i, tx := range txns {
+		missingParents, v, err := mp.validateTransaction(tx, true, false,
+			false, false)
+		switch {
+		case err != nil:
+		case len(missingParents) > 0:
+			str := fmt.Sprintf("orphan transaction %v references "+
+				"outputs of unknown or fully-spent "+
+				"transaction %v", tx.Hash(), missingParents[0])
+			err = txRuleError(wire.RejectDuplicate, str)
+		case len(v.conflicts) > 0 && len(txns) > 1:
+			str := fmt.Sprintf("package transaction %v double "+
+				"spends transactions in the memory pool",
+				tx.Hash())
+			err = txRuleError(wire.RejectDuplicate, str)
+		}
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		results[i].Fee = v.fee
+		if len(v.conflicts) > 0 {
+			continue
+		}
+		txD := &TxDesc{
+			TxDesc: mining.TxDesc{
+				Tx:       tx,
+				Added:    time.Now(),
+				Height:   v.height,
+				Fee:      v.fee,
+				FeePerKB: v.fee * 1000 / GetTxVirtualSize(tx),
+			},
+		}
+		mp.linkTransaction(txD)
+		staged = append(staged, txD)
+	}
+
+	return results
+}
+
+// addFeeReject records the passed transaction as rejected for paying too low a
+// fee so it can be reconsidered once a child paying for it arrives.  An
+// arbitrary transaction is forgotten when the maximum number of them is
+// reached.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addFeeReject(tx *btcutil.Tx) {
+	if len(mp.feeRejects) >= maxFeeRejects {
+		for txHash := range mp.feeRejects {
+			delete(mp.feeRejects, txHash)
+			break
+		}
+	}
+	mp.feeRejects[*tx.Hash()] = tx
+}
+
+// acceptWithOrphanChild attempts to accept the passed transaction, which was
+// rejected for paying too low a fee, as a package together with each of the
+// orphans spending its outputs in turn.  It returns the accepted transactions
+// of the first package which is accepted, or nil when there is none.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) acceptWithOrphanChild(tx *btcutil.Tx, rateLimit bool) []*TxDesc {
+	prevOut := wire.OutPoint{Hash: *tx.Hash()}
+	for txOutIdx := range tx.MsgTx().TxOut {
+		prevOut.Index = uint32(txOutIdx)
+		for _, orphan := range mp.orphansByPrev[prevOut] {
+			acceptedTxs, err := mp.processPackage([]*btcutil.Tx{tx,
+				orphan}, rateLimit)
+			if err == nil {
+				return acceptedTxs
+			}
+			log.Debugf("Rejected package of %v and orphan %v: %v",
+				tx.Hash(), orphan.Hash(), err)
+		}
+	}
+	return nil
+}
+
+// acceptWithRejectedParents attempts to accept the passed orphan transaction
+// as a package together with its passed missing parents when all of them were
+// previously rejected for paying too low a fee.  It returns the accepted
+// transactions, or nil when the package could not be accepted.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) acceptWithRejectedParents(tx *btcutil.Tx, missingParents []*chainhash.Hash, rateLimit bool) []*TxDesc {
+	txns := make([]*btcutil.Tx, 0, len(missingParents)+1)
+	seen := make(map[chainhash.Hash]struct{}, len(missingParents))
+	for _, parentHash := range missingParents {
+		if _, ok := seen[*parentHash]; ok {
+			continue
+		}
+		seen[*parentHash] = struct{}{}
+
+		parent, ok := mp.feeRejects[*parentHash]
+		if !ok {
+			return nil
+		}
+		txns = append(txns, parent)
+	}
+	txns = append(txns, tx)
+
+	acceptedTxs, err := mp.processPackage(txns, rateLimit)
+	if err != nil {
+		log.Debugf("Rejected package of orphan %v and its parents: %v",
+			tx.Hash(), err)
+		return nil
+	}
+	return acceptedTxs
+}
+
+// RelayFeePerKB returns the fee rate of the passed transaction used to decide
+// whether it is announced to peers which only want transactions paying at
+// least a minimum fee rate.  It is the higher of the fee rate of the
+// transaction itself and that of the transaction together with its
+// descendants in the pool, so a parent paid for by its child is relayed along
+// with the child.  Zero is returned when the transaction is not in the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) RelayFeePerKB(txHash *chainhash.Hash) int64 {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	txD, exists := mp.pool[*txHash]
+	if !exists {
+		return 0
+	}
+	feePerKB := txD.FeePerKB
+	if txD.DescendantSize > 0 {
+		packageFeePerKB := txD.DescendantFees * 1000 / txD.DescendantSize
+		if packageFeePerKB > feePerKB {
+			feePerKB = packageFeePerKB
+		}
+	}
+	return feePerKB
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestProcessPackage ensures a child paying a high fee can pay for a parent
+// whose fee rate is below the mempool minimum when they are validated together
+// as a package, either explicitly or when the parent and child arrive one after
+// the other, and that malformed or underpaying packages are rejected.
+func TestProcessPackage(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// Add a coinbase with several outputs to spend independently.
+	coinbase, err := harness.CreateCoinbaseTx(1, 6)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, 1)
+	var outputs []spendableOutput
+	for i := uint32(0); i < 6; i++ {
+		outputs = append(outputs, txOutToSpendableOut(coinbase, i))
+	}
+
+	// Raise the mempool minimum fee as if the pool had recently been full so
+	// transactions without fees are rejected on their own.
+	pool := harness.txPool
+	pool.rollingMinFee = 10000
+	pool.rollingFeeUpdated = time.Now()
+	pool.rollingFeeBumpHeight = harness.chain.BestHeight()
+
+	createTx := func(input spendableOutput, fee btcutil.Amount) *btcutil.Tx {
+		t.Helper()
+		tx, err := harness.CreateSignedTxWithFee([]spendableOutput{input},
+			1, fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+	rejectPackage := func(txns []*btcutil.Tx, wantCode wire.RejectCode) {
+		t.Helper()
+		_, err := pool.ProcessPackage(txns, false)
+		if code, _ := extractRejectCode(err); code != wantCode {
+			t.Fatalf("ProcessPackage: got %v, want %v rejection", err,
+				wantCode)
+		}
+		for _, tx := range txns {
+			testPoolMembership(tc, tx, false, false)
+		}
+	}
+
+	// The parent is rejected on its own, but accepted together with a child
+	// paying for both of them.
+	parent := createTx(outputs[0], 0)
+	child := createTx(txOutToSpendableOut(parent, 0), 10000)
+	_, err = pool.ProcessTransaction(parent, false, false, 0)
+	if code, _ := extractRejectCode(err); code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessTransaction: got %v, want insufficient fee "+
+			"rejection", err)
+	}
+	rejectPackage([]*btcutil.Tx{child, parent}, wire.RejectInvalid)
+	rejectPackage([]*btcutil.Tx{createTx(outputs[1], 0), child},
+		wire.RejectNonstandard)
+	acceptedTxs, err := pool.ProcessPackage([]*btcutil.Tx{parent, child},
+		false)
+	if err != nil {
+		t.Fatalf("ProcessPackage: failed to accept valid package: %v", err)
+	}
+	if len(acceptedTxs) != 2 || acceptedTxs[0].Tx != parent ||
+		acceptedTxs[1].Tx != child {
+
+		t.Fatalf("ProcessPackage: got %d accepted transactions, want "+
+			"the parent and child", len(acceptedTxs))
+	}
+	testPoolMembership(tc, parent, false, true)
+	testPoolMembership(tc, child, false, true)
+
+	// A child which doesn't pay enough for both of them is rejected along
+	// with its parent.
+	lowParent := createTx(outputs[1], 0)
+	rejectPackage([]*btcutil.Tx{lowParent, createTx(txOutToSpendableOut(
+		lowParent, 0), 1000)}, wire.RejectInsufficientFee)
+
+	// A child arriving after its parent was rejected for its low fee is
+	// accepted together with it.
+	parent2 := createTx(outputs[2], 0)
+	child2 := createTx(txOutToSpendableOut(parent2, 0), 10000)
+	if _, err := pool.ProcessTransaction(parent2, true, false, 0); err == nil {
+		t.Fatalf("ProcessTransaction: accepted transaction without fees")
+	}
+	acceptedTxs, err = pool.ProcessTransaction(child2, true, false, 0)
+	if err != nil || len(acceptedTxs) != 2 {
+		t.Fatalf("ProcessTransaction: got %d accepted transactions and "+
+			"error %v, want the parent and child", len(acceptedTxs), err)
+	}
+	testPoolMembership(tc, parent2, false, true)
+	testPoolMembership(tc, child2, false, true)
+
+	// A parent arriving after its child was added to the orphan pool is
+	// accepted together with it.
+	parent3 := createTx(outputs[3], 0)
+	child3 := createTx(txOutToSpendableOut(parent3, 0), 10000)
+	if _, err := pool.ProcessTransaction(child3, true, false, 0); err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept orphan: %v", err)
+	}
+	testPoolMembership(tc, child3, true, false)
+	acceptedTxs, err = pool.ProcessTransaction(parent3, true, false, 0)
+	if err != nil || len(acceptedTxs) != 2 {
+		t.Fatalf("ProcessTransaction: got %d accepted transactions and "+
+			"error %v, want the parent and child", len(acceptedTxs), err)
+	}
+	testPoolMembership(tc, parent3, false, true)
+	testPoolMembership(tc, child3, false, true)
+
+	// The parent is relayed using the fee rate of its package.
+	parentD := pool.pool[*parent3.Hash()]
+	if feePerKB := pool.RelayFeePerKB(parent3.Hash()); feePerKB <= parentD.FeePerKB {
+		t.Fatalf("RelayFeePerKB: got %d, want more than the %d of the "+
+			"parent", feePerKB, parentD.FeePerKB)
+	}
+}
+
+// TestTestAcceptPackage ensures testing whether transactions would be accepted
+// lets a transaction spend the outputs of the ones before it, rejects the
+// transactions spending rejected ones and leaves the pool unchanged.
+func TestTestAcceptPackage(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	pool := harness.txPool
+
+	// Add a coinbase with several outputs to spend independently.
+	coinbase, err := harness.CreateCoinbaseTx(1, 2)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, 1)
+
+	createTx := func(input spendableOutput, fee btcutil.Amount) *btcutil.Tx {
+		t.Helper()
+		tx, err := harness.CreateSignedTxWithFee([]spendableOutput{input},
+			1, fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+
+	// Add a transaction to the pool for the tested transactions to spend.
+	grandparent := createTx(txOutToSpendableOut(coinbase, 0), 1000)
+	_, err = pool.ProcessTransaction(grandparent, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid "+
+			"transaction %v", err)
+	}
+	parent := createTx(txOutToSpendableOut(grandparent, 0), 1000)
+	child := createTx(txOutToSpendableOut(parent, 0), 2000)
+	unrelated := createTx(txOutToSpendableOut(coinbase, 1), 3000)
+	doubleSpend := createTx(txOutToSpendableOut(coinbase, 0), 5000)
+	orphan := createTx(txOutToSpendableOut(doubleSpend, 0), 1000)
+
+	tests := []struct {
+		name     string
+		txns     []*btcutil.Tx
+		wantFees []int64
+		wantErrs []wire.RejectCode
+	}{
+		{
+			name:     "chain of transactions",
+			txns:     []*btcutil.Tx{parent, child, unrelated},
+			wantFees: []int64{1000, 2000, 3000},
+			wantErrs: []wire.RejectCode{0, 0, 0},
+		},
+		{
+			name:     "unsorted",
+			txns:     []*btcutil.Tx{child, parent},
+			wantFees: []int64{0, 0},
+			wantErrs: []wire.RejectCode{wire.RejectInvalid,
+				wire.RejectInvalid},
+		},
+		{
+			name:     "spends rejected transaction",
+			txns:     []*btcutil.Tx{doubleSpend, orphan, unrelated},
+			wantFees: []int64{0, 0, 3000},
+			wantErrs: []wire.RejectCode{wire.RejectDuplicate,
+				wire.RejectDuplicate, 0},
+		},
+	}
+	for _, test := range tests {
+		results := pool.TestAcceptPackage(test.txns)
+		if len(results) != len(test.txns) {
+			t.Fatalf("%s: got %d results, want %d", test.name,
+				len(results), len(test.txns))
+		}
+		for i, result := range results {
+			wantErr := test.wantErrs[i]
+			code, _ := extractRejectCode(result.Err)
+			if (result.Err == nil) != (wantErr == 0) ||
+				(result.Err != nil && code != wantErr) {
+				t.Fatalf("%s: tx %d: got error %v, want %v",
+					test.name, i, result.Err, wantErr)
+			}
+			if result.Fee != test.wantFees[i] {
+				t.Fatalf("%s: tx %d: got fee %d, want %d",
+					test.name, i, result.Fee,
+					test.wantFees[i])
+			}
+		}
+
+		// None of the tested transactions may be left in the pool, and
+		// the package statistics of the transaction in the pool must be
+		// restored.
+		for _, tx := range test.txns {
+			testPoolMembership(tc, tx, false, false)
+		}
+		if pool.Count() != 1 {
+			t.Fatalf("%s: got %d transactions in the pool, want 1",
+				test.name, pool.Count())
+		}
+		txD := pool.pool[*grandparent.Hash()]
+		if txD.DescendantCount != 1 || txD.DescendantFees != 1000 {
+			t.Fatalf("%s: got descendant count %d and fees %d, "+
+				"want 1 and 1000", test.name, txD.DescendantCount,
+				txD.DescendantFees)
+		}
+		if len(pool.outpoints) != 1 {
+			t.Fatalf("%s: got %d spent outpoints, want 1",
+				test.name, len(pool.outpoints))
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// dumpVersion is the version of the mempool dump format written by Save.
+//
+// The dump consists of the following, with all integers little endian:
+//   - the version as a uint64
+//   - the number of fee deltas as a uint64, followed by the hash and the int64
+//     delta of each one
+//   - the number of transactions as a uint64, followed by each transaction
+//     serialized with its witness data and the int64 unix time it entered the
+//     pool
+//
+// Transactions are written after the transactions in the pool they spend.
+const dumpVersion = 1
+
+// dumpEntry is a transaction read from a mempool dump.
+type dumpEntry struct {
+	tx    *btcutil.Tx
+	added time.Time
+}
+
+// dependencyOrder returns the descriptors of the transactions in the pool
+// ordered such that each transaction comes after the transactions in the pool
+// it spends.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) dependencyOrder() []*TxDesc {
+	descs := make([]*TxDesc, 0, len(mp.pool))
+	visited := make(map[chainhash.Hash]struct{}, len(mp.pool))
+	var visit func(desc *TxDesc)
+	visit = func(desc *TxDesc) {
+		hash := *desc.Tx.Hash()
+		if _, ok := visited[hash]; ok {
+			return
+		}
+		visited[hash] = struct{}{}
+		for _, txIn := range desc.Tx.MsgTx().TxIn {
+			parent, ok := mp.pool[txIn.PreviousOutPoint.Hash]
+			if ok {
+				visit(parent)
+			}
+		}
+		descs = append(descs, desc)
+	}
+	for _, desc := range mp.pool {
+		visit(desc)
+	}
+	return descs
+}
+
+// Save writes the transactions in the main pool, along with the time each of
+// them entered it, and the fee deltas to w in the versioned mempool dump
+// format.  The orphan pool is not saved.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Save(w io.Writer) error {
+	mp.mtx.RLock()
+	descs := mp.dependencyOrder()
+	feeDeltas := make(map[chainhash.Hash]int64, len(mp.feeDeltas))
+	for hash, delta := range mp.feeDeltas {
+		feeDeltas[hash] = delta
+	}
+	mp.mtx.RUnlock()
+
+	le := binary.LittleEndian
+	if err := binary.Write(w, le, uint64(dumpVersion)); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, le, uint64(len(feeDeltas))); err != nil {
+		return err
+	}
+	for hash, delta := range feeDeltas {
+		if _, err := w.Write(hash[:]); err != nil {
+			return err
+		}
+		if err := binary.Write(w, le, delta); err != nil {
+			return err
+		}
+	}
+
+	if err := binary.Write(w, le, uint64(len(descs))); err != nil {
+		return err
+	}
+	for _, desc := range descs {
+		if err := desc.Tx.MsgTx().Serialize(w); err != nil {
+			return err
+		}
+		if err := binary.Write(w, le, desc.Added.Unix()); err != nil {
+			return err
+		}
+	}
+
+	log.Debugf("Saved %d transactions and %d fee deltas", len(descs),
+		len(feeDeltas))
+	return nil
+}
+
+// Load reads a mempool dump written by Save from r.  The fee deltas are
+// added to the existing ones first, after which each of the transactions is processed with
+// ProcessTransaction and keeps the time it originally entered the pool.
+// Transactions which are no longer acceptable, such as those which were mined
+// while the node was down, are skipped.  Processing the transactions stops
+// early once the passed quit channel is closed, since validating a large dump
+// can take a long time.  It returns the number of transactions added to the
+// pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Load(r io.Reader, quit <-chan struct{}) (int, error) {
+	le := binary.LittleEndian
+	var version uint64
+	if err := binary.Read(r, le, &version); err != nil {
+		return 0, err
+	}
+	if version != dumpVersion {
+		return 0, fmt.Errorf("unsupported mempool dump version %d",
+			version)
+	}
+
+	// Read the whole dump before changing the pool so a truncated dump
+	// does not leave it partially loaded.
+	var numDeltas uint64
+	if err := binary.Read(r, le, &numDeltas); err != nil {
+		return 0, err
+	}
+	feeDeltas := make(map[chainhash.Hash]int64)
+	for i := uint64(0); i < numDeltas; i++ {
+		var hash chainhash.Hash
+		if _, err := io.ReadFull(r, hash[:]); err != nil {
+			return 0, err
+		}
+		var delta int64
+		if err := binary.Read(r, le, &delta); err != nil {
+			return 0, err
+		}
+		feeDeltas[hash] = delta
+	}
+
+	var numTxs uint64
+	if err := binary.Read(r, le, &numTxs); err != nil {
+		return 0, err
+	}
+	var entries []dumpEntry
+	for i := uint64(0); i < numTxs; i++ {
+		var msgTx wire.MsgTx
+		if err := msgTx.Deserialize(r); err != nil {
+			return 0, err
+		}
+		var added int64
+		if err := binary.Read(r, le, &added); err != nil {
+			return 0, err
+		}
+		entries = append(entries, dumpEntry{
+			tx:    btcutil.NewTx(&msgTx),
+			added: time.Unix(added, 0),
+		})
+	}
+
+	// The saved fee deltas are added to the existing ones so deltas set
+	// while the dump is loaded are kept.
+	for hash, delta := range feeDeltas {
+		mp.PrioritiseTransaction(&hash, delta)
+	}
+
+	var numAccepted int
+	for _, entry := range entries {
+		select {
+		case <-quit:
+			log.Debugf("Stopped loading saved transactions after %d "+
+				"of %d", numAccepted, len(entries))
+			return numAccepted, nil
+		default:
+		}
+
+		acceptedTxs, err := mp.ProcessTransaction(entry.tx, false, false, 0)
+		if err != nil {
+			log.Debugf("Skipping saved transaction %v: %v",
+				entry.tx.Hash(), err)
+			continue
+		}
+
+		mp.mtx.Lock()
+		acceptedTxs[0].Added = entry.added
+		mp.mtx.Unlock()
+		numAccepted++
+	}
+
+	return numAccepted, nil
+}
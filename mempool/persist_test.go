@@ -0,0 +1,113 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestSaveLoad ensures a saved mempool is loaded into a new pool with the
+// entry times intact and the fee deltas added to the existing ones, that
+// loading stops once the quit channel is closed, and that truncated dumps are
+// rejected.
+func TestSaveLoad(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+
+	pool := harness.txPool
+	added := time.Unix(time.Now().Add(-time.Hour).Unix(), 0)
+	for i, tx := range chainedTxns {
+		acceptedTxs, err := pool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+		acceptedTxs[0].Added = added.Add(time.Duration(i) * time.Second)
+	}
+	unknownHash := chainhash.Hash{0x01}
+	pool.feeDeltas[*chainedTxns[1].Hash()] = 1000
+	pool.feeDeltas[unknownHash] = -500
+
+	var buf bytes.Buffer
+	if err := pool.Save(&buf); err != nil {
+		t.Fatalf("Save: unexpected error %v", err)
+	}
+	dump := buf.Bytes()
+
+	// Fee deltas set before the dump is loaded are added to the saved ones.
+	loaded := New(&pool.cfg)
+	loaded.PrioritiseTransaction(&unknownHash, 200)
+	numAccepted, err := loaded.Load(bytes.NewReader(dump), nil)
+	if err != nil {
+		t.Fatalf("Load: unexpected error %v", err)
+	}
+	if numAccepted != len(chainedTxns) {
+		t.Fatalf("Load: got %d transactions, want %d", numAccepted,
+			len(chainedTxns))
+	}
+	for i, tx := range chainedTxns {
+		desc, ok := loaded.pool[*tx.Hash()]
+		if !ok {
+			t.Fatalf("Load: transaction %v not in pool", tx.Hash())
+		}
+		want := added.Add(time.Duration(i) * time.Second)
+		if !desc.Added.Equal(want) {
+			t.Fatalf("Load: transaction %v added at %v, want %v",
+				tx.Hash(), desc.Added, want)
+		}
+	}
+	if len(loaded.feeDeltas) != 2 ||
+		loaded.feeDeltas[*chainedTxns[1].Hash()] != 1000 ||
+		loaded.feeDeltas[unknownHash] != -300 {
+
+		t.Fatalf("Load: unexpected fee deltas %v", loaded.feeDeltas)
+	}
+
+	// Transactions already in the pool are skipped.
+	numAccepted, err = loaded.Load(bytes.NewReader(dump), nil)
+	if err != nil {
+		t.Fatalf("Load: unexpected error %v", err)
+	}
+	if numAccepted != 0 {
+		t.Fatalf("Load: got %d duplicate transactions, want 0",
+			numAccepted)
+	}
+
+	// No transactions are processed once the quit channel is closed.
+	quit := make(chan struct{})
+	close(quit)
+	interrupted := New(&pool.cfg)
+	numAccepted, err = interrupted.Load(bytes.NewReader(dump), quit)
+	if err != nil {
+		t.Fatalf("Load: unexpected error %v", err)
+	}
+	if numAccepted != 0 || interrupted.Count() != 0 {
+		t.Fatalf("Load: got %d transactions after quit, want 0",
+			numAccepted)
+	}
+
+	// A truncated dump must not change the pool.
+	empty := New(&pool.cfg)
+	_, err = empty.Load(bytes.NewReader(dump[:len(dump)-1]), nil)
+	if err == nil {
+		t.Fatal("Load: truncated dump accepted")
+	}
+	if empty.Count() != 0 || len(empty.feeDeltas) != 0 {
+		t.Fatal("Load: truncated dump changed the pool")
+	}
+}
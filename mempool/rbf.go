@@ -0,0 +1,169 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// MaxRBFSequence is the maximum sequence number an input can use to
+	// signal that the transaction spending it can be replaced as defined
+	// by BIP125.
+	MaxRBFSequence = wire.MaxTxInSequenceNum - 2
+
+	// MaxReplacementEvictions is the maximum number of transactions, including
+	// their descendants, a single replacement transaction may evict from
+	// the pool.
+	MaxReplacementEvictions = 100
+)
+
+// signalsReplacement returns whether the passed transaction can be replaced as
+// defined by BIP125.  A transaction signals replaceability explicitly when any
+// of its inputs has a sequence number of at most MaxRBFSequence, and inherits
+// it when any of its unconfirmed ancestors in the pool signals it.
+//
+// The optional cache holds the hashes of the transactions in the pool already
+// known not to signal replaceability so they are not visited again.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) signalsReplacement(tx *btcutil.Tx, cache map[chainhash.Hash]struct{}) bool {
+	for _, txIn := range tx.MsgTx().TxIn {
+		if txIn.Sequence <= MaxRBFSequence {
+			return true
+		}
+	}
+
+	if cache == nil {
+		cache = make(map[chainhash.Hash]struct{})
+	}
+	for _, txIn := range tx.MsgTx().TxIn {
+		parentHash := txIn.PreviousOutPoint.Hash
+		if _, ok := cache[parentHash]; ok {
+			continue
+		}
+		parent, ok := mp.pool[parentHash]
+		if !ok {
+			continue
+		}
+		if mp.signalsReplacement(parent.Tx, cache) {
+			return true
+		}
+		cache[parentHash] = struct{}{}
+	}
+	return false
+}
+
+// validateReplacement ensures the passed transaction, which has the passed
+// modified fee, may replace all of the transactions in the pool it double
+// spends as defined by BIP125.  The replacement must not evict more than
+// MaxReplacementEvictions transactions including descendants, must not spend
+// outputs of the transactions it replaces or any unconfirmed outputs the
+// transactions it directly conflicts with did not spend, must pay a higher
+// fee rate than each of those transactions, and must pay at least the total
+// fees of all of the evicted transactions plus the minimum relay fee for its
+// own size.  The fees of all of the transactions include their fee deltas.  The
+// descriptors of the directly conflicting transactions are returned.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) validateReplacement(tx *btcutil.Tx, txFee int64) ([]*TxDesc, error) {
+	txHash := tx.Hash()
+
+	// Gather the directly conflicting transactions along with all of the
+	// transactions which depend on them, since they would be evicted too.
+	var conflicts []*TxDesc
+	evicted := make(map[chainhash.Hash]*TxDesc)
+	for _, txIn := range tx.MsgTx().TxIn {
+		txR, exists := mp.outpoints[txIn.PreviousOutPoint]
+		if !exists {
+			continue
+		}
+		if _, ok := evicted[*txR.Hash()]; ok {
+			continue
+		}
+		conflict := mp.pool[*txR.Hash()]
+		conflicts = append(conflicts, conflict)
+		evicted[*txR.Hash()] = conflict
+		for _, desc := range mp.descendants(txR) {
+			evicted[*desc.Tx.Hash()] = desc
+		}
+	}
+	if len(evicted) > MaxReplacementEvictions {
+		str := fmt.Sprintf("replacement transaction %v evicts %d "+
+			"transactions which is more than the maximum of %d",
+			txHash, len(evicted), MaxReplacementEvictions)
+		return nil, txRuleError(wire.RejectNonstandard, str)
+	}
+
+	// The replacement can't spend the outputs of the transactions it would
+	// evict.
+	for _, ancestor := range mp.ancestors(tx) {
+		if _, ok := evicted[*ancestor.Tx.Hash()]; ok {
+			str := fmt.Sprintf("replacement transaction %v spends "+
+				"conflicting transaction %v", txHash,
+				ancestor.Tx.Hash())
+			return nil, txRuleError(wire.RejectInvalid, str)
+		}
+	}
+
+	// The replacement may only spend unconfirmed outputs which were
+	// already spent by the transactions it directly conflicts with.
+	conflictParents := make(map[chainhash.Hash]struct{})
+	for _, conflict := range conflicts {
+		for _, txIn := range conflict.Tx.MsgTx().TxIn {
+			conflictParents[txIn.PreviousOutPoint.Hash] = struct{}{}
+		}
+	}
+	for _, txIn := range tx.MsgTx().TxIn {
+		parentHash := txIn.PreviousOutPoint.Hash
+		if _, ok := conflictParents[parentHash]; ok {
+			continue
+		}
+		if _, ok := mp.pool[parentHash]; ok {
+			str := fmt.Sprintf("replacement transaction %v spends "+
+				"new unconfirmed output %v", txHash,
+				txIn.PreviousOutPoint)
+			return nil, txRuleError(wire.RejectNonstandard, str)
+		}
+	}
+
+	// The replacement must pay a higher fee rate than each of the
+	// transactions it directly conflicts with, so replacing them never
+	// lowers the fee rate of the next block.
+	txSize := GetTxVirtualSize(tx)
+	txFeeRate := txFee * 1000 / txSize
+	for _, conflict := range conflicts {
+		conflictFeeRate := mp.modifiedFee(conflict) * 1000 /
+			GetTxVirtualSize(conflict.Tx)
+		if txFeeRate <= conflictFeeRate {
+			str := fmt.Sprintf("replacement transaction %v has a fee "+
+				"rate of %d satoshi/kB which is not more than "+
+				"the %d satoshi/kB of transaction %v", txHash,
+				txFeeRate, conflictFeeRate, conflict.Tx.Hash())
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
+	}
+
+	// The replacement must pay at least the fees of all of the transactions
+	// it evicts, plus the minimum relay fee for the bandwidth it uses.
+	var evictedFees int64
+	for _, desc := range evicted {
+		evictedFees += mp.modifiedFee(desc)
+	}
+	minFee := evictedFees + calcMinRequiredTxRelayFee(txSize,
+		mp.cfg.Policy.MinRelayTxFee)
+	if txFee < minFee {
+		str := fmt.Sprintf("replacement transaction %v has %d fees "+
+			"which is under the required amount of %d", txHash,
+			txFee, minFee)
+		return nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
+	return conflicts, nil
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestReplaceByFee ensures transactions which double spend transactions in the
+// pool are only accepted when they satisfy the BIP125 replacement rules using
+// the modified fees, and that the replaced transactions are evicted along with
+// their descendants.
+func TestReplaceByFee(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// Add a coinbase with several outputs to spend independently.
+	coinbase, err := harness.CreateCoinbaseTx(1, 5)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	harness.chain.utxos.AddTxOuts(coinbase, 1)
+	var outputs []spendableOutput
+	for i := uint32(0); i < 5; i++ {
+		outputs = append(outputs, txOutToSpendableOut(coinbase, i))
+	}
+
+	createTx := func(inputs []spendableOutput, fee btcutil.Amount,
+		replaceable bool) *btcutil.Tx {
+
+		t.Helper()
+		create := harness.CreateSignedTxWithFee
+		if replaceable {
+			create = harness.CreateReplaceableTx
+		}
+		tx, err := create(inputs, 1, fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		return tx
+	}
+	removed := make(map[*btcutil.Tx]RemovalReason)
+	pool := harness.txPool
+	pool.cfg.OnTxRemoved = func(tx *btcutil.Tx, reason RemovalReason) {
+		removed[tx] = reason
+	}
+	accept := func(tx *btcutil.Tx) {
+		t.Helper()
+		if _, err := pool.ProcessTransaction(tx, false, false, 0); err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+	}
+	reject := func(tx *btcutil.Tx, wantCode wire.RejectCode) {
+		t.Helper()
+		_, err := pool.ProcessTransaction(tx, false, false, 0)
+		if code, _ := extractRejectCode(err); code != wantCode {
+			t.Fatalf("ProcessTransaction: got %v, want %v rejection",
+				err, wantCode)
+		}
+		testPoolMembership(tc, tx, false, false)
+	}
+
+	// Transactions which don't signal replaceability can only be replaced
+	// when full replace-by-fee is enabled.
+	final := createTx(outputs[0:1], 1000, false)
+	accept(final)
+	finalReplacement := createTx(outputs[0:1], 10000, false)
+	reject(finalReplacement, wire.RejectDuplicate)
+	pool.cfg.Policy.FullRBF = true
+	accept(finalReplacement)
+	pool.cfg.Policy.FullRBF = false
+	testPoolMembership(tc, final, false, false)
+	if reason, ok := removed[final]; !ok || reason != RemovalReplaced {
+		t.Fatalf("OnTxRemoved: transaction %v not reported as replaced",
+			final.Hash())
+	}
+
+	// A child which doesn't signal replaceability inherits it from its
+	// parent, and the replacement must pay for all of the transactions it
+	// evicts plus its own relay fee.
+	parent := createTx(outputs[1:2], 1000, true)
+	child := createTx([]spendableOutput{txOutToSpendableOut(parent, 0)},
+		1000, false)
+	accept(parent)
+	accept(child)
+	verbose := pool.RawMempoolVerbose()
+	for _, tx := range []*btcutil.Tx{parent, child} {
+		if !verbose[tx.Hash().String()].BIP125Replaceable {
+			t.Fatalf("RawMempoolVerbose: transaction %v not reported "+
+				"as replaceable", tx.Hash())
+		}
+	}
+	if verbose[finalReplacement.Hash().String()].BIP125Replaceable {
+		t.Fatalf("RawMempoolVerbose: transaction %v reported as "+
+			"replaceable", finalReplacement.Hash())
+	}
+	reject(createTx(outputs[1:2], 2000, true), wire.RejectInsufficientFee)
+
+	replacement := createTx(outputs[1:2], 3000, true)
+	accept(replacement)
+	for _, tx := range []*btcutil.Tx{parent, child} {
+		testPoolMembership(tc, tx, false, false)
+		if reason, ok := removed[tx]; !ok || reason != RemovalReplaced {
+			t.Fatalf("OnTxRemoved: transaction %v not reported as "+
+				"replaced", tx.Hash())
+		}
+	}
+
+	// The replacement may not spend unconfirmed outputs the transaction it
+	// replaces did not spend.
+	unrelated := createTx(outputs[2:3], 1000, false)
+	original := createTx(outputs[3:4], 1000, true)
+	accept(unrelated)
+	accept(original)
+	reject(createTx([]spendableOutput{outputs[3],
+		txOutToSpendableOut(unrelated, 0)}, 20000, true),
+		wire.RejectNonstandard)
+	testPoolMembership(tc, original, false, true)
+
+	// The replacement may not evict more than the maximum number of
+	// transactions.
+	chainedTxns, err := harness.CreateTxChain(txOutToSpendableOut(original,
+		0), MaxReplacementEvictions)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	for _, tx := range chainedTxns {
+		accept(tx)
+	}
+	reject(createTx(outputs[3:4], 50000, true), wire.RejectNonstandard)
+	testPoolMembership(tc, original, false, true)
+
+	// The fee deltas of both the replaced transaction and the replacement
+	// count toward the replacement rules.
+	prioritised := createTx(outputs[4:5], 1000, true)
+	accept(prioritised)
+	pool.PrioritiseTransaction(prioritised.Hash(), 5000)
+	reject(createTx(outputs[4:5], 3000, true), wire.RejectInsufficientFee)
+	testPoolMembership(tc, prioritised, false, true)
+	prioritisedReplacement := createTx(outputs[4:5], 2000, true)
+	pool.PrioritiseTransaction(prioritisedReplacement.Hash(), 10000)
+	accept(prioritisedReplacement)
+	testPoolMembership(tc, prioritised, false, false)
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// mempoolDumpFilename is the name of the file in the data directory which
+// houses the transactions in the memory pool between restarts.
+const mempoolDumpFilename = "mempool.dat"
+
+// errMempoolNotLoaded is returned when saving the memory pool before the dump
+// from the previous run has been loaded, which would lose the transactions in
+// it.
+var errMempoolNotLoaded = errors.New("the mempool was not loaded yet")
+
+// loadMempool loads the transactions saved in the mempool dump into the memory
+// pool.  A missing dump is not an error.  Loading stops early when the server
+// shuts down.  It MUST be run as a goroutine.
+func (s *server) loadMempool() {
+	defer s.wg.Done()
+	defer atomic.StoreInt32(&s.mempoolLoaded, 1)
+
+	dumpPath := filepath.Join(cfg.DataDir, mempoolDumpFilename)
+	f, err := os.Open(dumpPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		srvrLog.Errorf("Failed to load mempool %s: %v", dumpPath, err)
+		return
+	}
+	defer f.Close()
+
+	numAccepted, err := s.txMemPool.Load(bufio.NewReader(f), s.quit)
+	if err != nil {
+		srvrLog.Errorf("Failed to load mempool %s: %v", dumpPath, err)
+		return
+	}
+	srvrLog.Infof("Loaded %d transactions into the mempool from file '%s'",
+		numAccepted, dumpPath)
+}
+
+// saveMempool writes the transactions in the memory pool to the mempool dump
+// in the data directory.
+//
+// This function is safe for concurrent access.
+func (s *server) saveMempool() error {
+	if atomic.LoadInt32(&s.mempoolLoaded) == 0 {
+		return errMempoolNotLoaded
+	}
+
+	// Write to a temporary file first so a crash can't leave a partially
+	// written dump behind.
+	dumpPath := filepath.Join(cfg.DataDir, mempoolDumpFilename)
+	tmpPath := dumpPath + ".new"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := s.txMemPool.Save(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, dumpPath)
+}
@@ -51,6 +51,12 @@ type TxDesc struct {
 
 	// FeePerKB is the fee the transaction pays in Satoshi per 1000 bytes.
 	FeePerKB int64
+
+	// FeeDelta is the adjustment, in Satoshi, to the fee of the transaction
+	// which is only used when selecting transactions for new blocks.  It
+	// allows the transaction to be prioritized without changing the fees
+	// the block actually collects.
+	FeeDelta int64
 }
 
 // TxSource represents a source of transactions to consider for inclusion in
@@ -81,10 +87,21 @@ type txPrioItem struct {
 	priority float64
 	feePerKB int64
 
+	// modifiedFee is the fee of the transaction adjusted by its fee delta,
+	// which is used to select transactions, while fee is what the
+	// transaction actually pays to the block.  The fee per kilobyte is
+	// based on the modified fee.
+	modifiedFee int64
+
+	// weight and sigOpCost are the weight and signature operation cost the
+	// transaction adds to a block.
+	weight    int64
+	sigOpCost int64
+
 	// dependsOn holds a map of transaction hashes which this one depends
 	// on.  It will only be set when the transaction references other
 	// transactions in the source pool and hence must come after them in
-	// a block.
+	// a block.  Entries are removed as the transactions are included.
 	dependsOn map[chainhash.Hash]struct{}
 }
 
@@ -391,28 +408,33 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // factors.  First, each transaction has a priority calculated based on its
 // value, age of inputs, and size.  Transactions which consist of larger
 // amounts, older inputs, and small sizes have the highest priority.  Second, a
-// fee per kilobyte is calculated for each transaction.  Transactions with a
-// higher fee per kilobyte are preferred.  Finally, the block generation related
-// policy settings are all taken into account.
+// fee per kilobyte is calculated for the package of each transaction, which
+// consists of the transaction together with all of the transactions in the
+// source pool it depends on that have not been included yet.  Packages with a
+// higher fee per kilobyte are preferred, so a transaction paying a high fee
+// pulls the transactions it depends on into the block with it even when they
+// pay a low fee.  Finally, the block generation related policy settings are all
+// taken into account.
 //
-// Transactions which only spend outputs from other transactions already in the
-// block chain are immediately added to a priority queue which either
-// prioritizes based on the priority (then fee per kilobyte) or the fee per
-// kilobyte (then priority) depending on whether or not the BlockPrioritySize
-// policy setting allots space for high-priority transactions.  Transactions
-// which spend outputs from other transactions in the source pool are added to a
-// dependency map so they can be added to the priority queue once the
-// transactions they depend on have been included.
+// When the BlockPrioritySize policy setting allots space for high-priority
+// transactions, transactions which only spend outputs from other transactions
+// already in the block chain are added to a priority queue which prioritizes
+// based on the priority (then fee per kilobyte).  Transactions which spend
+// outputs from other transactions in the source pool are added to a dependency
+// map so they can be added to the priority queue once the transactions they
+// depend on have been included.
 //
 // Once the high-priority area (if configured) has been filled with
 // transactions, or the priority falls below what is considered high-priority,
-// the priority queue is updated to prioritize by fees per kilobyte (then
-// priority).
+// the remaining transactions are added as whole packages in order of the fee
+// per kilobyte of each package, much like the package selection of Bitcoin
+// Core.  The package of each transaction which depends on the included ones is
+// recalculated after each package is added.
 //
-// When the fees per kilobyte drop below the TxMinFreeFee policy setting, the
-// transaction will be skipped unless the BlockMinSize policy setting is
-// nonzero, in which case the block will be filled with the low-fee/free
-// transactions until the block size reaches that minimum size.
+// When the fees per kilobyte of a package drop below the TxMinFreeFee policy
+// setting, the package will be skipped unless the BlockMinSize policy setting
+// is nonzero, in which case the block will be filled with the low-fee/free
+// packages until the block size reaches that minimum size.
 //
 // Any transactions which would cause the block to exceed the BlockMaxSize
 // policy setting, exceed the maximum allowed signature operations per block, or
@@ -430,8 +452,9 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 //  |                                   |   |
 //  |                                   |   |
 //  |                                   |   |--- policy.BlockMaxSize
-//  |  Transactions prioritized by fee  |   |
-//  |  until <= policy.TxMinFreeFee     |   |
+//  |  Transaction packages prioritized |   |
+//  |  by fee until                     |   |
+//  |  <= policy.TxMinFreeFee           |   |
 //  |                                   |   |
 //  |                                   |   |
 //  |                                   |   |
@@ -465,15 +488,23 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*Bloc
 	}
 	coinbaseSigOpCost := int64(blockchain.CountSigOps(coinbaseTx)) * blockchain.WitnessScaleFactor
 
+	// Query the version bits state to see if segwit has been activated, if
+	// so then this means that we'll include any transactions with witness
+	// data in the mempool, and also add the witness commitment as an
+	// OP_RETURN output in the coinbase transaction.
+	segwitState, err := g.chain.ThresholdState(chaincfg.DeploymentSegwit)
+	if err != nil {
+		return nil, err
+	}
+	segwitActive := segwitState == blockchain.ThresholdActive
+
 	// Get the current source transactions and create a priority queue to
-	// hold the transactions which are ready for inclusion into a block
-	// along with some priority related and fee metadata.  Reserve the same
-	// number of items that are available for the priority queue.  Also,
-	// choose the initial sort order for the priority queue based on whether
-	// or not there is an area allocated for high-priority transactions.
+	// hold the transactions which are ready for inclusion into the
+	// high-priority area of the block along with some priority related and
+	// fee metadata.  Reserve the same number of items that are available
+	// for the priority queue.
 	sourceTxns := g.txSource.MiningDescs()
-	sortedByFee := g.policy.BlockPrioritySize == 0
-	priorityQueue := newTxPriorityQueue(len(sourceTxns), sortedByFee)
+	priorityQueue := newTxPriorityQueue(len(sourceTxns), false)
 
 	// Create a slice to hold the transactions to be included in the
 	// generated block with reserved space.  Also create a utxo view to
@@ -483,6 +514,12 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*Bloc
 	blockTxns = append(blockTxns, coinbaseTx)
 	blockUtxos := blockchain.NewUtxoViewpoint()
 
+	// candidates holds the transactions which may be included in the block
+	// keyed by their hashes.  Transactions which turn out not to be
+	// includable are removed from it, which in turn prevents any of the
+	// transactions which depend on them from being included.
+	candidates := make(map[chainhash.Hash]*txPrioItem, len(sourceTxns))
+
 	// dependers is used to track transactions which depend on another
 	// transaction in the source pool.  This, in conjunction with the
 	// dependsOn map kept with each dependent transaction helps quickly
@@ -520,6 +557,14 @@ mempoolLoop:
 			continue
 		}
 
+		// If segregated witness has not been activated yet, then we
+		// shouldn't include any witness transactions in the block.
+		if !segwitActive && tx.HasWitness() {
+			log.Tracef("Skipping witness tx %s before segwit is "+
+				"active", tx.Hash())
+			continue
+		}
+
 		// Fetch all of the utxos referenced by the this transaction.
 		// NOTE: This intentionally does not fetch inputs from the
 		// mempool since a transaction which depends on other
@@ -575,15 +620,18 @@ mempoolLoop:
 		prioItem.priority = CalcPriority(tx.MsgTx(), utxos,
 			nextBlockHeight)
 
-		// Calculate the fee in Satoshi/kB.
+		// Calculate the fee in Satoshi/kB, taking any fee delta of the
+		// transaction into account.
 		prioItem.feePerKB = txDesc.FeePerKB
 		prioItem.fee = txDesc.Fee
-
-		// Add the transaction to the priority queue to mark it ready
-		// for inclusion in the block unless it has dependencies.
-		if prioItem.dependsOn == nil {
-			heap.Push(priorityQueue, prioItem)
+		prioItem.modifiedFee = txDesc.Fee + txDesc.FeeDelta
+		prioItem.weight = blockchain.GetTransactionWeight(tx)
+		if txDesc.FeeDelta != 0 {
+			vsize := (prioItem.weight + blockchain.WitnessScaleFactor -
+				1) / blockchain.WitnessScaleFactor
+			prioItem.feePerKB = prioItem.modifiedFee * 1000 / vsize
 		}
+		candidates[*tx.Hash()] = prioItem
 
 		// Merge the referenced outputs from the input transactions to
 		// this transaction into the block utxo view.  This allows the
@@ -591,6 +639,34 @@ mempoolLoop:
 		mergeUtxoView(blockUtxos, utxos)
 	}
 
+	// Calculate the signature operation cost of each candidate up front so
+	// the cost of a whole package is known before any of it is included.
+	// The view used also contains the outputs of all of the candidates
+	// since they may be spent by other candidates.
+	sigOpUtxos := blockchain.NewUtxoViewpoint()
+	mergeUtxoView(sigOpUtxos, blockUtxos)
+	for _, item := range candidates {
+		sigOpUtxos.AddTxOuts(item.tx, nextBlockHeight)
+	}
+	for hash, item := range candidates {
+		sigOpCost, err := blockchain.GetSigOpCost(item.tx, false,
+			sigOpUtxos, true, segwitActive)
+		if err != nil {
+			log.Tracef("Skipping tx %s due to error in "+
+				"GetSigOpCost: %v", item.tx.Hash(), err)
+			delete(candidates, hash)
+			continue
+		}
+		item.sigOpCost = int64(sigOpCost)
+
+		// Add the transaction to the priority queue to mark it ready
+		// for inclusion in the high-priority area unless it has
+		// dependencies.
+		if item.dependsOn == nil {
+			heap.Push(priorityQueue, item)
+		}
+	}
+
 	log.Tracef("Priority queue len %d, dependers len %d",
 		priorityQueue.Len(), len(dependers))
 
@@ -602,150 +678,50 @@ mempoolLoop:
 	blockSigOpCost := coinbaseSigOpCost
 	totalFees := int64(0)
 
-	// Query the version bits state to see if segwit has been activated, if
-	// so then this means that we'll include any transactions with witness
-	// data in the mempool, and also add the witness commitment as an
-	// OP_RETURN output in the coinbase transaction.
-	segwitState, err := g.chain.ThresholdState(chaincfg.DeploymentSegwit)
-	if err != nil {
-		return nil, err
+	// If we include a transaction bearing witness data, then we'll also
+	// need to include a witness commitment in the coinbase transaction.
+	// Therefore, we account for the additional weight within the block
+	// with a model coinbase tx with a witness commitment.
+	coinbaseCopy := btcutil.NewTx(coinbaseTx.MsgTx().Copy())
+	coinbaseCopy.MsgTx().TxIn[0].Witness = [][]byte{
+		bytes.Repeat([]byte("a"), blockchain.CoinbaseWitnessDataLen),
 	}
-	segwitActive := segwitState == blockchain.ThresholdActive
-
+	coinbaseCopy.MsgTx().AddTxOut(&wire.TxOut{
+		PkScript: bytes.Repeat([]byte("a"),
+			blockchain.CoinbaseWitnessPkScriptLength),
+	})
+	witnessCommitmentWeight := blockchain.GetTransactionWeight(coinbaseCopy) -
+		blockchain.GetTransactionWeight(coinbaseTx)
 	witnessIncluded := false
 
-	// Choose which transactions make it into the block.
-	for priorityQueue.Len() > 0 {
-		// Grab the highest priority (or highest fee per kilobyte
-		// depending on the sort order) transaction.
-		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
-		tx := prioItem.tx
-
-		switch {
-		// If segregated witness has not been activated yet, then we
-		// shouldn't include any witness transactions in the block.
-		case !segwitActive && tx.HasWitness():
-			continue
-
-		// Otherwise, Keep track of if we've included a transaction
-		// with witness data or not. If so, then we'll need to include
-		// the witness commitment as the last output in the coinbase
-		// transaction.
-		case segwitActive && !witnessIncluded && tx.HasWitness():
-			// If we're about to include a transaction bearing
-			// witness data, then we'll also need to include a
-			// witness commitment in the coinbase transaction.
-			// Therefore, we account for the additional weight
-			// within the block with a model coinbase tx with a
-			// witness commitment.
-			coinbaseCopy := btcutil.NewTx(coinbaseTx.MsgTx().Copy())
-			coinbaseCopy.MsgTx().TxIn[0].Witness = [][]byte{
-				bytes.Repeat([]byte("a"),
-					blockchain.CoinbaseWitnessDataLen),
-			}
-			coinbaseCopy.MsgTx().AddTxOut(&wire.TxOut{
-				PkScript: bytes.Repeat([]byte("a"),
-					blockchain.CoinbaseWitnessPkScriptLength),
-			})
-
-			// In order to accurately account for the weight
-			// addition due to this coinbase transaction, we'll add
-			// the difference of the transaction before and after
-			// the addition of the commitment to the block weight.
-			weightDiff := blockchain.GetTransactionWeight(coinbaseCopy) -
-				blockchain.GetTransactionWeight(coinbaseTx)
-
-			blockWeight += uint32(weightDiff)
-
-			witnessIncluded = true
-		}
-
-		// Grab any transactions which depend on this one.
-		deps := dependers[*tx.Hash()]
-
-		// Enforce maximum block size.  Also check for overflow.
-		txWeight := uint32(blockchain.GetTransactionWeight(tx))
-		blockPlusTxWeight := blockWeight + txWeight
-		if blockPlusTxWeight < blockWeight ||
-			blockPlusTxWeight >= g.policy.BlockMaxWeight {
-
-			log.Tracef("Skipping tx %s because it would exceed "+
-				"the max block weight", tx.Hash())
-			logSkippedDeps(tx, deps)
-			continue
-		}
-
-		// Enforce maximum signature operation cost per block.  Also
-		// check for overflow.
-		sigOpCost, err := blockchain.GetSigOpCost(tx, false,
-			blockUtxos, true, segwitActive)
-		if err != nil {
-			log.Tracef("Skipping tx %s due to error in "+
-				"GetSigOpCost: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
-		}
-		if blockSigOpCost+int64(sigOpCost) < blockSigOpCost ||
-			blockSigOpCost+int64(sigOpCost) > blockchain.MaxBlockSigOpsCost {
-			log.Tracef("Skipping tx %s because it would "+
-				"exceed the maximum sigops per block", tx.Hash())
-			logSkippedDeps(tx, deps)
-			continue
-		}
-
-		// Skip free transactions once the block is larger than the
-		// minimum block size.
-		if sortedByFee &&
-			prioItem.feePerKB < int64(g.policy.TxMinFreeFee) &&
-			blockPlusTxWeight >= g.policy.BlockMinWeight {
-
-			log.Tracef("Skipping tx %s with feePerKB %d "+
-				"< TxMinFreeFee %d and block weight %d >= "+
-				"minBlockWeight %d", tx.Hash(), prioItem.feePerKB,
-				g.policy.TxMinFreeFee, blockPlusTxWeight,
-				g.policy.BlockMinWeight)
-			logSkippedDeps(tx, deps)
-			continue
-		}
-
-		// Prioritize by fee per kilobyte once the block is larger than
-		// the priority size or there are no more high-priority
-		// transactions.
-		if !sortedByFee && (blockPlusTxWeight >= g.policy.BlockPrioritySize ||
-			prioItem.priority <= MinHighPriority) {
-
-			log.Tracef("Switching to sort by fees per "+
-				"kilobyte blockSize %d >= BlockPrioritySize "+
-				"%d || priority %.2f <= minHighPriority %.2f",
-				blockPlusTxWeight, g.policy.BlockPrioritySize,
-				prioItem.priority, MinHighPriority)
-
-			sortedByFee = true
-			priorityQueue.SetLessFunc(txPQByFee)
-
-			// Put the transaction back into the priority queue and
-			// skip it so it is re-priortized by fees if it won't
-			// fit into the high-priority section or the priority
-			// is too low.  Otherwise this transaction will be the
-			// final one in the high-priority section, so just fall
-			// though to the code below so it is added now.
-			if blockPlusTxWeight > g.policy.BlockPrioritySize ||
-				prioItem.priority < MinHighPriority {
-
-				heap.Push(priorityQueue, prioItem)
-				continue
-			}
+	// fits returns whether transactions with the passed total weight and
+	// signature operation cost, which include witness data when hasWitness
+	// is set, can be added to the block without exceeding the maximum
+	// block weight or signature operation cost.
+	fits := func(weight, sigOpCost int64, hasWitness bool) bool {
+		if hasWitness && !witnessIncluded {
+			weight += witnessCommitmentWeight
 		}
+		return int64(blockWeight)+weight < int64(g.policy.BlockMaxWeight) &&
+			blockSigOpCost+sigOpCost <= blockchain.MaxBlockSigOpsCost
+	}
 
-		// Ensure the transaction inputs pass all of the necessary
-		// preconditions before allowing it to be added to the block.
-		_, err = blockchain.CheckTransactionInputs(tx, nextBlockHeight,
+	// addTx ensures the inputs of the passed candidate transaction pass all
+	// of the necessary preconditions and adds it to the block.  Candidates
+	// which fail are removed so none of the transactions which depend on
+	// them are included either.  It returns whether the transaction was
+	// added.
+	included := make(map[chainhash.Hash]struct{})
+	addTx := func(item *txPrioItem) bool {
+		tx := item.tx
+		_, err := blockchain.CheckTransactionInputs(tx, nextBlockHeight,
 			blockUtxos, g.chainParams)
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"CheckTransactionInputs: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
+			logSkippedDeps(tx, dependers[*tx.Hash()])
+			delete(candidates, *tx.Hash())
+			return false
 		}
 		err = blockchain.ValidateTransactionScripts(tx, blockUtxos,
 			txscript.StandardVerifyFlags, g.sigCache,
@@ -753,8 +729,9 @@ mempoolLoop:
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"ValidateTransactionScripts: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
+			logSkippedDeps(tx, dependers[*tx.Hash()])
+			delete(candidates, *tx.Hash())
+			return false
 		}
 
 		// Spend the transaction inputs in the block utxo view and add
@@ -763,32 +740,161 @@ mempoolLoop:
 		// aren't double spending.
 		spendTransaction(blockUtxos, tx, nextBlockHeight)
 
+		// Keep track of if we've included a transaction with witness
+		// data or not. If so, then we'll need to include the witness
+		// commitment as the last output in the coinbase transaction.
+		if tx.HasWitness() && !witnessIncluded {
+			blockWeight += uint32(witnessCommitmentWeight)
+			witnessIncluded = true
+		}
+
 		// Add the transaction to the block, increment counters, and
 		// save the fees and signature operation counts to the block
 		// template.
 		blockTxns = append(blockTxns, tx)
-		blockWeight += txWeight
-		blockSigOpCost += int64(sigOpCost)
-		totalFees += prioItem.fee
-		txFees = append(txFees, prioItem.fee)
-		txSigOpCosts = append(txSigOpCosts, int64(sigOpCost))
+		blockWeight += uint32(item.weight)
+		blockSigOpCost += item.sigOpCost
+		totalFees += item.fee
+		txFees = append(txFees, item.fee)
+		txSigOpCosts = append(txSigOpCosts, item.sigOpCost)
+		included[*tx.Hash()] = struct{}{}
+
+		log.Tracef("Adding tx %s (priority %.2f, feePerKB %d)",
+			tx.Hash(), item.priority, item.feePerKB)
+
+		// The transactions which depend on this one no longer need to
+		// wait for it.
+		for _, depender := range dependers[*tx.Hash()] {
+			delete(depender.dependsOn, *tx.Hash())
+		}
+		return true
+	}
+
+	// Fill the high-priority area of the block, if one is configured, with
+	// the transactions with the highest priority until the area is full or
+	// the priority falls below what is considered high-priority.
+	// Transactions which depend on others in the source pool become ready
+	// once all of those have been included.
+	for g.policy.BlockPrioritySize > 0 && priorityQueue.Len() > 0 {
+		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
+		tx := prioItem.tx
+		if _, ok := candidates[*tx.Hash()]; !ok {
+			continue
+		}
 
-		log.Tracef("Adding tx %s (priority %.2f, feePerKB %.2f)",
-			prioItem.tx.Hash(), prioItem.priority, prioItem.feePerKB)
+		blockPlusTxWeight := int64(blockWeight) + prioItem.weight
+		if blockPlusTxWeight >= int64(g.policy.BlockPrioritySize) ||
+			prioItem.priority <= MinHighPriority {
+
+			log.Tracef("Ending high-priority area blockSize %d >= "+
+				"BlockPrioritySize %d || priority %.2f <= "+
+				"minHighPriority %.2f", blockPlusTxWeight,
+				g.policy.BlockPrioritySize, prioItem.priority,
+				MinHighPriority)
+			break
+		}
+
+		if !fits(prioItem.weight, prioItem.sigOpCost, tx.HasWitness()) {
+			log.Tracef("Skipping tx %s because it would exceed "+
+				"the max block weight or sigops", tx.Hash())
+			logSkippedDeps(tx, dependers[*tx.Hash()])
+			continue
+		}
+		if !addTx(prioItem) {
+			continue
+		}
 
 		// Add transactions which depend on this one (and also do not
 		// have any other unsatisified dependencies) to the priority
 		// queue.
-		for _, item := range deps {
-			// Add the transaction to the priority queue if there
-			// are no more dependencies after this one.
-			delete(item.dependsOn, *tx.Hash())
+		for _, item := range dependers[*tx.Hash()] {
 			if len(item.dependsOn) == 0 {
 				heap.Push(priorityQueue, item)
 			}
 		}
 	}
 
+	// Fill the rest of the block with packages of transactions in order of
+	// the fee per kilobyte of each whole package, which consists of a
+	// transaction together with all of the transactions in the source pool
+	// it depends on that have not been included yet.  This allows a
+	// transaction paying a high fee to pull in the low fee transactions it
+	// depends on.
+	packageQueue := make(txPackageQueue, 0, len(candidates))
+	for hash, item := range candidates {
+		if _, ok := included[hash]; ok {
+			continue
+		}
+		if pkg := newTxPackage(item, candidates); pkg != nil {
+			packageQueue = append(packageQueue, pkg)
+		}
+	}
+	heap.Init(&packageQueue)
+
+	for packageQueue.Len() > 0 {
+		pkg := heap.Pop(&packageQueue).(*txPackage)
+		prioItem := pkg.txns[len(pkg.txns)-1]
+		tx := prioItem.tx
+		if _, ok := included[*tx.Hash()]; ok {
+			continue
+		}
+
+		// The package of a transaction shrinks as the transactions it
+		// depends on are included, so requeue it when it changed since
+		// it was queued.
+		current := newTxPackage(prioItem, candidates)
+		if current == nil {
+			continue
+		}
+		if len(current.txns) != len(pkg.txns) ||
+			current.feePerKB != pkg.feePerKB {
+
+			heap.Push(&packageQueue, current)
+			continue
+		}
+		pkg = current
+
+		// Skip free packages once the block is larger than the minimum
+		// block size.
+		blockPlusPkgWeight := int64(blockWeight) + pkg.weight
+		if pkg.feePerKB < int64(g.policy.TxMinFreeFee) &&
+			blockPlusPkgWeight >= int64(g.policy.BlockMinWeight) {
+
+			log.Tracef("Skipping tx %s with package feePerKB %d "+
+				"< TxMinFreeFee %d and block weight %d >= "+
+				"minBlockWeight %d", tx.Hash(), pkg.feePerKB,
+				g.policy.TxMinFreeFee, blockPlusPkgWeight,
+				g.policy.BlockMinWeight)
+			continue
+		}
+
+		if !fits(pkg.weight, pkg.sigOpCost, pkg.hasWitness) {
+			log.Tracef("Skipping tx %s because its package would "+
+				"exceed the max block weight or sigops",
+				tx.Hash())
+			continue
+		}
+
+		// Add the package, which is ordered so that each transaction
+		// comes after the ones it depends on.
+		for _, item := range pkg.txns {
+			if !addTx(item) {
+				break
+			}
+		}
+
+		// The packages of the transactions which depend on the ones
+		// just included have changed, so queue them again.
+		for _, item := range descendantItems(pkg.txns, dependers) {
+			if _, ok := included[*item.tx.Hash()]; ok {
+				continue
+			}
+			if pkg := newTxPackage(item, candidates); pkg != nil {
+				heap.Push(&packageQueue, pkg)
+			}
+		}
+	}
+
 	// Now that the actual transactions have been selected, update the
 	// block weight for the real transaction count and coinbase value with
 	// the total fees accordingly.
@@ -0,0 +1,136 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining
+
+import (
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// txPackage houses a transaction together with all of the transactions in the
+// source pool it depends on which have not been included in the block yet,
+// along with their combined modified fees, weight and signature operation
+// cost.
+type txPackage struct {
+	// txns holds the transactions of the package ordered so that each
+	// transaction comes after the ones it depends on.  The transaction the
+	// package was created for is always the last one.
+	txns []*txPrioItem
+
+	fee        int64
+	weight     int64
+	sigOpCost  int64
+	feePerKB   int64
+	hasWitness bool
+}
+
+// newTxPackage returns the package of the passed candidate transaction, which
+// consists of the transaction together with all of the candidate transactions
+// it depends on, directly or indirectly, which have not been included in the
+// block yet.  Nil is returned when the transaction depends on a transaction
+// which is no longer a candidate, since it can then never be included.
+func newTxPackage(item *txPrioItem, candidates map[chainhash.Hash]*txPrioItem) *txPackage {
+	pkg := new(txPackage)
+	visited := make(map[chainhash.Hash]struct{})
+	var visit func(item *txPrioItem) bool
+	visit = func(item *txPrioItem) bool {
+		visited[*item.tx.Hash()] = struct{}{}
+		for parentHash := range item.dependsOn {
+			if _, ok := visited[parentHash]; ok {
+				continue
+			}
+			parent, ok := candidates[parentHash]
+			if !ok || !visit(parent) {
+				return false
+			}
+		}
+
+		pkg.txns = append(pkg.txns, item)
+		pkg.fee += item.modifiedFee
+		pkg.weight += item.weight
+		pkg.sigOpCost += item.sigOpCost
+		pkg.hasWitness = pkg.hasWitness || item.tx.HasWitness()
+		return true
+	}
+	if !visit(item) {
+		return nil
+	}
+
+	vsize := (pkg.weight + blockchain.WitnessScaleFactor - 1) /
+		blockchain.WitnessScaleFactor
+	pkg.feePerKB = pkg.fee * 1000 / vsize
+	return pkg
+}
+
+// descendantItems returns all of the transactions which depend on any of the
+// passed transactions, directly or indirectly, according to the passed
+// dependers map.
+func descendantItems(items []*txPrioItem, dependers map[chainhash.Hash]map[chainhash.Hash]*txPrioItem) []*txPrioItem {
+	var descendants []*txPrioItem
+	visited := make(map[chainhash.Hash]struct{})
+	queue := append([]*txPrioItem(nil), items...)
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+
+		for hash, depender := range dependers[*item.tx.Hash()] {
+			if _, ok := visited[hash]; ok {
+				continue
+			}
+			visited[hash] = struct{}{}
+
+			descendants = append(descendants, depender)
+			queue = append(queue, depender)
+		}
+	}
+	return descendants
+}
+
+// txPackageQueue implements a priority queue of transaction packages ordered
+// by the fee per kilobyte of each whole package, with the highest first.
+type txPackageQueue []*txPackage
+
+// Len returns the number of packages in the priority queue.  It is part of the
+// heap.Interface implementation.
+func (pq txPackageQueue) Len() int {
+	return len(pq)
+}
+
+// Less returns whether the package in the priority queue with index i should
+// sort before the package with index j.  It is part of the heap.Interface
+// implementation.
+func (pq txPackageQueue) Less(i, j int) bool {
+	// Using > here so that pop gives the package with the highest fee per
+	// kilobyte as opposed to the lowest.  Prefer smaller packages when the
+	// fees per kilobyte are equal.
+	if pq[i].feePerKB == pq[j].feePerKB {
+		return pq[i].weight < pq[j].weight
+	}
+	return pq[i].feePerKB > pq[j].feePerKB
+}
+
+// Swap swaps the packages at the passed indices in the priority queue.  It is
+// part of the heap.Interface implementation.
+func (pq txPackageQueue) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+}
+
+// Push pushes the passed package onto the priority queue.  It is part of the
+// heap.Interface implementation.
+func (pq *txPackageQueue) Push(x interface{}) {
+	*pq = append(*pq, x.(*txPackage))
+}
+
+// Pop removes the highest priority package (according to Less) from the
+// priority queue and returns it.  It is part of the heap.Interface
+// implementation.
+func (pq *txPackageQueue) Pop() interface{} {
+	old := *pq
+	n := len(old)
+	pkg := old[n-1]
+	old[n-1] = nil
+	*pq = old[0 : n-1]
+	return pkg
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining
+
+import (
+	"container/heap"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestTxPackages ensures the package of a transaction includes all of the
+// transactions it depends on which have not been included yet in dependency
+// order, and that packages are ordered by their combined fee per kilobyte so a
+// high fee child pulls in its low fee parent.
+func TestTxPackages(t *testing.T) {
+	candidates := make(map[chainhash.Hash]*txPrioItem)
+	dependers := make(map[chainhash.Hash]map[chainhash.Hash]*txPrioItem)
+	newItem := func(fee int64, parents ...*txPrioItem) *txPrioItem {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Index: uint32(len(candidates))},
+		})
+		for _, parent := range parents {
+			msgTx.AddTxIn(&wire.TxIn{
+				PreviousOutPoint: wire.OutPoint{Hash: *parent.tx.Hash()},
+			})
+		}
+		msgTx.AddTxOut(&wire.TxOut{Value: 1000})
+
+		item := &txPrioItem{
+			tx:          btcutil.NewTx(msgTx),
+			fee:         fee,
+			modifiedFee: fee,
+			weight:      1000,
+		}
+		for _, parent := range parents {
+			if item.dependsOn == nil {
+				item.dependsOn = make(map[chainhash.Hash]struct{})
+			}
+			item.dependsOn[*parent.tx.Hash()] = struct{}{}
+
+			deps, ok := dependers[*parent.tx.Hash()]
+			if !ok {
+				deps = make(map[chainhash.Hash]*txPrioItem)
+				dependers[*parent.tx.Hash()] = deps
+			}
+			deps[*item.tx.Hash()] = item
+		}
+		candidates[*item.tx.Hash()] = item
+		return item
+	}
+
+	// The low fee parent has a high fee child, which in turn has a child of
+	// its own, while another transaction pays a medium fee on its own.
+	parent := newItem(100)
+	child := newItem(10000, parent)
+	grandchild := newItem(100, child)
+	medium := newItem(2000)
+
+	pkg := newTxPackage(grandchild, candidates)
+	if pkg == nil || len(pkg.txns) != 3 || pkg.txns[0] != parent ||
+		pkg.txns[1] != child || pkg.txns[2] != grandchild {
+
+		t.Fatalf("newTxPackage: got %v, want parent, child and "+
+			"grandchild in order", pkg)
+	}
+	if pkg.fee != 10200 || pkg.weight != 3000 || pkg.feePerKB != 13600 {
+		t.Fatalf("newTxPackage: got fee %d, weight %d and fee per kB "+
+			"%d, want 10200, 3000 and 13600", pkg.fee, pkg.weight,
+			pkg.feePerKB)
+	}
+
+	// The child's package pays the highest fee rate and is popped first,
+	// ahead of the medium fee transaction.
+	var pq txPackageQueue
+	for _, item := range []*txPrioItem{parent, child, grandchild, medium} {
+		heap.Push(&pq, newTxPackage(item, candidates))
+	}
+	if top := heap.Pop(&pq).(*txPackage); top.txns[len(top.txns)-1] != child {
+		t.Fatalf("txPackageQueue: popped the package of %v first, want "+
+			"the child", top.txns[len(top.txns)-1].tx.Hash())
+	}
+	if top := heap.Pop(&pq).(*txPackage); top.txns[len(top.txns)-1] != grandchild {
+		t.Fatalf("txPackageQueue: popped the package of %v second, "+
+			"want the grandchild", top.txns[len(top.txns)-1].tx.Hash())
+	}
+
+	// Once the parent is included, it's no longer part of the packages of
+	// its descendants.
+	delete(child.dependsOn, *parent.tx.Hash())
+	pkg = newTxPackage(grandchild, candidates)
+	if len(pkg.txns) != 2 || pkg.txns[0] != child {
+		t.Fatalf("newTxPackage: got %d transactions, want the child and "+
+			"grandchild", len(pkg.txns))
+	}
+	descendants := descendantItems([]*txPrioItem{parent}, dependers)
+	if len(descendants) != 2 {
+		t.Fatalf("descendantItems: got %d descendants, want 2",
+			len(descendants))
+	}
+
+	// A transaction depending on one which is no longer a candidate can't
+	// be included.
+	delete(candidates, *child.tx.Hash())
+	if pkg := newTxPackage(grandchild, candidates); pkg != nil {
+		t.Fatalf("newTxPackage: got a package for a transaction which " +
+			"depends on a removed candidate")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// maxHighBandwidthPeers is the maximum number of peers which are asked
+	// to announce new blocks by sending cmpctblock messages directly as
+	// described by the BIP0152 high-bandwidth mode.
+	maxHighBandwidthPeers = 3
+
+	// blockTxnTimeout is the amount of time to wait for the transactions
+	// requested for a partial block with a getblocktxn message before the
+	// full block is requested instead.
+	blockTxnTimeout = 10 * time.Second
+)
+
+var (
+	// errShortIDCollision is returned when a compact block contains
+	// duplicate short ids and therefore can't be reconstructed.  The full
+	// block must be requested instead.
+	errShortIDCollision = errors.New("compact block contains duplicate " +
+		"short ids")
+
+	// errReconstructMismatch is returned when a reconstructed block does
+	// not commit to the transactions which were used to build it.  This
+	// typically means a short id matched the wrong memory pool
+	// transaction.  The full block must be requested instead.
+	errReconstructMismatch = errors.New("reconstructed block does not " +
+		"match its merkle root or witness commitment")
+)
+
+// partialBlock houses a block which is being reconstructed from a cmpctblock
+// message along with the transactions that are still missing from it.
+type partialBlock struct {
+	header      wire.BlockHeader
+	txns        []*wire.MsgTx
+	missing     []uint32
+	haveWitness bool
+
+	// requested is the time the missing transactions were requested.
+	requested time.Time
+}
+
+// newPartialBlock creates a partial block from the passed compact block and
+// fills in as many of its transactions as possible from the passed memory pool
+// transactions.  The version is the negotiated compact block version which
+// determines whether short ids are calculated from transaction hashes or
+// witness transaction hashes.
+//
+// An error of type errShortIDCollision is returned when the compact block can
+// not be reconstructed without the full block.  Any other error indicates the
+// compact block itself is malformed.
+func newPartialBlock(msg *wire.MsgCmpctBlock, version uint64, pool []*mempool.TxDesc) (*partialBlock, error) {
+	txCount := msg.TxCount()
+	if txCount == 0 {
+		return nil, fmt.Errorf("compact block has no transactions")
+	}
+
+	pb := &partialBlock{
+		header:      msg.Header,
+		txns:        make([]*wire.MsgTx, txCount),
+		haveWitness: version == 2,
+	}
+
+	// Place the prefilled transactions at their positions.  The wire
+	// decoding already ensures the indexes are increasing.
+	for _, ptx := range msg.PrefilledTxs {
+		if int(ptx.Index) >= txCount || ptx.Tx == nil {
+			return nil, fmt.Errorf("prefilled transaction index %d "+
+				"is out of range", ptx.Index)
+		}
+		pb.txns[ptx.Index] = ptx.Tx
+	}
+
+	// Map the short ids to the remaining open positions in the block.
+	shortIDs := make(map[uint64]int, len(msg.ShortIDs))
+	pos := 0
+	for _, id := range msg.ShortIDs {
+		for pb.txns[pos] != nil {
+			pos++
+		}
+		if _, exists := shortIDs[id]; exists {
+			return nil, errShortIDCollision
+		}
+		shortIDs[id] = pos
+		pos++
+	}
+
+	// Fill in the transactions from the memory pool.  A short id which
+	// matches more than one transaction is ambiguous, so leave it to be
+	// requested from the peer.
+	key := msg.ShortIDKey()
+	collisions := make(map[int]struct{})
+	for _, txD := range pool {
+		var hash *chainhash.Hash
+		if pb.haveWitness {
+			hash = txD.Tx.WitnessHash()
+		} else {
+			hash = txD.Tx.Hash()
+		}
+		pos, ok := shortIDs[wire.ShortID(&key, hash)]
+		if !ok {
+			continue
+		}
+		if _, ok := collisions[pos]; ok {
+			continue
+		}
+		if pb.txns[pos] != nil {
+			pb.txns[pos] = nil
+			collisions[pos] = struct{}{}
+			continue
+		}
+		pb.txns[pos] = txD.Tx.MsgTx()
+	}
+
+	for i, tx := range pb.txns {
+		if tx == nil {
+			pb.missing = append(pb.missing, uint32(i))
+		}
+	}
+	return pb, nil
+}
+
+// fill adds the passed transactions, which must be in the same order as the
+// missing indexes, to the partial block.
+func (pb *partialBlock) fill(txns []*wire.MsgTx) error {
+	if len(txns) != len(pb.missing) {
+		return fmt.Errorf("blocktxn contains %d transactions instead "+
+			"of the %d requested", len(txns), len(pb.missing))
+	}
+	for i, index := range pb.missing {
+		pb.txns[index] = txns[i]
+	}
+	pb.missing = nil
+	return nil
+}
+
+// block returns the reconstructed block once all of its transactions are
+// known.  The merkle root and, for witness compact blocks, the witness
+// commitment are checked so a block built from the wrong transactions is not
+// handed to the chain.
+func (pb *partialBlock) block() (*btcutil.Block, error) {
+	if len(pb.missing) != 0 {
+		return nil, fmt.Errorf("partial block is missing %d "+
+			"transactions", len(pb.missing))
+	}
+
+	msgBlock := wire.NewMsgBlock(&pb.header)
+	for _, tx := range pb.txns {
+		msgBlock.AddTransaction(tx)
+	}
+	block := btcutil.NewBlock(msgBlock)
+
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	if !pb.header.MerkleRoot.IsEqual(merkles[len(merkles)-1]) {
+		return nil, errReconstructMismatch
+	}
+	if pb.haveWitness {
+		if err := blockchain.ValidateWitnessCommitment(block); err != nil {
+			return nil, errReconstructMismatch
+		}
+	}
+	return block, nil
+}
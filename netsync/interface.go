@@ -37,5 +37,10 @@ type Config struct {
 	DisableCheckpoints bool
 	MaxPeers           int
 
+	// AssumeValid is the hash of a block whose ancestors skip script
+	// validation once enough work is built on top of it.  It is nil when
+	// no block is assumed to be valid.
+	AssumeValid *chainhash.Hash
+
 	FeeEstimator *mempool.FeeEstimator
 }
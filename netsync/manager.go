@@ -6,6 +6,8 @@ package netsync
 
 import (
 	"container/list"
+	"encoding/binary"
+	"math/big"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -22,10 +24,36 @@ import (
 )
 
 const (
-	// minInFlightBlocks is the minimum number of blocks that should be
-	// in the request queue for headers-first mode before requesting
-	// more.
-	minInFlightBlocks = 10
+	// blockDownloadWindow is the maximum number of blocks past the first
+	// block which has not been processed yet that are requested in
+	// headers-first mode.  Blocks which arrive ahead of the blocks before
+	// them are held in memory until those are processed, so this also
+	// bounds the memory they use.
+	blockDownloadWindow = 256
+
+	// maxBlocksInFlightPerPeer is the maximum number of blocks requested
+	// from a single peer at once in headers-first mode.
+	maxBlocksInFlightPerPeer = 16
+
+	// blockStallTimeout is the amount of time a peer may hold up the
+	// download window in headers-first mode before it is disconnected so
+	// its blocks can be requested from other peers.
+	blockStallTimeout = 5 * time.Second
+
+	// stallCheckInterval is the interval at which peers which are stalling
+	// the download window and partial blocks whose missing transactions
+	// have not arrived are checked for.
+	stallCheckInterval = time.Second
+
+	// assumeValidWorkTime is the amount of time worth of work which must be
+	// built on top of the assumed valid block before its ancestors are
+	// allowed to skip script validation.
+	assumeValidWorkTime = time.Hour * 24 * 14
+
+	// headerCommitmentPeriod is the number of headers per commitment which
+	// is kept while checking the work of the header chain of the sync peer
+	// before its headers are stored.
+	headerCommitmentPeriod = 584
 
 	// maxRejectedTxns is the maximum number of rejected transactions
 	// hashes to store in memory.
@@ -56,6 +84,22 @@ type blockMsg struct {
 	reply chan struct{}
 }
 
+// cmpctBlockMsg packages a bitcoin cmpctblock message and the peer it came
+// from together so the block handler has access to that information.
+type cmpctBlockMsg struct {
+	cmpctBlock *wire.MsgCmpctBlock
+	peer       *peerpkg.Peer
+	reply      chan struct{}
+}
+
+// blockTxnMsg packages a bitcoin blocktxn message and the peer it came from
+// together so the block handler has access to that information.
+type blockTxnMsg struct {
+	blockTxn *wire.MsgBlockTxn
+	peer     *peerpkg.Peer
+	reply    chan struct{}
+}
+
 // invMsg packages a bitcoin inv message and the peer it came from together
 // so the block handler has access to that information.
 type invMsg struct {
@@ -122,11 +166,17 @@ type pauseMsg struct {
 	unpause <-chan struct{}
 }
 
-// headerNode is used as a node in a list of headers that are linked together
-// between checkpoints.
+// headerNode is used as a node in the list of headers of the blocks which are
+// downloaded in headers-first mode.
 type headerNode struct {
 	height int32
 	hash   *chainhash.Hash
+
+	// peer is the peer the block was requested from, if any.  block holds
+	// the block once it was received until the blocks before it have been
+	// processed.
+	peer  *peerpkg.Peer
+	block *btcutil.Block
 }
 
 // peerSyncState stores additional information that the SyncManager tracks
@@ -136,6 +186,11 @@ type peerSyncState struct {
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
 	requestedBlocks map[chainhash.Hash]struct{}
+	partialBlocks   map[chainhash.Hash]*partialBlock
+
+	// stallingSince is the time the peer started holding up the download
+	// window in headers-first mode, or zero when it is not.
+	stallingSince time.Time
 }
 
 // SyncManager is used to communicate block related messages with peers. The
@@ -162,11 +217,48 @@ type SyncManager struct {
 	syncPeer        *peerpkg.Peer
 	peerStates      map[*peerpkg.Peer]*peerSyncState
 
-	// The following fields are used for headers-first mode.
+	// hbPeers houses the peers which were asked to announce new blocks
+	// with cmpctblock messages, ordered from oldest to newest.
+	hbPeers []*peerpkg.Peer
+
+	// The following fields are used for headers-first mode.  The header
+	// list holds the headers of the blocks which have not been processed
+	// yet while lastHeader is the latest known header which the next
+	// downloaded header must connect to.  Blocks at or below the height
+	// of the latest checkpoint verified by the downloaded headers are
+	// eligible for less validation.
 	headersFirstMode bool
+	headersSynced    bool
 	headerList       *list.List
-	startHeader      *list.Element
+	headerNodes      map[chainhash.Hash]*list.Element
+	lastHeader       *headerNode
 	nextCheckpoint   *chaincfg.Checkpoint
+	checkpointHeight int32
+
+	// The following fields track the assumed valid block in the header
+	// list.  Once enough work is built on top of it, the blocks at or
+	// below assumeValidHeight skip script validation.
+	assumeValid         *chainhash.Hash
+	assumeValidNode     *headerNode
+	assumeValidWork     *big.Int
+	assumeValidRequired *big.Int
+	assumeValidHeight   int32
+
+	// The following fields are used to check the work of the header chain
+	// of the sync peer before its headers are stored.  While presyncing,
+	// the headers are only checked and a salted one bit commitment to one
+	// out of every headerCommitmentPeriod headers is kept.  Once the
+	// headers are shown to have the minimum chain work, they are
+	// downloaded again starting from startHeader, checked against the
+	// commitments and stored.  Blocks are only downloaded once the stored
+	// headers have the minimum chain work.
+	presyncing         bool
+	headerWorkVerified bool
+	headerWork         *big.Int
+	startHeader        *headerNode
+	startWork          *big.Int
+	headerCommitments  []bool
+	commitmentSalt     uint64
 
 	// An optional fee estimator.
 	feeEstimator *mempool.FeeEstimator
@@ -174,18 +266,49 @@ type SyncManager struct {
 
 // resetHeaderState sets the headers-first mode state to values appropriate for
 // syncing from a new peer.
-func (sm *SyncManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight int32) {
+func (sm *SyncManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight int32, newestWork *big.Int) {
 	sm.headersFirstMode = false
+	sm.headersSynced = false
 	sm.headerList.Init()
-	sm.startHeader = nil
+	sm.headerNodes = make(map[chainhash.Hash]*list.Element)
+	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(newestHeight)
+	sm.checkpointHeight = 0
+	sm.assumeValidNode = nil
+	sm.assumeValidWork = nil
+	sm.assumeValidRequired = nil
+	sm.assumeValidHeight = 0
+
+	// The latest known block is the last header.  This allows the next
+	// downloaded header to prove it links to the chain properly.
+	sm.lastHeader = &headerNode{height: newestHeight, hash: newestHash}
+
+	// The headers need to be presynced unless the chain already has the
+	// minimum chain work.
+	minWork := sm.chainParams.MinimumChainWork
+	sm.headerWorkVerified = minWork == nil || newestWork.Cmp(minWork) >= 0
+	sm.presyncing = !sm.headerWorkVerified
+	sm.headerWork = new(big.Int).Set(newestWork)
+	sm.startHeader = sm.lastHeader
+	sm.startWork = new(big.Int).Set(newestWork)
+	sm.headerCommitments = nil
+}
 
-	// When there is a next checkpoint, add an entry for the latest known
-	// block into the header pool.  This allows the next downloaded header
-	// to prove it links to the chain properly.
-	if sm.nextCheckpoint != nil {
-		node := headerNode{height: newestHeight, hash: newestHash}
-		sm.headerList.PushBack(&node)
-	}
+// headerCommitment returns the salted one bit commitment to the header with
+// the passed hash.  The salt is unknown to peers, so a peer can't serve a
+// different header chain once the headers are downloaded again without being
+// caught with high probability.
+func (sm *SyncManager) headerCommitment(hash *chainhash.Hash) bool {
+	var buf [8 + chainhash.HashSize]byte
+	binary.LittleEndian.PutUint64(buf[:8], sm.commitmentSalt)
+	copy(buf[8:], hash[:])
+	return chainhash.HashB(buf[:])[0]&1 == 1
+}
+
+// isCommitmentHeight returns whether or not a commitment is kept for the
+// header at the passed height while presyncing.
+func (sm *SyncManager) isCommitmentHeight(height int32) bool {
+	offset := int32(sm.commitmentSalt % headerCommitmentPeriod)
+	return height%headerCommitmentPeriod == offset
 }
 
 // findNextHeaderCheckpoint returns the next checkpoint after the passed height.
@@ -280,32 +403,31 @@ func (sm *SyncManager) startSync() {
 		log.Infof("Syncing to block height %d from peer %v",
 			bestPeer.LastBlock(), bestPeer.Addr())
 
-		// When the current height is less than a known checkpoint we
-		// can use block headers to learn about which blocks comprise
-		// the chain up to the checkpoint and perform less validation
-		// for them.  This is possible since each header contains the
-		// hash of the previous header and a merkle root.  Therefore if
-		// we validate all of the received headers link together
-		// properly and the checkpoint hashes match, we can be sure the
-		// hashes for the blocks in between are accurate.  Further, once
-		// the full blocks are downloaded, the merkle root is computed
-		// and compared against the value in the header which proves the
-		// full block hasn't been tampered with.
+		// When the peer is ahead of us, use block headers to learn
+		// about which blocks comprise the chain and download the blocks
+		// from all suitable peers at once.  Each header contains the
+		// hash of the previous header and a merkle root, so once the
+		// full blocks are downloaded, the merkle root is computed and
+		// compared against the value in the header which proves the
+		// full block hasn't been tampered with.  Further, when the
+		// headers link together properly and a checkpoint hash
+		// matches, we can be sure the hashes for the blocks before it
+		// are accurate and perform less validation for them.
 		//
-		// Once we have passed the final checkpoint, or checkpoints are
-		// disabled, use standard inv messages learn about the blocks
-		// and fully validate them.  Finally, regression test mode does
-		// not support the headers-first approach so do normal block
-		// downloads when in regression test mode.
-		if sm.nextCheckpoint != nil &&
-			best.Height < sm.nextCheckpoint.Height &&
+		// Regression test mode does not support the headers-first
+		// approach so do normal block downloads when in regression
+		// test mode or when the peer is not ahead of us.
+		if best.Height < bestPeer.LastBlock() &&
 			sm.chainParams != &chaincfg.RegressionNetParams {
 
-			bestPeer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
+			sm.resetHeaderState(&best.Hash, best.Height,
+				best.ChainWork)
+			bestPeer.PushGetHeadersMsg(locator, &zeroHash)
 			sm.headersFirstMode = true
+			sm.progressLogger.SetLastLogTime(time.Now())
 			log.Infof("Downloading headers for blocks %d to "+
 				"%d from peer %s", best.Height+1,
-				sm.nextCheckpoint.Height, bestPeer.Addr())
+				bestPeer.LastBlock(), bestPeer.Addr())
 		} else {
 			bestPeer.PushGetBlocksMsg(locator, &zeroHash)
 		}
@@ -369,11 +491,25 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 		syncCandidate:   isSyncCandidate,
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		partialBlocks:   make(map[chainhash.Hash]*partialBlock),
 	}
 
-	// Start syncing by choosing the best candidate if needed.
+	// Signal support for compact blocks in low-bandwidth mode.  The
+	// preferred version is sent first.  Peers are only switched to
+	// high-bandwidth mode once they have proven to deliver new blocks.
+	if peer.ProtocolVersion() >= wire.ShortIDsBlocksVersion {
+		if peer.IsWitnessEnabled() {
+			peer.QueueMessage(wire.NewMsgSendCmpct(false, 2), nil)
+		}
+		peer.QueueMessage(wire.NewMsgSendCmpct(false, 1), nil)
+	}
+
+	// Start syncing by choosing the best candidate if needed.  Otherwise,
+	// the peer can help downloading blocks in headers-first mode.
 	if isSyncCandidate && sm.syncPeer == nil {
 		sm.startSync()
+	} else if isSyncCandidate {
+		sm.fetchBlocks()
 	}
 }
 
@@ -400,24 +536,73 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 	}
 
 	// Remove requested blocks from the global map so that they will be
-	// fetched from elsewhere next time we get an inv.
-	// TODO: we could possibly here check which peers have these blocks
-	// and request them now to speed things up a little.
+	// fetched from elsewhere next time we get an inv.  Blocks requested in
+	// headers-first mode are requested from other peers right away.
 	for blockHash := range state.requestedBlocks {
 		delete(sm.requestedBlocks, blockHash)
+		if e, ok := sm.headerNodes[blockHash]; ok {
+			node := e.Value.(*headerNode)
+			if node.peer == peer && node.block == nil {
+				node.peer = nil
+			}
+		}
+	}
+
+	// Forget the blocks which were being reconstructed from compact blocks
+	// sent by the peer so they will be fetched from elsewhere too.
+	for blockHash := range state.partialBlocks {
+		delete(sm.requestedBlocks, blockHash)
+	}
+	state.partialBlocks = nil
+
+	// Remove the peer from the high-bandwidth compact block peers.
+	for i, hbPeer := range sm.hbPeers {
+		if hbPeer == peer {
+			sm.hbPeers = append(sm.hbPeers[:i], sm.hbPeers[i+1:]...)
+			break
+		}
 	}
 
 	// Attempt to find a new peer to sync from if the quitting peer is the
 	// sync peer.  Also, reset the headers-first state if in headers-first
-	// mode so
+	// mode so the headers are downloaded from the new sync peer.
 	if sm.syncPeer == peer {
 		sm.syncPeer = nil
 		if sm.headersFirstMode {
 			best := sm.chain.BestSnapshot()
-			sm.resetHeaderState(&best.Hash, best.Height)
+			sm.resetHeaderState(&best.Hash, best.Height,
+				best.ChainWork)
 		}
 		sm.startSync()
+		return
+	}
+	sm.fetchBlocks()
+}
+
+// witnessIndependentReject returns whether the passed error, which caused a
+// transaction to be rejected, would reject the transaction regardless of its
+// witness.  Transactions which are rejected due to their scripts or signature
+// operations might be accepted with a different witness.
+func witnessIndependentReject(err error) bool {
+	rerr, ok := err.(mempool.RuleError)
+	if !ok {
+		return false
+	}
+
+	switch err := rerr.Err.(type) {
+	case blockchain.RuleError:
+		switch err.ErrorCode {
+		case blockchain.ErrScriptMalformed, blockchain.ErrScriptValidation,
+			blockchain.ErrTooManySigOps:
+			return false
+		}
+		return true
+
+	case mempool.TxRuleError:
+		return err.RejectCode == wire.RejectDuplicate
 	}
+
+	return false
 }
 
 // handleTxMsg handles transaction messages from all peers.
@@ -438,11 +623,14 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	// to disconnect peers for sending unsolicited transactions to provide
 	// interoperability.
 	txHash := tmsg.tx.Hash()
+	wtxHash := tmsg.tx.WitnessHash()
 
 	// Ignore transactions that we have already rejected.  Do not
 	// send a reject message here because if the transaction was already
-	// rejected, the transaction was unsolicited.
-	if _, exists = sm.rejectedTxns[*txHash]; exists {
+	// rejected, the transaction was unsolicited.  Rejected transactions
+	// are tracked by witness hash so the same transaction with a different
+	// witness is still processed.
+	if _, exists = sm.rejectedTxns[*wtxHash]; exists {
 		log.Debugf("Ignoring unsolicited previously rejected "+
 			"transaction %v from %s", txHash, peer)
 		return
@@ -456,14 +644,23 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	// Remove transaction from request maps. Either the mempool/chain
 	// already knows about it and as such we shouldn't have any more
 	// instances of trying to fetch it, or we failed to insert and thus
-	// we'll retry next time we get an inv.
+	// we'll retry next time we get an inv.  The transaction may have been
+	// requested by either its hash or its witness hash.
 	delete(state.requestedTxns, *txHash)
 	delete(sm.requestedTxns, *txHash)
+	delete(state.requestedTxns, *wtxHash)
+	delete(sm.requestedTxns, *wtxHash)
 
 	if err != nil {
 		// Do not request this transaction again until a new block
-		// has been processed.
-		sm.rejectedTxns[*txHash] = struct{}{}
+		// has been processed.  The hash is also rejected when the
+		// witness isn't the cause of the rejection so the transaction
+		// isn't requested again from peers which announce it by its
+		// hash.
+		sm.rejectedTxns[*wtxHash] = struct{}{}
+		if witnessIndependentReject(err) {
+			sm.rejectedTxns[*txHash] = struct{}{}
+		}
 		sm.limitMap(sm.rejectedTxns, maxRejectedTxns)
 
 		// When the error is a rule error, it means the transaction was
@@ -534,39 +731,32 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
-	// When in headers-first mode, if the block matches the hash of the
-	// first header in the list of headers that are being fetched, it's
-	// eligible for less validation since the headers have already been
-	// verified to link together and are valid up to the next checkpoint.
-	// Also, remove the list entry for all blocks except the checkpoint
-	// since it is needed to verify the next round of headers links
-	// properly.
-	isCheckpointBlock := false
-	behaviorFlags := blockchain.BFNone
-	if sm.headersFirstMode {
-		firstNodeEl := sm.headerList.Front()
-		if firstNodeEl != nil {
-			firstNode := firstNodeEl.Value.(*headerNode)
-			if blockHash.IsEqual(firstNode.hash) {
-				behaviorFlags |= blockchain.BFFastAdd
-				if firstNode.hash.IsEqual(sm.nextCheckpoint.Hash) {
-					isCheckpointBlock = true
-				} else {
-					sm.headerList.Remove(firstNodeEl)
-				}
-			}
-		}
-	}
-
 	// Remove block from request maps. Either chain will know about it and
 	// so we shouldn't have any more instances of trying to fetch it, or we
 	// will fail the insert and thus we'll retry next time we get an inv.
 	delete(state.requestedBlocks, *blockHash)
 	delete(sm.requestedBlocks, *blockHash)
+	delete(state.partialBlocks, *blockHash)
+
+	// When in headers-first mode, blocks of the downloaded headers are
+	// processed in the order of the headers, so hold on to the block until
+	// the blocks before it have been processed.  The peer delivered a
+	// block, so it is no longer stalling the download either.
+	if sm.headersFirstMode {
+		if e, ok := sm.headerNodes[*blockHash]; ok {
+			state.stallingSince = time.Time{}
+			node := e.Value.(*headerNode)
+			node.peer = peer
+			node.block = bmsg.block
+			sm.processHeaderBlocks()
+			sm.fetchBlocks()
+			return
+		}
+	}
 
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
-	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, behaviorFlags)
+	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, blockchain.BFNone)
 	if err != nil {
 		// When the error is a rule error, it means the block was simply
 		// rejected as opposed to something actually going wrong, so log
@@ -625,12 +815,14 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 			}
 		}
 
+		// The parents are downloaded with the headers when in
+		// headers-first mode.
 		orphanRoot := sm.chain.GetOrphanRoot(blockHash)
 		locator, err := sm.chain.LatestBlockLocator()
 		if err != nil {
 			log.Warnf("Failed to get block locator for the "+
 				"latest block: %v", err)
-		} else {
+		} else if !sm.headersFirstMode {
 			peer.PushGetBlocksMsg(locator, orphanRoot)
 		}
 	} else {
@@ -646,6 +838,12 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 		// Clear the rejected transactions.
 		sm.rejectedTxns = make(map[chainhash.Hash]struct{})
+
+		// The peer delivered a new block, so consider it for
+		// high-bandwidth compact block relay.
+		if sm.current() {
+			sm.updateHighBandwidthPeers(peer)
+		}
 	}
 
 	// Update the block height for this peer. But only send a message to
@@ -659,115 +857,524 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 				peer)
 		}
 	}
+}
 
-	// Nothing more to do if we aren't in headers-first mode.
-	if !sm.headersFirstMode {
+// handleCmpctBlockMsg handles cmpctblock messages from all peers.  The block
+// is reconstructed from the memory pool when possible, otherwise the missing
+// transactions are requested with a getblocktxn message or, failing that, the
+// full block is requested.
+func (sm *SyncManager) handleCmpctBlockMsg(cmsg *cmpctBlockMsg) {
+	peer := cmsg.peer
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Warnf("Received cmpctblock message from unknown peer %s",
+			peer)
 		return
 	}
 
-	// This is headers-first mode, so if the block is not a checkpoint
-	// request more blocks using the header list when the request queue is
-	// getting short.
-	if !isCheckpointBlock {
-		if sm.startHeader != nil &&
-			len(state.requestedBlocks) < minInFlightBlocks {
-			sm.fetchHeaderBlocks()
+	msg := cmsg.cmpctBlock
+	blockHash := msg.BlockHash()
+	iv := wire.NewInvVect(wire.InvTypeBlock, &blockHash)
+	peer.AddKnownInventory(iv)
+
+	// Nothing more to do if the block is already known.
+	_, requested := state.requestedBlocks[blockHash]
+	haveBlock, err := sm.chain.HaveBlock(&blockHash)
+	if err != nil || haveBlock {
+		if requested {
+			delete(state.requestedBlocks, blockHash)
+			delete(sm.requestedBlocks, blockHash)
 		}
 		return
 	}
 
-	// This is headers-first mode and the block is a checkpoint.  When
-	// there is a next checkpoint, get the next round of headers by asking
-	// for headers starting from the block after this one up to the next
-	// checkpoint.
-	prevHeight := sm.nextCheckpoint.Height
-	prevHash := sm.nextCheckpoint.Hash
-	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(prevHeight)
-	if sm.nextCheckpoint != nil {
-		locator := blockchain.BlockLocator([]*chainhash.Hash{prevHash})
-		err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-		if err != nil {
-			log.Warnf("Failed to send getheaders message to "+
-				"peer %s: %v", peer.Addr(), err)
+	// Compact blocks can only be sent by peers which signalled support for
+	// them.
+	version := peer.CompactBlockVersion()
+	if version == 0 {
+		log.Warnf("Got cmpctblock %v from %s which did not negotiate "+
+			"compact blocks -- disconnecting", blockHash, peer.Addr())
+		peer.Disconnect()
+		return
+	}
+
+	// Unsolicited compact blocks are only expected from high-bandwidth
+	// peers, so ignore them when we're not current just like block
+	// announcements.
+	if !requested && !sm.current() {
+		return
+	}
+
+	// Ensure the header commits to enough work before spending any effort
+	// on reconstruction.
+	err = blockchain.CheckProofOfWork(btcutil.NewBlock(wire.NewMsgBlock(
+		&msg.Header)), sm.chainParams.PowLimit)
+	if err != nil {
+		log.Warnf("Got cmpctblock %v from %s with invalid proof of "+
+			"work: %v -- disconnecting", blockHash, peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+	peer.UpdateLastAnnouncedBlock(&blockHash)
+
+	// Reconstruction is only attempted for blocks which extend a known
+	// block.  Otherwise, fall back to the full block so it goes through
+	// the normal orphan handling.
+	haveParent, err := sm.chain.HaveBlock(&msg.Header.PrevBlock)
+	if err != nil || !haveParent || sm.chain.IsKnownOrphan(
+		&msg.Header.PrevBlock) {
+
+		sm.requestFullBlock(peer, &blockHash)
+		return
+	}
+
+	pb, err := newPartialBlock(msg, version, sm.txMemPool.TxDescs())
+	if err != nil {
+		if err == errShortIDCollision {
+			log.Debugf("Requesting full block %v from %s: %v",
+				blockHash, peer, err)
+			sm.requestFullBlock(peer, &blockHash)
 			return
 		}
-		log.Infof("Downloading headers for blocks %d to %d from "+
-			"peer %s", prevHeight+1, sm.nextCheckpoint.Height,
-			sm.syncPeer.Addr())
+		log.Warnf("Got invalid cmpctblock %v from %s: %v -- "+
+			"disconnecting", blockHash, peer.Addr(), err)
+		peer.Disconnect()
 		return
 	}
 
-	// This is headers-first mode, the block is a checkpoint, and there are
-	// no more checkpoints, so switch to normal mode by requesting blocks
-	// from the block after this one up to the end of the chain (zero hash).
-	sm.headersFirstMode = false
-	sm.headerList.Init()
-	log.Infof("Reached the final checkpoint -- switching to normal mode")
-	locator := blockchain.BlockLocator([]*chainhash.Hash{blockHash})
-	err = peer.PushGetBlocksMsg(locator, &zeroHash)
+	// Mark the block as requested so the reconstructed block is accepted
+	// and it isn't requested from other peers in the mean time.
+	if !requested {
+		sm.requestedBlocks[blockHash] = struct{}{}
+		sm.limitMap(sm.requestedBlocks, maxRequestedBlocks)
+		state.requestedBlocks[blockHash] = struct{}{}
+	}
+
+	// Request any transactions which could not be found in the memory
+	// pool.
+	if len(pb.missing) > 0 {
+		log.Debugf("Requesting %d of %d transactions for cmpctblock %v "+
+			"from %s", len(pb.missing), msg.TxCount(), blockHash,
+			peer)
+		pb.requested = time.Now()
+		state.partialBlocks[blockHash] = pb
+		getBlockTxn := wire.NewMsgGetBlockTxn(&blockHash)
+		for _, index := range pb.missing {
+			getBlockTxn.AddIndex(index)
+		}
+		peer.QueueMessage(getBlockTxn, nil)
+		return
+	}
+
+	sm.processPartialBlock(peer, pb)
+}
+
+// handleBlockTxnMsg handles blocktxn messages from all peers by completing the
+// partial block they were requested for.
+func (sm *SyncManager) handleBlockTxnMsg(bmsg *blockTxnMsg) {
+	peer := bmsg.peer
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Warnf("Received blocktxn message from unknown peer %s", peer)
+		return
+	}
+
+	blockHash := bmsg.blockTxn.BlockHash
+	pb, exists := state.partialBlocks[blockHash]
+	if !exists {
+		log.Debugf("Ignoring unrequested blocktxn %v from %s",
+			blockHash, peer)
+		return
+	}
+	delete(state.partialBlocks, blockHash)
+
+	if err := pb.fill(bmsg.blockTxn.Transactions); err != nil {
+		log.Warnf("Got invalid blocktxn %v from %s: %v -- "+
+			"disconnecting", blockHash, peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+
+	sm.processPartialBlock(peer, pb)
+}
+
+// handlePartialBlockTimeouts requests the full block from the peer for each
+// partial block whose missing transactions were not received within
+// blockTxnTimeout, so a peer which never answers a getblocktxn message can't
+// hold up the block.
+func (sm *SyncManager) handlePartialBlockTimeouts() {
+	now := time.Now()
+	for peer, state := range sm.peerStates {
+		for blockHash, pb := range state.partialBlocks {
+			if now.Sub(pb.requested) < blockTxnTimeout {
+				continue
+			}
+
+			log.Debugf("Timed out waiting for blocktxn %v from %s "+
+				"-- requesting full block", blockHash, peer)
+			delete(state.partialBlocks, blockHash)
+			blockHash := blockHash
+			sm.requestFullBlock(peer, &blockHash)
+		}
+	}
+}
+
+// processPartialBlock hands a fully reconstructed compact block to the normal
+// block handling.  When the reconstructed block does not match its header the
+// full block is requested from the peer instead.
+func (sm *SyncManager) processPartialBlock(peer *peerpkg.Peer, pb *partialBlock) {
+	blockHash := pb.header.BlockHash()
+	block, err := pb.block()
 	if err != nil {
-		log.Warnf("Failed to send getblocks message to peer %s: %v",
-			peer.Addr(), err)
+		log.Debugf("Failed to reconstruct cmpctblock %v from %s: %v",
+			blockHash, peer, err)
+		sm.requestFullBlock(peer, &blockHash)
 		return
 	}
+
+	sm.handleBlockMsg(&blockMsg{block: block, peer: peer})
 }
 
-// fetchHeaderBlocks creates and sends a request to the syncPeer for the next
-// list of blocks to be downloaded based on the current list of headers.
-func (sm *SyncManager) fetchHeaderBlocks() {
-	// Nothing to do if there is no start header.
-	if sm.startHeader == nil {
-		log.Warnf("fetchHeaderBlocks called with no start header")
+// requestFullBlock requests the full block with the passed hash from the
+// peer.  It is used when a compact block can't be reconstructed.
+func (sm *SyncManager) requestFullBlock(peer *peerpkg.Peer, hash *chainhash.Hash) {
+	state, exists := sm.peerStates[peer]
+	if !exists {
 		return
 	}
 
-	// Build up a getdata request for the list of blocks the headers
-	// describe.  The size hint will be limited to wire.MaxInvPerMsg by
-	// the function, so no need to double check it here.
-	gdmsg := wire.NewMsgGetDataSizeHint(uint(sm.headerList.Len()))
-	numRequested := 0
-	for e := sm.startHeader; e != nil; e = e.Next() {
-		node, ok := e.Value.(*headerNode)
-		if !ok {
-			log.Warn("Header list node type is not a headerNode")
-			continue
+	sm.requestedBlocks[*hash] = struct{}{}
+	sm.limitMap(sm.requestedBlocks, maxRequestedBlocks)
+	state.requestedBlocks[*hash] = struct{}{}
+
+	invType := wire.InvTypeBlock
+	if peer.IsWitnessEnabled() {
+		invType = wire.InvTypeWitnessBlock
+	}
+	gdmsg := wire.NewMsgGetData()
+	gdmsg.AddInvVect(wire.NewInvVect(invType, hash))
+	peer.QueueMessage(gdmsg, nil)
+}
+
+// updateHighBandwidthPeers asks the passed peer, which just delivered a new
+// block, to announce future blocks with cmpctblock messages.  Only the
+// maxHighBandwidthPeers most recent such peers are kept in high-bandwidth
+// mode and the oldest one is switched back to low-bandwidth mode as needed.
+func (sm *SyncManager) updateHighBandwidthPeers(peer *peerpkg.Peer) {
+	version := peer.CompactBlockVersion()
+	if version == 0 {
+		return
+	}
+
+	// Move the peer to the back of the list when it's already a
+	// high-bandwidth peer.
+	for i, hbPeer := range sm.hbPeers {
+		if hbPeer == peer {
+			sm.hbPeers = append(sm.hbPeers[:i], sm.hbPeers[i+1:]...)
+			sm.hbPeers = append(sm.hbPeers, peer)
+			return
 		}
+	}
 
-		iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
-		haveInv, err := sm.haveInventory(iv)
-		if err != nil {
-			log.Warnf("Unexpected failure when checking for "+
-				"existing inventory during header block "+
-				"fetch: %v", err)
+	if len(sm.hbPeers) >= maxHighBandwidthPeers {
+		oldest := sm.hbPeers[0]
+		sm.hbPeers = sm.hbPeers[1:]
+		oldest.QueueMessage(wire.NewMsgSendCmpct(false,
+			oldest.CompactBlockVersion()), nil)
+	}
+
+	log.Debugf("Requesting high-bandwidth compact blocks from %s", peer)
+	sm.hbPeers = append(sm.hbPeers, peer)
+	peer.QueueMessage(wire.NewMsgSendCmpct(true, version), nil)
+}
+
+// fetchBlocks requests the blocks in the download window from every peer which
+// is suitable for downloading them, up to maxBlocksInFlightPerPeer blocks per
+// peer at once.  When a peer could download more blocks but all of the blocks
+// in the window have already been requested, the peer holding the first
+// outstanding block of the window is stalling the download and is marked as
+// such.  It is only used in headers-first mode.
+func (sm *SyncManager) fetchBlocks() {
+	// Blocks are not downloaded until the headers are known to have the
+	// minimum chain work.
+	if !sm.headersFirstMode || !sm.headerWorkVerified {
+		return
+	}
+
+	now := time.Now()
+	for peer, state := range sm.peerStates {
+		if !state.syncCandidate || !peer.Connected() {
+			continue
+		}
+		free := maxBlocksInFlightPerPeer - len(state.requestedBlocks)
+		if free <= 0 {
+			continue
 		}
-		if !haveInv {
-			syncPeerState := sm.peerStates[sm.syncPeer]
 
+		// Request the blocks in the window which have not been
+		// requested yet and which the peer is known to have.  The
+		// headers are ordered by height, so once the peer doesn't have
+		// a block, it doesn't have any of the following ones either.
+		gdmsg := wire.NewMsgGetData()
+		var firstInFlight *headerNode
+		var e *list.Element
+		var i int
+		for e = sm.headerList.Front(); e != nil && free > 0 &&
+			i < blockDownloadWindow; e, i = e.Next(), i+1 {
+
+			node := e.Value.(*headerNode)
+			if node.block != nil {
+				continue
+			}
+			if node.peer != nil {
+				if firstInFlight == nil {
+					firstInFlight = node
+				}
+				continue
+			}
+			if node.height > peer.LastBlock() {
+				break
+			}
+			if sm.chain.MainChainHasBlock(node.hash) {
+				continue
+			}
+
+			node.peer = peer
 			sm.requestedBlocks[*node.hash] = struct{}{}
-			syncPeerState.requestedBlocks[*node.hash] = struct{}{}
+			sm.limitMap(sm.requestedBlocks, maxRequestedBlocks)
+			state.requestedBlocks[*node.hash] = struct{}{}
 
 			// If we're fetching from a witness enabled peer
 			// post-fork, then ensure that we receive all the
 			// witness data in the blocks.
-			if sm.syncPeer.IsWitnessEnabled() {
+			iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
+			if peer.IsWitnessEnabled() {
 				iv.Type = wire.InvTypeWitnessBlock
 			}
-
 			gdmsg.AddInvVect(iv)
-			numRequested++
+			free--
 		}
-		sm.startHeader = e.Next()
-		if numRequested >= wire.MaxInvPerMsg {
-			break
+		if len(gdmsg.InvList) > 0 {
+			log.Debugf("Requesting %d blocks from %s",
+				len(gdmsg.InvList), peer)
+			peer.QueueMessage(gdmsg, nil)
+		}
+
+		// The peer could download more blocks than the window allows,
+		// so whichever peer has the first outstanding block of the
+		// window is holding up the download.
+		if free > 0 && i == blockDownloadWindow && e != nil &&
+			firstInFlight != nil && firstInFlight.peer != peer {
+
+			stallerState, ok := sm.peerStates[firstInFlight.peer]
+			if ok && stallerState.stallingSince.IsZero() {
+				log.Debugf("Peer %s is stalling the block "+
+					"download", firstInFlight.peer)
+				stallerState.stallingSince = now
+			}
 		}
 	}
-	if len(gdmsg.InvList) > 0 {
-		sm.syncPeer.QueueMessage(gdmsg, nil)
+}
+
+// isMutatedBlockErr returns whether or not the passed error indicates that a
+// block does not match the transactions committed to by its header, which
+// means the block was corrupted by the peer which sent it rather than the
+// block itself being invalid.
+func isMutatedBlockErr(err error) bool {
+	ruleErr, ok := err.(blockchain.RuleError)
+	if !ok {
+		return false
+	}
+	switch ruleErr.ErrorCode {
+	case blockchain.ErrBadMerkleRoot, blockchain.ErrUnexpectedWitness,
+		blockchain.ErrInvalidWitnessCommitment,
+		blockchain.ErrWitnessCommitmentMismatch:
+
+		return true
+	}
+	return false
+}
+
+// headerBlockFlags returns the behavior flags to process the block at the
+// passed height of the header list with.
+func (sm *SyncManager) headerBlockFlags(height int32) blockchain.BehaviorFlags {
+	// Blocks which are ancestors of a checkpoint verified by the downloaded
+	// headers are eligible for less validation.
+	behaviorFlags := blockchain.BFNone
+	if height <= sm.checkpointHeight {
+		behaviorFlags |= blockchain.BFFastAdd
+	}
+
+	// Likewise, ancestors of the assumed valid block which has enough work
+	// built on top of it skip script validation.
+	if height <= sm.assumeValidHeight {
+		behaviorFlags |= blockchain.BFAssumeValid
+	}
+	return behaviorFlags
+}
+
+// processHeaderBlocks processes the blocks received in headers-first mode in
+// the order of their headers.  Processing stops at the first block which has
+// not been received yet.  Once all headers are downloaded and all of their
+// blocks are processed, headers-first mode ends.
+func (sm *SyncManager) processHeaderBlocks() {
+	processed := false
+	for e := sm.headerList.Front(); e != nil; e = sm.headerList.Front() {
+		node := e.Value.(*headerNode)
+		if node.block == nil {
+			if !sm.chain.MainChainHasBlock(node.hash) {
+				break
+			}
+			sm.headerList.Remove(e)
+			delete(sm.headerNodes, *node.hash)
+			continue
+		}
+
+		behaviorFlags := sm.headerBlockFlags(node.height)
+		_, _, err := sm.chain.ProcessBlock(node.block, behaviorFlags)
+		if err != nil {
+			ruleErr, ok := err.(blockchain.RuleError)
+			if ok && ruleErr.ErrorCode == blockchain.ErrDuplicateBlock {
+				sm.headerList.Remove(e)
+				delete(sm.headerNodes, *node.hash)
+				continue
+			}
+
+			// When the error is a rule error, it means the block
+			// was simply rejected as opposed to something actually
+			// going wrong, so log it as such.  Otherwise, something
+			// really did go wrong, so log it as an actual error.
+			if ok {
+				log.Infof("Rejected block %v from %s: %v",
+					node.hash, node.peer, err)
+			} else {
+				log.Errorf("Failed to process block %v: %v",
+					node.hash, err)
+			}
+			if dbErr, ok := err.(database.Error); ok && dbErr.ErrorCode ==
+				database.ErrCorruption {
+				panic(dbErr)
+			}
+
+			// Convert the error into an appropriate reject message
+			// and send it.
+			code, reason := mempool.ErrToRejectErr(err)
+			node.peer.PushRejectMsg(wire.CmdBlock, code, reason,
+				node.hash, false)
+
+			// A block which doesn't match its header was corrupted
+			// by the peer which sent it, so request it from another
+			// peer.  Otherwise, the downloaded headers lead to an
+			// invalid block, so start over with another sync peer.
+			if isMutatedBlockErr(err) {
+				node.peer.Disconnect()
+				node.peer = nil
+				node.block = nil
+				break
+			}
+			best := sm.chain.BestSnapshot()
+			sm.resetHeaderState(&best.Hash, best.Height,
+				best.ChainWork)
+			sm.syncPeer.Disconnect()
+			return
+		}
+
+		sm.progressLogger.LogBlockHeight(node.block)
+		sm.headerList.Remove(e)
+		delete(sm.headerNodes, *node.hash)
+		processed = true
+	}
+
+	if processed {
+		// Clear the rejected transactions.
+		sm.rejectedTxns = make(map[chainhash.Hash]struct{})
+
+		// The download window moved, so no peer is stalling it
+		// anymore.
+		for _, state := range sm.peerStates {
+			state.stallingSince = time.Time{}
+		}
+	}
+
+	// Switch to normal mode once all of the blocks of the headers have
+	// been processed.  Blocks which were announced in the mean time are
+	// requested from the sync peer.
+	if !sm.headersSynced || sm.headerList.Len() != 0 {
+		return
+	}
+	sm.headersFirstMode = false
+	best := sm.chain.BestSnapshot()
+	log.Infof("Processed the blocks of all downloaded headers -- " +
+		"switching to normal mode")
+	locator := blockchain.BlockLocator([]*chainhash.Hash{&best.Hash})
+	err := sm.syncPeer.PushGetBlocksMsg(locator, &zeroHash)
+	if err != nil {
+		log.Warnf("Failed to send getblocks message to peer %s: %v",
+			sm.syncPeer.Addr(), err)
+	}
+}
+
+// trackAssumeValid updates the state of the assumed valid block with the passed
+// header node which must directly follow the previously downloaded header.
+// Once the assumed valid block is found and enough work is built on top of it,
+// its height is recorded so it and all of its ancestors skip script
+// validation.
+func (sm *SyncManager) trackAssumeValid(node *headerNode, bits uint32) {
+	if sm.assumeValid == nil || sm.assumeValidHeight != 0 {
+		return
+	}
+
+	// Start tracking the work built on top of the assumed valid block once
+	// its header is downloaded.  The required work is the work of the
+	// block itself over the expected number of blocks for the period.
+	if sm.assumeValidNode == nil {
+		if !node.hash.IsEqual(sm.assumeValid) {
+			return
+		}
+		numBlocks := int64(assumeValidWorkTime /
+			sm.chainParams.TargetTimePerBlock)
+		sm.assumeValidNode = node
+		sm.assumeValidWork = new(big.Int)
+		sm.assumeValidRequired = new(big.Int).Mul(
+			blockchain.CalcWork(bits), big.NewInt(numBlocks))
+		return
+	}
+
+	sm.assumeValidWork.Add(sm.assumeValidWork, blockchain.CalcWork(bits))
+	if sm.assumeValidWork.Cmp(sm.assumeValidRequired) >= 0 {
+		sm.assumeValidHeight = sm.assumeValidNode.height
+		log.Infof("Verified enough work on top of assumed valid block "+
+			"at height %d/hash %s -- skipping script validation of "+
+			"its ancestors", sm.assumeValidHeight,
+			sm.assumeValidNode.hash)
+	}
+}
+
+// handleStallCheck disconnects peers which have been stalling the download
+// window for longer than blockStallTimeout in headers-first mode, which allows
+// their blocks to be requested from other peers.
+func (sm *SyncManager) handleStallCheck() {
+	if !sm.headersFirstMode {
+		return
+	}
+
+	sm.fetchBlocks()
+	now := time.Now()
+	for peer, state := range sm.peerStates {
+		if state.stallingSince.IsZero() ||
+			now.Sub(state.stallingSince) < blockStallTimeout {
+			continue
+		}
+
+		log.Infof("Peer %s is stalling the block download for %v -- "+
+			"disconnecting", peer, now.Sub(state.stallingSince))
+		state.stallingSince = time.Time{}
+		peer.Disconnect()
 	}
 }
 
 // handleHeadersMsg handles block header messages from all peers.  Headers are
-// requested when performing a headers-first sync.
+// requested from the sync peer when performing a headers-first sync.
 func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	peer := hmsg.peer
 	_, exists := sm.peerStates[peer]
@@ -786,54 +1393,49 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
-	// Nothing to do for an empty headers message.
-	if numHeaders == 0 {
+	// Headers are only requested from the sync peer until it has no more
+	// of them.
+	if peer != sm.syncPeer || sm.headersSynced {
+		log.Debugf("Ignoring %d unrequested headers from %s",
+			numHeaders, peer)
 		return
 	}
 
 	// Process all of the received headers ensuring each one connects to the
-	// previous and that checkpoints match.
-	receivedCheckpoint := false
-	var finalHash *chainhash.Hash
+	// previous, commits to enough work and that checkpoints match.
 	for _, blockHeader := range msg.Headers {
 		blockHash := blockHeader.BlockHash()
-		finalHash = &blockHash
 
-		// Ensure there is a previous header to compare against.
-		prevNodeEl := sm.headerList.Back()
-		if prevNodeEl == nil {
-			log.Warnf("Header list does not contain a previous" +
-				"element as expected -- disconnecting peer")
+		// Ensure the header properly connects to the previous one.
+		if !sm.lastHeader.hash.IsEqual(&blockHeader.PrevBlock) {
+			log.Warnf("Received block header that does not "+
+				"properly connect to the chain from peer %s "+
+				"-- disconnecting", peer.Addr())
 			peer.Disconnect()
 			return
 		}
 
-		// Ensure the header properly connects to the previous one and
-		// add it to the list of headers.
-		node := headerNode{hash: &blockHash}
-		prevNode := prevNodeEl.Value.(*headerNode)
-		if prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
-			node.height = prevNode.height + 1
-			e := sm.headerList.PushBack(&node)
-			if sm.startHeader == nil {
-				sm.startHeader = e
-			}
-		} else {
-			log.Warnf("Received block header that does not "+
-				"properly connect to the chain from peer %s "+
-				"-- disconnecting", peer.Addr())
+		// Ensure the header commits to enough work so a peer can't
+		// make us download a long chain of bogus blocks for free.
+		err := blockchain.CheckProofOfWork(btcutil.NewBlock(
+			wire.NewMsgBlock(blockHeader)), sm.chainParams.PowLimit)
+		if err != nil {
+			log.Warnf("Received block header %v with invalid proof "+
+				"of work from peer %s: %v -- disconnecting",
+				blockHash, peer.Addr(), err)
 			peer.Disconnect()
 			return
 		}
 
 		// Verify the header at the next checkpoint height matches.
-		if node.height == sm.nextCheckpoint.Height {
-			if node.hash.IsEqual(sm.nextCheckpoint.Hash) {
-				receivedCheckpoint = true
-				log.Infof("Verified downloaded block "+
-					"header against checkpoint at height "+
-					"%d/hash %s", node.height, node.hash)
-			} else {
+		node := &headerNode{
+			height: sm.lastHeader.height + 1,
+			hash:   &blockHash,
+		}
+		if sm.nextCheckpoint != nil &&
+			node.height == sm.nextCheckpoint.Height {
+
+			if !node.hash.IsEqual(sm.nextCheckpoint.Hash) {
 				log.Warnf("Block header at height %d/hash "+
 					"%s from peer %s does NOT match "+
 					"expected checkpoint hash of %s -- "+
@@ -843,35 +1445,113 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 				peer.Disconnect()
 				return
 			}
-			break
+			log.Infof("Verified downloaded block header against "+
+				"checkpoint at height %d/hash %s", node.height,
+				node.hash)
+			sm.checkpointHeight = node.height
+			sm.nextCheckpoint = sm.findNextHeaderCheckpoint(node.height)
+		}
+		sm.headerWork.Add(sm.headerWork, blockchain.CalcWork(blockHeader.Bits))
+
+		// Only keep a commitment to the header while presyncing and
+		// stop once the headers have the minimum chain work.
+		minWork := sm.chainParams.MinimumChainWork
+		if sm.presyncing {
+			if sm.isCommitmentHeight(node.height) {
+				sm.headerCommitments = append(sm.headerCommitments,
+					sm.headerCommitment(node.hash))
+			}
+			sm.lastHeader = node
+			if sm.headerWork.Cmp(minWork) >= 0 {
+				break
+			}
+			continue
+		}
+
+		// Ensure the headers which are downloaded again match the
+		// commitments kept while presyncing.
+		if !sm.headerWorkVerified {
+			if sm.isCommitmentHeight(node.height) {
+				if len(sm.headerCommitments) == 0 ||
+					sm.headerCommitments[0] !=
+						sm.headerCommitment(node.hash) {
+
+					log.Warnf("Block header at height %d "+
+						"from peer %s does not match the "+
+						"presynced headers -- disconnecting",
+						node.height, peer.Addr())
+					peer.Disconnect()
+					return
+				}
+				sm.headerCommitments = sm.headerCommitments[1:]
+			}
+			if sm.headerWork.Cmp(minWork) >= 0 {
+				sm.headerWorkVerified = true
+				sm.headerCommitments = nil
+				log.Infof("Verified block headers up to height %d "+
+					"have the minimum chain work", node.height)
+			}
 		}
+		sm.trackAssumeValid(node, blockHeader.Bits)
+
+		sm.headerNodes[blockHash] = sm.headerList.PushBack(node)
+		sm.lastHeader = node
 	}
 
-	// When this header is a checkpoint, switch to fetching the blocks for
-	// all of the headers since the last checkpoint.
-	if receivedCheckpoint {
-		// Since the first entry of the list is always the final block
-		// that is already in the database and is only used to ensure
-		// the next header links properly, it must be removed before
-		// fetching the blocks.
-		sm.headerList.Remove(sm.headerList.Front())
-		log.Infof("Received %v block headers: Fetching blocks",
-			sm.headerList.Len())
-		sm.progressLogger.SetLastLogTime(time.Now())
-		sm.fetchHeaderBlocks()
+	// Download the headers again starting from the latest known block once
+	// presyncing shows they have the minimum chain work.  The checkpoints
+	// are verified again along the way.
+	minWork := sm.chainParams.MinimumChainWork
+	if sm.presyncing && sm.headerWork.Cmp(minWork) >= 0 {
+		log.Infof("Presynced block headers up to height %d from peer "+
+			"%s have the minimum chain work -- downloading them "+
+			"again", sm.lastHeader.height, peer.Addr())
+		sm.presyncing = false
+		sm.headerWork.Set(sm.startWork)
+		sm.lastHeader = sm.startHeader
+		sm.nextCheckpoint = sm.findNextHeaderCheckpoint(sm.startHeader.height)
+		sm.checkpointHeight = 0
+		locator := blockchain.BlockLocator([]*chainhash.Hash{
+			sm.startHeader.hash})
+		err := peer.PushGetHeadersMsg(locator, &zeroHash)
+		if err != nil {
+			log.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", peer.Addr(), err)
+		}
 		return
 	}
 
-	// This header is not a checkpoint, so request the next batch of
-	// headers starting from the latest known header and ending with the
-	// next checkpoint.
-	locator := blockchain.BlockLocator([]*chainhash.Hash{finalHash})
-	err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
-	if err != nil {
-		log.Warnf("Failed to send getheaders message to "+
-			"peer %s: %v", peer.Addr(), err)
+	// The sync peer has all of the headers it sent, so make sure it is
+	// considered for downloading their blocks.
+	if sm.lastHeader.height > peer.LastBlock() {
+		peer.UpdateLastBlockHeight(sm.lastHeader.height)
+	}
+
+	// A full headers message means the peer likely has more headers, so
+	// request the next batch starting from the latest known header.
+	// Otherwise, all of the headers of the peer have been downloaded.
+	if numHeaders == wire.MaxBlockHeadersPerMsg {
+		locator := blockchain.BlockLocator([]*chainhash.Hash{
+			sm.lastHeader.hash})
+		err := peer.PushGetHeadersMsg(locator, &zeroHash)
+		if err != nil {
+			log.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", peer.Addr(), err)
+		}
+	} else if !sm.headerWorkVerified {
+		log.Warnf("Block headers up to height %d from peer %s do not "+
+			"have the minimum chain work -- disconnecting",
+			sm.lastHeader.height, peer.Addr())
+		peer.Disconnect()
 		return
+	} else {
+		sm.headersSynced = true
+		log.Infof("Downloaded block headers up to height %d from "+
+			"peer %s", sm.lastHeader.height, peer.Addr())
 	}
+
+	sm.processHeaderBlocks()
+	sm.fetchBlocks()
 }
 
 // haveInventory returns whether or not the inventory represented by the passed
@@ -918,6 +1598,13 @@ func (sm *SyncManager) haveInventory(invVect *wire.InvVect) (bool, error) {
 		}
 
 		return false, nil
+
+	case wire.InvTypeWTx:
+		// Ask the transaction memory pool if a transaction with the
+		// witness hash is known to it in any form (main pool or
+		// orphan).  Unlike transaction hashes, witness hashes can't be
+		// checked against the unspent outputs of the main chain.
+		return sm.txMemPool.HaveTransactionByWitnessHash(&invVect.Hash), nil
 	}
 
 	// The requested inventory is is an unsupported type, so just claim
@@ -981,10 +1668,21 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 		case wire.InvTypeTx:
 		case wire.InvTypeWitnessBlock:
 		case wire.InvTypeWitnessTx:
+		case wire.InvTypeWTx:
 		default:
 			continue
 		}
 
+		// Peers which negotiated wtxid relay must announce
+		// transactions by witness hash while all other peers must
+		// announce them by hash, so ignore the other kind.
+		if iv.Type == wire.InvTypeTx && peer.WantsWTxIdRelay() {
+			continue
+		}
+		if iv.Type == wire.InvTypeWTx && !peer.WantsWTxIdRelay() {
+			continue
+		}
+
 		// Add the inventory to the cache of known inventory
 		// for the peer.
 		peer.AddKnownInventory(iv)
@@ -1003,7 +1701,7 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 			continue
 		}
 		if !haveInv {
-			if iv.Type == wire.InvTypeTx {
+			if iv.Type == wire.InvTypeTx || iv.Type == wire.InvTypeWTx {
 				// Skip the transaction if it has already been
 				// rejected.
 				if _, exists := sm.rejectedTxns[iv.Hash]; exists {
@@ -1090,6 +1788,13 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 					iv.Type = wire.InvTypeWitnessBlock
 				}
 
+				// Request a compact block when we're current
+				// since most of its transactions should
+				// already be in the memory pool.
+				if sm.current() && peer.CompactBlockVersion() != 0 {
+					iv.Type = wire.InvTypeCmpctBlock
+				}
+
 				gdmsg.AddInvVect(iv)
 				numRequested++
 			}
@@ -1110,6 +1815,19 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 					iv.Type = wire.InvTypeWitnessTx
 				}
 
+				gdmsg.AddInvVect(iv)
+				numRequested++
+			}
+
+		case wire.InvTypeWTx:
+			// Request the transaction by its witness hash if there
+			// is not already a pending request.  Transactions
+			// requested this way always include their witness data.
+			if _, exists := sm.requestedTxns[iv.Hash]; !exists {
+				sm.requestedTxns[iv.Hash] = struct{}{}
+				sm.limitMap(sm.requestedTxns, maxRequestedTxns)
+				state.requestedTxns[iv.Hash] = struct{}{}
+
 				gdmsg.AddInvVect(iv)
 				numRequested++
 			}
@@ -1150,6 +1868,9 @@ func (sm *SyncManager) limitMap(m map[chainhash.Hash]struct{}, limit int) {
 // important because the sync manager controls which blocks are needed and how
 // the fetching should proceed.
 func (sm *SyncManager) blockHandler() {
+	stallTicker := time.NewTicker(stallCheckInterval)
+	defer stallTicker.Stop()
+
 out:
 	for {
 		select {
@@ -1166,6 +1887,14 @@ out:
 				sm.handleBlockMsg(msg)
 				msg.reply <- struct{}{}
 
+			case *cmpctBlockMsg:
+				sm.handleCmpctBlockMsg(msg)
+				msg.reply <- struct{}{}
+
+			case *blockTxnMsg:
+				sm.handleBlockTxnMsg(msg)
+				msg.reply <- struct{}{}
+
 			case *invMsg:
 				sm.handleInvMsg(msg)
 
@@ -1209,6 +1938,10 @@ out:
 					"handler: %T", msg)
 			}
 
+		case <-stallTicker.C:
+			sm.handleStallCheck()
+			sm.handlePartialBlockTimeouts()
+
 		case <-sm.quit:
 			break out
 		}
@@ -1238,9 +1971,11 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			break
 		}
 
-		// Generate the inventory vector and relay it.
+		// Generate the inventory vector and relay it.  The full block
+		// is passed along so peers which requested high-bandwidth
+		// compact block relay can be sent a cmpctblock message.
 		iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
-		sm.peerNotifier.RelayInventory(iv, block.MsgBlock().Header)
+		sm.peerNotifier.RelayInventory(iv, block)
 
 	// A block has been connected to the main block chain.
 	case blockchain.NTBlockConnected:
@@ -1343,6 +2078,33 @@ func (sm *SyncManager) QueueBlock(block *btcutil.Block, peer *peerpkg.Peer, done
 	sm.msgChan <- &blockMsg{block: block, peer: peer, reply: done}
 }
 
+// QueueCmpctBlock adds the passed cmpctblock message and peer to the block
+// handling queue. Responds to the done channel argument after the message is
+// processed.
+func (sm *SyncManager) QueueCmpctBlock(cmpctBlock *wire.MsgCmpctBlock, peer *peerpkg.Peer, done chan struct{}) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		done <- struct{}{}
+		return
+	}
+
+	sm.msgChan <- &cmpctBlockMsg{cmpctBlock: cmpctBlock, peer: peer,
+		reply: done}
+}
+
+// QueueBlockTxn adds the passed blocktxn message and peer to the block
+// handling queue. Responds to the done channel argument after the message is
+// processed.
+func (sm *SyncManager) QueueBlockTxn(blockTxn *wire.MsgBlockTxn, peer *peerpkg.Peer, done chan struct{}) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		done <- struct{}{}
+		return
+	}
+
+	sm.msgChan <- &blockTxnMsg{blockTxn: blockTxn, peer: peer, reply: done}
+}
+
 // QueueInv adds the passed inv message and peer to the block handling queue.
 func (sm *SyncManager) QueueInv(inv *wire.MsgInv, peer *peerpkg.Peer) {
 	// No channel handling here because peers do not need to block on inv
@@ -1445,6 +2207,7 @@ func New(config *Config) (*SyncManager, error) {
 		chain:           config.Chain,
 		txMemPool:       config.TxMemPool,
 		chainParams:     config.ChainParams,
+		assumeValid:     config.AssumeValid,
 		rejectedTxns:    make(map[chainhash.Hash]struct{}),
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
 		requestedBlocks: make(map[chainhash.Hash]struct{}),
@@ -1456,16 +2219,23 @@ func New(config *Config) (*SyncManager, error) {
 		feeEstimator:    config.FeeEstimator,
 	}
 
+	salt, err := wire.RandomUint64()
+	if err != nil {
+		return nil, err
+	}
+	sm.commitmentSalt = salt
+
 	best := sm.chain.BestSnapshot()
-	if !config.DisableCheckpoints {
-		// Initialize the next checkpoint based on the current height.
-		sm.nextCheckpoint = sm.findNextHeaderCheckpoint(best.Height)
-		if sm.nextCheckpoint != nil {
-			sm.resetHeaderState(&best.Hash, best.Height)
-		}
-	} else {
+	if config.DisableCheckpoints {
 		log.Info("Checkpoints are disabled")
 	}
+	if config.AssumeValid == nil {
+		log.Info("Assumed valid block is disabled")
+	} else {
+		log.Infof("Assuming ancestors of block %s are valid",
+			config.AssumeValid)
+	}
+	sm.resetHeaderState(&best.Hash, best.Height, best.ChainWork)
 
 	sm.chain.Subscribe(sm.handleBlockchainNotification)
 
@@ -0,0 +1,609 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/mempool"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// newTestSyncManager returns a sync manager backed by a new chain instance
+// with only the genesis block of a copy of the passed chain parameters.  It
+// also returns a teardown function the caller should invoke when done testing
+// to clean up.
+func newTestSyncManager(t *testing.T, params *chaincfg.Params) (*SyncManager, func()) {
+	paramsCopy := *params
+	dbPath := filepath.Join(t.TempDir(), "netsynctest")
+	db, err := database.Create("ffldb", dbPath, paramsCopy.Net)
+	if err != nil {
+		t.Fatalf("error creating db: %v", err)
+	}
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &paramsCopy,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		db.Close()
+		t.Fatalf("failed to create chain instance: %v", err)
+	}
+	sm, err := New(&Config{
+		Chain:       chain,
+		ChainParams: &paramsCopy,
+		MaxPeers:    8,
+	})
+	if err != nil {
+		db.Close()
+		t.Fatalf("failed to create sync manager: %v", err)
+	}
+	return sm, func() { db.Close() }
+}
+
+// newTestPeer returns an outbound peer connected over the loopback interface
+// to a remote node which claims to have blocks up to the passed height.  The
+// remote node only completes the handshake and ignores all other messages.
+// The handshake is complete once it returns.
+func newTestPeer(t *testing.T, params *chaincfg.Params, lastBlock int32) *peerpkg.Peer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		accepted <- conn
+
+		pver := wire.ProtocolVersion
+		_, _, err = wire.ReadMessage(conn, pver, params.Net)
+		if err != nil {
+			return
+		}
+		me := wire.NewNetAddress(conn.LocalAddr().(*net.TCPAddr),
+			wire.SFNodeNetwork)
+		you := wire.NewNetAddress(conn.RemoteAddr().(*net.TCPAddr), 0)
+		nonce, err := wire.RandomUint64()
+		if err != nil {
+			return
+		}
+		version := wire.NewMsgVersion(me, you, nonce, lastBlock)
+		version.Services = wire.SFNodeNetwork
+		if wire.WriteMessage(conn, version, pver, params.Net) != nil {
+			return
+		}
+		if wire.WriteMessage(conn, wire.NewMsgVerAck(), pver,
+			params.Net) != nil {
+
+			return
+		}
+		for {
+			_, _, err := wire.ReadMessage(conn, pver, params.Net)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	verack := make(chan struct{}, 1)
+	peerCfg := &peerpkg.Config{
+		Listeners: peerpkg.MessageListeners{
+			OnVerAck: func(p *peerpkg.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+		},
+		UserAgentName:    "peer",
+		UserAgentVersion: "1.0",
+		ChainParams:      params,
+		TrickleInterval:  time.Second * 10,
+	}
+	addr := listener.Addr().String()
+	p, err := peerpkg.NewOutboundPeer(peerCfg, addr)
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err %v", err)
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	p.AssociateConnection(conn)
+
+	remote := <-accepted
+	if remote == nil {
+		t.Fatalf("unable to accept connection")
+	}
+	t.Cleanup(func() {
+		p.Disconnect()
+		remote.Close()
+		p.WaitForDisconnect()
+	})
+
+	select {
+	case <-verack:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("verack timeout")
+	}
+	return p
+}
+
+// addTestPeer registers the passed peer with the sync manager as a sync
+// candidate and returns its sync state.
+func addTestPeer(sm *SyncManager, peer *peerpkg.Peer) *peerSyncState {
+	state := &peerSyncState{
+		syncCandidate:   true,
+		requestedTxns:   make(map[chainhash.Hash]struct{}),
+		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		partialBlocks:   make(map[chainhash.Hash]*partialBlock),
+	}
+	sm.peerStates[peer] = state
+	return state
+}
+
+// addTestHeaders appends the passed number of header nodes with made up hashes
+// to the header list of the sync manager and puts it in headers-first mode.
+func addTestHeaders(sm *SyncManager, numHeaders int) []*headerNode {
+	sm.headersFirstMode = true
+	nodes := make([]*headerNode, 0, numHeaders)
+	for i := 0; i < numHeaders; i++ {
+		var buf [4]byte
+		height := sm.lastHeader.height + 1
+		binary.LittleEndian.PutUint32(buf[:], uint32(height))
+		hash := chainhash.DoubleHashH(buf[:])
+		node := &headerNode{height: height, hash: &hash}
+		sm.headerNodes[hash] = sm.headerList.PushBack(node)
+		sm.lastHeader = node
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// assertRequested ensures exactly the passed header nodes are in flight from
+// the passed peer.
+func assertRequested(t *testing.T, desc string, peer *peerpkg.Peer, state *peerSyncState, nodes []*headerNode) {
+	t.Helper()
+
+	if len(state.requestedBlocks) != len(nodes) {
+		t.Fatalf("%s: got %d requested blocks, want %d", desc,
+			len(state.requestedBlocks), len(nodes))
+	}
+	for _, node := range nodes {
+		if _, ok := state.requestedBlocks[*node.hash]; !ok {
+			t.Fatalf("%s: block at height %d was not requested",
+				desc, node.height)
+		}
+		if node.peer != peer {
+			t.Fatalf("%s: block at height %d requested from %v, "+
+				"want %v", desc, node.height, node.peer, peer)
+		}
+	}
+}
+
+// TestFetchBlocks ensures the blocks in the download window are spread over
+// the peers which have them without exceeding the number of blocks in flight
+// per peer.
+func TestFetchBlocks(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	sm, teardown := newTestSyncManager(t, params)
+	defer teardown()
+	nodes := addTestHeaders(sm, 64)
+
+	// The first peer gets the first blocks up to the per peer limit and no
+	// more on later calls.
+	peer1 := newTestPeer(t, params, 64)
+	state1 := addTestPeer(sm, peer1)
+	sm.fetchBlocks()
+	assertRequested(t, "first peer", peer1, state1,
+		nodes[:maxBlocksInFlightPerPeer])
+	sm.fetchBlocks()
+	assertRequested(t, "first peer again", peer1, state1,
+		nodes[:maxBlocksInFlightPerPeer])
+
+	// A peer which only has some of the following blocks only gets those.
+	peer2 := newTestPeer(t, params, 20)
+	state2 := addTestPeer(sm, peer2)
+	sm.fetchBlocks()
+	assertRequested(t, "short peer", peer2, state2,
+		nodes[maxBlocksInFlightPerPeer:20])
+
+	// Another peer with all of the blocks gets the next ones.
+	peer3 := newTestPeer(t, params, 64)
+	state3 := addTestPeer(sm, peer3)
+	sm.fetchBlocks()
+	assertRequested(t, "third peer", peer3, state3,
+		nodes[20:20+maxBlocksInFlightPerPeer])
+	assertRequested(t, "first peer after others", peer1, state1,
+		nodes[:maxBlocksInFlightPerPeer])
+
+	// Blocks are not requested until the headers have the minimum chain
+	// work.
+	for _, node := range nodes {
+		node.peer = nil
+	}
+	state1.requestedBlocks = make(map[chainhash.Hash]struct{})
+	sm.headerWorkVerified = false
+	sm.fetchBlocks()
+	assertRequested(t, "unverified headers", peer1, state1, nil)
+}
+
+// TestStallReassignment ensures a peer holding up the download window is
+// detected, disconnected once it stalls for too long and its blocks are
+// requested from another peer.
+func TestStallReassignment(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	sm, teardown := newTestSyncManager(t, params)
+	defer teardown()
+	nodes := addTestHeaders(sm, blockDownloadWindow+44)
+
+	// The first block of the window is in flight from the first peer while
+	// all of the others in the window have already been received.
+	peer1 := newTestPeer(t, params, int32(len(nodes)))
+	state1 := addTestPeer(sm, peer1)
+	nodes[0].peer = peer1
+	state1.requestedBlocks[*nodes[0].hash] = struct{}{}
+	sm.requestedBlocks[*nodes[0].hash] = struct{}{}
+	for _, node := range nodes[1:blockDownloadWindow] {
+		node.block = btcutil.NewBlock(&wire.MsgBlock{})
+	}
+
+	// A second peer with free slots can't request anything past the
+	// window, so the first peer is stalling the download.
+	peer2 := newTestPeer(t, params, int32(len(nodes)))
+	state2 := addTestPeer(sm, peer2)
+	sm.fetchBlocks()
+	assertRequested(t, "window exhausted", peer2, state2, nil)
+	if state1.stallingSince.IsZero() {
+		t.Fatalf("fetchBlocks: first peer is not marked as stalling")
+	}
+	if !state2.stallingSince.IsZero() {
+		t.Fatalf("fetchBlocks: second peer is marked as stalling")
+	}
+
+	// The stalling peer is kept until the stall timeout passes.
+	sm.handleStallCheck()
+	if !peer1.Connected() {
+		t.Fatalf("handleStallCheck: peer disconnected before the " +
+			"stall timeout")
+	}
+	state1.stallingSince = time.Now().Add(-blockStallTimeout - time.Second)
+	sm.handleStallCheck()
+	if peer1.Connected() {
+		t.Fatalf("handleStallCheck: stalling peer is still connected")
+	}
+	if !peer2.Connected() {
+		t.Fatalf("handleStallCheck: other peer was disconnected")
+	}
+
+	// Once the stalling peer is gone, its block is requested from the
+	// other peer.
+	sm.handleDonePeerMsg(peer1)
+	assertRequested(t, "reassigned", peer2, state2, nodes[:1])
+	if _, ok := sm.requestedBlocks[*nodes[0].hash]; !ok {
+		t.Fatalf("handleDonePeerMsg: reassigned block is not tracked " +
+			"as requested")
+	}
+}
+
+// TestAssumeValid ensures only the blocks at or below the assumed valid block
+// skip script validation and only once the downloaded headers include it and
+// have enough work built on top of it.
+func TestAssumeValid(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	sm, teardown := newTestSyncManager(t, params)
+	defer teardown()
+
+	bits := params.PowLimitBits
+	numBlocks := int(assumeValidWorkTime / params.TargetTimePerBlock)
+	const assumeValidHeight = 10
+
+	tests := []struct {
+		name        string
+		assumeValid bool
+		numHeaders  int
+		wantHeight  int32
+	}{
+		{
+			name:        "assumed valid block with enough work",
+			assumeValid: true,
+			numHeaders:  assumeValidHeight + numBlocks,
+			wantHeight:  assumeValidHeight,
+		},
+		{
+			name:        "assumed valid block without enough work",
+			assumeValid: true,
+			numHeaders:  assumeValidHeight + numBlocks - 1,
+		},
+		{
+			name:       "assumed valid block not in headers",
+			numHeaders: assumeValidHeight + numBlocks,
+		},
+	}
+	for _, test := range tests {
+		best := sm.chain.BestSnapshot()
+		sm.resetHeaderState(&best.Hash, best.Height, best.ChainWork)
+		nodes := addTestHeaders(sm, test.numHeaders)
+
+		// Assume a block on another chain to be valid unless the
+		// assumed valid block is in the headers.
+		assumeValid := chainhash.HashH([]byte("other chain"))
+		if test.assumeValid {
+			assumeValid = *nodes[assumeValidHeight-1].hash
+		}
+		sm.assumeValid = &assumeValid
+		for _, node := range nodes {
+			sm.trackAssumeValid(node, bits)
+		}
+		if sm.assumeValidHeight != test.wantHeight {
+			t.Errorf("%s: got assumed valid height %d, want %d",
+				test.name, sm.assumeValidHeight, test.wantHeight)
+			continue
+		}
+
+		// Only the blocks up to the assumed valid block skip script
+		// validation.
+		for _, node := range nodes {
+			flags := sm.headerBlockFlags(node.height)
+			got := flags&blockchain.BFAssumeValid != 0
+			want := node.height <= test.wantHeight
+			if got != want {
+				t.Errorf("%s: block at height %d skips scripts: "+
+					"got %v, want %v", test.name, node.height,
+					got, want)
+				break
+			}
+		}
+	}
+}
+
+// solveTestHeader increments the nonce of the passed header until it has
+// enough proof of work for its difficulty bits.
+func solveTestHeader(header *wire.BlockHeader) {
+	target := blockchain.CompactToBig(header.Bits)
+	for {
+		hash := header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			return
+		}
+		header.Nonce++
+	}
+}
+
+// createTestHeaders returns the passed number of solved headers at the
+// minimum difficulty of the passed chain parameters which build on top of the
+// passed header.
+func createTestHeaders(params *chaincfg.Params, prev *wire.BlockHeader, numHeaders int) []*wire.BlockHeader {
+	headers := make([]*wire.BlockHeader, 0, numHeaders)
+	for i := 0; i < numHeaders; i++ {
+		header := &wire.BlockHeader{
+			Version:   4,
+			PrevBlock: prev.BlockHash(),
+			Timestamp: prev.Timestamp.Add(time.Minute),
+			Bits:      params.PowLimitBits,
+		}
+		solveTestHeader(header)
+		headers = append(headers, header)
+		prev = header
+	}
+	return headers
+}
+
+// newTestHeadersMsg returns a headers message from the passed peer with the
+// passed headers.
+func newTestHeadersMsg(peer *peerpkg.Peer, headers []*wire.BlockHeader) *headersMsg {
+	msg := wire.NewMsgHeaders()
+	for _, header := range headers {
+		msg.AddBlockHeader(header)
+	}
+	return &headersMsg{headers: msg, peer: peer}
+}
+
+// TestMinimumChainWorkHeaders ensures the headers of a sync peer are only
+// stored once they are shown to have the minimum chain work and the headers
+// which are downloaded again match the ones which were presynced.
+func TestMinimumChainWorkHeaders(t *testing.T) {
+	const numHeaders = 20
+	params := chaincfg.RegressionNetParams
+	genesisWork := blockchain.CalcWork(params.GenesisBlock.Header.Bits)
+	headerWork := blockchain.CalcWork(params.PowLimitBits)
+	params.MinimumChainWork = new(big.Int).Mul(headerWork,
+		big.NewInt(numHeaders))
+	params.MinimumChainWork.Add(params.MinimumChainWork, genesisWork)
+	headers := createTestHeaders(&params, &params.GenesisBlock.Header,
+		numHeaders)
+
+	// setup returns a sync manager in headers-first mode syncing from a
+	// newly connected peer.  Commitments to the presynced headers are kept
+	// at the passed height.
+	setup := func(commitmentHeight int32) (*SyncManager, *peerpkg.Peer, func()) {
+		sm, teardown := newTestSyncManager(t, &params)
+		sm.commitmentSalt = uint64(commitmentHeight)
+		peer := newTestPeer(t, &params, 0)
+		addTestPeer(sm, peer)
+		sm.syncPeer = peer
+		sm.headersFirstMode = true
+		return sm, peer, teardown
+	}
+
+	// assertStored ensures exactly the passed headers are stored.
+	assertStored := func(desc string, sm *SyncManager, headers []*wire.BlockHeader) {
+		t.Helper()
+
+		if sm.headerList.Len() != len(headers) {
+			t.Fatalf("%s: got %d stored headers, want %d", desc,
+				sm.headerList.Len(), len(headers))
+		}
+		for _, header := range headers {
+			if _, ok := sm.headerNodes[header.BlockHash()]; !ok {
+				t.Fatalf("%s: header %v is not stored", desc,
+					header.BlockHash())
+			}
+		}
+	}
+
+	// Headers below the minimum chain work are not stored and the peer
+	// which sent them is disconnected once it has no more of them.
+	sm, peer, teardown := setup(5)
+	defer teardown()
+	sm.handleHeadersMsg(newTestHeadersMsg(peer, headers[:numHeaders-1]))
+	assertStored("below minimum chain work", sm, nil)
+	if peer.Connected() {
+		t.Fatalf("handleHeadersMsg: peer with too little work is " +
+			"still connected")
+	}
+
+	// Headers with the minimum chain work are only presynced at first and
+	// stored once they are downloaded again.
+	sm, peer, teardown = setup(5)
+	defer teardown()
+	sm.handleHeadersMsg(newTestHeadersMsg(peer, headers))
+	assertStored("presynced", sm, nil)
+	if sm.presyncing || sm.headerWorkVerified {
+		t.Fatalf("handleHeadersMsg: headers are not downloaded again")
+	}
+	sm.handleHeadersMsg(newTestHeadersMsg(peer, headers))
+	assertStored("downloaded again", sm, headers)
+	if !sm.headerWorkVerified || !peer.Connected() {
+		t.Fatalf("handleHeadersMsg: headers matching the commitments " +
+			"are not verified")
+	}
+
+	// Headers which are downloaded again are rejected when they don't match
+	// the commitment kept while presyncing.  The header at the commitment
+	// height is replaced with one with a different commitment.
+	sm, peer, teardown = setup(5)
+	defer teardown()
+	sm.handleHeadersMsg(newTestHeadersMsg(peer, headers))
+	hash := headers[4].BlockHash()
+	presynced := sm.headerCommitment(&hash)
+	other := *headers[4]
+	for {
+		other.Timestamp = other.Timestamp.Add(time.Second)
+		solveTestHeader(&other)
+		hash = other.BlockHash()
+		if sm.headerCommitment(&hash) != presynced {
+			break
+		}
+	}
+	otherHeaders := append([]*wire.BlockHeader{}, headers[:4]...)
+	otherHeaders = append(otherHeaders, &other)
+	otherHeaders = append(otherHeaders, createTestHeaders(&params, &other,
+		numHeaders-len(otherHeaders))...)
+	sm.handleHeadersMsg(newTestHeadersMsg(peer, otherHeaders))
+	if _, ok := sm.headerNodes[hash]; ok {
+		t.Fatalf("handleHeadersMsg: header not matching the " +
+			"commitment is stored")
+	}
+	if sm.headerWorkVerified || peer.Connected() {
+		t.Fatalf("handleHeadersMsg: headers not matching the " +
+			"commitments are accepted")
+	}
+}
+
+// TestPartialBlockTimeout ensures the full block is requested once the peer
+// doesn't send the missing transactions of a partial block in time and that
+// the partial blocks of a peer are forgotten once it disconnects.
+func TestPartialBlockTimeout(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	sm, teardown := newTestSyncManager(t, params)
+	defer teardown()
+
+	peer := newTestPeer(t, params, 0)
+	state := addTestPeer(sm, peer)
+	recent := &partialBlock{
+		header:    wire.BlockHeader{Nonce: 1},
+		requested: time.Now(),
+	}
+	expired := &partialBlock{
+		header:    wire.BlockHeader{Nonce: 2},
+		requested: time.Now().Add(-blockTxnTimeout - time.Second),
+	}
+	for _, pb := range []*partialBlock{recent, expired} {
+		blockHash := pb.header.BlockHash()
+		state.partialBlocks[blockHash] = pb
+		state.requestedBlocks[blockHash] = struct{}{}
+		sm.requestedBlocks[blockHash] = struct{}{}
+	}
+
+	// Only the expired partial block is dropped in favor of the full block,
+	// which remains requested from the peer.
+	recentHash := recent.header.BlockHash()
+	expiredHash := expired.header.BlockHash()
+	sm.handlePartialBlockTimeouts()
+	if _, ok := state.partialBlocks[recentHash]; !ok {
+		t.Fatalf("handlePartialBlockTimeouts: recent partial block " +
+			"removed")
+	}
+	if _, ok := state.partialBlocks[expiredHash]; ok {
+		t.Fatalf("handlePartialBlockTimeouts: expired partial block " +
+			"not removed")
+	}
+	if _, ok := state.requestedBlocks[expiredHash]; !ok {
+		t.Fatalf("handlePartialBlockTimeouts: full block not requested")
+	}
+
+	// The blocks of a peer which disconnects can be requested from other
+	// peers.
+	sm.handleDonePeerMsg(peer)
+	for _, blockHash := range []chainhash.Hash{recentHash, expiredHash} {
+		if _, ok := sm.requestedBlocks[blockHash]; ok {
+			t.Fatalf("handleDonePeerMsg: block %v still requested",
+				blockHash)
+		}
+	}
+}
+
+// TestWitnessIndependentReject ensures only transaction rejections which can't
+// be caused by the witness of the transaction reject every transaction with
+// the same hash.
+func TestWitnessIndependentReject(t *testing.T) {
+	chainErr := func(c blockchain.ErrorCode) error {
+		return mempool.RuleError{Err: blockchain.RuleError{ErrorCode: c}}
+	}
+	txErr := func(c wire.RejectCode) error {
+		return mempool.RuleError{Err: mempool.TxRuleError{RejectCode: c}}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"missing input", chainErr(blockchain.ErrMissingTxOut), true},
+		{"spend too high", chainErr(blockchain.ErrSpendTooHigh), true},
+		{"script validation", chainErr(blockchain.ErrScriptValidation), false},
+		{"malformed script", chainErr(blockchain.ErrScriptMalformed), false},
+		{"too many sigops", chainErr(blockchain.ErrTooManySigOps), false},
+		{"double spend", txErr(wire.RejectDuplicate), true},
+		{"insufficient fee", txErr(wire.RejectInsufficientFee), false},
+		{"non-standard", txErr(wire.RejectNonstandard), false},
+		{"not a rule error", errors.New("failure"), false},
+	}
+	for _, test := range tests {
+		if got := witnessIndependentReject(test.err); got != test.want {
+			t.Errorf("witnessIndependentReject %s: got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
@@ -28,7 +28,7 @@ import (
 
 const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
-	MaxProtocolVersion = wire.FeeFilterVersion
+	MaxProtocolVersion = wire.AddrV2Version
 
 	// DefaultTrickleInterval is the min time between attempts to send an
 	// inv message to a peer.
@@ -106,6 +106,9 @@ type MessageListeners struct {
 	// OnAddr is invoked when a peer receives an addr bitcoin message.
 	OnAddr func(p *Peer, msg *wire.MsgAddr)
 
+	// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message.
+	OnAddrV2 func(p *Peer, msg *wire.MsgAddrV2)
+
 	// OnPing is invoked when a peer receives a ping bitcoin message.
 	OnPing func(p *Peer, msg *wire.MsgPing)
 
@@ -201,6 +204,30 @@ type MessageListeners struct {
 	// message.
 	OnSendHeaders func(p *Peer, msg *wire.MsgSendHeaders)
 
+	// OnSendCmpct is invoked when a peer receives a sendcmpct bitcoin
+	// message.
+	OnSendCmpct func(p *Peer, msg *wire.MsgSendCmpct)
+
+	// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin
+	// message.
+	OnCmpctBlock func(p *Peer, msg *wire.MsgCmpctBlock)
+
+	// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin
+	// message.
+	OnGetBlockTxn func(p *Peer, msg *wire.MsgGetBlockTxn)
+
+	// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin
+	// message.
+	OnBlockTxn func(p *Peer, msg *wire.MsgBlockTxn)
+
+	// OnSendAddrV2 is invoked when a peer receives a sendaddrv2 bitcoin
+	// message.
+	OnSendAddrV2 func(p *Peer, msg *wire.MsgSendAddrV2)
+
+	// OnWTxIdRelay is invoked when a peer receives a wtxidrelay bitcoin
+	// message.
+	OnWTxIdRelay func(p *Peer, msg *wire.MsgWTxIdRelay)
+
 	// OnRead is invoked when a peer receives a bitcoin message.  It
 	// consists of the number of bytes read, the message, and whether or not
 	// an error in the read occurred.  Typically, callers will opt to use
@@ -275,6 +302,12 @@ type Config struct {
 	// TrickleInterval is the duration of the ticker which trickles down the
 	// inventory to a peer.
 	TrickleInterval time.Duration
+
+	// V2Transport specifies whether the encrypted v2 transport defined by
+	// BIP0324 is used.  Outbound peers attempt the v2 handshake, while
+	// inbound peers accept both the v2 handshake and the unencrypted v1
+	// transport.
+	V2Transport bool
 }
 
 // minUint32 is a helper function to return the minimum of two uint32s.
@@ -289,12 +322,12 @@ func minUint32(a, b uint32) uint32 {
 // newNetAddress attempts to extract the IP address and port from the passed
 // net.Addr interface and create a bitcoin NetAddress structure using that
 // information.
-func newNetAddress(addr net.Addr, services wire.ServiceFlag) (*wire.NetAddress, error) {
+func newNetAddress(addr net.Addr, services wire.ServiceFlag) (*wire.NetAddressV2, error) {
 	// addr will be a net.TCPAddr when not using a proxy.
 	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
 		ip := tcpAddr.IP
 		port := uint16(tcpAddr.Port)
-		na := wire.NewNetAddressIPPort(ip, port, services)
+		na := wire.NewNetAddressV2IPPort(ip, port, services)
 		return na, nil
 	}
 
@@ -305,7 +338,7 @@ func newNetAddress(addr net.Addr, services wire.ServiceFlag) (*wire.NetAddress,
 			ip = net.ParseIP("0.0.0.0")
 		}
 		port := uint16(proxiedAddr.Port)
-		na := wire.NewNetAddressIPPort(ip, port, services)
+		na := wire.NewNetAddressV2IPPort(ip, port, services)
 		return na, nil
 	}
 
@@ -321,7 +354,7 @@ func newNetAddress(addr net.Addr, services wire.ServiceFlag) (*wire.NetAddress,
 	if err != nil {
 		return nil, err
 	}
-	na := wire.NewNetAddressIPPort(ip, uint16(port), services)
+	na := wire.NewNetAddressV2IPPort(ip, uint16(port), services)
 	return na, nil
 }
 
@@ -391,7 +424,7 @@ type AddrFunc func(remoteAddr *wire.NetAddress) *wire.NetAddress
 // HostToNetAddrFunc is a func which takes a host, port, services and returns
 // the netaddress.
 type HostToNetAddrFunc func(host string, port uint16,
-	services wire.ServiceFlag) (*wire.NetAddress, error)
+	services wire.ServiceFlag) (*wire.NetAddressV2, error)
 
 // NOTE: The overall data flow of a peer is split into 3 goroutines.  Inbound
 // messages are read via the inHandler goroutine and generally dispatched to
@@ -428,7 +461,8 @@ type Peer struct {
 	connected     int32
 	disconnect    int32
 
-	conn net.Conn
+	conn      net.Conn
+	transport transport
 
 	// These fields are set at creation time and never modified, so they are
 	// safe to read from concurrently without a mutex.
@@ -437,7 +471,7 @@ type Peer struct {
 	inbound bool
 
 	flagsMtx             sync.Mutex // protects the peer flags below
-	na                   *wire.NetAddress
+	na                   *wire.NetAddressV2
 	id                   int32
 	userAgent            string
 	services             wire.ServiceFlag
@@ -447,6 +481,12 @@ type Peer struct {
 	sendHeadersPreferred bool   // peer sent a sendheaders message
 	verAckReceived       bool
 	witnessEnabled       bool
+	cmpctBlockVersion    uint64 // compact block version negotiated
+	cmpctBlockAnnounce   bool   // peer wants high-bandwidth compact blocks
+	sendAddrV2           bool   // peer sent a sendaddrv2 message
+	wtxIDRelay           bool   // peer sent a wtxidrelay message
+	v2Transport          bool   // v2 transport negotiated
+	v2HandshakeFailed    bool   // outbound v2 handshake failed
 
 	wireEncoding wire.MessageEncoding
 
@@ -520,6 +560,14 @@ func (p *Peer) AddKnownInventory(invVect *wire.InvVect) {
 	p.knownInventory.Add(invVect)
 }
 
+// IsKnownInventory returns whether the passed inventory is in the cache of
+// known inventory for the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) IsKnownInventory(invVect *wire.InvVect) bool {
+	return p.knownInventory.Exists(invVect)
+}
+
 // StatsSnapshot returns a snapshot of the current peer flags and statistics.
 //
 // This function is safe for concurrent access.
@@ -573,7 +621,7 @@ func (p *Peer) ID() int32 {
 // NA returns the peer network address.
 //
 // This function is safe for concurrent access.
-func (p *Peer) NA() *wire.NetAddress {
+func (p *Peer) NA() *wire.NetAddressV2 {
 	p.flagsMtx.Lock()
 	na := p.na
 	p.flagsMtx.Unlock()
@@ -796,6 +844,83 @@ func (p *Peer) WantsHeaders() bool {
 	return sendHeadersPreferred
 }
 
+// CompactBlockVersion returns the compact block version (BIP0152) the peer
+// has signalled support for via a sendcmpct message or zero if it has not
+// signalled support for any version this peer supports.  Version 2 is only
+// negotiated with peers that support segregated witness.
+//
+// This function is safe for concurrent access.
+func (p *Peer) CompactBlockVersion() uint64 {
+	p.flagsMtx.Lock()
+	version := p.cmpctBlockVersion
+	p.flagsMtx.Unlock()
+
+	return version
+}
+
+// WantsCompactBlocks returns if the peer requested new blocks be announced by
+// sending cmpctblock messages directly instead of inventory vectors or
+// headers, which is known as the BIP0152 high-bandwidth mode.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsCompactBlocks() bool {
+	p.flagsMtx.Lock()
+	announce := p.cmpctBlockAnnounce && p.cmpctBlockVersion != 0
+	p.flagsMtx.Unlock()
+
+	return announce
+}
+
+// WantsAddrV2 returns if the peer signalled it prefers addresses be relayed
+// using addrv2 messages (BIP0155) by sending a sendaddrv2 message.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsAddrV2() bool {
+	p.flagsMtx.Lock()
+	wantsAddrV2 := p.sendAddrV2
+	p.flagsMtx.Unlock()
+
+	return wantsAddrV2
+}
+
+// WantsWTxIdRelay returns if the peer signalled that transactions are to be
+// announced and requested by their witness hash (BIP0339) by sending a
+// wtxidrelay message.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsWTxIdRelay() bool {
+	p.flagsMtx.Lock()
+	wtxIDRelay := p.wtxIDRelay
+	p.flagsMtx.Unlock()
+
+	return wtxIDRelay
+}
+
+// V2Transport returns whether the encrypted v2 transport (BIP0324) is used
+// with the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) V2Transport() bool {
+	p.flagsMtx.Lock()
+	v2Transport := p.v2Transport
+	p.flagsMtx.Unlock()
+
+	return v2Transport
+}
+
+// V2HandshakeFailed returns whether the v2 handshake with an outbound peer
+// failed, which typically means the peer only supports the v1 transport and
+// the connection should be retried without it.
+//
+// This function is safe for concurrent access.
+func (p *Peer) V2HandshakeFailed() bool {
+	p.flagsMtx.Lock()
+	failed := p.v2HandshakeFailed
+	p.flagsMtx.Unlock()
+
+	return failed
+}
+
 // IsWitnessEnabled returns true if the peer has signalled that it supports
 // segregated witness.
 //
@@ -844,6 +969,41 @@ func (p *Peer) PushAddrMsg(addresses []*wire.NetAddress) ([]*wire.NetAddress, er
 	return msg.AddrList, nil
 }
 
+// PushAddrV2Msg sends an addrv2 message to the connected peer using the
+// provided addresses.  It behaves the same as PushAddrMsg except the addresses
+// may be of any network known to addrv2 messages (BIP0155).  The caller is
+// responsible for only calling it for peers which signalled support via
+// WantsAddrV2.
+//
+// This function is safe for concurrent access.
+func (p *Peer) PushAddrV2Msg(addresses []*wire.NetAddressV2) ([]*wire.NetAddressV2, error) {
+	addressCount := len(addresses)
+
+	// Nothing to send.
+	if addressCount == 0 {
+		return nil, nil
+	}
+
+	msg := wire.NewMsgAddrV2()
+	msg.AddrList = make([]*wire.NetAddressV2, addressCount)
+	copy(msg.AddrList, addresses)
+
+	// Randomize the addresses sent if there are more than the maximum allowed.
+	if addressCount > wire.MaxAddrPerMsg {
+		// Shuffle the address list.
+		for i := 0; i < wire.MaxAddrPerMsg; i++ {
+			j := i + rand.Intn(addressCount-i)
+			msg.AddrList[i], msg.AddrList[j] = msg.AddrList[j], msg.AddrList[i]
+		}
+
+		// Truncate it to the maximum size.
+		msg.AddrList = msg.AddrList[:wire.MaxAddrPerMsg]
+	}
+
+	p.QueueMessage(msg, nil)
+	return msg.AddrList, nil
+}
+
 // PushGetBlocksMsg sends a getblocks message for the provided block locator
 // and stop hash.  It will ignore back-to-back duplicate requests.
 //
@@ -1006,8 +1166,8 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 
 // readMessage reads the next bitcoin message from the peer with logging.
 func (p *Peer) readMessage(encoding wire.MessageEncoding) (wire.Message, []byte, error) {
-	n, msg, buf, err := wire.ReadMessageWithEncodingN(p.conn,
-		p.ProtocolVersion(), p.cfg.ChainParams.Net, encoding)
+	n, msg, buf, err := p.transport.readMessage(p.ProtocolVersion(),
+		p.cfg.ChainParams.Net, encoding)
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
 	if p.cfg.Listeners.OnRead != nil {
 		p.cfg.Listeners.OnRead(p, n, msg, err)
@@ -1069,8 +1229,8 @@ func (p *Peer) writeMessage(msg wire.Message, enc wire.MessageEncoding) error {
 	}))
 
 	// Write the message to the peer.
-	n, err := wire.WriteMessageWithEncodingN(p.conn, msg,
-		p.ProtocolVersion(), p.cfg.ChainParams.Net, enc)
+	n, err := p.transport.writeMessage(msg, p.ProtocolVersion(),
+		p.cfg.ChainParams.Net, enc)
 	atomic.AddUint64(&p.bytesSent, uint64(n))
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
@@ -1153,12 +1313,18 @@ func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd st
 		pendingResponses[wire.CmdInv] = deadline
 
 	case wire.CmdGetData:
-		// Expects a block, merkleblock, tx, or notfound message.
+		// Expects a block, cmpctblock, merkleblock, tx, or notfound
+		// message.
 		pendingResponses[wire.CmdBlock] = deadline
+		pendingResponses[wire.CmdCmpctBlock] = deadline
 		pendingResponses[wire.CmdMerkleBlock] = deadline
 		pendingResponses[wire.CmdTx] = deadline
 		pendingResponses[wire.CmdNotFound] = deadline
 
+	case wire.CmdGetBlockTxn:
+		// Expects a blocktxn message.
+		pendingResponses[wire.CmdBlockTxn] = deadline
+
 	case wire.CmdGetHeaders:
 		// Expects a headers message.  Use a longer deadline since it
 		// can take a while for the remote peer to load all of the
@@ -1212,12 +1378,15 @@ out:
 				switch msgCmd := msg.message.Command(); msgCmd {
 				case wire.CmdBlock:
 					fallthrough
+				case wire.CmdCmpctBlock:
+					fallthrough
 				case wire.CmdMerkleBlock:
 					fallthrough
 				case wire.CmdTx:
 					fallthrough
 				case wire.CmdNotFound:
 					delete(pendingResponses, wire.CmdBlock)
+					delete(pendingResponses, wire.CmdCmpctBlock)
 					delete(pendingResponses, wire.CmdMerkleBlock)
 					delete(pendingResponses, wire.CmdTx)
 					delete(pendingResponses, wire.CmdNotFound)
@@ -1402,6 +1571,43 @@ out:
 				p.cfg.Listeners.OnAddr(p, msg)
 			}
 
+		case *wire.MsgAddrV2:
+			if p.cfg.Listeners.OnAddrV2 != nil {
+				p.cfg.Listeners.OnAddrV2(p, msg)
+			}
+
+		case *wire.MsgSendAddrV2:
+			// The sendaddrv2 message must be sent before the verack
+			// message, so ignore it otherwise.
+			if p.verAckReceived {
+				log.Debugf("Ignoring sendaddrv2 received after "+
+					"verack from %v", p)
+				break
+			}
+			p.flagsMtx.Lock()
+			p.sendAddrV2 = true
+			p.flagsMtx.Unlock()
+
+			if p.cfg.Listeners.OnSendAddrV2 != nil {
+				p.cfg.Listeners.OnSendAddrV2(p, msg)
+			}
+
+		case *wire.MsgWTxIdRelay:
+			// The wtxidrelay message must be sent before the verack
+			// message, so ignore it otherwise.
+			if p.verAckReceived {
+				log.Debugf("Ignoring wtxidrelay received after "+
+					"verack from %v", p)
+				break
+			}
+			p.flagsMtx.Lock()
+			p.wtxIDRelay = true
+			p.flagsMtx.Unlock()
+
+			if p.cfg.Listeners.OnWTxIdRelay != nil {
+				p.cfg.Listeners.OnWTxIdRelay(p, msg)
+			}
+
 		case *wire.MsgPing:
 			p.handlePingMsg(msg)
 			if p.cfg.Listeners.OnPing != nil {
@@ -1528,6 +1734,43 @@ out:
 				p.cfg.Listeners.OnSendHeaders(p, msg)
 			}
 
+		case *wire.MsgSendCmpct:
+			// Only versions 1 and 2 are defined.  Unknown versions
+			// must be ignored and version 2 is only meaningful
+			// for peers that support segregated witness.  The
+			// highest mutually supported version is retained.
+			p.flagsMtx.Lock()
+			if msg.Version == 1 || (msg.Version == 2 &&
+				p.witnessEnabled) {
+
+				if msg.Version > p.cmpctBlockVersion {
+					p.cmpctBlockVersion = msg.Version
+				}
+				if msg.Version == p.cmpctBlockVersion {
+					p.cmpctBlockAnnounce = msg.Announce
+				}
+			}
+			p.flagsMtx.Unlock()
+
+			if p.cfg.Listeners.OnSendCmpct != nil {
+				p.cfg.Listeners.OnSendCmpct(p, msg)
+			}
+
+		case *wire.MsgCmpctBlock:
+			if p.cfg.Listeners.OnCmpctBlock != nil {
+				p.cfg.Listeners.OnCmpctBlock(p, msg)
+			}
+
+		case *wire.MsgGetBlockTxn:
+			if p.cfg.Listeners.OnGetBlockTxn != nil {
+				p.cfg.Listeners.OnGetBlockTxn(p, msg)
+			}
+
+		case *wire.MsgBlockTxn:
+			if p.cfg.Listeners.OnBlockTxn != nil {
+				p.cfg.Listeners.OnBlockTxn(p, msg)
+			}
+
 		default:
 			log.Debugf("Received unhandled message of type %v "+
 				"from %v", rmsg.Command(), p)
@@ -1986,7 +2229,13 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 		}
 	}
 
-	theirNA := p.na
+	// Addresses of networks which can't be represented by the version
+	// message, such as Tor v3 and I2P, are sent as an unroutable address.
+	theirNA := p.na.ToLegacy()
+	if theirNA == nil {
+		theirNA = wire.NewNetAddressIPPort(net.IP([]byte{0, 0, 0, 0}), 0,
+			p.na.Services)
+	}
 
 	// If we are behind a proxy and the connection comes from the proxy then
 	// we return an unroutable address as their address. This is to prevent
@@ -1994,7 +2243,7 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 	if p.cfg.Proxy != "" {
 		proxyaddress, _, err := net.SplitHostPort(p.cfg.Proxy)
 		// invalid proxy means poorly configured, be on the safe side.
-		if err != nil || p.na.IP.String() == proxyaddress {
+		if err != nil || theirNA.IP.String() == proxyaddress {
 			theirNA = wire.NewNetAddressIPPort(net.IP([]byte{0, 0, 0, 0}), 0,
 				theirNA.Services)
 		}
@@ -2068,12 +2317,54 @@ func (p *Peer) negotiateOutboundProtocol() error {
 	return p.readRemoteVersionMsg()
 }
 
+// negotiateTransport performs the v2 handshake (BIP0324) with the peer when
+// the v2 transport is enabled.  Inbound peers fall back to the v1 transport
+// when the peer starts with a v1 version message, while a failed handshake
+// with an outbound peer is recorded so the caller may retry with the v1
+// transport.
+func (p *Peer) negotiateTransport() error {
+	if !p.cfg.V2Transport {
+		return nil
+	}
+
+	if p.inbound {
+		t, err := acceptV2Transport(p.conn, p.cfg.ChainParams.Net)
+		if err != nil {
+			return err
+		}
+		p.transport = t
+		if _, ok := t.(*v2Transport); ok {
+			p.flagsMtx.Lock()
+			p.v2Transport = true
+			p.flagsMtx.Unlock()
+		}
+		return nil
+	}
+
+	t, err := initiateV2Transport(p.conn, p.cfg.ChainParams.Net)
+	if err != nil {
+		p.flagsMtx.Lock()
+		p.v2HandshakeFailed = true
+		p.flagsMtx.Unlock()
+		return fmt.Errorf("v2 handshake failed: %v", err)
+	}
+	p.transport = t
+	p.flagsMtx.Lock()
+	p.v2Transport = true
+	p.flagsMtx.Unlock()
+	return nil
+}
+
 // start begins processing input and output messages.
 func (p *Peer) start() error {
 	log.Tracef("Starting peer %s", p)
 
 	negotiateErr := make(chan error, 1)
 	go func() {
+		if err := p.negotiateTransport(); err != nil {
+			negotiateErr <- err
+			return
+		}
 		if p.inbound {
 			negotiateErr <- p.negotiateInboundProtocol()
 		} else {
@@ -2102,6 +2393,15 @@ func (p *Peer) start() error {
 	go p.outHandler()
 	go p.pingHandler()
 
+	// Signal support for wtxid based transaction relay and addrv2
+	// messages, which must happen before the verack message is sent.
+	if p.ProtocolVersion() >= wire.WTxIdRelayVersion {
+		p.QueueMessage(wire.NewMsgWTxIdRelay(), nil)
+	}
+	if p.ProtocolVersion() >= wire.AddrV2Version {
+		p.QueueMessage(wire.NewMsgSendAddrV2(), nil)
+	}
+
 	// Send our verack message now that the IO processing machinery has started.
 	p.QueueMessage(wire.NewMsgVerAck(), nil)
 	return nil
@@ -2116,6 +2416,7 @@ func (p *Peer) AssociateConnection(conn net.Conn) {
 	}
 
 	p.conn = conn
+	p.transport = &v1Transport{r: conn, w: conn}
 	p.timeConnected = time.Now()
 
 	if p.inbound {
@@ -2218,7 +2519,7 @@ func NewOutboundPeer(cfg *Config, addr string) (*Peer, error) {
 		}
 		p.na = na
 	} else {
-		p.na = wire.NewNetAddressIPPort(net.ParseIP(host), uint16(port), 0)
+		p.na = wire.NewNetAddressV2IPPort(net.ParseIP(host), uint16(port), 0)
 	}
 
 	return p, nil
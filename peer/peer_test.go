@@ -357,6 +357,8 @@ func TestPeerConnection(t *testing.T) {
 // TestPeerListeners tests that the peer listeners are called as expected.
 func TestPeerListeners(t *testing.T) {
 	verack := make(chan struct{}, 1)
+	sendAddrV2 := make(chan struct{}, 1)
+	wtxIDRelay := make(chan struct{}, 1)
 	ok := make(chan wire.Message, 20)
 	peerCfg := &peer.Config{
 		Listeners: peer.MessageListeners{
@@ -366,6 +368,9 @@ func TestPeerListeners(t *testing.T) {
 			OnAddr: func(p *peer.Peer, msg *wire.MsgAddr) {
 				ok <- msg
 			},
+			OnAddrV2: func(p *peer.Peer, msg *wire.MsgAddrV2) {
+				ok <- msg
+			},
 			OnPing: func(p *peer.Peer, msg *wire.MsgPing) {
 				ok <- msg
 			},
@@ -445,6 +450,24 @@ func TestPeerListeners(t *testing.T) {
 			OnSendHeaders: func(p *peer.Peer, msg *wire.MsgSendHeaders) {
 				ok <- msg
 			},
+			OnSendCmpct: func(p *peer.Peer, msg *wire.MsgSendCmpct) {
+				ok <- msg
+			},
+			OnCmpctBlock: func(p *peer.Peer, msg *wire.MsgCmpctBlock) {
+				ok <- msg
+			},
+			OnGetBlockTxn: func(p *peer.Peer, msg *wire.MsgGetBlockTxn) {
+				ok <- msg
+			},
+			OnBlockTxn: func(p *peer.Peer, msg *wire.MsgBlockTxn) {
+				ok <- msg
+			},
+			OnSendAddrV2: func(p *peer.Peer, msg *wire.MsgSendAddrV2) {
+				sendAddrV2 <- struct{}{}
+			},
+			OnWTxIdRelay: func(p *peer.Peer, msg *wire.MsgWTxIdRelay) {
+				wtxIDRelay <- struct{}{}
+			},
 		},
 		UserAgentName:     "peer",
 		UserAgentVersion:  "1.0",
@@ -493,6 +516,10 @@ func TestPeerListeners(t *testing.T) {
 			"OnAddr",
 			wire.NewMsgAddr(),
 		},
+		{
+			"OnAddrV2",
+			wire.NewMsgAddrV2(),
+		},
 		{
 			"OnPing",
 			wire.NewMsgPing(42),
@@ -594,6 +621,23 @@ func TestPeerListeners(t *testing.T) {
 			"OnSendHeaders",
 			wire.NewMsgSendHeaders(),
 		},
+		{
+			"OnSendCmpct",
+			wire.NewMsgSendCmpct(true, 1),
+		},
+		{
+			"OnCmpctBlock",
+			wire.NewMsgCmpctBlock(wire.NewBlockHeader(1,
+				&chainhash.Hash{}, &chainhash.Hash{}, 1, 1), 1),
+		},
+		{
+			"OnGetBlockTxn",
+			wire.NewMsgGetBlockTxn(&chainhash.Hash{}),
+		},
+		{
+			"OnBlockTxn",
+			wire.NewMsgBlockTxn(&chainhash.Hash{}),
+		},
 	}
 	t.Logf("Running %d tests", len(tests))
 	for _, test := range tests {
@@ -606,6 +650,36 @@ func TestPeerListeners(t *testing.T) {
 			return
 		}
 	}
+
+	// Ensure the sendcmpct message negotiated high-bandwidth version 1
+	// compact blocks.
+	if v := inPeer.CompactBlockVersion(); v != 1 {
+		t.Errorf("TestPeerListeners: wrong compact block version - "+
+			"got %v, want 1", v)
+	}
+	if !inPeer.WantsCompactBlocks() {
+		t.Errorf("TestPeerListeners: peer does not want compact blocks")
+	}
+
+	// Ensure the sendaddrv2 message sent during the handshake was received.
+	select {
+	case <-sendAddrV2:
+	case <-time.After(time.Second * 1):
+		t.Errorf("TestPeerListeners: OnSendAddrV2 timeout")
+	}
+	if !inPeer.WantsAddrV2() {
+		t.Errorf("TestPeerListeners: peer does not want addrv2")
+	}
+
+	// Ensure the wtxidrelay message sent during the handshake was received.
+	select {
+	case <-wtxIDRelay:
+	case <-time.After(time.Second * 1):
+		t.Errorf("TestPeerListeners: OnWTxIdRelay timeout")
+	}
+	if !inPeer.WantsWTxIdRelay() {
+		t.Errorf("TestPeerListeners: peer does not want wtxid relay")
+	}
 	inPeer.Disconnect()
 	outPeer.Disconnect()
 }
@@ -731,6 +805,15 @@ func TestOutboundPeer(t *testing.T) {
 		t.Errorf("PushAddrMsg: unexpected err %v\n", err)
 		return
 	}
+	var addrsV2 []*wire.NetAddressV2
+	for i := 0; i < 5; i++ {
+		na := wire.NetAddressV2{}
+		addrsV2 = append(addrsV2, &na)
+	}
+	if _, err := p2.PushAddrV2Msg(addrsV2); err != nil {
+		t.Errorf("PushAddrV2Msg: unexpected err %v\n", err)
+		return
+	}
 	if err := p2.PushGetBlocksMsg(nil, &chainhash.Hash{}); err != nil {
 		t.Errorf("PushGetBlocksMsg: unexpected err %v\n", err)
 		return
@@ -917,6 +1000,79 @@ func TestDuplicateVersionMsg(t *testing.T) {
 	}
 }
 
+// TestPeerV2Transport ensures peers negotiate the v2 transport (BIP0324) when
+// both sides enable it and that inbound peers fall back to the v1 transport
+// for outbound peers which don't support it.
+func TestPeerV2Transport(t *testing.T) {
+	tests := []struct {
+		name   string
+		inV2   bool
+		outV2  bool
+		wantV2 bool
+	}{
+		{"both v2", true, true, true},
+		{"v1 outbound fallback", true, false, false},
+		{"both v1", false, false, false},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for _, test := range tests {
+		verack := make(chan struct{}, 2)
+		listeners := peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+		}
+		inCfg := &peer.Config{
+			Listeners:        listeners,
+			UserAgentName:    "peer",
+			UserAgentVersion: "1.0",
+			ChainParams:      &chaincfg.MainNetParams,
+			V2Transport:      test.inV2,
+		}
+		outCfg := *inCfg
+		outCfg.V2Transport = test.outV2
+
+		inConn, outConn := pipe(
+			&conn{laddr: "10.0.0.1:8333", raddr: "10.0.0.2:8333"},
+			&conn{laddr: "10.0.0.2:8333", raddr: "10.0.0.1:8333"},
+		)
+		inPeer := peer.NewInboundPeer(inCfg)
+		inPeer.AssociateConnection(inConn)
+		outPeer, err := peer.NewOutboundPeer(&outCfg, inConn.laddr)
+		if err != nil {
+			t.Fatalf("%s: NewOutboundPeer: unexpected err %v",
+				test.name, err)
+		}
+		outPeer.AssociateConnection(outConn)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second):
+				t.Fatalf("%s: verack timeout", test.name)
+			}
+		}
+		if got := inPeer.V2Transport(); got != test.wantV2 {
+			t.Errorf("%s: inbound V2Transport: got %v, want %v",
+				test.name, got, test.wantV2)
+		}
+		if got := outPeer.V2Transport(); got != test.wantV2 {
+			t.Errorf("%s: outbound V2Transport: got %v, want %v",
+				test.name, got, test.wantV2)
+		}
+		if outPeer.V2HandshakeFailed() {
+			t.Errorf("%s: V2HandshakeFailed: got true, want false",
+				test.name)
+		}
+
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+		inPeer.WaitForDisconnect()
+		outPeer.WaitForDisconnect()
+	}
+}
+
 func init() {
 	// Allow self connection when running the tests.
 	peer.TstAllowSelfConns()
@@ -0,0 +1,56 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"io"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// transport describes how bitcoin messages are framed on the connection with
+// a peer.  The original unencrypted framing is implemented by v1Transport
+// while the encrypted framing of BIP0324 is implemented by v2Transport.
+type transport interface {
+	// readMessage reads, validates, and parses the next bitcoin message.
+	// It returns the number of bytes read in addition to the parsed
+	// message and the raw payload bytes.
+	readMessage(pver uint32, btcnet wire.BitcoinNet,
+		enc wire.MessageEncoding) (int, wire.Message, []byte, error)
+
+	// writeMessage writes the passed bitcoin message and returns the
+	// number of bytes written.
+	writeMessage(msg wire.Message, pver uint32, btcnet wire.BitcoinNet,
+		enc wire.MessageEncoding) (int, error)
+}
+
+// v1Transport implements the transport interface using the original
+// unencrypted message framing which prefixes every message with a header
+// holding the network magic, command, length and checksum.
+type v1Transport struct {
+	r io.Reader
+	w io.Writer
+}
+
+// Ensure v1Transport implements the transport interface.
+var _ transport = (*v1Transport)(nil)
+
+// readMessage reads the next bitcoin message from the underlying reader.
+//
+// This is part of the transport interface implementation.
+func (t *v1Transport) readMessage(pver uint32, btcnet wire.BitcoinNet,
+	enc wire.MessageEncoding) (int, wire.Message, []byte, error) {
+
+	return wire.ReadMessageWithEncodingN(t.r, pver, btcnet, enc)
+}
+
+// writeMessage writes the passed bitcoin message to the underlying writer.
+//
+// This is part of the transport interface implementation.
+func (t *v1Transport) writeMessage(msg wire.Message, pver uint32,
+	btcnet wire.BitcoinNet, enc wire.MessageEncoding) (int, error) {
+
+	return wire.WriteMessageWithEncodingN(t.w, msg, pver, btcnet, enc)
+}
@@ -0,0 +1,574 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// v2RekeyInterval is the number of packets after which the ciphers of
+	// the v2 transport are rekeyed to provide forward secrecy.
+	v2RekeyInterval = 224
+
+	// v2LengthFieldLen is the length of the encrypted length field which
+	// precedes every packet.
+	v2LengthFieldLen = 3
+
+	// v2HeaderLen is the length of the header byte of every packet.
+	v2HeaderLen = 1
+
+	// v2TagLen is the length of the authentication tag of every packet.
+	v2TagLen = chacha20poly1305.Overhead
+
+	// v2IgnoreBit is set in the header byte of decoy packets which are to
+	// be ignored by the receiver.
+	v2IgnoreBit = 0x80
+
+	// v2GarbageTerminatorLen is the length of the terminators which mark
+	// the end of the garbage sent by each side during the handshake.
+	v2GarbageTerminatorLen = 16
+
+	// v2MaxGarbageLen is the maximum amount of garbage either side may
+	// send before its garbage terminator.
+	v2MaxGarbageLen = 4095
+
+	// v2MaxContentsLen is the maximum length of the contents of a packet,
+	// which is the largest possible message along with its command.
+	v2MaxContentsLen = 1 + wire.CommandSize + wire.MaxMessagePayload
+)
+
+// v2ShortIDs houses the commands which are encoded with a single byte in the
+// v2 transport as defined by BIP0324.  The index of a command in the slice is
+// its short id.  Short id 0 indicates the command follows in full.
+var v2ShortIDs = []string{
+	"",
+	wire.CmdAddr,
+	wire.CmdBlock,
+	wire.CmdBlockTxn,
+	wire.CmdCmpctBlock,
+	wire.CmdFeeFilter,
+	wire.CmdFilterAdd,
+	wire.CmdFilterClear,
+	wire.CmdFilterLoad,
+	wire.CmdGetBlocks,
+	wire.CmdGetBlockTxn,
+	wire.CmdGetData,
+	wire.CmdGetHeaders,
+	wire.CmdHeaders,
+	wire.CmdInv,
+	wire.CmdMemPool,
+	wire.CmdMerkleBlock,
+	wire.CmdNotFound,
+	wire.CmdPing,
+	wire.CmdPong,
+	wire.CmdSendCmpct,
+	wire.CmdTx,
+	wire.CmdGetCFilters,
+	wire.CmdCFilter,
+	wire.CmdGetCFHeaders,
+	wire.CmdCFHeaders,
+	wire.CmdGetCFCheckpt,
+	wire.CmdCFCheckpt,
+	wire.CmdAddrV2,
+}
+
+// v2ShortIDsByCmd maps the commands which have a short id to it.
+var v2ShortIDsByCmd = func() map[string]byte {
+	ids := make(map[string]byte, len(v2ShortIDs)-1)
+	for id, cmd := range v2ShortIDs[1:] {
+		ids[cmd] = byte(id + 1)
+	}
+	return ids
+}()
+
+// errV2GarbageTooLong is returned when the other side of a v2 handshake did
+// not send its garbage terminator within the maximum amount of garbage.
+var errV2GarbageTooLong = errors.New("v2 garbage terminator not found")
+
+// fsChaCha20 is the forward secure ChaCha20 stream cipher used to encrypt the
+// length field of v2 packets.  The keystream continues from one packet to the
+// next and the key is replaced with the next bytes of the keystream every
+// v2RekeyInterval packets.
+type fsChaCha20 struct {
+	key          [chacha20.KeySize]byte
+	chunkCounter uint64
+	cipher       *chacha20.Cipher
+}
+
+// newFSChaCha20 returns a new forward secure ChaCha20 cipher with the passed
+// initial key.
+func newFSChaCha20(key []byte) *fsChaCha20 {
+	c := &fsChaCha20{}
+	copy(c.key[:], key)
+	c.resetCipher()
+	return c
+}
+
+// resetCipher starts a new keystream for the current key and rekey epoch.
+func (c *fsChaCha20) resetCipher() {
+	var nonce [chacha20.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.chunkCounter/v2RekeyInterval)
+	c.cipher, _ = chacha20.NewUnauthenticatedCipher(c.key[:], nonce[:])
+}
+
+// crypt encrypts or decrypts the passed chunk into dst and rekeys the cipher
+// when the end of the rekey interval is reached.
+func (c *fsChaCha20) crypt(dst, src []byte) {
+	c.cipher.XORKeyStream(dst, src)
+	c.chunkCounter++
+	if c.chunkCounter%v2RekeyInterval == 0 {
+		var key [chacha20.KeySize]byte
+		c.cipher.XORKeyStream(key[:], key[:])
+		c.key = key
+		c.resetCipher()
+	}
+}
+
+// fsChaCha20Poly1305 is the forward secure ChaCha20-Poly1305 AEAD used to
+// encrypt the contents of v2 packets.  The key is replaced every
+// v2RekeyInterval packets.
+type fsChaCha20Poly1305 struct {
+	key           [chacha20poly1305.KeySize]byte
+	packetCounter uint64
+}
+
+// newFSChaCha20Poly1305 returns a new forward secure ChaCha20-Poly1305 AEAD
+// with the passed initial key.
+func newFSChaCha20Poly1305(key []byte) *fsChaCha20Poly1305 {
+	c := &fsChaCha20Poly1305{}
+	copy(c.key[:], key)
+	return c
+}
+
+// nonce returns the nonce for the current packet.
+func (c *fsChaCha20Poly1305) nonce() []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint32(nonce[:4],
+		uint32(c.packetCounter%v2RekeyInterval))
+	binary.LittleEndian.PutUint64(nonce[4:], c.packetCounter/v2RekeyInterval)
+	return nonce[:]
+}
+
+// next advances to the next packet and rekeys the AEAD when the end of the
+// rekey interval is reached.
+func (c *fsChaCha20Poly1305) next() {
+	if (c.packetCounter+1)%v2RekeyInterval == 0 {
+		nonce := c.nonce()
+		for i := 0; i < 4; i++ {
+			nonce[i] = 0xff
+		}
+		aead, _ := chacha20poly1305.New(c.key[:])
+		var zero [chacha20poly1305.KeySize]byte
+		copy(c.key[:], aead.Seal(nil, nonce, zero[:], nil))
+	}
+	c.packetCounter++
+}
+
+// seal encrypts and authenticates the passed plaintext along with the
+// additional data and appends the result to dst.
+func (c *fsChaCha20Poly1305) seal(dst, plaintext, aad []byte) []byte {
+	aead, _ := chacha20poly1305.New(c.key[:])
+	dst = aead.Seal(dst, c.nonce(), plaintext, aad)
+	c.next()
+	return dst
+}
+
+// open authenticates and decrypts the passed ciphertext along with the
+// additional data.
+func (c *fsChaCha20Poly1305) open(ciphertext, aad []byte) ([]byte, error) {
+	aead, _ := chacha20poly1305.New(c.key[:])
+	plaintext, err := aead.Open(nil, c.nonce(), ciphertext, aad)
+	if err != nil {
+		return nil, err
+	}
+	c.next()
+	return plaintext, nil
+}
+
+// v2Transport implements the transport interface using the encrypted message
+// framing defined by BIP0324.
+type v2Transport struct {
+	r *bufio.Reader
+	w io.Writer
+
+	sendL *fsChaCha20
+	sendP *fsChaCha20Poly1305
+	recvL *fsChaCha20
+	recvP *fsChaCha20Poly1305
+
+	sendTerminator [v2GarbageTerminatorLen]byte
+	recvTerminator [v2GarbageTerminatorLen]byte
+
+	// sendAAD and recvAAD hold the garbage sent and received during the
+	// handshake which is authenticated by the first packet in each
+	// direction.
+	sendAAD []byte
+	recvAAD []byte
+}
+
+// Ensure v2Transport implements the transport interface.
+var _ transport = (*v2Transport)(nil)
+
+// taggedHash returns the BIP0340 style tagged hash of the passed message.
+func taggedHash(tag string, msg ...[]byte) [sha256.Size]byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, m := range msg {
+		h.Write(m)
+	}
+	var hash [sha256.Size]byte
+	copy(hash[:], h.Sum(nil))
+	return hash
+}
+
+// newV2Transport derives the session keys for a v2 transport from the local
+// private key and the ElligatorSwift encoded public keys of both sides.
+func newV2Transport(r *bufio.Reader, w io.Writer, btcnet wire.BitcoinNet,
+	privKey *btcec.PrivateKey, initiatorKey, responderKey *[btcec.EllswiftPubKeyLen]byte,
+	initiator bool) *v2Transport {
+
+	theirs := initiatorKey
+	if initiator {
+		theirs = responderKey
+	}
+	ecdhX := btcec.EllswiftECDHXOnly(privKey, theirs)
+	secret := taggedHash("bip324_ellswift_xonly_ecdh", initiatorKey[:],
+		responderKey[:], ecdhX[:])
+
+	var magic [4]byte
+	binary.LittleEndian.PutUint32(magic[:], uint32(btcnet))
+	salt := append([]byte("bitcoin_v2_shared_secret"), magic[:]...)
+	prk := hkdf.Extract(sha256.New, secret[:], salt)
+	expand := func(label string, n int) []byte {
+		key := make([]byte, n)
+		io.ReadFull(hkdf.Expand(sha256.New, prk, []byte(label)), key)
+		return key
+	}
+
+	initiatorL := newFSChaCha20(expand("initiator_L", 32))
+	initiatorP := newFSChaCha20Poly1305(expand("initiator_P", 32))
+	responderL := newFSChaCha20(expand("responder_L", 32))
+	responderP := newFSChaCha20Poly1305(expand("responder_P", 32))
+	terminators := expand("garbage_terminators", 2*v2GarbageTerminatorLen)
+
+	t := &v2Transport{r: r, w: w}
+	if initiator {
+		t.sendL, t.sendP = initiatorL, initiatorP
+		t.recvL, t.recvP = responderL, responderP
+		copy(t.sendTerminator[:], terminators[:v2GarbageTerminatorLen])
+		copy(t.recvTerminator[:], terminators[v2GarbageTerminatorLen:])
+	} else {
+		t.sendL, t.sendP = responderL, responderP
+		t.recvL, t.recvP = initiatorL, initiatorP
+		copy(t.sendTerminator[:], terminators[v2GarbageTerminatorLen:])
+		copy(t.recvTerminator[:], terminators[:v2GarbageTerminatorLen])
+	}
+	return t
+}
+
+// v1VersionPrefix returns the first bytes of the header of a version message
+// sent with the v1 transport.  A responder which receives them instead of a
+// public key falls back to the v1 transport.
+func v1VersionPrefix(btcnet wire.BitcoinNet) []byte {
+	prefix := make([]byte, 4, 4+wire.CommandSize)
+	binary.LittleEndian.PutUint32(prefix, uint32(btcnet))
+	var cmd [wire.CommandSize]byte
+	copy(cmd[:], wire.CmdVersion)
+	return append(prefix, cmd[:]...)
+}
+
+// randomGarbage returns a random amount of random bytes to be sent before the
+// garbage terminator during the handshake.
+func randomGarbage() ([]byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(v2MaxGarbageLen+1))
+	if err != nil {
+		return nil, err
+	}
+	garbage := make([]byte, n.Int64())
+	if _, err := rand.Read(garbage); err != nil {
+		return nil, err
+	}
+	return garbage, nil
+}
+
+// writeAsync writes the passed data to w from a separate goroutine and
+// returns a channel which receives the result.  The handshake writes its data
+// asynchronously so neither side blocks on the other while both are sending.
+func writeAsync(w io.Writer, data []byte) <-chan error {
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := w.Write(data)
+		errChan <- err
+	}()
+	return errChan
+}
+
+// initiateV2Transport performs the initiator side of the v2 handshake on the
+// passed connection and returns the resulting transport.
+func initiateV2Transport(rw io.ReadWriter, btcnet wire.BitcoinNet) (*v2Transport, error) {
+	privKey, ours, err := btcec.NewEllswiftKey()
+	if err != nil {
+		return nil, err
+	}
+	garbage, err := randomGarbage()
+	if err != nil {
+		return nil, err
+	}
+	sent := writeAsync(rw, append(ours[:], garbage...))
+
+	r := bufio.NewReader(rw)
+	var theirs [btcec.EllswiftPubKeyLen]byte
+	if _, err := io.ReadFull(r, theirs[:]); err != nil {
+		return nil, err
+	}
+	if err := <-sent; err != nil {
+		return nil, err
+	}
+
+	t := newV2Transport(r, rw, btcnet, privKey, &ours, &theirs, true)
+	t.sendAAD = garbage
+	sent = writeAsync(rw, t.handshakeTrailer())
+	if err := t.readHandshakeTrailer(); err != nil {
+		return nil, err
+	}
+	if err := <-sent; err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// acceptV2Transport performs the responder side of the v2 handshake on the
+// passed connection and returns the resulting transport.  A v1 transport is
+// returned instead when the other side starts with a v1 version message.
+func acceptV2Transport(rw io.ReadWriter, btcnet wire.BitcoinNet) (transport, error) {
+	r := bufio.NewReader(rw)
+	var theirs [btcec.EllswiftPubKeyLen]byte
+	prefix := v1VersionPrefix(btcnet)
+	if _, err := io.ReadFull(r, theirs[:len(prefix)]); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(theirs[:len(prefix)], prefix) {
+		return &v1Transport{
+			r: io.MultiReader(bytes.NewReader(prefix), r),
+			w: rw,
+		}, nil
+	}
+	if _, err := io.ReadFull(r, theirs[len(prefix):]); err != nil {
+		return nil, err
+	}
+
+	privKey, ours, err := btcec.NewEllswiftKey()
+	if err != nil {
+		return nil, err
+	}
+	garbage, err := randomGarbage()
+	if err != nil {
+		return nil, err
+	}
+
+	t := newV2Transport(r, rw, btcnet, privKey, &theirs, &ours, false)
+	t.sendAAD = garbage
+	data := append(ours[:], garbage...)
+	sent := writeAsync(rw, append(data, t.handshakeTrailer()...))
+	if err := t.readHandshakeTrailer(); err != nil {
+		return nil, err
+	}
+	if err := <-sent; err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// handshakeTrailer returns the garbage terminator followed by the version
+// packet which complete the local side of the handshake.
+func (t *v2Transport) handshakeTrailer() []byte {
+	trailer := append([]byte(nil), t.sendTerminator[:]...)
+	return append(trailer, t.encryptPacket(nil, false)...)
+}
+
+// readHandshakeTrailer skips the garbage sent by the other side and reads its
+// version packet which completes the handshake.
+func (t *v2Transport) readHandshakeTrailer() error {
+	garbage := make([]byte, 0, v2MaxGarbageLen+v2GarbageTerminatorLen)
+	for {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		garbage = append(garbage, b)
+		if len(garbage) >= v2GarbageTerminatorLen && bytes.Equal(
+			garbage[len(garbage)-v2GarbageTerminatorLen:],
+			t.recvTerminator[:]) {
+
+			break
+		}
+		if len(garbage) == cap(garbage) {
+			return errV2GarbageTooLong
+		}
+	}
+	t.recvAAD = garbage[:len(garbage)-v2GarbageTerminatorLen]
+
+	// The contents of the version packet are reserved for future
+	// extensions, so they are ignored.  Decoy packets may precede it.
+	for {
+		_, _, ignore, err := t.readPacket()
+		if err != nil {
+			return err
+		}
+		if !ignore {
+			return nil
+		}
+	}
+}
+
+// encryptPacket returns the encrypted packet for the passed contents.
+func (t *v2Transport) encryptPacket(contents []byte, ignore bool) []byte {
+	packet := make([]byte, v2LengthFieldLen, v2LengthFieldLen+v2HeaderLen+
+		len(contents)+v2TagLen)
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(contents)))
+	t.sendL.crypt(packet, length[:v2LengthFieldLen])
+
+	plaintext := make([]byte, v2HeaderLen, v2HeaderLen+len(contents))
+	if ignore {
+		plaintext[0] = v2IgnoreBit
+	}
+	plaintext = append(plaintext, contents...)
+	packet = t.sendP.seal(packet, plaintext, t.sendAAD)
+	t.sendAAD = nil
+	return packet
+}
+
+// readPacket reads and decrypts the next packet.  It returns the number of
+// bytes read in addition to the contents of the packet and whether or not it
+// is a decoy packet which must be ignored.
+func (t *v2Transport) readPacket() (int, []byte, bool, error) {
+	var length [4]byte
+	n, err := io.ReadFull(t.r, length[:v2LengthFieldLen])
+	if err != nil {
+		return n, nil, false, err
+	}
+	t.recvL.crypt(length[:v2LengthFieldLen], length[:v2LengthFieldLen])
+	contentsLen := binary.LittleEndian.Uint32(length[:])
+	if contentsLen > v2MaxContentsLen {
+		return n, nil, false, fmt.Errorf("v2 packet contents of %d "+
+			"bytes exceed the maximum of %d bytes", contentsLen,
+			v2MaxContentsLen)
+	}
+
+	ciphertext := make([]byte, v2HeaderLen+int(contentsLen)+v2TagLen)
+	read, err := io.ReadFull(t.r, ciphertext)
+	n += read
+	if err != nil {
+		return n, nil, false, err
+	}
+	plaintext, err := t.recvP.open(ciphertext, t.recvAAD)
+	if err != nil {
+		return n, nil, false, err
+	}
+	t.recvAAD = nil
+	return n, plaintext[v2HeaderLen:], plaintext[0]&v2IgnoreBit != 0, nil
+}
+
+// readMessage reads and decrypts the next bitcoin message skipping any decoy
+// packets.
+//
+// This is part of the transport interface implementation.
+func (t *v2Transport) readMessage(pver uint32, btcnet wire.BitcoinNet,
+	enc wire.MessageEncoding) (int, wire.Message, []byte, error) {
+
+	var totalBytes int
+	for {
+		n, contents, ignore, err := t.readPacket()
+		totalBytes += n
+		if err != nil {
+			return totalBytes, nil, nil, err
+		}
+		if ignore {
+			continue
+		}
+		if len(contents) == 0 {
+			return totalBytes, nil, nil, &wire.MessageError{
+				Func:        "v2Transport.readMessage",
+				Description: "empty v2 packet contents",
+			}
+		}
+
+		// Decode the command from its short id or in full when the
+		// short id is 0.
+		var command string
+		payload := contents[1:]
+		switch id := contents[0]; {
+		case id == 0:
+			if len(payload) < wire.CommandSize {
+				return totalBytes, nil, nil, &wire.MessageError{
+					Func:        "v2Transport.readMessage",
+					Description: "truncated v2 message command",
+				}
+			}
+			command = string(bytes.TrimRight(
+				payload[:wire.CommandSize], "\x00"))
+			payload = payload[wire.CommandSize:]
+
+		case int(id) < len(v2ShortIDs):
+			command = v2ShortIDs[id]
+
+		default:
+			str := fmt.Sprintf("unknown v2 short message id %d", id)
+			return totalBytes, nil, nil, &wire.MessageError{
+				Func:        "v2Transport.readMessage",
+				Description: str,
+			}
+		}
+
+		msg, err := wire.DecodeMessagePayload(command, payload, pver, enc)
+		if err != nil {
+			return totalBytes, nil, nil, err
+		}
+		return totalBytes, msg, payload, nil
+	}
+}
+
+// writeMessage encrypts and writes the passed bitcoin message using its short
+// id when it has one.
+//
+// This is part of the transport interface implementation.
+func (t *v2Transport) writeMessage(msg wire.Message, pver uint32,
+	btcnet wire.BitcoinNet, enc wire.MessageEncoding) (int, error) {
+
+	payload, err := wire.EncodeMessagePayload(msg, pver, enc)
+	if err != nil {
+		return 0, err
+	}
+
+	var contents []byte
+	if id, ok := v2ShortIDsByCmd[msg.Command()]; ok {
+		contents = make([]byte, 1, 1+len(payload))
+		contents[0] = id
+	} else {
+		contents = make([]byte, 1+wire.CommandSize, 1+wire.CommandSize+
+			len(payload))
+		copy(contents[1:], msg.Command())
+	}
+	contents = append(contents, payload...)
+	return t.w.Write(t.encryptPacket(contents, false))
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestFSChaCha20 ensures the forward secure ciphers used by the v2 transport
+// stay in sync across rekeys and that tampered packets are rejected.
+func TestFSChaCha20(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	enc, dec := newFSChaCha20(key), newFSChaCha20(key)
+	aeadEnc, aeadDec := newFSChaCha20Poly1305(key), newFSChaCha20Poly1305(key)
+
+	var prevKey [32]byte
+	copy(prevKey[:], key)
+	for i := 0; i < 3*v2RekeyInterval; i++ {
+		chunk := []byte{byte(i), byte(i >> 8), 0x01}
+		ciphertext := make([]byte, len(chunk))
+		enc.crypt(ciphertext, chunk)
+		plaintext := make([]byte, len(chunk))
+		dec.crypt(plaintext, ciphertext)
+		if !bytes.Equal(plaintext, chunk) {
+			t.Fatalf("fsChaCha20 #%d: got %x, want %x", i, plaintext,
+				chunk)
+		}
+
+		// The key must only change at the end of each rekey interval.
+		rekeyed := enc.key != prevKey
+		if want := (i+1)%v2RekeyInterval == 0; rekeyed != want {
+			t.Fatalf("fsChaCha20 #%d: rekeyed %v, want %v", i,
+				rekeyed, want)
+		}
+		prevKey = enc.key
+
+		sealed := aeadEnc.seal(nil, chunk, nil)
+		opened, err := aeadDec.open(sealed, nil)
+		if err != nil {
+			t.Fatalf("fsChaCha20Poly1305 #%d: unexpected error %v",
+				i, err)
+		}
+		if !bytes.Equal(opened, chunk) {
+			t.Fatalf("fsChaCha20Poly1305 #%d: got %x, want %x", i,
+				opened, chunk)
+		}
+	}
+
+	// A tampered packet must fail to authenticate.
+	sealed := aeadEnc.seal(nil, []byte{0x01}, nil)
+	sealed[0] ^= 0x01
+	if _, err := aeadDec.open(sealed, nil); err == nil {
+		t.Fatal("fsChaCha20Poly1305: tampered packet was accepted")
+	}
+}
+
+// TestV2Transport ensures the v2 handshake completes between an initiator and
+// a responder and that messages with and without short ids can be exchanged
+// afterwards.
+func TestV2Transport(t *testing.T) {
+	pver := wire.ProtocolVersion
+	btcnet := wire.MainNet
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	type result struct {
+		t   transport
+		err error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		t, err := acceptV2Transport(c2, btcnet)
+		accepted <- result{t, err}
+	}()
+	initiator, err := initiateV2Transport(c1, btcnet)
+	if err != nil {
+		t.Fatalf("initiateV2Transport: unexpected error %v", err)
+	}
+	res := <-accepted
+	if res.err != nil {
+		t.Fatalf("acceptV2Transport: unexpected error %v", res.err)
+	}
+	responder, ok := res.t.(*v2Transport)
+	if !ok {
+		t.Fatalf("acceptV2Transport: got transport %T, want *v2Transport",
+			res.t)
+	}
+
+	msgs := []wire.Message{
+		wire.NewMsgPing(123123),         // short id
+		wire.NewMsgSendAddrV2(),         // full command
+		wire.NewMsgFeeFilter(1000),      // short id
+		wire.NewMsgGetAddr(),            // full command
+		wire.NewMsgVerAck(),             // full command
+		wire.NewMsgNotFound(),           // short id
+		wire.NewMsgReject("tx", 0, "x"), // full command
+	}
+	for i, msg := range msgs {
+		for _, dir := range []struct{ from, to *v2Transport }{
+			{initiator, responder},
+			{responder, initiator},
+		} {
+			written := make(chan error, 1)
+			go func() {
+				_, err := dir.from.writeMessage(msg, pver, btcnet,
+					wire.BaseEncoding)
+				written <- err
+			}()
+			_, got, _, err := dir.to.readMessage(pver, btcnet,
+				wire.BaseEncoding)
+			if err != nil {
+				t.Fatalf("readMessage #%d: unexpected error %v", i,
+					err)
+			}
+			if err := <-written; err != nil {
+				t.Fatalf("writeMessage #%d: unexpected error %v",
+					i, err)
+			}
+			if !reflect.DeepEqual(got, msg) {
+				t.Fatalf("readMessage #%d\n got: %s want: %s", i,
+					spew.Sdump(got), spew.Sdump(msg))
+			}
+		}
+	}
+
+	// Decoy packets must be skipped by the receiver.
+	go func() {
+		initiator.w.Write(initiator.encryptPacket([]byte{0x01}, true))
+		initiator.writeMessage(wire.NewMsgPong(1), pver, btcnet,
+			wire.BaseEncoding)
+	}()
+	_, got, _, err := responder.readMessage(pver, btcnet, wire.BaseEncoding)
+	if err != nil {
+		t.Fatalf("readMessage: unexpected error %v", err)
+	}
+	if _, ok := got.(*wire.MsgPong); !ok {
+		t.Fatalf("readMessage: got %T, want *wire.MsgPong", got)
+	}
+}
+
+// TestV2TransportFallback ensures a responder falls back to the v1 transport
+// when the other side starts with a v1 version message.
+func TestV2TransportFallback(t *testing.T) {
+	pver := wire.ProtocolVersion
+	btcnet := wire.TestNet3
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	me := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 8333, 0)
+	you := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.2"), 8333, 0)
+	msg := wire.NewMsgVersion(me, you, 123, 0)
+	go wire.WriteMessage(c1, msg, pver, btcnet)
+
+	tr, err := acceptV2Transport(c2, btcnet)
+	if err != nil {
+		t.Fatalf("acceptV2Transport: unexpected error %v", err)
+	}
+	if _, ok := tr.(*v1Transport); !ok {
+		t.Fatalf("acceptV2Transport: got transport %T, want *v1Transport",
+			tr)
+	}
+	_, got, _, err := tr.readMessage(pver, btcnet, wire.BaseEncoding)
+	if err != nil {
+		t.Fatalf("readMessage: unexpected error %v", err)
+	}
+	version, ok := got.(*wire.MsgVersion)
+	if !ok || version.Nonce != msg.Nonce {
+		t.Fatalf("readMessage: got %s, want %s", spew.Sdump(got),
+			spew.Sdump(msg))
+	}
+}
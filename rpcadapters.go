@@ -5,9 +5,12 @@
 package main
 
 import (
+	"net"
 	"sync/atomic"
+	"time"
 
 	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/netsync"
@@ -40,7 +43,7 @@ func (p *rpcPeer) ToPeer() *peer.Peer {
 // This function is safe for concurrent access and is part of the rpcserverPeer
 // interface implementation.
 func (p *rpcPeer) IsTxRelayDisabled() bool {
-	return (*serverPeer)(p).disableRelayTx
+	return (*serverPeer)(p).relayTxDisabled()
 }
 
 // BanScore returns the current integer value that represents how close the peer
@@ -61,6 +64,38 @@ func (p *rpcPeer) FeeFilter() int64 {
 	return atomic.LoadInt64(&(*serverPeer)(p).feeFilter)
 }
 
+// ConnectionType returns the type of the connection with the peer as reported
+// by the getpeerinfo command.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) ConnectionType() string {
+	sp := (*serverPeer)(p)
+	switch {
+	case sp.Inbound():
+		return btcjson.ConnTypeInbound
+	case sp.persistent:
+		return btcjson.ConnTypeManual
+	case sp.blockRelayOnly:
+		return btcjson.ConnTypeBlockRelayOnly
+	default:
+		return btcjson.ConnTypeOutboundFullRelay
+	}
+}
+
+// MappedAS returns the number of the autonomous system which announces the
+// address of the peer according to the ASN map, or 0 when it is not mapped.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) MappedAS() uint32 {
+	sp := (*serverPeer)(p)
+	if sp.NA() == nil {
+		return 0
+	}
+	return sp.server.addrManager.ASN(sp.NA())
+}
+
 // rpcConnManager provides a connection manager for use with the RPC server and
 // implements the rpcserverConnManager interface.
 type rpcConnManager struct {
@@ -223,6 +258,40 @@ func (cm *rpcConnManager) RelayTransactions(txns []*mempool.TxDesc) {
 	cm.server.relayTransactions(txns)
 }
 
+// BanSubnet bans the passed subnet until the passed time for the passed reason
+// and disconnects all connected peers within it.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) BanSubnet(ipNet *net.IPNet, until time.Time, reason string) {
+	cm.server.BanSubnet(ipNet, until, reason)
+}
+
+// UnbanSubnet removes the ban of the passed subnet.  It returns false when the
+// subnet is not banned.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) UnbanSubnet(ipNet *net.IPNet) bool {
+	return cm.server.banList.Remove(ipNet)
+}
+
+// BannedSubnets returns the bans which have not expired.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) BannedSubnets() []banEntry {
+	return cm.server.banList.Entries()
+}
+
+// ClearBanned removes all bans.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) ClearBanned() {
+	cm.server.banList.Clear()
+}
+
 // rpcSyncMgr provides a block manager for use with the RPC server and
 // implements the rpcserverSyncManager interface.
 type rpcSyncMgr struct {
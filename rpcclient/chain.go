@@ -426,6 +426,192 @@ func (c *Client) GetBlockHeaderVerbose(blockHash *chainhash.Hash) (*btcjson.GetB
 	return c.GetBlockHeaderVerboseAsync(blockHash).Receive()
 }
 
+// FutureGetMempoolAncestorsResult is a future promise to deliver the result of a
+// GetMempoolAncestorsAsync RPC invocation (or an applicable error).
+type FutureGetMempoolAncestorsResult chan *response
+
+// Receive waits for the response promised by the future and returns the hashes
+// of the transactions in the memory pool the passed transaction depends on.
+func (r FutureGetMempoolAncestorsResult) Receive() ([]*chainhash.Hash, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as an array of strings.
+	var txHashStrs []string
+	err = json.Unmarshal(res, &txHashStrs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a slice of hashes from the string slice.
+	txHashes := make([]*chainhash.Hash, 0, len(txHashStrs))
+	for _, hashStr := range txHashStrs {
+		txHash, err := chainhash.NewHashFromStr(hashStr)
+		if err != nil {
+			return nil, err
+		}
+		txHashes = append(txHashes, txHash)
+	}
+
+	return txHashes, nil
+}
+
+// GetMempoolAncestorsAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetMempoolAncestors for the blocking version and more details.
+func (c *Client) GetMempoolAncestorsAsync(txHash string) FutureGetMempoolAncestorsResult {
+	cmd := btcjson.NewGetMempoolAncestorsCmd(txHash, btcjson.Bool(false))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolAncestors returns the hashes of the transactions in the memory pool
+// the passed transaction depends on.
+//
+// See GetMempoolAncestorsVerbose to retrieve data structures with information
+// about the transactions instead.
+func (c *Client) GetMempoolAncestors(txHash string) ([]*chainhash.Hash, error) {
+	return c.GetMempoolAncestorsAsync(txHash).Receive()
+}
+
+// FutureGetMempoolAncestorsVerboseResult is a future promise to deliver the result
+// of a GetMempoolAncestorsVerboseAsync RPC invocation (or an applicable error).
+type FutureGetMempoolAncestorsVerboseResult chan *response
+
+// Receive waits for the response promised by the future and returns a map of
+// transaction hashes to an associated data structure with information about the
+// transaction for the transactions in the memory pool the passed transaction depends on.
+func (r FutureGetMempoolAncestorsVerboseResult) Receive() (map[string]btcjson.GetMempoolEntryResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a map of strings (tx hashes) to their
+	// detailed results.
+	var mempoolItems map[string]btcjson.GetMempoolEntryResult
+	err = json.Unmarshal(res, &mempoolItems)
+	if err != nil {
+		return nil, err
+	}
+	return mempoolItems, nil
+}
+
+// GetMempoolAncestorsVerboseAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolAncestorsVerbose for the blocking version and more details.
+func (c *Client) GetMempoolAncestorsVerboseAsync(txHash string) FutureGetMempoolAncestorsVerboseResult {
+	cmd := btcjson.NewGetMempoolAncestorsCmd(txHash, btcjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolAncestorsVerbose returns a map of transaction hashes to an associated
+// data structure with information about the transaction for the transactions
+// in the memory pool the passed transaction depends on.
+//
+// See GetMempoolAncestors to retrieve only the transaction hashes instead.
+func (c *Client) GetMempoolAncestorsVerbose(txHash string) (map[string]btcjson.GetMempoolEntryResult, error) {
+	return c.GetMempoolAncestorsVerboseAsync(txHash).Receive()
+}
+
+// FutureGetMempoolDescendantsResult is a future promise to deliver the result of a
+// GetMempoolDescendantsAsync RPC invocation (or an applicable error).
+type FutureGetMempoolDescendantsResult chan *response
+
+// Receive waits for the response promised by the future and returns the hashes
+// of the transactions in the memory pool which depend on the passed transaction.
+func (r FutureGetMempoolDescendantsResult) Receive() ([]*chainhash.Hash, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as an array of strings.
+	var txHashStrs []string
+	err = json.Unmarshal(res, &txHashStrs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a slice of hashes from the string slice.
+	txHashes := make([]*chainhash.Hash, 0, len(txHashStrs))
+	for _, hashStr := range txHashStrs {
+		txHash, err := chainhash.NewHashFromStr(hashStr)
+		if err != nil {
+			return nil, err
+		}
+		txHashes = append(txHashes, txHash)
+	}
+
+	return txHashes, nil
+}
+
+// GetMempoolDescendantsAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See GetMempoolDescendants for the blocking version and more details.
+func (c *Client) GetMempoolDescendantsAsync(txHash string) FutureGetMempoolDescendantsResult {
+	cmd := btcjson.NewGetMempoolDescendantsCmd(txHash, btcjson.Bool(false))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolDescendants returns the hashes of the transactions in the memory pool
+// which depend on the passed transaction.
+//
+// See GetMempoolDescendantsVerbose to retrieve data structures with information
+// about the transactions instead.
+func (c *Client) GetMempoolDescendants(txHash string) ([]*chainhash.Hash, error) {
+	return c.GetMempoolDescendantsAsync(txHash).Receive()
+}
+
+// FutureGetMempoolDescendantsVerboseResult is a future promise to deliver the result
+// of a GetMempoolDescendantsVerboseAsync RPC invocation (or an applicable error).
+type FutureGetMempoolDescendantsVerboseResult chan *response
+
+// Receive waits for the response promised by the future and returns a map of
+// transaction hashes to an associated data structure with information about the
+// transaction for the transactions in the memory pool which depend on the passed transaction.
+func (r FutureGetMempoolDescendantsVerboseResult) Receive() (map[string]btcjson.GetMempoolEntryResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a map of strings (tx hashes) to their
+	// detailed results.
+	var mempoolItems map[string]btcjson.GetMempoolEntryResult
+	err = json.Unmarshal(res, &mempoolItems)
+	if err != nil {
+		return nil, err
+	}
+	return mempoolItems, nil
+}
+
+// GetMempoolDescendantsVerboseAsync returns an instance of a type that can be used
+// to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetMempoolDescendantsVerbose for the blocking version and more details.
+func (c *Client) GetMempoolDescendantsVerboseAsync(txHash string) FutureGetMempoolDescendantsVerboseResult {
+	cmd := btcjson.NewGetMempoolDescendantsCmd(txHash, btcjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolDescendantsVerbose returns a map of transaction hashes to an associated
+// data structure with information about the transaction for the transactions
+// in the memory pool which depend on the passed transaction.
+//
+// See GetMempoolDescendants to retrieve only the transaction hashes instead.
+func (c *Client) GetMempoolDescendantsVerbose(txHash string) (map[string]btcjson.GetMempoolEntryResult, error) {
+	return c.GetMempoolDescendantsVerboseAsync(txHash).Receive()
+}
+
 // FutureGetMempoolEntryResult is a future promise to deliver the result of a
 // GetMempoolEntryAsync RPC invocation (or an applicable error).
 type FutureGetMempoolEntryResult chan *response
@@ -557,6 +743,33 @@ func (c *Client) GetRawMempoolVerbose() (map[string]btcjson.GetRawMempoolVerbose
 	return c.GetRawMempoolVerboseAsync().Receive()
 }
 
+// FutureSaveMempoolResult is a future promise to deliver the result of a
+// SaveMempoolAsync RPC invocation (or an applicable error).
+type FutureSaveMempoolResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the memory pool could not be saved.
+func (r FutureSaveMempoolResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// SaveMempoolAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See SaveMempool for the blocking version and more details.
+func (c *Client) SaveMempoolAsync() FutureSaveMempoolResult {
+	cmd := btcjson.NewSaveMempoolCmd()
+	return c.sendCmd(cmd)
+}
+
+// SaveMempool asks the server to write the transactions in its memory pool to
+// the mempool dump in its data directory so they are loaded again on restart.
+func (c *Client) SaveMempool() error {
+	return c.SaveMempoolAsync().Receive()
+}
+
 // FutureEstimateFeeResult is a future promise to deliver the result of a
 // EstimateFeeAsync RPC invocation (or an applicable error).
 type FutureEstimateFeeResult chan *response
@@ -594,6 +807,48 @@ func (c *Client) EstimateFee(numBlocks int64) (float64, error) {
 	return c.EstimateFeeAsync(numBlocks).Receive()
 }
 
+// FutureEstimateSmartFeeResult is a future promise to deliver the result of a
+// EstimateSmartFeeAsync RPC invocation (or an applicable error).
+type FutureEstimateSmartFeeResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// estimated fee rate along with the number of blocks it was estimated for.
+func (r FutureEstimateSmartFeeResult) Receive() (*btcjson.EstimateSmartFeeResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an estimatesmartfee result object.
+	var estimate btcjson.EstimateSmartFeeResult
+	err = json.Unmarshal(res, &estimate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &estimate, nil
+}
+
+// EstimateSmartFeeAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See EstimateSmartFee for the blocking version and more details.
+func (c *Client) EstimateSmartFeeAsync(confTarget int64,
+	mode *btcjson.EstimateSmartFeeMode) FutureEstimateSmartFeeResult {
+
+	cmd := btcjson.NewEstimateSmartFeeCmd(confTarget, mode)
+	return c.sendCmd(cmd)
+}
+
+// EstimateSmartFee provides an estimated fee rate in bitcoins per kilobyte for
+// a transaction to begin confirmation within confTarget blocks.
+func (c *Client) EstimateSmartFee(confTarget int64,
+	mode *btcjson.EstimateSmartFeeMode) (*btcjson.EstimateSmartFeeResult, error) {
+
+	return c.EstimateSmartFeeAsync(confTarget, mode).Receive()
+}
+
 // FutureVerifyChainResult is a future promise to deliver the result of a
 // VerifyChainAsync, VerifyChainLevelAsyncRPC, or VerifyChainBlocksAsync
 // invocation (or an applicable error).
@@ -363,6 +363,40 @@ func (c *Client) GetWorkSubmit(data string) (bool, error) {
 	return c.GetWorkSubmitAsync(data).Receive()
 }
 
+// FuturePrioritiseTransactionResult is a future promise to deliver the result
+// of a PrioritiseTransactionAsync RPC invocation (or an applicable error).
+type FuturePrioritiseTransactionResult chan *response
+
+// Receive waits for the response promised by the future and returns an error if
+// any occurred when prioritising the transaction.
+func (r FuturePrioritiseTransactionResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// PrioritiseTransactionAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See PrioritiseTransaction for the blocking version and more details.
+func (c *Client) PrioritiseTransactionAsync(txHash *chainhash.Hash, feeDelta int64) FuturePrioritiseTransactionResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := btcjson.NewPrioritiseTransactionCmd(hash, 0, feeDelta)
+	return c.sendCmd(cmd)
+}
+
+// PrioritiseTransaction adds the passed fee delta, in satoshi, to the fee the
+// server uses when deciding whether to keep the transaction in its memory pool
+// and when selecting transactions for block templates.  The transaction need
+// not be in the memory pool yet.
+func (c *Client) PrioritiseTransaction(txHash *chainhash.Hash, feeDelta int64) error {
+	return c.PrioritiseTransactionAsync(txHash, feeDelta).Receive()
+}
+
 // FutureSubmitBlockResult is a future promise to deliver the result of a
 // SubmitBlockAsync RPC invocation (or an applicable error).
 type FutureSubmitBlockResult chan *response
@@ -179,6 +179,15 @@ type NotificationHandlers struct {
 	// made to register for the notification and the function is non-nil.
 	OnTxAcceptedVerbose func(txDetails *btcjson.TxRawResult)
 
+	// OnTxRemoved is invoked when the memory pool removes a transaction on
+	// its own, such as when it expires or is evicted from the full memory
+	// pool, along with the reason for the removal.  It will only be invoked
+	// if a preceding call to NotifyNewTransactions has been made to
+	// register for the notification and the function is non-nil.
+	//
+	// NOTE: This is a btcd extension.
+	OnTxRemoved func(hash *chainhash.Hash, reason string)
+
 	// OnBtcdConnected is invoked when a wallet connects or disconnects from
 	// btcd.
 	//
@@ -409,6 +418,23 @@ func (c *Client) handleNotification(ntfn *rawNotification) {
 
 		c.ntfnHandlers.OnTxAcceptedVerbose(rawTx)
 
+	// OnTxRemoved
+	case btcjson.TxRemovedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnTxRemoved == nil {
+			return
+		}
+
+		hash, reason, err := parseTxRemovedNtfnParams(ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid tx removed "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnTxRemoved(hash, reason)
+
 	// OnBtcdConnected
 	case btcjson.BtcdConnectedNtfnMethod:
 		// Ignore the notification if the client is not interested in
@@ -775,6 +801,38 @@ func parseTxAcceptedVerboseNtfnParams(params []json.RawMessage) (*btcjson.TxRawR
 	return &rawTx, nil
 }
 
+// parseTxRemovedNtfnParams parses out the transaction hash and the reason for
+// the removal from the parameters of a txremoved notification.
+func parseTxRemovedNtfnParams(params []json.RawMessage) (*chainhash.Hash,
+	string, error) {
+
+	if len(params) != 2 {
+		return nil, "", wrongNumParams(len(params))
+	}
+
+	// Unmarshal first parameter as a string.
+	var txHashStr string
+	err := json.Unmarshal(params[0], &txHashStr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Unmarshal second parameter as a string.
+	var reason string
+	err = json.Unmarshal(params[1], &reason)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Decode string encoding of transaction sha.
+	txHash, err := chainhash.NewHashFromStr(txHashStr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return txHash, reason, nil
+}
+
 // parseBtcdConnectedNtfnParams parses out the connection status of btcd
 // and btcwallet from the parameters of a btcdconnected notification.
 func parseBtcdConnectedNtfnParams(params []json.RawMessage) (bool, error) {
@@ -306,6 +306,108 @@ func (c *Client) SendRawTransaction(tx *wire.MsgTx, allowHighFees bool) (*chainh
 	return c.SendRawTransactionAsync(tx, allowHighFees).Receive()
 }
 
+// FutureSubmitPackageResult is a future promise to deliver the result of a
+// SubmitPackageAsync RPC invocation (or an applicable error).
+type FutureSubmitPackageResult chan *response
+
+// Receive waits for the response promised by the future and returns the result
+// of submitting the package to the server which then relays its transactions
+// to the network.
+func (r FutureSubmitPackageResult) Receive() (*btcjson.SubmitPackageResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a submitpackage result object.
+	var packageResult btcjson.SubmitPackageResult
+	err = json.Unmarshal(res, &packageResult)
+	if err != nil {
+		return nil, err
+	}
+
+	return &packageResult, nil
+}
+
+// SubmitPackageAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See SubmitPackage for the blocking version and more details.
+func (c *Client) SubmitPackageAsync(txns []*wire.MsgTx) FutureSubmitPackageResult {
+	rawTxs, err := serializeTxnsHex(txns)
+	if err != nil {
+		return newFutureError(err)
+	}
+
+	cmd := btcjson.NewSubmitPackageCmd(rawTxs)
+	return c.sendCmd(cmd)
+}
+
+// SubmitPackage submits a package consisting of a child transaction along with
+// its parents to the server which will validate them together and then relay
+// them to the network.
+func (c *Client) SubmitPackage(txns []*wire.MsgTx) (*btcjson.SubmitPackageResult, error) {
+	return c.SubmitPackageAsync(txns).Receive()
+}
+
+// serializeTxnsHex serializes the passed transactions and converts them to hex
+// strings.
+func serializeTxnsHex(txns []*wire.MsgTx) ([]string, error) {
+	rawTxs := make([]string, 0, len(txns))
+	for _, tx := range txns {
+		buf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
+		if err := tx.Serialize(buf); err != nil {
+			return nil, err
+		}
+		rawTxs = append(rawTxs, hex.EncodeToString(buf.Bytes()))
+	}
+	return rawTxs, nil
+}
+
+// FutureTestMempoolAcceptResult is a future promise to deliver the result of a
+// TestMempoolAcceptAsync RPC invocation (or an applicable error).
+type FutureTestMempoolAcceptResult chan *response
+
+// Receive waits for the response promised by the future and returns whether
+// each of the tested transactions would be accepted to the memory pool.
+func (r FutureTestMempoolAcceptResult) Receive() ([]btcjson.TestMempoolAcceptResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an array of testmempoolaccept result objects.
+	var results []btcjson.TestMempoolAcceptResult
+	err = json.Unmarshal(res, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// TestMempoolAcceptAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See TestMempoolAccept for the blocking version and more details.
+func (c *Client) TestMempoolAcceptAsync(txns []*wire.MsgTx) FutureTestMempoolAcceptResult {
+	rawTxs, err := serializeTxnsHex(txns)
+	if err != nil {
+		return newFutureError(err)
+	}
+
+	cmd := btcjson.NewTestMempoolAcceptCmd(rawTxs)
+	return c.sendCmd(cmd)
+}
+
+// TestMempoolAccept returns whether each of the passed transactions would be
+// accepted to the memory pool of the server without adding or relaying them.
+func (c *Client) TestMempoolAccept(txns []*wire.MsgTx) ([]btcjson.TestMempoolAcceptResult, error) {
+	return c.TestMempoolAcceptAsync(txns).Receive()
+}
+
 // FutureSignRawTransactionResult is a future promise to deliver the result
 // of one of the SignRawTransactionAsync family of RPC invocations (or an
 // applicable error).
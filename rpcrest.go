@@ -0,0 +1,565 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// restMaxHeaders is the maximum number of block headers which can be
+	// requested from the REST interface at once.
+	restMaxHeaders = 2000
+
+	// restMaxOutpoints is the maximum number of outpoints which can be
+	// queried by a single getutxos request.
+	restMaxOutpoints = 15
+
+	// restMempoolHeight is the height reported by getutxos for outputs of
+	// transactions in the mempool.
+	restMempoolHeight = 0x7fffffff
+)
+
+// restFormat is the output format of a REST request, which is selected by the
+// extension of the requested path.
+type restFormat string
+
+// The output formats supported by the REST interface.
+const (
+	restFormatBinary restFormat = "bin"
+	restFormatHex    restFormat = "hex"
+	restFormatJSON   restFormat = "json"
+)
+
+// restError is an error which is returned to REST clients with the given HTTP
+// status code.
+type restError struct {
+	status  int
+	message string
+}
+
+// Error satisfies the error interface and returns the error message.
+func (e *restError) Error() string {
+	return e.message
+}
+
+// newRESTError returns a restError with the passed status code and a message
+// formatted according to the passed format specifier and arguments.
+func newRESTError(status int, format string, args ...interface{}) *restError {
+	return &restError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// restErrorFromRPC converts an error returned by an RPC handler to a restError
+// with the HTTP status code matching the failure.
+func restErrorFromRPC(err error) *restError {
+	rpcErr, ok := err.(*btcjson.RPCError)
+	if !ok {
+		return newRESTError(http.StatusInternalServerError, "%v", err)
+	}
+
+	switch rpcErr.Code {
+	case btcjson.ErrRPCDecodeHexString, btcjson.ErrRPCInvalidParameter:
+		return newRESTError(http.StatusBadRequest, "%s", rpcErr.Message)
+	// Note that ErrRPCBlockNotFound shares its code with ErrRPCNoTxInfo.
+	case btcjson.ErrRPCBlockNotFound, btcjson.ErrRPCOutOfRange:
+		return newRESTError(http.StatusNotFound, "%s", rpcErr.Message)
+	}
+	return newRESTError(http.StatusInternalServerError, "%s", rpcErr.Message)
+}
+
+// restHandler handles a REST request for the passed parameter, which is the
+// requested path following the handler's prefix with the extension removed.
+// It returns a []byte for the binary format and either a []byte or a string
+// for the hex format, and a value to encode as JSON for the JSON format.
+type restHandler func(*rpcServer, string, restFormat) (interface{}, error)
+
+// restHandlers maps the path prefixes served by the REST interface to their
+// handlers and the output formats they support.  Longer prefixes must precede
+// the prefixes they start with.
+var restHandlers = []struct {
+	prefix  string
+	formats []restFormat
+	handler restHandler
+}{
+	{"/rest/tx/", []restFormat{restFormatBinary, restFormatHex, restFormatJSON}, handleRESTTx},
+	{"/rest/block/notxdetails/", []restFormat{restFormatBinary, restFormatHex, restFormatJSON}, handleRESTBlockNoTxDetails},
+	{"/rest/block/", []restFormat{restFormatBinary, restFormatHex, restFormatJSON}, handleRESTBlock},
+	{"/rest/headers/", []restFormat{restFormatBinary, restFormatHex, restFormatJSON}, handleRESTHeaders},
+	{"/rest/blockhashbyheight/", []restFormat{restFormatBinary, restFormatHex, restFormatJSON}, handleRESTBlockHashByHeight},
+	{"/rest/getutxos", []restFormat{restFormatBinary, restFormatHex, restFormatJSON}, handleRESTGetUtxos},
+	{"/rest/mempool/info", []restFormat{restFormatJSON}, handleRESTMempoolInfo},
+}
+
+// parseRESTPath splits the passed path into the parameter of the request and
+// its output format, which is given by the extension of the path.  The format
+// is empty when the path has no extension.
+func parseRESTPath(path string) (string, restFormat) {
+	dot := strings.LastIndexByte(path, '.')
+	if dot == -1 || strings.IndexByte(path[dot:], '/') != -1 {
+		return path, ""
+	}
+	return path[:dot], restFormat(path[dot+1:])
+}
+
+// parseRESTHash parses the passed block or transaction hash, which must be
+// given in full.
+func parseRESTHash(str string) (*chainhash.Hash, error) {
+	if len(str) != chainhash.MaxHashStringSize {
+		return nil, newRESTError(http.StatusBadRequest, "Invalid hash: %s",
+			str)
+	}
+	hash, err := chainhash.NewHashFromStr(str)
+	if err != nil {
+		return nil, newRESTError(http.StatusBadRequest, "Invalid hash: %s",
+			str)
+	}
+	return hash, nil
+}
+
+// handleREST serves requests to the REST interface.  The requests are not
+// authenticated, so the REST interface only provides public data.
+func (s *rpcServer) handleREST(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 Method Not Allowed.",
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	for _, h := range restHandlers {
+		if !strings.HasPrefix(r.URL.Path, h.prefix) {
+			continue
+		}
+
+		param, format := parseRESTPath(r.URL.Path[len(h.prefix):])
+		supported := false
+		for _, f := range h.formats {
+			supported = supported || f == format
+		}
+		if !supported {
+			available := make([]string, len(h.formats))
+			for i, f := range h.formats {
+				available[i] = "." + string(f)
+			}
+			writeRESTError(w, newRESTError(http.StatusNotFound,
+				"output format not found (available: %s)",
+				strings.Join(available, ", ")))
+			return
+		}
+
+		result, err := h.handler(s, param, format)
+		if err != nil {
+			restErr, ok := err.(*restError)
+			if !ok {
+				restErr = restErrorFromRPC(err)
+			}
+			writeRESTError(w, restErr)
+			return
+		}
+		writeRESTResult(w, result, format)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// writeRESTError writes the passed error to a REST client.
+func writeRESTError(w http.ResponseWriter, err *restError) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(err.status)
+	fmt.Fprintf(w, "%s\r\n", err.message)
+}
+
+// writeRESTResult writes the result of a REST request to the client in the
+// requested output format.
+func writeRESTResult(w http.ResponseWriter, result interface{}, format restFormat) {
+	var body []byte
+	switch format {
+	case restFormatBinary:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		body = result.([]byte)
+
+	case restFormatHex:
+		w.Header().Set("Content-Type", "text/plain")
+		switch result := result.(type) {
+		case []byte:
+			body = []byte(hex.EncodeToString(result) + "\n")
+		case string:
+			body = []byte(result + "\n")
+		}
+
+	case restFormatJSON:
+		marshalled, err := json.Marshal(result)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal REST reply: %v", err)
+			writeRESTError(w, newRESTError(
+				http.StatusInternalServerError, "%v", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		body = append(marshalled, '\n')
+	}
+
+	if _, err := w.Write(body); err != nil {
+		rpcsLog.Errorf("Failed to write REST reply: %v", err)
+	}
+}
+
+// handleRESTTx implements the /rest/tx/<txid> endpoint, which returns a
+// transaction from the mempool or, when the transaction index is enabled, the
+// block chain.
+func handleRESTTx(s *rpcServer, param string, format restFormat) (interface{}, error) {
+	if _, err := parseRESTHash(param); err != nil {
+		return nil, err
+	}
+
+	verbose := 0
+	if format == restFormatJSON {
+		verbose = 1
+	}
+	result, err := handleGetRawTransaction(s, &btcjson.GetRawTransactionCmd{
+		Txid:    param,
+		Verbose: &verbose,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if format == restFormatJSON {
+		return result, nil
+	}
+	return hex.DecodeString(result.(string))
+}
+
+// restBlock returns the block with the passed hash in the passed format.  The
+// JSON format only includes the hashes of the transactions of the block unless
+// txDetails is set.
+func restBlock(s *rpcServer, param string, format restFormat, txDetails bool) (interface{}, error) {
+	hash, err := parseRESTHash(param)
+	if err != nil {
+		return nil, err
+	}
+
+	if format != restFormatJSON {
+		var blockBytes []byte
+		err := s.cfg.DB.View(func(dbTx database.Tx) error {
+			var err error
+			blockBytes, err = dbTx.FetchBlock(hash)
+			return err
+		})
+		if err != nil {
+			return nil, newRESTError(http.StatusNotFound,
+				"%s not found", param)
+		}
+		return blockBytes, nil
+	}
+
+	verbose := true
+	result, err := handleGetBlock(s, &btcjson.GetBlockCmd{
+		Hash:      param,
+		Verbose:   &verbose,
+		VerboseTx: &txDetails,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// handleRESTBlock implements the /rest/block/<hash> endpoint, which returns a
+// block including the details of its transactions.
+func handleRESTBlock(s *rpcServer, param string, format restFormat) (interface{}, error) {
+	return restBlock(s, param, format, true)
+}
+
+// handleRESTBlockNoTxDetails implements the /rest/block/notxdetails/<hash>
+// endpoint, which returns a block with only the hashes of its transactions.
+func handleRESTBlockNoTxDetails(s *rpcServer, param string, format restFormat) (interface{}, error) {
+	return restBlock(s, param, format, false)
+}
+
+// handleRESTHeaders implements the /rest/headers/<count>/<hash> endpoint,
+// which returns up to count headers of the main chain starting with the block
+// with the passed hash.  No headers are returned when the block is not in the
+// main chain.
+func handleRESTHeaders(s *rpcServer, param string, format restFormat) (interface{}, error) {
+	fields := strings.Split(param, "/")
+	if len(fields) != 2 {
+		return nil, newRESTError(http.StatusBadRequest, "No header count "+
+			"specified. Use /rest/headers/<count>/<hash>.<ext>.")
+	}
+	count, err := strconv.Atoi(fields[0])
+	if err != nil || count < 1 || count > restMaxHeaders {
+		return nil, newRESTError(http.StatusBadRequest, "Header count out "+
+			"of range: %s", fields[0])
+	}
+	hash, err := parseRESTHash(fields[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []*chainhash.Hash
+	if height, err := s.cfg.Chain.BlockHeightByHash(hash); err == nil {
+		for i := 0; i < count; i++ {
+			hash, err := s.cfg.Chain.BlockHashByHeight(height + int32(i))
+			if err != nil {
+				break
+			}
+			hashes = append(hashes, hash)
+		}
+	}
+
+	if format == restFormatJSON {
+		headers := make([]interface{}, 0, len(hashes))
+		verbose := true
+		for _, hash := range hashes {
+			header, err := handleGetBlockHeader(s,
+				&btcjson.GetBlockHeaderCmd{
+					Hash:    hash.String(),
+					Verbose: &verbose,
+				}, nil)
+			if err != nil {
+				return nil, err
+			}
+			headers = append(headers, header)
+		}
+		return headers, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(hashes) * wire.MaxBlockHeaderPayload)
+	for _, hash := range hashes {
+		header, err := s.cfg.Chain.HeaderByHash(hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := header.Serialize(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// handleRESTBlockHashByHeight implements the /rest/blockhashbyheight/<height>
+// endpoint, which returns the hash of the block at the passed height of the
+// main chain.
+func handleRESTBlockHashByHeight(s *rpcServer, param string, format restFormat) (interface{}, error) {
+	height, err := strconv.ParseInt(param, 10, 32)
+	if err != nil || height < 0 {
+		return nil, newRESTError(http.StatusBadRequest,
+			"Invalid height: %s", param)
+	}
+	hash, err := s.cfg.Chain.BlockHashByHeight(int32(height))
+	if err != nil {
+		return nil, newRESTError(http.StatusNotFound,
+			"Block height out of range")
+	}
+
+	switch format {
+	case restFormatBinary:
+		return hash[:], nil
+	case restFormatHex:
+		return hash.String(), nil
+	}
+	return struct {
+		BlockHash string `json:"blockhash"`
+	}{hash.String()}, nil
+}
+
+// restUtxo is an unspent transaction output returned by the getutxos endpoint.
+type restUtxo struct {
+	Height       int32                      `json:"height"`
+	Value        float64                    `json:"value"`
+	ScriptPubKey btcjson.ScriptPubKeyResult `json:"scriptPubKey"`
+
+	amount   int64
+	pkScript []byte
+}
+
+// restGetUtxosResult is the JSON result of the getutxos endpoint.
+type restGetUtxosResult struct {
+	ChainHeight  int32      `json:"chainHeight"`
+	ChainTipHash string     `json:"chaintipHash"`
+	Bitmap       string     `json:"bitmap"`
+	Utxos        []restUtxo `json:"utxos"`
+}
+
+// parseRESTOutpoints parses the parameter of a getutxos request, which is an
+// optional checkmempool flag followed by the outpoints to query in the form
+// <txid>-<index>, all separated by slashes.
+func parseRESTOutpoints(param string) ([]wire.OutPoint, bool, error) {
+	fields := strings.Split(strings.TrimPrefix(param, "/"), "/")
+	checkMempool := fields[0] == "checkmempool"
+	if checkMempool {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || fields[0] == "" {
+		return nil, false, newRESTError(http.StatusBadRequest,
+			"Error: empty request")
+	}
+	if len(fields) > restMaxOutpoints {
+		return nil, false, newRESTError(http.StatusBadRequest,
+			"Error: max outpoints exceeded (max: %d, tried: %d)",
+			restMaxOutpoints, len(fields))
+	}
+
+	outpoints := make([]wire.OutPoint, 0, len(fields))
+	for _, field := range fields {
+		parts := strings.Split(field, "-")
+		if len(parts) != 2 {
+			return nil, false, newRESTError(http.StatusBadRequest,
+				"Parse error")
+		}
+		hash, err := parseRESTHash(parts[0])
+		if err != nil {
+			return nil, false, newRESTError(http.StatusBadRequest,
+				"Parse error")
+		}
+		index, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return nil, false, newRESTError(http.StatusBadRequest,
+				"Parse error")
+		}
+		outpoints = append(outpoints, *wire.NewOutPoint(hash,
+			uint32(index)))
+	}
+	return outpoints, checkMempool, nil
+}
+
+// handleRESTGetUtxos implements the /rest/getutxos[/checkmempool]/<outpoints>
+// endpoint, which returns which of the passed outpoints are unspent along
+// with their outputs.  Outputs created and spent by mempool transactions are
+// only taken into account when checkmempool is given.
+func handleRESTGetUtxos(s *rpcServer, param string, format restFormat) (interface{}, error) {
+	outpoints, checkMempool, err := parseRESTOutpoints(param)
+	if err != nil {
+		return nil, err
+	}
+
+	best := s.cfg.Chain.BestSnapshot()
+	bitmap := make([]byte, (len(outpoints)+7)/8)
+	bitmapString := make([]byte, len(outpoints))
+	utxos := make([]restUtxo, 0, len(outpoints))
+	for i, outpoint := range outpoints {
+		bitmapString[i] = '0'
+
+		var utxo *restUtxo
+		if checkMempool {
+			if s.cfg.TxMemPool.CheckSpend(outpoint) != nil {
+				continue
+			}
+			tx, err := s.cfg.TxMemPool.FetchTransaction(&outpoint.Hash)
+			if err == nil {
+				txOuts := tx.MsgTx().TxOut
+				if outpoint.Index >= uint32(len(txOuts)) {
+					continue
+				}
+				txOut := txOuts[outpoint.Index]
+				utxo = &restUtxo{
+					Height:   restMempoolHeight,
+					amount:   txOut.Value,
+					pkScript: txOut.PkScript,
+				}
+			}
+		}
+		if utxo == nil {
+			entry, err := s.cfg.Chain.FetchUtxoEntry(outpoint)
+			if err != nil {
+				return nil, err
+			}
+			if entry == nil || entry.IsSpent() {
+				continue
+			}
+			utxo = &restUtxo{
+				Height:   entry.BlockHeight(),
+				amount:   entry.Amount(),
+				pkScript: entry.PkScript(),
+			}
+		}
+
+		bitmap[i/8] |= 1 << uint(i%8)
+		bitmapString[i] = '1'
+		utxos = append(utxos, *utxo)
+	}
+
+	if format == restFormatJSON {
+		for i := range utxos {
+			utxo := &utxos[i]
+			utxo.Value = btcutil.Amount(utxo.amount).ToBTC()
+
+			// Ignore the errors since they only mean the script
+			// could not be parsed, in which case the disassembly
+			// contains [error] and there are no addresses.
+			disbuf, _ := txscript.DisasmString(utxo.pkScript)
+			scriptClass, addrs, reqSigs, _ := txscript.ExtractPkScriptAddrs(
+				utxo.pkScript, s.cfg.ChainParams)
+			addresses := make([]string, len(addrs))
+			for i, addr := range addrs {
+				addresses[i] = addr.EncodeAddress()
+			}
+			utxo.ScriptPubKey = btcjson.ScriptPubKeyResult{
+				Asm:       disbuf,
+				Hex:       hex.EncodeToString(utxo.pkScript),
+				ReqSigs:   int32(reqSigs),
+				Type:      scriptClass.String(),
+				Addresses: addresses,
+			}
+		}
+		return &restGetUtxosResult{
+			ChainHeight:  best.Height,
+			ChainTipHash: best.Hash.String(),
+			Bitmap:       string(bitmapString),
+			Utxos:        utxos,
+		}, nil
+	}
+
+	// The binary format matches the serialization used by Bitcoin Core:
+	// the chain height and tip, the bitmap and the outputs, each preceded
+	// by the unused transaction version and its height.
+	var buf bytes.Buffer
+	var scratch [4]byte
+	binary.LittleEndian.PutUint32(scratch[:], uint32(best.Height))
+	buf.Write(scratch[:])
+	buf.Write(best.Hash[:])
+	if err := wire.WriteVarBytes(&buf, 0, bitmap); err != nil {
+		return nil, err
+	}
+	if err := wire.WriteVarInt(&buf, 0, uint64(len(utxos))); err != nil {
+		return nil, err
+	}
+	for _, utxo := range utxos {
+		binary.LittleEndian.PutUint32(scratch[:], 0)
+		buf.Write(scratch[:])
+		binary.LittleEndian.PutUint32(scratch[:], uint32(utxo.Height))
+		buf.Write(scratch[:])
+		txOut := wire.NewTxOut(utxo.amount, utxo.pkScript)
+		if err := wire.WriteTxOut(&buf, 0, 0, txOut); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// handleRESTMempoolInfo implements the /rest/mempool/info endpoint, which
+// returns the same information as the getmempoolinfo command.
+func handleRESTMempoolInfo(s *rpcServer, param string, format restFormat) (interface{}, error) {
+	if param != "" {
+		return nil, newRESTError(http.StatusNotFound, "Not found")
+	}
+	return handleGetMempoolInfo(s, nil, nil)
+}
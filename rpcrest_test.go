@@ -0,0 +1,104 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestParseRESTPath ensures the output format of REST requests is taken from
+// the extension of the requested path.
+func TestParseRESTPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path   string
+		param  string
+		format restFormat
+	}{
+		{"00ff.json", "00ff", restFormatJSON},
+		{"10/00ff.bin", "10/00ff", restFormatBinary},
+		{"/checkmempool/00ff-1.hex", "/checkmempool/00ff-1", restFormatHex},
+		{".json", "", restFormatJSON},
+		{"00ff", "00ff", ""},
+		{"a.b/00ff", "a.b/00ff", ""},
+	}
+	for _, test := range tests {
+		param, format := parseRESTPath(test.path)
+		if param != test.param || format != test.format {
+			t.Errorf("parseRESTPath(%q): got %q %q, want %q %q",
+				test.path, param, format, test.param, test.format)
+		}
+	}
+}
+
+// TestParseRESTOutpoints ensures the outpoints of getutxos requests are
+// parsed along with the checkmempool flag and malformed requests are rejected
+// with a bad request status.
+func TestParseRESTOutpoints(t *testing.T) {
+	t.Parallel()
+
+	txid := "d0e8b6d4f0f10a63e6bad5ef5b4ab3f59cab7fe1276f6c5bfc0fb1a1a6de6b5b"
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		t.Fatalf("NewHashFromStr: unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		param        string
+		outpoints    []wire.OutPoint
+		checkMempool bool
+		valid        bool
+	}{
+		{
+			param:     "/" + txid + "-0",
+			outpoints: []wire.OutPoint{{Hash: *hash, Index: 0}},
+			valid:     true,
+		},
+		{
+			param: "/checkmempool/" + txid + "-1/" + txid + "-4294967295",
+			outpoints: []wire.OutPoint{{Hash: *hash, Index: 1},
+				{Hash: *hash, Index: 4294967295}},
+			checkMempool: true,
+			valid:        true,
+		},
+		{param: ""},
+		{param: "/checkmempool"},
+		{param: "/" + txid},
+		{param: "/" + txid + "-x"},
+		{param: "/" + txid + "-4294967296"},
+		{param: "/" + txid[:63] + "-0"},
+		{param: strings.Repeat("/"+txid+"-0", restMaxOutpoints+1)},
+	}
+	for _, test := range tests {
+		outpoints, checkMempool, err := parseRESTOutpoints(test.param)
+		if !test.valid {
+			restErr, ok := err.(*restError)
+			if !ok || restErr.status != http.StatusBadRequest {
+				t.Errorf("parseRESTOutpoints(%q): got error %v, "+
+					"want bad request", test.param, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRESTOutpoints(%q): unexpected error: %v",
+				test.param, err)
+			continue
+		}
+		if !reflect.DeepEqual(outpoints, test.outpoints) ||
+			checkMempool != test.checkMempool {
+
+			t.Errorf("parseRESTOutpoints(%q): got %v %v, want %v %v",
+				test.param, outpoints, checkMempool,
+				test.outpoints, test.checkMempool)
+		}
+	}
+}
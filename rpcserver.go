@@ -128,11 +128,13 @@ type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{},
 var rpcHandlers map[string]commandHandler
 var rpcHandlersBeforeInit = map[string]commandHandler{
 	"addnode":               handleAddNode,
+	"clearbanned":           handleClearBanned,
 	"createrawtransaction":  handleCreateRawTransaction,
 	"debuglevel":            handleDebugLevel,
 	"decoderawtransaction":  handleDecodeRawTransaction,
 	"decodescript":          handleDecodeScript,
 	"estimatefee":           handleEstimateFee,
+	"estimatesmartfee":      handleEstimateSmartFee,
 	"generate":              handleGenerate,
 	"getaddednodeinfo":      handleGetAddedNodeInfo,
 	"getbestblock":          handleGetBestBlock,
@@ -152,6 +154,9 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"gethashespersec":       handleGetHashesPerSec,
 	"getheaders":            handleGetHeaders,
 	"getinfo":               handleGetInfo,
+	"getmempoolancestors":   handleGetMempoolAncestors,
+	"getmempooldescendants": handleGetMempoolDescendants,
+	"getmempoolentry":       handleGetMempoolEntry,
 	"getmempoolinfo":        handleGetMempoolInfo,
 	"getmininginfo":         handleGetMiningInfo,
 	"getnettotals":          handleGetNetTotals,
@@ -161,13 +166,19 @@ var rpcHandlersBeforeInit = map[string]commandHandler{
 	"getrawtransaction":     handleGetRawTransaction,
 	"gettxout":              handleGetTxOut,
 	"help":                  handleHelp,
+	"listbanned":            handleListBanned,
 	"node":                  handleNode,
 	"ping":                  handlePing,
+	"prioritisetransaction": handlePrioritiseTransaction,
+	"savemempool":           handleSaveMempool,
 	"searchrawtransactions": handleSearchRawTransactions,
 	"sendrawtransaction":    handleSendRawTransaction,
+	"setban":                handleSetBan,
 	"setgenerate":           handleSetGenerate,
 	"stop":                  handleStop,
 	"submitblock":           handleSubmitBlock,
+	"submitpackage":         handleSubmitPackage,
+	"testmempoolaccept":     handleTestMempoolAccept,
 	"uptime":                handleUptime,
 	"validateaddress":       handleValidateAddress,
 	"verifychain":           handleVerifyChain,
@@ -227,7 +238,6 @@ var rpcAskWallet = map[string]struct{}{
 var rpcUnimplemented = map[string]struct{}{
 	"estimatepriority": {},
 	"getchaintips":     {},
-	"getmempoolentry":  {},
 	"getnetworkinfo":   {},
 	"getwork":          {},
 	"invalidateblock":  {},
@@ -255,6 +265,7 @@ var rpcLimited = map[string]struct{}{
 	"decoderawtransaction":  {},
 	"decodescript":          {},
 	"estimatefee":           {},
+	"estimatesmartfee":      {},
 	"getbestblock":          {},
 	"getbestblockhash":      {},
 	"getblock":              {},
@@ -269,12 +280,17 @@ var rpcLimited = map[string]struct{}{
 	"getinfo":               {},
 	"getnettotals":          {},
 	"getnetworkhashps":      {},
+	"getmempoolancestors":   {},
+	"getmempooldescendants": {},
+	"getmempoolentry":       {},
 	"getrawmempool":         {},
 	"getrawtransaction":     {},
 	"gettxout":              {},
 	"searchrawtransactions": {},
 	"sendrawtransaction":    {},
 	"submitblock":           {},
+	"submitpackage":         {},
+	"testmempoolaccept":     {},
 	"uptime":                {},
 	"validateaddress":       {},
 	"verifymessage":         {},
@@ -508,6 +524,12 @@ func messageToHex(msg wire.Message) (string, error) {
 	return hex.EncodeToString(buf.Bytes()), nil
 }
 
+// handleClearBanned implements the clearbanned command.
+func handleClearBanned(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	s.cfg.ConnMgr.ClearBanned()
+	return nil, nil
+}
+
 // handleCreateRawTransaction handles createrawtransaction commands.
 func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.CreateRawTransactionCmd)
@@ -876,6 +898,54 @@ func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return float64(feeRate), nil
 }
 
+// handleEstimateSmartFee handles estimatesmartfee commands.
+func handleEstimateSmartFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.EstimateSmartFeeCmd)
+
+	if s.cfg.FeeEstimator == nil {
+		return nil, errors.New("Fee estimation disabled")
+	}
+
+	if c.ConfTarget < 1 || c.ConfTarget > mempool.MaxSmartFeeTarget {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid conf_target, must be "+
+				"between 1 and %d", mempool.MaxSmartFeeTarget),
+		}
+	}
+
+	conservative := true
+	if c.EstimateMode != nil {
+		switch *c.EstimateMode {
+		case btcjson.EstimateModeUnset, btcjson.EstimateModeConservative:
+		case btcjson.EstimateModeEconomical:
+			conservative = false
+		default:
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Invalid estimate_mode parameter",
+			}
+		}
+	}
+
+	feeRate, target, err := s.cfg.FeeEstimator.EstimateSmartFee(
+		uint32(c.ConfTarget), conservative)
+	result := &btcjson.EstimateSmartFeeResult{Blocks: int64(target)}
+	if err != nil {
+		result.Errors = []string{err.Error()}
+		return result, nil
+	}
+
+	// Transactions paying less than the mempool minimum fee rate won't be
+	// relayed, so never estimate less than it.
+	estimate := float64(feeRate)
+	if minFeeRate := s.cfg.TxMemPool.MinFeeRate().ToBTC(); estimate < minFeeRate {
+		estimate = minFeeRate
+	}
+	result.FeeRate = &estimate
+	return result, nil
+}
+
 // handleGenerate handles generate commands.
 func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if there are no addresses to pay the
@@ -2317,6 +2387,65 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 	return ret, nil
 }
 
+// mempoolEntriesResult returns the passed mempool entries when the verbose flag
+// is set, or an array of their transaction hashes otherwise.
+func mempoolEntriesResult(entries map[string]*btcjson.GetMempoolEntryResult, verbose *bool) interface{} {
+	if verbose != nil && *verbose {
+		return entries
+	}
+
+	hashStrings := make([]string, 0, len(entries))
+	for hash := range entries {
+		hashStrings = append(hashStrings, hash)
+	}
+	return hashStrings
+}
+
+// handleGetMempoolAncestors implements the getmempoolancestors command.
+func handleGetMempoolAncestors(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolAncestorsCmd)
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	ancestors, err := s.cfg.TxMemPool.MempoolAncestors(txHash)
+	if err != nil {
+		return nil, rpcNoTxInfoError(txHash)
+	}
+	return mempoolEntriesResult(ancestors, c.Verbose), nil
+}
+
+// handleGetMempoolDescendants implements the getmempooldescendants command.
+func handleGetMempoolDescendants(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolDescendantsCmd)
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	descendants, err := s.cfg.TxMemPool.MempoolDescendants(txHash)
+	if err != nil {
+		return nil, rpcNoTxInfoError(txHash)
+	}
+	return mempoolEntriesResult(descendants, c.Verbose), nil
+}
+
+// handleGetMempoolEntry implements the getmempoolentry command.
+func handleGetMempoolEntry(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolEntryCmd)
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	entry, err := s.cfg.TxMemPool.MempoolEntry(txHash)
+	if err != nil {
+		return nil, rpcNoTxInfoError(txHash)
+	}
+	return entry, nil
+}
+
 // handleGetMempoolInfo implements the getmempoolinfo command.
 func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	mempoolTxns := s.cfg.TxMemPool.TxDescs()
@@ -2327,8 +2456,11 @@ func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct
 	}
 
 	ret := &btcjson.GetMempoolInfoResult{
-		Size:  int64(len(mempoolTxns)),
-		Bytes: numBytes,
+		Size:          int64(len(mempoolTxns)),
+		Bytes:         numBytes,
+		MaxMempool:    int64(cfg.MaxMempool) * 1000000,
+		MempoolMinFee: s.cfg.TxMemPool.MinFeeRate().ToBTC(),
+		MinRelayTxFee: cfg.minRelayTxFee.ToBTC(),
 	}
 
 	return ret, nil
@@ -2503,6 +2635,8 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 			BanScore:       int32(p.BanScore()),
 			FeeFilter:      p.FeeFilter(),
 			SyncNode:       statsSnap.ID == syncPeerID,
+			ConnectionType: p.ConnectionType(),
+			MappedAS:       p.MappedAS(),
 		}
 		if p.ToPeer().LastPingNonce() != 0 {
 			wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
@@ -2798,6 +2932,24 @@ func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return help, nil
 }
 
+// handleListBanned implements the listbanned command.
+func handleListBanned(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	now := time.Now()
+	bans := s.cfg.ConnMgr.BannedSubnets()
+	results := make([]btcjson.ListBannedResult, 0, len(bans))
+	for _, ban := range bans {
+		results = append(results, btcjson.ListBannedResult{
+			Address:       ban.Subnet,
+			BanCreated:    ban.Created.Unix(),
+			BannedUntil:   ban.Until.Unix(),
+			BanDuration:   int64(ban.Until.Sub(ban.Created) / time.Second),
+			TimeRemaining: int64(ban.Until.Sub(now) / time.Second),
+			BanReason:     ban.Reason,
+		})
+	}
+	return results, nil
+}
+
 // handlePing implements the ping command.
 func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Ask server to ping \o_
@@ -2811,6 +2963,41 @@ func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return nil, nil
 }
 
+// handlePrioritiseTransaction implements the prioritisetransaction command.
+func handlePrioritiseTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.PrioritiseTransactionCmd)
+
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	// Transactions are no longer prioritised by their priority, so only a
+	// zero priority delta is accepted.
+	if c.PriorityDelta != 0 {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: "Priority is no longer supported, the priority " +
+				"delta must be 0",
+		}
+	}
+
+	s.cfg.TxMemPool.PrioritiseTransaction(txHash, c.FeeDelta)
+	return true, nil
+}
+
+// handleSaveMempool implements the savemempool command.
+func handleSaveMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if err := s.cfg.SaveMempool(); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Unable to save mempool: " + err.Error(),
+		}
+	}
+
+	return nil, nil
+}
+
 // retrievedTx represents a transaction that was either loaded from the
 // transaction memory pool or from the database.  When a transaction is loaded
 // from the database, it is loaded with the raw serialized bytes while the
@@ -3373,6 +3560,66 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 	return tx.Hash().String(), nil
 }
 
+// handleSetBan implements the setban command.
+func handleSetBan(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SetBanCmd)
+
+	ipNet, err := parseBanSubnet(c.Subnet)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCClientInvalidIPOrSubnet,
+			Message: "Invalid IP/Subnet: " + err.Error(),
+		}
+	}
+
+	switch c.SubCmd {
+	case btcjson.SBAdd:
+		// The ban time is either a duration in seconds or, when absolute,
+		// the time the ban ends in seconds since the epoch.  Zero means
+		// the default ban duration.
+		var banTime int64
+		if c.BanTime != nil {
+			banTime = *c.BanTime
+		}
+		if banTime < 0 {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Ban time must not be negative",
+			}
+		}
+		until := time.Now().Add(cfg.BanDuration)
+		switch {
+		case c.Absolute != nil && *c.Absolute:
+			until = time.Unix(banTime, 0)
+		case banTime > 0:
+			until = time.Now().Add(time.Duration(banTime) * time.Second)
+		}
+		if !until.After(time.Now()) {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Ban must end in the future",
+			}
+		}
+		s.cfg.ConnMgr.BanSubnet(ipNet, until, banReasonManual)
+
+	case btcjson.SBRemove:
+		if !s.cfg.ConnMgr.UnbanSubnet(ipNet) {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCClientInvalidIPOrSubnet,
+				Message: "Unban failed. Requested address/subnet was not previously banned.",
+			}
+		}
+
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "invalid subcommand for setban",
+		}
+	}
+
+	return nil, nil
+}
+
 // handleSetGenerate implements the setgenerate command.
 func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.SetGenerateCmd)
@@ -3451,6 +3698,143 @@ func handleSubmitBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return nil, nil
 }
 
+// handleSubmitPackage implements the submitpackage command.
+func handleSubmitPackage(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SubmitPackageCmd)
+
+	// Deserialize all of the transactions of the package.
+	txns, err := decodeRawTxs(c.RawTxs)
+	if err != nil {
+		return nil, err
+	}
+
+	acceptedTxs, err := s.cfg.TxMemPool.ProcessPackage(txns, false)
+	if err != nil {
+		// When the error is a rule error, it means the package was
+		// simply rejected as opposed to something actually going wrong,
+		// so log it as such.  Otherwise, something really did go wrong,
+		// so log it as an actual error.  In both cases, a JSON-RPC
+		// error is returned to the client with the deserialization
+		// error code to match sendrawtransaction.
+		if _, ok := err.(mempool.RuleError); ok {
+			rpcsLog.Debugf("Rejected package: %v", err)
+		} else {
+			rpcsLog.Errorf("Failed to process package: %v", err)
+		}
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "Package rejected: " + err.Error(),
+		}
+	}
+
+	// Generate and relay inventory vectors for all newly accepted
+	// transactions, and notify both websocket and getblocktemplate long
+	// poll clients of them.
+	s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
+	s.NotifyNewTransactions(acceptedTxs)
+
+	// Keep track of the newly accepted transactions of the package so they
+	// can be rebroadcast if they don't make their way into a block.
+	packageTxns := make(map[chainhash.Hash]struct{}, len(txns))
+	for _, tx := range txns {
+		packageTxns[*tx.Hash()] = struct{}{}
+	}
+	for _, txD := range acceptedTxs {
+		if _, ok := packageTxns[*txD.Tx.Hash()]; !ok {
+			continue
+		}
+		iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
+		s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
+	}
+
+	result := &btcjson.SubmitPackageResult{
+		PackageMsg: "success",
+		TxResults:  make(map[string]btcjson.SubmitPackageTxResult, len(txns)),
+	}
+	for _, tx := range txns {
+		entry, err := s.cfg.TxMemPool.MempoolEntry(tx.Hash())
+		if err != nil {
+			return nil, rpcNoTxInfoError(tx.Hash())
+		}
+		result.TxResults[tx.WitnessHash().String()] = btcjson.SubmitPackageTxResult{
+			TxID:  tx.Hash().String(),
+			Vsize: entry.Vsize,
+			Fees:  btcjson.SubmitPackageTxFees{Base: entry.Fee},
+		}
+	}
+	return result, nil
+}
+
+// decodeRawTxs deserializes the passed serialized, hex-encoded transactions.
+func decodeRawTxs(rawTxs []string) ([]*btcutil.Tx, error) {
+	txns := make([]*btcutil.Tx, 0, len(rawTxs))
+	for _, hexStr := range rawTxs {
+		if len(hexStr)%2 != 0 {
+			hexStr = "0" + hexStr
+		}
+		serializedTx, err := hex.DecodeString(hexStr)
+		if err != nil {
+			return nil, rpcDecodeHexError(hexStr)
+		}
+		var msgTx wire.MsgTx
+		err = msgTx.Deserialize(bytes.NewReader(serializedTx))
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCDeserialization,
+				Message: "TX decode failed: " + err.Error(),
+			}
+		}
+		txns = append(txns, btcutil.NewTx(&msgTx))
+	}
+	return txns, nil
+}
+
+// handleTestMempoolAccept implements the testmempoolaccept command.
+func handleTestMempoolAccept(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.TestMempoolAcceptCmd)
+
+	if len(c.RawTxs) == 0 || len(c.RawTxs) > mempool.MaxPackageCount {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Array must contain between 1 and "+
+				"%d transactions", mempool.MaxPackageCount),
+		}
+	}
+	txns, err := decodeRawTxs(c.RawTxs)
+	if err != nil {
+		return nil, err
+	}
+
+	// The transactions are tested in order against the current contents of
+	// the memory pool, so a transaction may spend the outputs of the ones
+	// before it which would be accepted.
+	testResults := s.cfg.TxMemPool.TestAcceptPackage(txns)
+	results := make([]btcjson.TestMempoolAcceptResult, 0, len(txns))
+	for i, tx := range txns {
+		result := btcjson.TestMempoolAcceptResult{
+			TxID:  tx.Hash().String(),
+			WTxID: tx.WitnessHash().String(),
+			Vsize: int32(mempool.GetTxVirtualSize(tx)),
+		}
+		if err := testResults[i].Err; err != nil {
+			// Errors which are not rule errors mean something
+			// actually went wrong, so log them as such.
+			if _, ok := err.(mempool.RuleError); !ok {
+				rpcsLog.Errorf("Failed to test transaction %v: %v",
+					tx.Hash(), err)
+			}
+			result.RejectReason = err.Error()
+		} else {
+			result.Allowed = true
+			result.Fees = &btcjson.TestMempoolAcceptFees{
+				Base: btcutil.Amount(testResults[i].Fee).ToBTC(),
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 // handleUptime implements the uptime command.
 func handleUptime(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return time.Now().Unix() - s.cfg.StartupTime, nil
@@ -3718,6 +4102,12 @@ func (s *rpcServer) NotifyNewTransactions(txns []*mempool.TxDesc) {
 	}
 }
 
+// NotifyRemovedTransaction notifies websocket clients that the mempool removed
+// the passed transaction on its own for the passed reason.
+func (s *rpcServer) NotifyRemovedTransaction(tx *btcutil.Tx, reason mempool.RemovalReason) {
+	s.ntfnMgr.NotifyMempoolTxRemoved(tx, reason)
+}
+
 // limitConnections responds with a 503 service unavailable and returns true if
 // adding another client would exceed the maximum allow RPC clients.
 //
@@ -4077,6 +4467,22 @@ func (s *rpcServer) Start() {
 		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin)
 	})
 
+	// REST endpoints, which are served without authentication.
+	if cfg.REST {
+		rpcServeMux.HandleFunc("/rest/", func(w http.ResponseWriter, r *http.Request) {
+			// Limit the number of connections to max allowed.
+			if s.limitConnections(w, r.RemoteAddr) {
+				return
+			}
+
+			// Keep track of the number of connected clients.
+			s.incrementClients()
+			defer s.decrementClients()
+
+			s.handleREST(w, r)
+		})
+	}
+
 	for _, listener := range s.cfg.Listeners {
 		s.wg.Add(1)
 		go func(listener net.Listener) {
@@ -4133,6 +4539,15 @@ type rpcserverPeer interface {
 	// FeeFilter returns the requested current minimum fee rate for which
 	// transactions should be announced.
 	FeeFilter() int64
+
+	// ConnectionType returns the type of the connection with the peer as
+	// reported by the getpeerinfo command.
+	ConnectionType() string
+
+	// MappedAS returns the number of the autonomous system which announces
+	// the address of the peer according to the ASN map, or 0 when it is
+	// not mapped.
+	MappedAS() uint32
 }
 
 // rpcserverConnManager represents a connection manager for use with the RPC
@@ -4194,6 +4609,20 @@ type rpcserverConnManager interface {
 	// RelayTransactions generates and relays inventory vectors for all of
 	// the passed transactions to all connected peers.
 	RelayTransactions(txns []*mempool.TxDesc)
+
+	// BanSubnet bans the passed subnet until the passed time for the
+	// passed reason and disconnects all connected peers within it.
+	BanSubnet(ipNet *net.IPNet, until time.Time, reason string)
+
+	// UnbanSubnet removes the ban of the passed subnet.  It returns false
+	// when the subnet is not banned.
+	UnbanSubnet(ipNet *net.IPNet) bool
+
+	// BannedSubnets returns the bans which have not expired.
+	BannedSubnets() []banEntry
+
+	// ClearBanned removes all bans.
+	ClearBanned()
 }
 
 // rpcserverSyncManager represents a sync manager for use with the RPC server.
@@ -4254,6 +4683,10 @@ type rpcserverConfig struct {
 	// TxMemPool defines the transaction memory pool to interact with.
 	TxMemPool *mempool.TxPool
 
+	// SaveMempool writes the transactions in the memory pool to the
+	// mempool dump in the data directory.
+	SaveMempool func() error
+
 	// These fields allow the RPC server to interface with mining.
 	//
 	// Generator produces block templates and the CPUMiner solves them using
@@ -40,6 +40,9 @@ var helpDescsEnUS = map[string]string{
 	"node-target":        "Either the IP address and port of the peer to operate on, or a valid peer ID.",
 	"node-connectsubcmd": "'perm' to make the connected peer a permanent one, 'temp' to try a single connect to a peer",
 
+	// ClearBannedCmd help.
+	"clearbanned--synopsis": "Removes all banned IP addresses and subnets.",
+
 	// TransactionInput help.
 	"transactioninput-txid": "The hash of the input transaction",
 	"transactioninput-vout": "The specific output of the input transaction to redeem",
@@ -124,6 +127,24 @@ var helpDescsEnUS = map[string]string{
 	"estimatefee--result0": "Estimated fee per kilobyte in satoshis for a block to " +
 		"be mined in the next NumBlocks blocks.",
 
+	// EstimateSmartFeeCmd help.
+	"estimatesmartfee--synopsis": "Estimate the fee rate in bitcoins per kilobyte " +
+		"required for a transaction to begin confirmation within a certain " +
+		"number of blocks.",
+	"estimatesmartfee-conftarget": "The number of blocks within which the " +
+		"transaction should begin confirmation (1 to 1008)",
+	"estimatesmartfee-estimatemode": "Either ECONOMICAL, which only considers " +
+		"recent confirmations, or CONSERVATIVE, which also considers " +
+		"confirmations over longer periods and is less likely to estimate too low",
+
+	// EstimateSmartFeeResult help.
+	"estimatesmartfeeresult-feerate": "The estimated fee rate in bitcoins per kilobyte " +
+		"(only present when an estimate was found)",
+	"estimatesmartfeeresult-errors": "Errors encountered while estimating " +
+		"(only present when no estimate was found)",
+	"estimatesmartfeeresult-blocks": "The number of blocks the estimate is for, " +
+		"which is adjusted to what the estimator has enough history for",
+
 	// GenerateCmd help
 	"generate--synopsis": "Generates a set number of blocks (simnet or regtest only) and returns a JSON\n" +
 		" array of their hashes.",
@@ -403,12 +424,53 @@ var helpDescsEnUS = map[string]string{
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
+	// GetMempoolAncestorsCmd help.
+	"getmempoolancestors--synopsis":   "Returns the transactions in the memory pool the passed transaction depends on.",
+	"getmempoolancestors-txid":        "The hash of the transaction in the memory pool",
+	"getmempoolancestors-verbose":     "Returns JSON object when true or an array of transaction hashes when false",
+	"getmempoolancestors--condition0": "verbose=false",
+	"getmempoolancestors--condition1": "verbose=true",
+	"getmempoolancestors--result0":    "Array of transaction hashes",
+
+	// GetMempoolDescendantsCmd help.
+	"getmempooldescendants--synopsis":   "Returns the transactions in the memory pool which depend on the passed transaction.",
+	"getmempooldescendants-txid":        "The hash of the transaction in the memory pool",
+	"getmempooldescendants-verbose":     "Returns JSON object when true or an array of transaction hashes when false",
+	"getmempooldescendants--condition0": "verbose=false",
+	"getmempooldescendants--condition1": "verbose=true",
+	"getmempooldescendants--result0":    "Array of transaction hashes",
+
+	// GetMempoolEntryCmd help.
+	"getmempoolentry--synopsis": "Returns information about a transaction in the memory pool.",
+	"getmempoolentry-txid":      "The hash of the transaction in the memory pool",
+
+	// GetMempoolEntryResult help.
+	"getmempoolentryresult-size":               "Transaction size in bytes",
+	"getmempoolentryresult-vsize":              "The virtual size of the transaction",
+	"getmempoolentryresult-fee":                "Transaction fee in bitcoins",
+	"getmempoolentryresult-modifiedfee":        "Transaction fee in bitcoins used for mining and eviction",
+	"getmempoolentryresult-time":               "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getmempoolentryresult-height":             "Block height when transaction entered the pool",
+	"getmempoolentryresult-startingpriority":   "Priority when transaction entered the pool",
+	"getmempoolentryresult-currentpriority":    "Current priority",
+	"getmempoolentryresult-descendantcount":    "Number of transactions in the pool which depend on this one, including itself",
+	"getmempoolentryresult-descendantsize":     "Virtual size of the transactions in the pool which depend on this one, including itself",
+	"getmempoolentryresult-descendantfees":     "Fees in bitcoins of the transactions in the pool which depend on this one, including itself",
+	"getmempoolentryresult-ancestorcount":      "Number of transactions in the pool this one depends on, including itself",
+	"getmempoolentryresult-ancestorsize":       "Virtual size of the transactions in the pool this one depends on, including itself",
+	"getmempoolentryresult-ancestorfees":       "Fees in bitcoins of the transactions in the pool this one depends on, including itself",
+	"getmempoolentryresult-depends":            "Unconfirmed transactions used as inputs for this transaction",
+	"getmempoolentryresult-bip125-replaceable": "Whether the transaction can be replaced as defined by BIP125, either because it signals replaceability or one of its unconfirmed ancestors does",
+
 	// GetMempoolInfoCmd help.
 	"getmempoolinfo--synopsis": "Returns memory pool information",
 
 	// GetMempoolInfoResult help.
-	"getmempoolinforesult-bytes": "Size in bytes of the mempool",
-	"getmempoolinforesult-size":  "Number of transactions in the mempool",
+	"getmempoolinforesult-bytes":         "Size in bytes of the mempool",
+	"getmempoolinforesult-size":          "Number of transactions in the mempool",
+	"getmempoolinforesult-maxmempool":    "Maximum size in bytes of the mempool, after which the transactions with the lowest fee rates are evicted",
+	"getmempoolinforesult-mempoolminfee": "Minimum fee rate in BTC/kB for transactions to be accepted, which is raised above minrelaytxfee after the mempool was full",
+	"getmempoolinforesult-minrelaytxfee": "Minimum relay fee rate in BTC/kB for transactions",
 
 	// GetMiningInfoResult help.
 	"getmininginforesult-blocks":             "Height of the latest best block",
@@ -442,40 +504,44 @@ var helpDescsEnUS = map[string]string{
 	"getnettotalsresult-timemillis":     "Number of milliseconds since 1 Jan 1970 GMT",
 
 	// GetPeerInfoResult help.
-	"getpeerinforesult-id":             "A unique node ID",
-	"getpeerinforesult-addr":           "The ip address and port of the peer",
-	"getpeerinforesult-addrlocal":      "Local address",
-	"getpeerinforesult-services":       "Services bitmask which represents the services supported by the peer",
-	"getpeerinforesult-relaytxes":      "Peer has requested transactions be relayed to it",
-	"getpeerinforesult-lastsend":       "Time the last message was received in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-lastrecv":       "Time the last message was sent in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-bytessent":      "Total bytes sent",
-	"getpeerinforesult-bytesrecv":      "Total bytes received",
-	"getpeerinforesult-conntime":       "Time the connection was made in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-timeoffset":     "The time offset of the peer",
-	"getpeerinforesult-pingtime":       "Number of microseconds the last ping took",
-	"getpeerinforesult-pingwait":       "Number of microseconds a queued ping has been waiting for a response",
-	"getpeerinforesult-version":        "The protocol version of the peer",
-	"getpeerinforesult-subver":         "The user agent of the peer",
-	"getpeerinforesult-inbound":        "Whether or not the peer is an inbound connection",
-	"getpeerinforesult-startingheight": "The latest block height the peer knew about when the connection was established",
-	"getpeerinforesult-currentheight":  "The current height of the peer",
-	"getpeerinforesult-banscore":       "The ban score",
-	"getpeerinforesult-feefilter":      "The requested minimum fee a transaction must have to be announced to the peer",
-	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
+	"getpeerinforesult-id":              "A unique node ID",
+	"getpeerinforesult-addr":            "The ip address and port of the peer",
+	"getpeerinforesult-addrlocal":       "Local address",
+	"getpeerinforesult-services":        "Services bitmask which represents the services supported by the peer",
+	"getpeerinforesult-relaytxes":       "Peer has requested transactions be relayed to it",
+	"getpeerinforesult-lastsend":        "Time the last message was received in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-lastrecv":        "Time the last message was sent in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-bytessent":       "Total bytes sent",
+	"getpeerinforesult-bytesrecv":       "Total bytes received",
+	"getpeerinforesult-conntime":        "Time the connection was made in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-timeoffset":      "The time offset of the peer",
+	"getpeerinforesult-pingtime":        "Number of microseconds the last ping took",
+	"getpeerinforesult-pingwait":        "Number of microseconds a queued ping has been waiting for a response",
+	"getpeerinforesult-version":         "The protocol version of the peer",
+	"getpeerinforesult-subver":          "The user agent of the peer",
+	"getpeerinforesult-inbound":         "Whether or not the peer is an inbound connection",
+	"getpeerinforesult-startingheight":  "The latest block height the peer knew about when the connection was established",
+	"getpeerinforesult-currentheight":   "The current height of the peer",
+	"getpeerinforesult-banscore":        "The ban score",
+	"getpeerinforesult-feefilter":       "The requested minimum fee a transaction must have to be announced to the peer",
+	"getpeerinforesult-syncnode":        "Whether or not the peer is the sync peer",
+	"getpeerinforesult-connection_type": "The type of the connection (inbound, outbound-full-relay, block-relay-only or manual)",
+	"getpeerinforesult-mapped_as":       "The number of the autonomous system which announces the address of the peer according to the ASN map (--asmap), omitted when it is not mapped",
 
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
 
 	// GetRawMempoolVerboseResult help.
-	"getrawmempoolverboseresult-size":             "Transaction size in bytes",
-	"getrawmempoolverboseresult-fee":              "Transaction fee in bitcoins",
-	"getrawmempoolverboseresult-time":             "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
-	"getrawmempoolverboseresult-height":           "Block height when transaction entered the pool",
-	"getrawmempoolverboseresult-startingpriority": "Priority when transaction entered the pool",
-	"getrawmempoolverboseresult-currentpriority":  "Current priority",
-	"getrawmempoolverboseresult-depends":          "Unconfirmed transactions used as inputs for this transaction",
-	"getrawmempoolverboseresult-vsize":            "The virtual size of a transaction",
+	"getrawmempoolverboseresult-size":               "Transaction size in bytes",
+	"getrawmempoolverboseresult-fee":                "Transaction fee in bitcoins",
+	"getrawmempoolverboseresult-modifiedfee":        "Transaction fee in bitcoins adjusted by its fee delta, which is used for mining and eviction",
+	"getrawmempoolverboseresult-time":               "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getrawmempoolverboseresult-height":             "Block height when transaction entered the pool",
+	"getrawmempoolverboseresult-startingpriority":   "Priority when transaction entered the pool",
+	"getrawmempoolverboseresult-currentpriority":    "Current priority",
+	"getrawmempoolverboseresult-depends":            "Unconfirmed transactions used as inputs for this transaction",
+	"getrawmempoolverboseresult-vsize":              "The virtual size of a transaction",
+	"getrawmempoolverboseresult-bip125-replaceable": "Whether the transaction can be replaced as defined by BIP125, either because it signals replaceability or one of its unconfirmed ancestors does",
 
 	// GetRawMempoolCmd help.
 	"getrawmempool--synopsis":   "Returns information about all of the transactions currently in the memory pool.",
@@ -514,10 +580,32 @@ var helpDescsEnUS = map[string]string{
 	"help--result0":    "List of commands",
 	"help--result1":    "Help for specified command",
 
+	// ListBannedCmd help.
+	"listbanned--synopsis": "Returns the banned IP addresses and subnets.",
+
+	// ListBannedResult help.
+	"listbannedresult-address":        "The banned IP address or subnet",
+	"listbannedresult-ban_created":    "The time the ban was created in seconds since 1 Jan 1970 GMT",
+	"listbannedresult-banned_until":   "The time the ban ends in seconds since 1 Jan 1970 GMT",
+	"listbannedresult-ban_duration":   "The duration of the ban in seconds",
+	"listbannedresult-time_remaining": "The number of seconds until the ban ends",
+	"listbannedresult-ban_reason":     "The reason for the ban",
+
 	// PingCmd help.
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// PrioritiseTransactionCmd help.
+	"prioritisetransaction--synopsis": "Adds a fee delta to the fee of a transaction used when deciding whether to accept it to the memory pool, when evicting transactions from a full memory pool and when selecting transactions for block templates.\n" +
+		"The transaction need not be in the memory pool yet, and the fee it actually pays is not changed.",
+	"prioritisetransaction-txid":          "The hash of the transaction",
+	"prioritisetransaction-prioritydelta": "No longer supported, must be 0",
+	"prioritisetransaction-feedelta":      "The fee delta in satoshi to add to the fee of the transaction, which may be negative",
+	"prioritisetransaction--result0":      "Always true",
+
+	// SaveMempoolCmd help.
+	"savemempool--synopsis": "Writes the transactions in the memory pool to the mempool dump in the data directory, which is loaded again on startup.",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
@@ -541,6 +629,13 @@ var helpDescsEnUS = map[string]string{
 	"sendrawtransaction-allowhighfees": "Whether or not to allow insanely high fees (btcd does not yet implement this parameter, so it has no effect)",
 	"sendrawtransaction--result0":      "The hash of the transaction",
 
+	// SetBanCmd help.
+	"setban--synopsis": "Bans or unbans an IP address or subnet.  Connected peers within a newly banned subnet are disconnected.",
+	"setban-subnet":    "The IP address or subnet in CIDR notation (e.g. 192.168.0.0/24) to operate on",
+	"setban-subcmd":    "'add' to ban the IP address or subnet, or 'remove' to unban it",
+	"setban-bantime":   "The number of seconds to ban for, or 0 for the default ban duration (--banduration)",
+	"setban-absolute":  "Whether or not bantime is the time the ban ends in seconds since 1 Jan 1970 GMT",
+
 	// SetGenerateCmd help.
 	"setgenerate--synopsis":    "Set the server to generate coins (mine) or not.",
 	"setgenerate-generate":     "Use true to enable generation, false to disable it",
@@ -561,6 +656,44 @@ var helpDescsEnUS = map[string]string{
 	"submitblock--condition1": "Block rejected",
 	"submitblock--result1":    "The reason the block was rejected",
 
+	// SubmitPackageCmd help.
+	"submitpackage--synopsis": "Submits a package of serialized, hex-encoded transactions to the local peer and relays them to the network.\n" +
+		"The package must consist of a child along with its parents, sorted so every transaction comes after the transactions it spends.\n" +
+		"Transactions paying too low a fee on their own are accepted when the transactions of the package pay enough fees together.",
+	"submitpackage-rawtxs": "Serialized, hex-encoded signed transactions of the package",
+
+	// SubmitPackageResult help.
+	"submitpackageresult-package_msg":       "The result of the package validation, 'success' when the package was accepted",
+	"submitpackageresult-tx-results":        "The results of the transactions of the package",
+	"submitpackageresult-tx-results--key":   "wtxid",
+	"submitpackageresult-tx-results--value": "An object describing the result of a transaction of the package",
+	"submitpackageresult-tx-results--desc":  "The results of the transactions of the package keyed by their witness hashes",
+
+	// SubmitPackageTxResult help.
+	"submitpackagetxresult-txid":  "The hash of the transaction",
+	"submitpackagetxresult-vsize": "The virtual size of the transaction",
+	"submitpackagetxresult-fees":  "The fees of the transaction",
+
+	// SubmitPackageTxFees help.
+	"submitpackagetxfees-base": "The fee of the transaction in BTC",
+
+	// TestMempoolAcceptCmd help.
+	"testmempoolaccept--synopsis": "Tests whether serialized, hex-encoded transactions would be accepted to the memory pool without adding or relaying them.\n" +
+		"The transactions are tested in order against the current contents of the memory pool, so a transaction may spend the outputs of the transactions before it which would be accepted.\n" +
+		"Every transaction must pay the required fees on its own, and transactions replacing ones in the memory pool are rejected when more than one transaction is tested.",
+	"testmempoolaccept-rawtxs": "Serialized, hex-encoded signed transactions to test, sorted so every transaction comes after the transactions it spends",
+
+	// TestMempoolAcceptResult help.
+	"testmempoolacceptresult-txid":          "The hash of the transaction",
+	"testmempoolacceptresult-wtxid":         "The witness hash of the transaction",
+	"testmempoolacceptresult-allowed":       "Whether or not the transaction would be accepted to the memory pool",
+	"testmempoolacceptresult-vsize":         "The virtual size of the transaction",
+	"testmempoolacceptresult-fees":          "The fees of the transaction (only when allowed is true)",
+	"testmempoolacceptresult-reject-reason": "The reason the transaction would be rejected (only when allowed is false)",
+
+	// TestMempoolAcceptFees help.
+	"testmempoolacceptfees-base": "The fee of the transaction in BTC",
+
 	// ValidateAddressResult help.
 	"validateaddresschainresult-isvalid": "Whether or not the address is valid",
 	"validateaddresschainresult-address": "The bitcoin address (only when isvalid is true)",
@@ -675,11 +808,13 @@ var helpDescsEnUS = map[string]string{
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
 	"addnode":               nil,
+	"clearbanned":           nil,
 	"createrawtransaction":  {(*string)(nil)},
 	"debuglevel":            {(*string)(nil), (*string)(nil)},
 	"decoderawtransaction":  {(*btcjson.TxRawDecodeResult)(nil)},
 	"decodescript":          {(*btcjson.DecodeScriptResult)(nil)},
 	"estimatefee":           {(*float64)(nil)},
+	"estimatesmartfee":      {(*btcjson.EstimateSmartFeeResult)(nil)},
 	"generate":              {(*[]string)(nil)},
 	"getaddednodeinfo":      {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
 	"getbestblock":          {(*btcjson.GetBestBlockResult)(nil)},
@@ -699,6 +834,9 @@ var rpcResultTypes = map[string][]interface{}{
 	"gethashespersec":       {(*float64)(nil)},
 	"getheaders":            {(*[]string)(nil)},
 	"getinfo":               {(*btcjson.InfoChainResult)(nil)},
+	"getmempoolancestors":   {(*[]string)(nil), (*btcjson.GetMempoolEntryResult)(nil)},
+	"getmempooldescendants": {(*[]string)(nil), (*btcjson.GetMempoolEntryResult)(nil)},
+	"getmempoolentry":       {(*btcjson.GetMempoolEntryResult)(nil)},
 	"getmempoolinfo":        {(*btcjson.GetMempoolInfoResult)(nil)},
 	"getmininginfo":         {(*btcjson.GetMiningInfoResult)(nil)},
 	"getnettotals":          {(*btcjson.GetNetTotalsResult)(nil)},
@@ -709,12 +847,18 @@ var rpcResultTypes = map[string][]interface{}{
 	"gettxout":              {(*btcjson.GetTxOutResult)(nil)},
 	"node":                  nil,
 	"help":                  {(*string)(nil), (*string)(nil)},
+	"listbanned":            {(*[]btcjson.ListBannedResult)(nil)},
 	"ping":                  nil,
+	"prioritisetransaction": {(*bool)(nil)},
+	"savemempool":           nil,
 	"searchrawtransactions": {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
 	"sendrawtransaction":    {(*string)(nil)},
+	"setban":                nil,
 	"setgenerate":           nil,
 	"stop":                  {(*string)(nil)},
 	"submitblock":           {nil, (*string)(nil)},
+	"submitpackage":         {(*btcjson.SubmitPackageResult)(nil)},
+	"testmempoolaccept":     {(*[]btcjson.TestMempoolAcceptResult)(nil)},
 	"uptime":                {(*int64)(nil)},
 	"validateaddress":       {(*btcjson.ValidateAddressChainResult)(nil)},
 	"verifychain":           {(*bool)(nil)},
@@ -25,6 +25,7 @@ import (
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -246,6 +247,26 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *btcutil.Tx, isNew bool) {
 	}
 }
 
+// NotifyMempoolTxRemoved passes a transaction the mempool removed on its own to
+// the notification manager for transaction notification processing.
+func (m *wsNotificationManager) NotifyMempoolTxRemoved(tx *btcutil.Tx,
+	reason mempool.RemovalReason) {
+
+	n := &notificationTxRemovedFromMempool{
+		tx:     tx,
+		reason: reason,
+	}
+
+	// As NotifyMempoolTxRemoved will be called by mempool and the RPC
+	// server may no longer be running, use a select statement to unblock
+	// enqueuing the notification once the RPC server has begun shutting
+	// down.
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+	}
+}
+
 // wsClientFilter tracks relevant addresses for each websocket client for
 // the `rescanblocks` extension. It is modified by the `loadtxfilter` command.
 //
@@ -451,6 +472,10 @@ type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *btcutil.Tx
 }
+type notificationTxRemovedFromMempool struct {
+	tx     *btcutil.Tx
+	reason mempool.RemovalReason
+}
 
 // Notification control requests
 type notificationRegisterClient wsClient
@@ -539,6 +564,12 @@ out:
 				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
 				m.notifyRelevantTxAccepted(n.tx, clients)
 
+			case *notificationTxRemovedFromMempool:
+				if len(txNotifications) != 0 {
+					m.notifyTxRemoved(txNotifications, n.tx,
+						n.reason)
+				}
+
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
 				blockNotifications[wsc.quit] = wsc
@@ -868,6 +899,24 @@ func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClie
 	}
 }
 
+// notifyTxRemoved notifies websocket clients that have registered for updates
+// when new transactions are added to the memory pool that the memory pool
+// removed a transaction on its own.
+func (m *wsNotificationManager) notifyTxRemoved(clients map[chan struct{}]*wsClient,
+	tx *btcutil.Tx, reason mempool.RemovalReason) {
+
+	ntfn := btcjson.NewTxRemovedNtfn(tx.Hash().String(), reason.String())
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal tx removed notification: %v",
+			err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // RegisterSpentRequests requests a notification when each of the passed
 // outpoints is confirmed spent (contained in a block connected to the main
 // chain) for the passed websocket client.  The request is automatically
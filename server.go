@@ -57,6 +57,21 @@ const (
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
 	connectionRetryInterval = time.Second * 5
+
+	// maxCmpctBlockDepth is the maximum depth from the best chain tip of a
+	// block which will be served as a cmpctblock message.  Deeper blocks
+	// are served in full since the peer is unlikely to have their
+	// transactions in its memory pool.
+	maxCmpctBlockDepth = 5
+
+	// maxBlockTxnDepth is the maximum depth from the best chain tip of a
+	// block for which getblocktxn requests are answered.  Requests for
+	// deeper blocks are answered with the full block.
+	maxBlockTxnDepth = 10
+
+	// mempoolExpiryInterval is the interval between sweeps of the memory
+	// pool for transactions which have expired.
+	mempoolExpiryInterval = 10 * time.Minute
 )
 
 var (
@@ -94,6 +109,28 @@ func (oa *onionAddr) Network() string {
 // Ensure onionAddr implements the net.Addr interface.
 var _ net.Addr = (*onionAddr)(nil)
 
+// i2pAddr implements the net.Addr interface and represents an I2P address.
+type i2pAddr struct {
+	addr string
+}
+
+// String returns the I2P address.
+//
+// This is part of the net.Addr interface.
+func (ia *i2pAddr) String() string {
+	return ia.addr
+}
+
+// Network returns "i2p".
+//
+// This is part of the net.Addr interface.
+func (ia *i2pAddr) Network() string {
+	return "i2p"
+}
+
+// Ensure i2pAddr implements the net.Addr interface.
+var _ net.Addr = (*i2pAddr)(nil)
+
 // simpleAddr implements the net.Addr interface with two struct fields
 type simpleAddr struct {
 	net, addr string
@@ -151,13 +188,19 @@ type updatePeerHeightsMsg struct {
 }
 
 // peerState maintains state of inbound, persistent, outbound peers as well
-// as banned peers and outbound groups.
+// as outbound groups, banned hosts which are not IP addresses and the state
+// used to detect a stale chain tip.
 type peerState struct {
 	inboundPeers    map[int32]*serverPeer
 	outboundPeers   map[int32]*serverPeer
 	persistentPeers map[int32]*serverPeer
-	banned          map[string]time.Time
 	outboundGroups  map[string]int
+	staleTip        staleTipState
+
+	// bannedHosts houses the time the bans of misbehaving peers on overlay
+	// networks such as Tor and I2P end, keyed by their host.  Their hosts
+	// are not IP addresses, so they can't be added to the ban list.
+	bannedHosts map[string]time.Time
 }
 
 // Count returns the count of all known peers.
@@ -205,8 +248,13 @@ type server struct {
 	shutdownSched int32
 	startupTime   int64
 
+	// mempoolLoaded is set once the mempool dump has been loaded, after
+	// which the memory pool may be saved.  It must only be used atomically.
+	mempoolLoaded int32
+
 	chainParams          *chaincfg.Params
 	addrManager          *addrmgr.AddrManager
+	banList              *banList
 	connManager          *connmgr.ConnManager
 	sigCache             *txscript.SigCache
 	hashCache            *txscript.HashCache
@@ -219,6 +267,7 @@ type server struct {
 	newPeers             chan *serverPeer
 	donePeers            chan *serverPeer
 	banPeers             chan *serverPeer
+	targetOutbound       int
 	query                chan interface{}
 	relayInv             chan relayMsg
 	broadcast            chan broadcastMsg
@@ -242,23 +291,42 @@ type server struct {
 	// the mempool before they are mined into blocks.
 	feeEstimator *mempool.FeeEstimator
 
+	// zmqNotifier publishes notifications to ZMQ subscribers.  It is nil
+	// when no ZMQ endpoints are configured.
+	zmqNotifier *zmqNotifier
+
 	// cfCheckptCaches stores a cached slice of filter headers for cfcheckpt
 	// messages for each filter type.
 	cfCheckptCaches    map[wire.FilterType][]cfHeaderKV
 	cfCheckptCachesMtx sync.RWMutex
+
+	// v1Fallback houses the addresses of permanent peers whose v2
+	// handshake failed so the retry of the connection uses the v1
+	// transport.
+	v1Fallback    map[string]struct{}
+	v1FallbackMtx sync.Mutex
+
+	// evictionSalt is the secret salt used to key the network groups of
+	// inbound peers when choosing which of them to protect from eviction.
+	evictionSalt uint64
 }
 
 // serverPeer extends the peer to maintain state shared by the server and
 // the blockmanager.
 type serverPeer struct {
 	// The following variables must only be used atomically
-	feeFilter int64
+	feeFilter     int64
+	lastBlockTime int64 // Unix time the peer last relayed a new block.
+	lastTxTime    int64 // Unix time the peer last relayed a new tx.
 
 	*peer.Peer
 
 	connReq        *connmgr.ConnReq
 	server         *server
 	persistent     bool
+	blockRelayOnly bool
+	feeler         bool
+	manual         bool
 	continueHash   *chainhash.Hash
 	relayMtx       sync.Mutex
 	disableRelayTx bool
@@ -271,6 +339,13 @@ type serverPeer struct {
 	// The following chans are used to sync blockmanager and server.
 	txProcessed    chan struct{}
 	blockProcessed chan struct{}
+
+	// sentFeeFilter is the minimum fee rate last sent to the peer in a
+	// feefilter message and nextFeeFilter is the time after which it is
+	// sent the current one.  They are only used by the peerHandler
+	// goroutine.
+	sentFeeFilter int64
+	nextFeeFilter time.Time
 }
 
 // newServerPeer returns a new serverPeer instance. The peer needs to be set by
@@ -296,14 +371,14 @@ func (sp *serverPeer) newestBlock() (*chainhash.Hash, int32, error) {
 
 // addKnownAddresses adds the given addresses to the set of known addresses to
 // the peer to prevent sending duplicate addresses.
-func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddress) {
+func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddressV2) {
 	for _, na := range addresses {
 		sp.knownAddresses[addrmgr.NetAddressKey(na)] = struct{}{}
 	}
 }
 
 // addressKnown true if the given address is already known to the peer.
-func (sp *serverPeer) addressKnown(na *wire.NetAddress) bool {
+func (sp *serverPeer) addressKnown(na *wire.NetAddressV2) bool {
 	_, exists := sp.knownAddresses[addrmgr.NetAddressKey(na)]
 	return exists
 }
@@ -321,23 +396,46 @@ func (sp *serverPeer) setDisableRelayTx(disable bool) {
 // It is safe for concurrent access.
 func (sp *serverPeer) relayTxDisabled() bool {
 	sp.relayMtx.Lock()
-	isDisabled := sp.disableRelayTx
+	isDisabled := sp.disableRelayTx || sp.blockRelayOnly
 	sp.relayMtx.Unlock()
 
 	return isDisabled
 }
 
-// pushAddrMsg sends an addr message to the connected peer using the provided
-// addresses.
-func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
-	// Filter addresses already known to the peer.
-	addrs := make([]*wire.NetAddress, 0, len(addresses))
+// pushAddrMsg sends an addrv2 message to the connected peer using the provided
+// addresses when the peer signalled support for it, or an addr message
+// otherwise.
+func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddressV2) {
+	// Filter addresses already known to the peer.  Peers which don't
+	// support addrv2 can only be sent the addresses which can be
+	// represented by an addr message.
+	wantsAddrV2 := sp.WantsAddrV2()
+	addrs := make([]*wire.NetAddressV2, 0, len(addresses))
 	for _, addr := range addresses {
-		if !sp.addressKnown(addr) {
-			addrs = append(addrs, addr)
+		if sp.addressKnown(addr) {
+			continue
+		}
+		if !wantsAddrV2 && addr.ToLegacy() == nil {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+
+	var known []*wire.NetAddressV2
+	var err error
+	if wantsAddrV2 {
+		known, err = sp.PushAddrV2Msg(addrs)
+	} else {
+		legacyAddrs := make([]*wire.NetAddress, 0, len(addrs))
+		for _, addr := range addrs {
+			legacyAddrs = append(legacyAddrs, addr.ToLegacy())
+		}
+		var sent []*wire.NetAddress
+		sent, err = sp.PushAddrMsg(legacyAddrs)
+		for _, na := range sent {
+			known = append(known, wire.NetAddressV2FromLegacy(na))
 		}
 	}
-	known, err := sp.PushAddrMsg(addrs)
 	if err != nil {
 		peerLog.Errorf("Can't push address message to %s: %v", sp.Peer, err)
 		sp.Disconnect()
@@ -454,14 +552,26 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 			return nil
 		}
 
+		// Feeler connections are only made to test the address, so
+		// mark it as good and disconnect now that it is known to work.
+		if sp.feeler {
+			peerLog.Debugf("Feeler connection to %v succeeded", sp)
+			addrManager.Good(remoteAddr)
+			sp.Disconnect()
+			return nil
+		}
+
 		// Advertise the local address when the server accepts incoming
 		// connections and it believes itself to be close to the best known tip.
-		if !cfg.DisableListen && sp.server.syncManager.IsCurrent() {
+		// Addresses are never relayed with block relay only peers.
+		if !cfg.DisableListen && !sp.blockRelayOnly &&
+			sp.server.syncManager.IsCurrent() {
+
 			// Get address that best matches.
 			lna := addrManager.GetBestLocalAddress(remoteAddr)
 			if addrmgr.IsRoutable(lna) {
 				// Filter addresses the peer already knows about.
-				addresses := []*wire.NetAddress{lna}
+				addresses := []*wire.NetAddressV2{lna}
 				sp.pushAddrMsg(addresses)
 			}
 		}
@@ -470,7 +580,9 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 		// more and the peer has a protocol version new enough to
 		// include a timestamp with addresses.
 		hasTimestamp := sp.ProtocolVersion() >= wire.NetAddressTimeVersion
-		if addrManager.NeedMoreAddresses() && hasTimestamp {
+		if addrManager.NeedMoreAddresses() && hasTimestamp &&
+			!sp.blockRelayOnly {
+
 			sp.QueueMessage(wire.NewMsgGetAddr(), nil)
 		}
 
@@ -529,6 +641,10 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 		// one.
 		if !sp.filter.IsLoaded() || sp.filter.MatchTxAndUpdate(txDesc.Tx) {
 			iv := wire.NewInvVect(wire.InvTypeTx, txDesc.Tx.Hash())
+			if sp.WantsWTxIdRelay() {
+				iv = wire.NewInvVect(wire.InvTypeWTx,
+					txDesc.Tx.WitnessHash())
+			}
 			invMsg.AddInvVect(iv)
 			if len(invMsg.InvList)+1 > wire.MaxInvPerMsg {
 				break
@@ -552,6 +668,11 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 			msg.TxHash(), sp)
 		return
 	}
+	if sp.blockRelayOnly {
+		peerLog.Tracef("Ignoring tx %v from block relay only peer %v",
+			msg.TxHash(), sp)
+		return
+	}
 
 	// Add the transaction to the known inventory for the peer.
 	// Convert the raw MsgTx to a btcutil.Tx which provides some convenience
@@ -559,14 +680,25 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 	tx := btcutil.NewTx(msg)
 	iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
 	sp.AddKnownInventory(iv)
+	if sp.WantsWTxIdRelay() {
+		iv = wire.NewInvVect(wire.InvTypeWTx, tx.WitnessHash())
+		sp.AddKnownInventory(iv)
+	}
 
 	// Queue the transaction up to be handled by the sync manager and
 	// intentionally block further receives until the transaction is fully
 	// processed and known good or bad.  This helps prevent a malicious peer
 	// from queuing up a bunch of bad transactions before disconnecting (or
 	// being disconnected) and wasting memory.
+	known := sp.server.txMemPool.HaveTransaction(tx.Hash())
 	sp.server.syncManager.QueueTx(tx, sp.Peer, sp.txProcessed)
 	<-sp.txProcessed
+
+	// Remember when the peer last relayed a new transaction so the peer is
+	// protected from eviction.
+	if !known && sp.server.txMemPool.HaveTransaction(tx.Hash()) {
+		atomic.StoreInt64(&sp.lastTxTime, time.Now().Unix())
+	}
 }
 
 // OnBlock is invoked when a peer receives a block bitcoin message.  It
@@ -591,8 +723,107 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 	// reference implementation processes blocks in the same
 	// thread and therefore blocks further messages until
 	// the bitcoin block has been fully processed.
+	known := sp.haveBlock(block.Hash())
 	sp.server.syncManager.QueueBlock(block, sp.Peer, sp.blockProcessed)
 	<-sp.blockProcessed
+	sp.updateLastBlockTime(block.Hash(), known)
+}
+
+// haveBlock returns whether or not the block with the passed hash is already
+// known to the chain.
+func (sp *serverPeer) haveBlock(hash *chainhash.Hash) bool {
+	have, err := sp.server.chain.HaveBlock(hash)
+	return err == nil && have
+}
+
+// updateLastBlockTime remembers when the peer last relayed a new block so the
+// peer is protected from eviction.  The block is new when it was not known
+// before the peer relayed it and is known now.
+func (sp *serverPeer) updateLastBlockTime(hash *chainhash.Hash, known bool) {
+	if !known && sp.haveBlock(hash) {
+		atomic.StoreInt64(&sp.lastBlockTime, time.Now().Unix())
+	}
+}
+
+// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin message.
+// It blocks until the compact block has been fully processed, which includes
+// either reconstructing the block or requesting its missing transactions.
+func (sp *serverPeer) OnCmpctBlock(_ *peer.Peer, msg *wire.MsgCmpctBlock) {
+	// Queue the compact block up to be handled by the sync manager and
+	// intentionally block further receives until it is processed for the
+	// same reasons as full blocks.
+	hash := msg.Header.BlockHash()
+	known := sp.haveBlock(&hash)
+	sp.server.syncManager.QueueCmpctBlock(msg, sp.Peer, sp.blockProcessed)
+	<-sp.blockProcessed
+	sp.updateLastBlockTime(&hash, known)
+}
+
+// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin message.  It
+// blocks until the block the transactions complete has been fully processed.
+func (sp *serverPeer) OnBlockTxn(_ *peer.Peer, msg *wire.MsgBlockTxn) {
+	known := sp.haveBlock(&msg.BlockHash)
+	sp.server.syncManager.QueueBlockTxn(msg, sp.Peer, sp.blockProcessed)
+	<-sp.blockProcessed
+	sp.updateLastBlockTime(&msg.BlockHash, known)
+}
+
+// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin message
+// and is used to deliver the requested transactions of a recent block.  The
+// full block is sent instead when the block is too deep in the chain.
+func (sp *serverPeer) OnGetBlockTxn(_ *peer.Peer, msg *wire.MsgGetBlockTxn) {
+	chain := sp.server.chain
+	height, err := chain.BlockHeightByHash(&msg.BlockHash)
+	if err != nil {
+		peerLog.Debugf("Unable to fetch height for getblocktxn block "+
+			"%v requested by %v: %v", msg.BlockHash, sp, err)
+		return
+	}
+
+	encoding := wire.BaseEncoding
+	if sp.CompactBlockVersion() == 2 {
+		encoding = wire.WitnessEncoding
+	}
+
+	best := chain.BestSnapshot()
+	if best.Height-height > maxBlockTxnDepth {
+		encoding = wire.BaseEncoding
+		if sp.IsWitnessEnabled() {
+			encoding = wire.WitnessEncoding
+		}
+		doneChan := make(chan struct{}, 1)
+		err := sp.server.pushBlockMsg(sp, &msg.BlockHash, doneChan, nil,
+			encoding)
+		if err == nil {
+			<-doneChan
+		}
+		return
+	}
+
+	block, err := chain.BlockByHash(&msg.BlockHash)
+	if err != nil {
+		peerLog.Debugf("Unable to fetch getblocktxn block %v requested "+
+			"by %v: %v", msg.BlockHash, sp, err)
+		return
+	}
+
+	txns := block.MsgBlock().Transactions
+	blockTxn := wire.NewMsgBlockTxn(&msg.BlockHash)
+	for _, index := range msg.Indexes {
+		if int(index) >= len(txns) {
+			peerLog.Debugf("%s requested out of range transaction %d "+
+				"of block %v -- disconnecting", sp, index,
+				msg.BlockHash)
+			sp.addBanScore(100, 0, "getblocktxn")
+			sp.Disconnect()
+			return
+		}
+		blockTxn.AddTransaction(txns[index])
+	}
+
+	doneChan := make(chan struct{}, 1)
+	sp.QueueMessageWithEncoding(blockTxn, doneChan, encoding)
+	<-doneChan
 }
 
 // OnInv is invoked when a peer receives an inv bitcoin message and is
@@ -600,7 +831,7 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 // accordingly.  We pass the message down to blockmanager which will call
 // QueueMessage with any appropriate responses.
 func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
-	if !cfg.BlocksOnly {
+	if !cfg.BlocksOnly && !sp.blockRelayOnly {
 		if len(msg.InvList) > 0 {
 			sp.server.syncManager.QueueInv(msg, sp.Peer)
 		}
@@ -609,9 +840,9 @@ func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
 
 	newInv := wire.NewMsgInvSizeHint(uint(len(msg.InvList)))
 	for _, invVect := range msg.InvList {
-		if invVect.Type == wire.InvTypeTx {
+		if invVect.Type == wire.InvTypeTx || invVect.Type == wire.InvTypeWTx {
 			peerLog.Tracef("Ignoring tx %v in inv from %v -- "+
-				"blocksonly enabled", invVect.Hash, sp)
+				"tx relay disabled", invVect.Hash, sp)
 			if sp.ProtocolVersion() >= wire.BIP0037Version {
 				peerLog.Infof("Peer %v is announcing "+
 					"transactions -- disconnecting", sp)
@@ -676,10 +907,14 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeTx:
 			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
+		case wire.InvTypeWTx:
+			err = sp.server.pushWTxMsg(sp, &iv.Hash, c, waitChan)
 		case wire.InvTypeWitnessBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
+		case wire.InvTypeCmpctBlock:
+			err = sp.server.pushCmpctBlockMsg(sp, &iv.Hash, c, waitChan)
 		case wire.InvTypeFilteredWitnessBlock:
 			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeFilteredBlock:
@@ -1267,6 +1502,11 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
+	// Addresses are never relayed with block relay only peers.
+	if sp.blockRelayOnly {
+		return
+	}
+
 	// Ignore old style addresses which don't include a timestamp.
 	if sp.ProtocolVersion() < wire.NetAddressTimeVersion {
 		return
@@ -1280,7 +1520,46 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
+	addrs := make([]*wire.NetAddressV2, 0, len(msg.AddrList))
 	for _, na := range msg.AddrList {
+		addrs = append(addrs, wire.NetAddressV2FromLegacy(na))
+	}
+	sp.addAddresses(addrs)
+}
+
+// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message and is
+// used to notify the server about advertised addresses of any network,
+// including those which can't be represented by an addr message.
+func (sp *serverPeer) OnAddrV2(_ *peer.Peer, msg *wire.MsgAddrV2) {
+	// Ignore addresses when running on the simulation test network.  This
+	// helps prevent the network from becoming another public test network
+	// since it will not be able to learn about other peers that have not
+	// specifically been provided.
+	if cfg.SimNet {
+		return
+	}
+
+	// Addresses are never relayed with block relay only peers.
+	if sp.blockRelayOnly {
+		return
+	}
+
+	// A message that has no addresses is invalid.
+	if len(msg.AddrList) == 0 {
+		peerLog.Errorf("Command [%s] from %s does not contain any addresses",
+			msg.Command(), sp.Peer)
+		sp.Disconnect()
+		return
+	}
+
+	sp.addAddresses(msg.AddrList)
+}
+
+// addAddresses adds the addresses advertised by the peer to the set of
+// addresses known to the peer and the server address manager.  Addresses of
+// networks unknown to the address manager are ignored by it.
+func (sp *serverPeer) addAddresses(addrs []*wire.NetAddressV2) {
+	for _, na := range addrs {
 		// Don't add more address if we're disconnecting.
 		if !sp.Connected() {
 			return
@@ -1295,7 +1574,7 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		}
 
 		// Add address to known addresses for this peer.
-		sp.addKnownAddresses([]*wire.NetAddress{na})
+		sp.addKnownAddresses([]*wire.NetAddressV2{na})
 	}
 
 	// Add addresses to server address manager.  The address manager handles
@@ -1303,7 +1582,7 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 	// addresses, and last seen updates.
 	// XXX bitcoind gives a 2 hour time penalty here, do we want to do the
 	// same?
-	sp.server.addrManager.AddAddresses(msg.AddrList, sp.NA())
+	sp.server.addrManager.AddAddresses(addrs, sp.NA())
 }
 
 // OnRead is invoked when a peer receives a message and it is used to update
@@ -1359,7 +1638,8 @@ func (s *server) RemoveRebroadcastInventory(iv *wire.InvVect) {
 }
 
 // relayTransactions generates and relays inventory vectors for all of the
-// passed transactions to all connected peers.
+// passed transactions to all connected peers.  It is called for all
+// transactions newly accepted to the mempool.
 func (s *server) relayTransactions(txns []*mempool.TxDesc) {
 	for _, txD := range txns {
 		iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
@@ -1383,6 +1663,33 @@ func (s *server) AnnounceNewTransactions(txns []*mempool.TxDesc) {
 	}
 }
 
+// TransactionAdded is invoked by the mempool when it adds a transaction, with
+// the mempool lock held, and publishes the transaction and its addition to ZMQ
+// subscribers.
+func (s *server) TransactionAdded(txD *mempool.TxDesc) {
+	if s.zmqNotifier != nil {
+		s.zmqNotifier.NotifyAddedTransaction(txD)
+	}
+}
+
+// TransactionRemoved is invoked by the mempool when it removes a transaction
+// for any reason other than being mined, such as when the transaction expires,
+// and notifies websocket clients of the removal and its reason and ZMQ
+// subscribers of the removal.
+func (s *server) TransactionRemoved(tx *btcutil.Tx, reason mempool.RemovalReason) {
+	if s.zmqNotifier != nil {
+		s.zmqNotifier.NotifyRemovedTransaction(tx)
+	}
+
+	// Websocket clients are not notified of transactions double spent by
+	// a block, just like they aren't of mined ones, nor of transactions of
+	// a rejected package, which they were never notified of.
+	if s.rpcServer != nil && reason != mempool.RemovalConflict &&
+		reason != mempool.RemovalPackageRejected {
+		s.rpcServer.NotifyRemovedTransaction(tx, reason)
+	}
+}
+
 // Transaction has one confirmation on the main chain. Now we can mark it as no
 // longer needing rebroadcasting.
 func (s *server) TransactionConfirmed(tx *btcutil.Tx) {
@@ -1424,6 +1731,34 @@ func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<-
 	return nil
 }
 
+// pushWTxMsg sends a tx message including its witness data for the provided
+// transaction witness hash to the connected peer.  An error is returned if the
+// witness hash is not known.
+func (s *server) pushWTxMsg(sp *serverPeer, wtxHash *chainhash.Hash, doneChan chan<- struct{},
+	waitChan <-chan struct{}) error {
+
+	// Attempt to fetch the requested transaction from the pool.
+	tx, err := s.txMemPool.FetchTransactionByWitnessHash(wtxHash)
+	if err != nil {
+		peerLog.Tracef("Unable to fetch wtx %v from transaction "+
+			"pool: %v", wtxHash, err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+
+	sp.QueueMessageWithEncoding(tx.MsgTx(), doneChan, wire.WitnessEncoding)
+
+	return nil
+}
+
 // pushBlockMsg sends a block message for the provided block hash to the
 // connected peer.  An error is returned if the block hash is not known.
 func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
@@ -1490,6 +1825,69 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 	return nil
 }
 
+// pushCmpctBlockMsg sends a cmpctblock message for the provided block hash to
+// the connected peer.  Blocks deeper than maxCmpctBlockDepth are sent in full
+// instead.  An error is returned if the block hash is not known.
+func (s *server) pushCmpctBlockMsg(sp *serverPeer, hash *chainhash.Hash,
+	doneChan chan<- struct{}, waitChan <-chan struct{}) error {
+
+	encoding := wire.BaseEncoding
+	if sp.IsWitnessEnabled() {
+		encoding = wire.WitnessEncoding
+	}
+
+	// Send the full block when the block is too deep in the chain or
+	// the peer never signalled support for compact blocks.
+	version := sp.CompactBlockVersion()
+	height, err := s.chain.BlockHeightByHash(hash)
+	if err != nil || version == 0 ||
+		s.chain.BestSnapshot().Height-height > maxCmpctBlockDepth {
+
+		return s.pushBlockMsg(sp, hash, doneChan, waitChan, encoding)
+	}
+
+	blk, err := s.chain.BlockByHash(hash)
+	if err != nil {
+		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
+			hash, err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
+	msg, err := newCmpctBlockMsg(blk, version)
+	if err != nil {
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+
+	if version != 2 {
+		encoding = wire.BaseEncoding
+	}
+	sp.QueueMessageWithEncoding(msg, doneChan, encoding)
+	return nil
+}
+
+// newCmpctBlockMsg returns a cmpctblock message with a random nonce for the
+// passed block using the given compact block version.
+func newCmpctBlockMsg(block *btcutil.Block, version uint64) (*wire.MsgCmpctBlock, error) {
+	nonce, err := wire.RandomUint64()
+	if err != nil {
+		return nil, err
+	}
+	return wire.NewMsgCmpctBlockFromBlock(block.MsgBlock(), nonce,
+		version == 2), nil
+}
+
 // pushMerkleBlockMsg sends a merkleblock message for the provided block hash to
 // the connected peer.  Since a merkle block requires the peer to have a filter
 // loaded, this call will simply be ignored if there is no filter loaded.  An
@@ -1600,7 +1998,14 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		sp.Disconnect()
 		return false
 	}
-	if banEnd, ok := state.banned[host]; ok {
+	if ip := net.ParseIP(host); ip != nil {
+		if banned, banEnd := s.banList.IsBanned(ip); banned {
+			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
+				host, time.Until(banEnd))
+			sp.Disconnect()
+			return false
+		}
+	} else if banEnd, ok := state.bannedHosts[host]; ok {
 		if time.Now().Before(banEnd) {
 			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
 				host, time.Until(banEnd))
@@ -1609,13 +2014,17 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		}
 
 		srvrLog.Infof("Peer %s is no longer banned", host)
-		delete(state.banned, host)
+		delete(state.bannedHosts, host)
 	}
 
 	// TODO: Check for max peers from a single IP.
 
-	// Limit max number of total peers.
-	if state.Count() >= cfg.MaxPeers {
+	// Limit max number of total peers.  New inbound peers take the place
+	// of an existing inbound peer when one can be evicted so an attacker
+	// can't lock out other peers by taking all of the inbound slots.
+	if state.Count() >= cfg.MaxPeers &&
+		(!sp.Inbound() || !s.evictInboundPeer(state)) {
+
 		srvrLog.Infof("Max peers reached [%d] - disconnecting peer %s",
 			cfg.MaxPeers, sp)
 		sp.Disconnect()
@@ -1629,7 +2038,7 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	if sp.Inbound() {
 		state.inboundPeers[sp.ID()] = sp
 	} else {
-		state.outboundGroups[addrmgr.GroupKey(sp.NA())]++
+		state.outboundGroups[s.addrManager.GroupKey(sp.NA())]++
 		if sp.persistent {
 			state.persistentPeers[sp.ID()] = sp
 		} else {
@@ -1653,7 +2062,7 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 	}
 	if _, ok := list[sp.ID()]; ok {
 		if !sp.Inbound() && sp.VersionKnown() {
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		}
 		if !sp.Inbound() && sp.connReq != nil {
 			s.connManager.Disconnect(sp.connReq.ID())
@@ -1688,27 +2097,77 @@ func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 	direction := directionString(sp.Inbound())
 	srvrLog.Infof("Banned peer %s (%s) for %v", host, direction,
 		cfg.BanDuration)
-	state.banned[host] = time.Now().Add(cfg.BanDuration)
+	until := time.Now().Add(cfg.BanDuration)
+
+	// Peers on overlay networks such as Tor and I2P don't have an IP
+	// address, so ban their host until the server restarts instead.
+	ipNet, err := parseBanSubnet(host)
+	if err != nil {
+		state.bannedHosts[host] = until
+		return
+	}
+	s.banList.Add(ipNet, until, banReasonMisbehaving)
 }
 
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
 // known to have it.  It is invoked from the peerHandler goroutine.
 func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
+	// Transactions are compared against the fee filters of peers using the
+	// fee rate of their package, so a parent paid for by its child reaches
+	// peers which would not accept the parent on its own.
+	var relayFeePerKB int64
+	if txD, ok := msg.data.(*mempool.TxDesc); ok {
+		relayFeePerKB = txD.FeePerKB
+		if feePerKB := s.txMemPool.RelayFeePerKB(txD.Tx.Hash()); feePerKB > relayFeePerKB {
+			relayFeePerKB = feePerKB
+		}
+	}
+
 	state.forAllPeers(func(sp *serverPeer) {
 		if !sp.Connected() {
 			return
 		}
 
+		// If the inventory is a block and the peer requested
+		// high-bandwidth compact blocks, send a cmpctblock message
+		// instead of an inventory message.
+		if msg.invVect.Type == wire.InvTypeBlock && sp.WantsCompactBlocks() {
+			block, ok := msg.data.(*btcutil.Block)
+			if !ok {
+				peerLog.Warnf("Underlying data for compact " +
+					"block is not a block")
+				return
+			}
+			if sp.IsKnownInventory(msg.invVect) {
+				return
+			}
+			version := sp.CompactBlockVersion()
+			cmpctBlock, err := newCmpctBlockMsg(block, version)
+			if err != nil {
+				peerLog.Errorf("Failed to create compact "+
+					"block: %v", err)
+				return
+			}
+			encoding := wire.BaseEncoding
+			if version == 2 {
+				encoding = wire.WitnessEncoding
+			}
+			sp.AddKnownInventory(msg.invVect)
+			sp.QueueMessageWithEncoding(cmpctBlock, nil, encoding)
+			return
+		}
+
 		// If the inventory is a block and the peer prefers headers,
 		// generate and send a headers message instead of an inventory
 		// message.
 		if msg.invVect.Type == wire.InvTypeBlock && sp.WantsHeaders() {
-			blockHeader, ok := msg.data.(wire.BlockHeader)
+			block, ok := msg.data.(*btcutil.Block)
 			if !ok {
 				peerLog.Warnf("Underlying data for headers" +
-					" is not a block header")
+					" is not a block")
 				return
 			}
+			blockHeader := block.MsgBlock().Header
 			msgHeaders := wire.NewMsgHeaders()
 			if err := msgHeaders.AddBlockHeader(&blockHeader); err != nil {
 				peerLog.Errorf("Failed to add block"+
@@ -1734,10 +2193,10 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 				return
 			}
 
-			// Don't relay the transaction if the transaction fee-per-kb
-			// is less than the peer's feefilter.
+			// Don't relay the transaction if the fee-per-kb of its
+			// package is less than the peer's feefilter.
 			feeFilter := atomic.LoadInt64(&sp.feeFilter)
-			if feeFilter > 0 && txD.FeePerKB < feeFilter {
+			if feeFilter > 0 && relayFeePerKB < feeFilter {
 				return
 			}
 
@@ -1748,6 +2207,15 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 					return
 				}
 			}
+
+			// Announce the transaction by its witness hash when
+			// the peer negotiated wtxid relay.
+			if sp.WantsWTxIdRelay() {
+				iv := wire.NewInvVect(wire.InvTypeWTx,
+					txD.Tx.WitnessHash())
+				sp.QueueInventory(iv)
+				return
+			}
 		}
 
 		// Queue the inventory to be relayed with the next batch.
@@ -1808,6 +2276,10 @@ type removeNodeMsg struct {
 	reply chan error
 }
 
+type disconnectSubnetMsg struct {
+	ipNet *net.IPNet
+}
+
 // handleQuery is the central handler for all queries and commands from other
 // goroutines related to peer state.
 func (s *server) handleQuery(state *peerState, querymsg interface{}) {
@@ -1859,13 +2331,14 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		go s.connManager.Connect(&connmgr.ConnReq{
 			Addr:      netAddr,
 			Permanent: msg.permanent,
+			Manual:    true,
 		})
 		msg.reply <- nil
 	case removeNodeMsg:
 		found := disconnectPeer(state.persistentPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 
 		if found {
@@ -1901,7 +2374,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 		if found {
 			// If there are multiple outbound connections to the same
@@ -1909,7 +2382,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 			// peers are found.
 			for found {
 				found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
-					state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+					state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 				})
 			}
 			msg.reply <- nil
@@ -1917,6 +2390,18 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		}
 
 		msg.reply <- errors.New("peer not found")
+
+	case disconnectSubnetMsg:
+		state.forAllPeers(func(sp *serverPeer) {
+			host, _, err := net.SplitHostPort(sp.Addr())
+			if err != nil {
+				return
+			}
+			if ip := net.ParseIP(host); ip != nil && msg.ipNet.Contains(ip) {
+				srvrLog.Infof("Disconnecting banned peer %s", sp)
+				sp.Disconnect()
+			}
+		})
 	}
 }
 
@@ -1952,6 +2437,9 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnMemPool:      sp.OnMemPool,
 			OnTx:           sp.OnTx,
 			OnBlock:        sp.OnBlock,
+			OnCmpctBlock:   sp.OnCmpctBlock,
+			OnBlockTxn:     sp.OnBlockTxn,
+			OnGetBlockTxn:  sp.OnGetBlockTxn,
 			OnInv:          sp.OnInv,
 			OnHeaders:      sp.OnHeaders,
 			OnGetData:      sp.OnGetData,
@@ -1966,6 +2454,7 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnFilterLoad:   sp.OnFilterLoad,
 			OnGetAddr:      sp.OnGetAddr,
 			OnAddr:         sp.OnAddr,
+			OnAddrV2:       sp.OnAddrV2,
 			OnRead:         sp.OnRead,
 			OnWrite:        sp.OnWrite,
 
@@ -1986,9 +2475,43 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 		DisableRelayTx:    cfg.BlocksOnly,
 		ProtocolVersion:   peer.MaxProtocolVersion,
 		TrickleInterval:   cfg.TrickleInterval,
+		V2Transport:       !cfg.NoV2Transport,
 	}
 }
 
+// useV2Transport returns whether the v2 transport (BIP0324) should be
+// attempted for the passed outbound connection request.  It is used for
+// permanent peers and addresses which advertise support for it, unless the
+// previous v2 handshake with the permanent peer failed, in which case the v1
+// transport is used for this attempt.  Requiring the v2 transport disables the
+// fallback entirely.
+func (s *server) useV2Transport(c *connmgr.ConnReq) bool {
+	if cfg.NoV2Transport {
+		return false
+	}
+	if cfg.RequireV2Transport {
+		return true
+	}
+
+	addr := c.Addr.String()
+	s.v1FallbackMtx.Lock()
+	_, fallback := s.v1Fallback[addr]
+	delete(s.v1Fallback, addr)
+	s.v1FallbackMtx.Unlock()
+	if fallback {
+		return false
+	}
+	if c.Permanent {
+		return true
+	}
+
+	na, err := s.addrManager.DeserializeNetAddress(addr)
+	if err != nil {
+		return false
+	}
+	return s.addrManager.Services(na)&wire.SFNodeP2PV2 == wire.SFNodeP2PV2
+}
+
 // inboundPeerConnected is invoked by the connection manager when a new inbound
 // connection is established.  It initializes a new inbound server peer
 // instance, associates it with the connection, and starts a goroutine to wait
@@ -2008,7 +2531,13 @@ func (s *server) inboundPeerConnected(conn net.Conn) {
 // manager of the attempt.
 func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	sp := newServerPeer(s, c.Permanent)
-	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
+	sp.blockRelayOnly = c.BlockRelayOnly
+	sp.feeler = c.Feeler
+	sp.manual = c.Manual
+	peerCfg := newPeerConfig(sp)
+	peerCfg.V2Transport = s.useV2Transport(c)
+	peerCfg.DisableRelayTx = peerCfg.DisableRelayTx || c.BlockRelayOnly
+	p, err := peer.NewOutboundPeer(peerCfg, c.Addr.String())
 	if err != nil {
 		srvrLog.Debugf("Cannot create outbound peer %s: %v", c.Addr, err)
 		s.connManager.Disconnect(c.ID())
@@ -2018,17 +2547,34 @@ func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
-	s.addrManager.Attempt(sp.NA())
+
+	// The attempt of feeler connections is recorded before connecting so
+	// failed attempts are known too.
+	if !c.Feeler {
+		s.addrManager.Attempt(sp.NA())
+	}
 }
 
 // peerDoneHandler handles peer disconnects by notifiying the server that it's
 // done along with other performing other desirable cleanup.
 func (s *server) peerDoneHandler(sp *serverPeer) {
 	sp.WaitForDisconnect()
+
+	// Retry permanent peers whose v2 handshake failed with the v1
+	// transport unless it is required.  This must happen before the
+	// connection manager is notified so the retry sees it.  Other
+	// outbound addresses are not retried by the connection manager, so
+	// they aren't recorded.
+	if sp.persistent && sp.V2HandshakeFailed() && !cfg.RequireV2Transport {
+		srvrLog.Debugf("Falling back to the v1 transport for %s", sp)
+		s.v1FallbackMtx.Lock()
+		s.v1Fallback[sp.Addr()] = struct{}{}
+		s.v1FallbackMtx.Unlock()
+	}
 	s.donePeers <- sp
 
 	// Only tell sync manager we are gone if we ever told it we existed.
-	if sp.VersionKnown() {
+	if sp.VersionKnown() && !sp.feeler {
 		s.syncManager.DonePeer(sp.Peer)
 
 		// Evict any remaining orphans that were sent by the peer.
@@ -2060,24 +2606,35 @@ func (s *server) peerHandler() {
 		inboundPeers:    make(map[int32]*serverPeer),
 		persistentPeers: make(map[int32]*serverPeer),
 		outboundPeers:   make(map[int32]*serverPeer),
-		banned:          make(map[string]time.Time),
 		outboundGroups:  make(map[string]int),
+		bannedHosts:     make(map[string]time.Time),
 	}
 
 	if !cfg.DisableDNSSeed {
 		// Add peers discovered through DNS to the address manager.
 		connmgr.SeedFromDNS(activeNetParams.Params, defaultRequiredServices,
 			btcdLookup, func(addrs []*wire.NetAddress) {
+				addrsV2 := make([]*wire.NetAddressV2, 0, len(addrs))
+				for _, na := range addrs {
+					addrsV2 = append(addrsV2,
+						wire.NetAddressV2FromLegacy(na))
+				}
+
 				// Bitcoind uses a lookup of the dns seeder here. This
 				// is rather strange since the values looked up by the
 				// DNS seed lookups will vary quite a lot.
 				// to replicate this behaviour we put all addresses as
 				// having come from the first one.
-				s.addrManager.AddAddresses(addrs, addrs[0])
+				s.addrManager.AddAddresses(addrsV2, addrsV2[0])
 			})
 	}
 	go s.connManager.Start()
 
+	staleTipTicker := time.NewTicker(staleTipCheckInterval)
+	defer staleTipTicker.Stop()
+	feeFilterTicker := time.NewTicker(feeFilterCheckInterval)
+	defer feeFilterTicker.Stop()
+
 out:
 	for {
 		select {
@@ -2109,6 +2666,14 @@ out:
 		case qmsg := <-s.query:
 			s.handleQuery(state, qmsg)
 
+		// Check whether the best chain tip has gone stale.
+		case <-staleTipTicker.C:
+			s.handleStaleTipCheck(state)
+
+		// Send peers the current minimum fee rate of the mempool.
+		case <-feeFilterTicker.C:
+			s.handleFeeFilterUpdate(state)
+
 		case <-s.quit:
 			// Disconnect all peers on server shutdown.
 			state.forAllPeers(func(sp *serverPeer) {
@@ -2152,6 +2717,13 @@ func (s *server) BanPeer(sp *serverPeer) {
 	s.banPeers <- sp
 }
 
+// BanSubnet bans the passed subnet until the passed time for the passed reason
+// and disconnects all connected peers within it.
+func (s *server) BanSubnet(ipNet *net.IPNet, until time.Time, reason string) {
+	s.banList.Add(ipNet, until, reason)
+	s.query <- disconnectSubnetMsg{ipNet: ipNet}
+}
+
 // RelayInventory relays the passed inventory vector to all connected peers
 // that are not already known to have it.
 func (s *server) RelayInventory(invVect *wire.InvVect, data interface{}) {
@@ -2273,6 +2845,26 @@ cleanup:
 	s.wg.Done()
 }
 
+// mempoolExpiryHandler periodically removes the transactions which have been in
+// the memory pool for longer than the expiry age.  It must be run as a
+// goroutine.
+func (s *server) mempoolExpiryHandler() {
+	ticker := time.NewTicker(mempoolExpiryInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			s.txMemPool.ExpireTransactions()
+
+		case <-s.quit:
+			break out
+		}
+	}
+	s.wg.Done()
+}
+
 // Start begins accepting connections from peers.
 func (s *server) Start() {
 	// Already started?
@@ -2290,6 +2882,14 @@ func (s *server) Start() {
 	s.wg.Add(1)
 	go s.peerHandler()
 
+	// Load the transactions saved in the mempool dump on the last
+	// shutdown.
+	s.wg.Add(1)
+	go s.loadMempool()
+
+	s.wg.Add(1)
+	go s.mempoolExpiryHandler()
+
 	if s.nat != nil {
 		s.wg.Add(1)
 		go s.upnpUpdateThread()
@@ -2330,6 +2930,17 @@ func (s *server) Stop() error {
 		s.rpcServer.Stop()
 	}
 
+	// Stop publishing ZMQ notifications.
+	if s.zmqNotifier != nil {
+		s.zmqNotifier.Stop()
+	}
+
+	// Save the transactions in the mempool so they are loaded again on the
+	// next start.
+	if err := s.saveMempool(); err != nil {
+		srvrLog.Errorf("Failed to save mempool: %v", err)
+	}
+
 	// Save fee estimator state in the database.
 	s.db.Update(func(tx database.Tx) error {
 		metadata := tx.Metadata()
@@ -2460,7 +3071,7 @@ out:
 					srvrLog.Warnf("UPnP can't get external address: %v", err)
 					continue out
 				}
-				na := wire.NewNetAddressIPPort(externalip, uint16(listenPort),
+				na := wire.NewNetAddressV2IPPort(externalip, uint16(listenPort),
 					s.services)
 				err = s.addrManager.AddLocalAddress(na, addrmgr.UpnpPrio)
 				if err != nil {
@@ -2546,8 +3157,26 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	if cfg.NoCFilters {
 		services &^= wire.SFNodeCF
 	}
+	if !cfg.NoV2Transport {
+		services |= wire.SFNodeP2PV2
+	}
 
 	amgr := addrmgr.New(cfg.DataDir, btcdLookup)
+	amgr.SetCJDNSReachable(cfg.CJDNSReachable)
+	if cfg.ASMap != "" {
+		asmap, err := addrmgr.LoadASMap(cfg.ASMap)
+		if err != nil {
+			return nil, err
+		}
+		amgr.SetASMap(asmap)
+		srvrLog.Infof("Grouping peers with ASN map %s (%s)", cfg.ASMap,
+			asmap.Hash())
+	}
+
+	evictionSalt, err := wire.RandomUint64()
+	if err != nil {
+		return nil, err
+	}
 
 	var listeners []net.Listener
 	var nat NAT
@@ -2565,6 +3194,7 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	s := server{
 		chainParams:          chainParams,
 		addrManager:          amgr,
+		banList:              newBanList(cfg.DataDir),
 		newPeers:             make(chan *serverPeer, cfg.MaxPeers),
 		donePeers:            make(chan *serverPeer, cfg.MaxPeers),
 		banPeers:             make(chan *serverPeer, cfg.MaxPeers),
@@ -2581,6 +3211,8 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		sigCache:             txscript.NewSigCache(cfg.SigCacheMaxSize),
 		hashCache:            txscript.NewHashCache(cfg.SigCacheMaxSize),
 		cfCheckptCaches:      make(map[wire.FilterType][]cfHeaderKV),
+		v1Fallback:           make(map[string]struct{}),
+		evictionSalt:         evictionSalt,
 	}
 
 	// Create the transaction and address indexes if needed.
@@ -2628,7 +3260,6 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	}
 
 	// Create a new block chain instance with the appropriate configuration.
-	var err error
 	s.chain, err = blockchain.New(&blockchain.Config{
 		DB:           s.db,
 		Interrupt:    interrupt,
@@ -2683,6 +3314,13 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 			MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
 			MinRelayTxFee:        cfg.minRelayTxFee,
 			MaxTxVersion:         2,
+			MaxPoolSize:          int64(cfg.MaxMempool) * 1000000,
+			ExpiryAge:            time.Duration(cfg.MempoolExpiry) * time.Hour,
+			FullRBF:              cfg.MempoolFullRBF,
+			MaxAncestorCount:     int64(cfg.LimitAncestorCount),
+			MaxAncestorSize:      int64(cfg.LimitAncestorSize) * 1000,
+			MaxDescendantCount:   int64(cfg.LimitDescendantCount),
+			MaxDescendantSize:    int64(cfg.LimitDescendantSize) * 1000,
 		},
 		ChainParams:    chainParams,
 		FetchUtxoView:  s.chain.FetchUtxoView,
@@ -2696,6 +3334,8 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		HashCache:          s.hashCache,
 		AddrIndex:          s.addrIndex,
 		FeeEstimator:       s.feeEstimator,
+		OnTxAdded:          s.TransactionAdded,
+		OnTxRemoved:        s.TransactionRemoved,
 	}
 	s.txMemPool = mempool.New(&txC)
 
@@ -2705,6 +3345,7 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		TxMemPool:          s.txMemPool,
 		ChainParams:        s.chainParams,
 		DisableCheckpoints: cfg.DisableCheckpoints,
+		AssumeValid:        cfg.assumeValid,
 		MaxPeers:           cfg.MaxPeers,
 		FeeEstimator:       s.feeEstimator,
 	})
@@ -2758,11 +3399,20 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 				// in the same group so that we are not connecting
 				// to the same network segment at the expense of
 				// others.
-				key := addrmgr.GroupKey(addr.NetAddress())
+				key := s.addrManager.GroupKey(addr.NetAddress())
 				if s.OutboundGroupCount(key) != 0 {
 					continue
 				}
 
+				// Skip addresses of overlay networks which can't
+				// be reached with the current configuration.
+				if cfg.NoOnion && addrmgr.IsTor(addr.NetAddress()) {
+					continue
+				}
+				if cfg.I2PProxy == "" && addrmgr.IsI2P(addr.NetAddress()) {
+					continue
+				}
+
 				// only allow recent nodes (10mins) after we failed 30
 				// times
 				if tries < 30 && time.Since(addr.LastAttempt()) < 10*time.Minute {
@@ -2783,24 +3433,63 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		}
 	}
 
+	// Periodically test addresses with feeler connections so good new
+	// addresses are moved to the tried buckets and tried addresses are
+	// only evicted when they no longer work.
+	var feelerAddressFunc func() (net.Addr, error)
+	if !cfg.SimNet && len(cfg.ConnectPeers) == 0 {
+		feelerAddressFunc = func() (net.Addr, error) {
+			s.addrManager.ResolveCollisions()
+			addr := s.addrManager.GetFeelerAddress()
+			if addr == nil {
+				return nil, errors.New("no feeler address")
+			}
+
+			// Skip addresses of the same network segments as the
+			// outbound peers and of overlay networks which can't be
+			// reached with the current configuration.
+			na := addr.NetAddress()
+			if s.OutboundGroupCount(s.addrManager.GroupKey(na)) != 0 {
+				return nil, errors.New("feeler address group " +
+					"already connected")
+			}
+			if (cfg.NoOnion && addrmgr.IsTor(na)) ||
+				(cfg.I2PProxy == "" && addrmgr.IsI2P(na)) {
+
+				return nil, errors.New("feeler address not " +
+					"reachable")
+			}
+
+			s.addrManager.Attempt(na)
+			return addrStringToNetAddr(addrmgr.NetAddressKey(na))
+		}
+	}
+
 	// Create a connection manager.
 	targetOutbound := defaultTargetOutbound
 	if cfg.MaxPeers < targetOutbound {
 		targetOutbound = cfg.MaxPeers
 	}
+	targetBlockRelayOnly := cfg.MaxBlockRelayOnly
+	if cfg.MaxPeers-targetOutbound < targetBlockRelayOnly {
+		targetBlockRelayOnly = cfg.MaxPeers - targetOutbound
+	}
 	cmgr, err := connmgr.New(&connmgr.Config{
-		Listeners:      listeners,
-		OnAccept:       s.inboundPeerConnected,
-		RetryDuration:  connectionRetryInterval,
-		TargetOutbound: uint32(targetOutbound),
-		Dial:           btcdDial,
-		OnConnection:   s.outboundPeerConnected,
-		GetNewAddress:  newAddressFunc,
+		Listeners:            listeners,
+		OnAccept:             s.inboundPeerConnected,
+		RetryDuration:        connectionRetryInterval,
+		TargetOutbound:       uint32(targetOutbound),
+		TargetBlockRelayOnly: uint32(targetBlockRelayOnly),
+		Dial:                 btcdDial,
+		OnConnection:         s.outboundPeerConnected,
+		GetNewAddress:        newAddressFunc,
+		GetFeelerAddress:     feelerAddressFunc,
 	})
 	if err != nil {
 		return nil, err
 	}
 	s.connManager = cmgr
+	s.targetOutbound = targetOutbound
 
 	// Start up persistent peers.
 	permanentPeers := cfg.ConnectPeers
@@ -2840,6 +3529,7 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 			ChainParams:  chainParams,
 			DB:           db,
 			TxMemPool:    s.txMemPool,
+			SaveMempool:  s.saveMempool,
 			Generator:    blockTemplateGenerator,
 			CPUMiner:     s.cpuMiner,
 			TxIndex:      s.txIndex,
@@ -2858,6 +3548,16 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		}()
 	}
 
+	// Publish notifications to ZMQ subscribers when any endpoints are
+	// configured.
+	s.zmqNotifier, err = newZMQNotifier()
+	if err != nil {
+		return nil, err
+	}
+	if s.zmqNotifier != nil {
+		s.chain.Subscribe(s.zmqNotifier.handleBlockchainNotification)
+	}
+
 	return &s, nil
 }
 
@@ -2972,6 +3672,16 @@ func addrStringToNetAddr(addr string) (net.Addr, error) {
 		return &onionAddr{addr: addr}, nil
 	}
 
+	// I2P addresses can only be reached through an I2P proxy, so just
+	// return an I2P address instead.
+	if strings.HasSuffix(host, ".b32.i2p") {
+		if cfg.I2PProxy == "" {
+			return nil, errors.New("i2p has not been configured")
+		}
+
+		return &i2pAddr{addr: addr}, nil
+	}
+
 	// Attempt to look up an IP address associated with the parsed host.
 	ips, err := btcdLookup(host)
 	if err != nil {
@@ -3018,7 +3728,7 @@ func addLocalAddress(addrMgr *addrmgr.AddrManager, addr string, services wire.Se
 				continue
 			}
 
-			netAddr := wire.NewNetAddressIPPort(ifaceIP, uint16(port), services)
+			netAddr := wire.NewNetAddressV2IPPort(ifaceIP, uint16(port), services)
 			addrMgr.AddLocalAddress(netAddr, addrmgr.BoundPrio)
 		}
 	} else {
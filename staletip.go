@@ -0,0 +1,145 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	// staleTipCheckInterval is the interval between checks for whether the
+	// best chain tip has gone stale and whether there are extra outbound
+	// peers to evict.
+	staleTipCheckInterval = 45 * time.Second
+
+	// staleTipFactor is the number of times the target time per block the
+	// best chain tip must go without advancing to be considered stale.
+	staleTipFactor = 3
+
+	// minExtraOutboundConnTime is the minimum time an outbound peer must be
+	// connected before it is evicted to get back to the target number of
+	// outbound peers.
+	minExtraOutboundConnTime = 30 * time.Second
+)
+
+// staleTipState houses the state used to detect a stale best chain tip.
+type staleTipState struct {
+	hash      chainhash.Hash
+	updated   time.Time
+	requested bool
+}
+
+// handleStaleTipCheck connects to an extra outbound peer when the best chain tip
+// has not advanced for much longer than expected, since all of the outbound
+// peers might be stuck on a stale chain, for instance after a network
+// partition.  Once the tip is no longer stale and there are more outbound peers
+// than the target, the outbound peer which has gone the longest without
+// relaying a new block is evicted.  It is invoked from the peerHandler
+// goroutine.
+func (s *server) handleStaleTipCheck(state *peerState) {
+	// Outbound peers are only connected automatically when not running in
+	// connect-only mode.
+	if cfg.SimNet || len(cfg.ConnectPeers) != 0 {
+		return
+	}
+
+	now := time.Now()
+	best := s.chain.BestSnapshot()
+	if best.Hash != state.staleTip.hash {
+		state.staleTip.hash = best.Hash
+		state.staleTip.updated = now
+		state.staleTip.requested = false
+	}
+
+	// Count the full relay outbound peers, which are the peers the extra
+	// outbound peer is in addition to.  Manual connections requested by
+	// the user, such as one-shot connections, are neither counted nor
+	// evicted.
+	var numOutbound int
+	for _, sp := range state.outboundPeers {
+		if !sp.blockRelayOnly && !sp.feeler && !sp.manual {
+			numOutbound++
+		}
+	}
+
+	staleAfter := staleTipFactor * s.chainParams.TargetTimePerBlock
+	if now.Sub(state.staleTip.updated) > staleAfter {
+		if !state.staleTip.requested && numOutbound <= s.targetOutbound {
+			srvrLog.Infof("Best chain tip %s has not advanced for %v "+
+				"-- connecting to an extra outbound peer",
+				state.staleTip.hash,
+				now.Sub(state.staleTip.updated).Truncate(time.Second))
+			state.staleTip.requested = true
+			go s.connManager.NewConnReq()
+		}
+		return
+	}
+	if numOutbound <= s.targetOutbound {
+		return
+	}
+
+	candidates := make([]extraOutboundCandidate, 0, len(state.outboundPeers))
+	for _, sp := range state.outboundPeers {
+		if sp.blockRelayOnly || sp.feeler || sp.manual || !sp.Connected() {
+			continue
+		}
+		candidates = append(candidates, extraOutboundCandidate{
+			id:            sp.ID(),
+			connected:     sp.TimeConnected(),
+			lastBlockTime: time.Unix(atomic.LoadInt64(&sp.lastBlockTime), 0),
+		})
+	}
+	id, ok := selectExtraOutboundToEvict(candidates,
+		s.syncManager.SyncPeerID(), now)
+	if !ok {
+		return
+	}
+	evict := state.outboundPeers[id]
+	srvrLog.Infof("Evicting extra outbound peer %s which has gone the "+
+		"longest without relaying a new block", evict)
+	evict.Disconnect()
+}
+
+// extraOutboundCandidate houses the information about a full relay outbound
+// peer which is used to decide whether or not it is evicted once there are
+// more outbound peers than the target.
+type extraOutboundCandidate struct {
+	id            int32
+	connected     time.Time
+	lastBlockTime time.Time
+}
+
+// selectExtraOutboundToEvict chooses the outbound peer to evict among the
+// passed candidates to get back to the target number of outbound peers.  The
+// peer which has gone the longest without relaying a new block is chosen,
+// preferring the most recently connected peer on ties.  The sync peer and peers
+// which have not had a chance to relay a block yet are never evicted.  False is
+// returned when none of the candidates can be evicted.
+func selectExtraOutboundToEvict(candidates []extraOutboundCandidate,
+	syncPeerID int32, now time.Time) (int32, bool) {
+
+	var evict *extraOutboundCandidate
+	for i := range candidates {
+		c := &candidates[i]
+		if c.id == syncPeerID ||
+			now.Sub(c.connected) < minExtraOutboundConnTime {
+
+			continue
+		}
+		if evict == nil || c.lastBlockTime.Before(evict.lastBlockTime) ||
+			(c.lastBlockTime.Equal(evict.lastBlockTime) &&
+				c.id > evict.id) {
+
+			evict = c
+		}
+	}
+	if evict == nil {
+		return 0, false
+	}
+	return evict.id, true
+}
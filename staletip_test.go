@@ -0,0 +1,98 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSelectExtraOutboundToEvict ensures the extra outbound peer chosen for
+// eviction is the one which has gone the longest without relaying a new block
+// and that the sync peer and recently connected peers are never evicted.
+func TestSelectExtraOutboundToEvict(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-minExtraOutboundConnTime - time.Second)
+	recent := now.Add(-minExtraOutboundConnTime + time.Second)
+	block := func(minutes int) time.Time {
+		return now.Add(-time.Duration(minutes) * time.Minute)
+	}
+
+	tests := []struct {
+		name       string
+		candidates []extraOutboundCandidate
+		syncPeerID int32
+		wantID     int32
+		wantOK     bool
+	}{
+		{
+			name: "no candidates",
+		},
+		{
+			name: "oldest block relay",
+			candidates: []extraOutboundCandidate{
+				{id: 1, connected: old, lastBlockTime: block(1)},
+				{id: 2, connected: old, lastBlockTime: block(30)},
+				{id: 3, connected: old, lastBlockTime: block(5)},
+			},
+			wantID: 2,
+			wantOK: true,
+		},
+		{
+			name: "newest peer on ties",
+			candidates: []extraOutboundCandidate{
+				{id: 4, connected: old, lastBlockTime: block(10)},
+				{id: 6, connected: old, lastBlockTime: block(10)},
+				{id: 5, connected: old, lastBlockTime: block(10)},
+			},
+			wantID: 6,
+			wantOK: true,
+		},
+		{
+			name: "never relayed a block",
+			candidates: []extraOutboundCandidate{
+				{id: 1, connected: old, lastBlockTime: block(10)},
+				{id: 2, connected: old, lastBlockTime: time.Unix(0, 0)},
+			},
+			wantID: 2,
+			wantOK: true,
+		},
+		{
+			name: "sync peer protected",
+			candidates: []extraOutboundCandidate{
+				{id: 1, connected: old, lastBlockTime: block(10)},
+				{id: 2, connected: old, lastBlockTime: block(30)},
+			},
+			syncPeerID: 2,
+			wantID:     1,
+			wantOK:     true,
+		},
+		{
+			name: "recently connected peer protected",
+			candidates: []extraOutboundCandidate{
+				{id: 1, connected: old, lastBlockTime: block(10)},
+				{id: 2, connected: recent, lastBlockTime: time.Unix(0, 0)},
+			},
+			wantID: 1,
+			wantOK: true,
+		},
+		{
+			name: "all protected",
+			candidates: []extraOutboundCandidate{
+				{id: 1, connected: old, lastBlockTime: block(10)},
+				{id: 2, connected: recent, lastBlockTime: block(30)},
+			},
+			syncPeerID: 1,
+		},
+	}
+	for _, test := range tests {
+		id, ok := selectExtraOutboundToEvict(test.candidates,
+			test.syncPeerID, now)
+		if ok != test.wantOK || id != test.wantID {
+			t.Errorf("%s: got %d %v, want %d %v", test.name, id, ok,
+				test.wantID, test.wantOK)
+		}
+	}
+}
@@ -57,6 +57,13 @@ const (
 	CmdCFilter      = "cfilter"
 	CmdCFHeaders    = "cfheaders"
 	CmdCFCheckpt    = "cfcheckpt"
+	CmdSendCmpct    = "sendcmpct"
+	CmdCmpctBlock   = "cmpctblock"
+	CmdGetBlockTxn  = "getblocktxn"
+	CmdBlockTxn     = "blocktxn"
+	CmdSendAddrV2   = "sendaddrv2"
+	CmdAddrV2       = "addrv2"
+	CmdWTxIdRelay   = "wtxidrelay"
 )
 
 // MessageEncoding represents the wire message encoding format to be used.
@@ -180,6 +187,27 @@ func makeEmptyMessage(command string) (Message, error) {
 	case CmdCFCheckpt:
 		msg = &MsgCFCheckpt{}
 
+	case CmdSendCmpct:
+		msg = &MsgSendCmpct{}
+
+	case CmdCmpctBlock:
+		msg = &MsgCmpctBlock{}
+
+	case CmdGetBlockTxn:
+		msg = &MsgGetBlockTxn{}
+
+	case CmdBlockTxn:
+		msg = &MsgBlockTxn{}
+
+	case CmdSendAddrV2:
+		msg = &MsgSendAddrV2{}
+
+	case CmdAddrV2:
+		msg = &MsgAddrV2{}
+
+	case CmdWTxIdRelay:
+		msg = &MsgWTxIdRelay{}
+
 	default:
 		return nil, fmt.Errorf("unhandled command [%s]", command)
 	}
@@ -415,6 +443,94 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, btcnet BitcoinNet,
 	return totalBytes, msg, payload, nil
 }
 
+// EncodeMessagePayload returns the payload of the passed message encoded for
+// the provided protocol version and message encoding.  It is used by
+// transports which don't frame messages with the message header, such as the
+// v2 encrypted transport (BIP0324).
+func EncodeMessagePayload(msg Message, pver uint32, encoding MessageEncoding) ([]byte, error) {
+	// Enforce max command size.
+	cmd := msg.Command()
+	if len(cmd) > CommandSize {
+		str := fmt.Sprintf("command [%s] is too long [max %v]",
+			cmd, CommandSize)
+		return nil, messageError("EncodeMessagePayload", str)
+	}
+
+	// Encode the message payload.
+	var bw bytes.Buffer
+	err := msg.BtcEncode(&bw, pver, encoding)
+	if err != nil {
+		return nil, err
+	}
+	payload := bw.Bytes()
+	lenp := len(payload)
+
+	// Enforce maximum overall message payload.
+	if lenp > MaxMessagePayload {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload is %d bytes",
+			lenp, MaxMessagePayload)
+		return nil, messageError("EncodeMessagePayload", str)
+	}
+
+	// Enforce maximum message payload based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(lenp) > mpl {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload size for "+
+			"messages of type [%s] is %d.", lenp, cmd, mpl)
+		return nil, messageError("EncodeMessagePayload", str)
+	}
+
+	return payload, nil
+}
+
+// DecodeMessagePayload validates and parses the payload of a bitcoin Message
+// with the passed command for the provided protocol version and message
+// encoding.  It is used by transports which don't frame messages with the
+// message header, such as the v2 encrypted transport (BIP0324).
+func DecodeMessagePayload(command string, payload []byte, pver uint32,
+	encoding MessageEncoding) (Message, error) {
+
+	// Enforce maximum message payload.
+	if len(payload) > MaxMessagePayload {
+		str := fmt.Sprintf("message payload is too large - %d bytes, "+
+			"but max message payload is %d bytes.", len(payload),
+			MaxMessagePayload)
+		return nil, messageError("DecodeMessagePayload", str)
+	}
+
+	// Check for malformed commands.
+	if !utf8.ValidString(command) {
+		str := fmt.Sprintf("invalid command %v", []byte(command))
+		return nil, messageError("DecodeMessagePayload", str)
+	}
+
+	// Create struct of appropriate message type based on the command.
+	msg, err := makeEmptyMessage(command)
+	if err != nil {
+		return nil, messageError("DecodeMessagePayload", err.Error())
+	}
+
+	// Check for maximum length based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(len(payload)) > mpl {
+		str := fmt.Sprintf("payload exceeds max length - %v bytes, "+
+			"but max payload size for messages of type [%v] is %v.",
+			len(payload), command, mpl)
+		return nil, messageError("DecodeMessagePayload", str)
+	}
+
+	// Unmarshal message.  NOTE: This must be a *bytes.Buffer since the
+	// MsgVersion BtcDecode function requires it.
+	err = msg.BtcDecode(bytes.NewBuffer(payload), pver, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
 // ReadMessageN reads, validates, and parses the next bitcoin Message from r for
 // the provided protocol version and bitcoin network.  It returns the number of
 // bytes read in addition to the parsed Message and raw bytes which comprise the
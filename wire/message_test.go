@@ -76,6 +76,13 @@ func TestMessage(t *testing.T) {
 		[]byte("payload"))
 	msgCFHeaders := NewMsgCFHeaders()
 	msgCFCheckpt := NewMsgCFCheckpt(GCSFilterRegular, &chainhash.Hash{}, 0)
+	msgSendCmpct := NewMsgSendCmpct(true, 1)
+	msgCmpctBlock := NewMsgCmpctBlock(bh, 0)
+	msgGetBlockTxn := NewMsgGetBlockTxn(&chainhash.Hash{})
+	msgBlockTxn := NewMsgBlockTxn(&chainhash.Hash{})
+	msgSendAddrV2 := NewMsgSendAddrV2()
+	msgAddrV2 := NewMsgAddrV2()
+	msgWTxIdRelay := NewMsgWTxIdRelay()
 
 	tests := []struct {
 		in     Message    // Value to encode
@@ -111,6 +118,13 @@ func TestMessage(t *testing.T) {
 		{msgCFilter, msgCFilter, pver, MainNet, 65},
 		{msgCFHeaders, msgCFHeaders, pver, MainNet, 90},
 		{msgCFCheckpt, msgCFCheckpt, pver, MainNet, 58},
+		{msgSendCmpct, msgSendCmpct, pver, MainNet, 33},
+		{msgCmpctBlock, msgCmpctBlock, pver, MainNet, 114},
+		{msgGetBlockTxn, msgGetBlockTxn, pver, MainNet, 57},
+		{msgBlockTxn, msgBlockTxn, pver, MainNet, 57},
+		{msgSendAddrV2, msgSendAddrV2, pver, MainNet, 24},
+		{msgAddrV2, msgAddrV2, pver, MainNet, 25},
+		{msgWTxIdRelay, msgWTxIdRelay, pver, MainNet, 24},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -457,3 +471,76 @@ func TestWriteMessageWireErrors(t *testing.T) {
 		}
 	}
 }
+
+// TestMessagePayload tests the EncodeMessagePayload and DecodeMessagePayload
+// API used by transports which don't frame messages with the message header.
+func TestMessagePayload(t *testing.T) {
+	pver := ProtocolVersion
+	wireErr := &MessageError{}
+
+	// Ensure messages survive a round trip.
+	msgs := []Message{
+		NewMsgVerAck(),
+		NewMsgPing(123123),
+		NewMsgInv(),
+		&blockOne,
+	}
+	for i, msg := range msgs {
+		payload, err := EncodeMessagePayload(msg, pver, BaseEncoding)
+		if err != nil {
+			t.Errorf("EncodeMessagePayload #%d error %v", i, err)
+			continue
+		}
+		got, err := DecodeMessagePayload(msg.Command(), payload, pver,
+			BaseEncoding)
+		if err != nil {
+			t.Errorf("DecodeMessagePayload #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, msg) {
+			t.Errorf("DecodeMessagePayload #%d\n got: %s want: %s", i,
+				spew.Sdump(got), spew.Sdump(msg))
+		}
+	}
+
+	// Ensure messages which can't be encoded are rejected.
+	encodeTests := []Message{
+		&fakeMessage{command: "somethingtoolong"},
+		&fakeMessage{forceEncodeErr: true},
+		&fakeMessage{payload: make([]byte, MaxMessagePayload+1)},
+		&fakeMessage{payload: make([]byte, 1), forceLenErr: true},
+	}
+	for i, msg := range encodeTests {
+		_, err := EncodeMessagePayload(msg, pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(wireErr) {
+			t.Errorf("EncodeMessagePayload #%d wrong error got: %v, "+
+				"want: %T", i, err, wireErr)
+		}
+	}
+
+	// Ensure payloads which can't be decoded are rejected.
+	decodeTests := []struct {
+		command string // Command of the payload
+		payload []byte // Payload to decode
+		err     error  // Expected error
+	}{
+		// Payload exceeds max overall message payload.
+		{CmdPing, make([]byte, MaxMessagePayload+1), wireErr},
+		// Invalid command.
+		{"\xff", nil, wireErr},
+		// Unknown command.
+		{"bogus", nil, wireErr},
+		// Payload exceeds max payload for message type.
+		{CmdVerAck, []byte{0x00}, wireErr},
+		// Truncated payload.
+		{CmdPing, []byte{0x00}, io.ErrUnexpectedEOF},
+	}
+	for i, test := range decodeTests {
+		_, err := DecodeMessagePayload(test.command, test.payload, pver,
+			BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.err) {
+			t.Errorf("DecodeMessagePayload #%d wrong error got: %v, "+
+				"want: %T", i, err, test.err)
+		}
+	}
+}
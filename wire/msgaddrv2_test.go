@@ -0,0 +1,327 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestAddrV2 tests the MsgAddrV2 API.
+func TestAddrV2(t *testing.T) {
+	pver := ProtocolVersion
+
+	// Ensure the command is expected value.
+	wantCmd := "addrv2"
+	msg := NewMsgAddrV2()
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgAddrV2: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	// Num addresses (varInt) + max allowed addresses.
+	wantPayload := uint32(MaxVarIntPayload + MaxAddrPerMsg*537)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure NetAddresses are added properly.
+	na := NewNetAddressV2(NetworkTorV3, make([]byte, 32), 8333,
+		SFNodeNetwork)
+	err := msg.AddAddress(na)
+	if err != nil {
+		t.Errorf("AddAddress: %v", err)
+	}
+	if msg.AddrList[0] != na {
+		t.Errorf("AddAddress: wrong address added - got %v, want %v",
+			spew.Sprint(msg.AddrList[0]), spew.Sprint(na))
+	}
+
+	// Ensure the address list is cleared properly.
+	msg.ClearAddresses()
+	if len(msg.AddrList) != 0 {
+		t.Errorf("ClearAddresses: address list is not empty - "+
+			"got %v [%v], want %v", len(msg.AddrList),
+			spew.Sprint(msg.AddrList[0]), 0)
+	}
+
+	// Ensure adding more than the max allowed addresses per message returns
+	// error.
+	for i := 0; i < MaxAddrPerMsg+1; i++ {
+		err = msg.AddAddress(na)
+	}
+	if err == nil {
+		t.Errorf("AddAddress: expected error on too many addresses " +
+			"not received")
+	}
+	err = msg.AddAddresses(na)
+	if err == nil {
+		t.Errorf("AddAddresses: expected error on too many addresses " +
+			"not received")
+	}
+}
+
+// TestAddrV2Wire tests the MsgAddrV2 wire encode and decode for addresses of
+// the various networks.
+func TestAddrV2Wire(t *testing.T) {
+	// A couple of addresses of different networks.
+	na := &NetAddressV2{
+		Timestamp: time.Unix(0x495fab29, 0), // 2009-01-03 12:15:05 -0600 CST
+		Services:  SFNodeNetwork,
+		Network:   NetworkIPv4,
+		Addr:      []byte(net.ParseIP("127.0.0.1").To4()),
+		Port:      8333,
+	}
+	onion := make([]byte, 32)
+	for i := range onion {
+		onion[i] = byte(i)
+	}
+	na2 := &NetAddressV2{
+		Timestamp: time.Unix(0x495fab29, 0), // 2009-01-03 12:15:05 -0600 CST
+		Services:  SFNodeNetwork | SFNodeWitness,
+		Network:   NetworkTorV3,
+		Addr:      onion,
+		Port:      8334,
+	}
+
+	// Unknown networks are decoded as is so they can be ignored.
+	na3 := &NetAddressV2{
+		Timestamp: time.Unix(0x495fab29, 0), // 2009-01-03 12:15:05 -0600 CST
+		Services:  0,
+		Network:   NetworkID(0x42),
+		Addr:      []byte{0x01, 0x02, 0x03},
+		Port:      0,
+	}
+
+	// Empty address message.
+	noAddr := NewMsgAddrV2()
+	noAddrEncoded := []byte{
+		0x00, // Varint for number of addresses
+	}
+
+	// Address message with multiple addresses.
+	multiAddr := NewMsgAddrV2()
+	multiAddr.AddAddresses(na, na2, na3)
+	multiAddrEncoded := []byte{
+		0x03,                   // Varint for number of addresses
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01,                   // Varint for services
+		0x01,                   // Network IPv4
+		0x04,                   // Varint for address length
+		0x7f, 0x00, 0x00, 0x01, // IP 127.0.0.1
+		0x20, 0x8d, // Port 8333 in big-endian
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x09, // Varint for services
+		0x04, // Network TorV3
+		0x20, // Varint for address length
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07,
+		0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17,
+		0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f, // Tor v3 key
+		0x20, 0x8e, // Port 8334 in big-endian
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x00,             // Varint for services
+		0x42,             // Unknown network
+		0x03,             // Varint for address length
+		0x01, 0x02, 0x03, // Address
+		0x00, 0x00, // Port 0
+	}
+
+	tests := []struct {
+		in   *MsgAddrV2 // Message to encode
+		out  *MsgAddrV2 // Expected decoded message
+		buf  []byte     // Wire encoding
+		pver uint32     // Protocol version for wire encoding
+	}{
+		// Latest protocol version with no addresses.
+		{noAddr, noAddr, noAddrEncoded, ProtocolVersion},
+
+		// Latest protocol version with multiple addresses.
+		{multiAddr, multiAddr, multiAddrEncoded, ProtocolVersion},
+
+		// Protocol version AddrV2Version with multiple addresses.
+		{multiAddr, multiAddr, multiAddrEncoded, AddrV2Version},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.BtcEncode(&buf, test.pver, BaseEncoding)
+		if err != nil {
+			t.Errorf("BtcEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("BtcEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgAddrV2
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.BtcDecode(rbuf, test.pver, BaseEncoding)
+		if err != nil {
+			t.Errorf("BtcDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.out) {
+			t.Errorf("BtcDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(msg), spew.Sdump(test.out))
+			continue
+		}
+	}
+}
+
+// TestAddrV2WireErrors performs negative tests against wire encode and decode
+// of MsgAddrV2 to confirm error paths work correctly.
+func TestAddrV2WireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	wireErr := &MessageError{}
+
+	// A couple of NetAddressV2s to use for testing.
+	na := &NetAddressV2{
+		Timestamp: time.Unix(0x495fab29, 0), // 2009-01-03 12:15:05 -0600 CST
+		Services:  SFNodeNetwork,
+		Network:   NetworkIPv4,
+		Addr:      []byte(net.ParseIP("127.0.0.1").To4()),
+		Port:      8333,
+	}
+
+	// Address message with a single address.
+	baseAddr := NewMsgAddrV2()
+	baseAddr.AddAddress(na)
+	baseAddrEncoded := []byte{
+		0x01,                   // Varint for number of addresses
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01,                   // Varint for services
+		0x01,                   // Network IPv4
+		0x04,                   // Varint for address length
+		0x7f, 0x00, 0x00, 0x01, // IP 127.0.0.1
+		0x20, 0x8d, // Port 8333 in big-endian
+	}
+
+	// Message that forces an error by having more than the max allowed
+	// addresses.
+	maxAddr := NewMsgAddrV2()
+	for i := 0; i < MaxAddrPerMsg; i++ {
+		maxAddr.AddAddress(na)
+	}
+	maxAddr.AddrList = append(maxAddr.AddrList, na)
+	maxAddrEncoded := []byte{
+		0xfd, 0xe9, 0x03, // Varint for number of addresses (1001)
+	}
+
+	// Message that forces an error by having an address of a known network
+	// with the wrong size.
+	badSize := NewMsgAddrV2()
+	badSize.AddAddress(&NetAddressV2{Network: NetworkTorV3,
+		Addr: make([]byte, 31)})
+	badSizeEncoded := []byte{
+		0x01,                   // Varint for number of addresses
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01, // Varint for services
+		0x04, // Network TorV3
+		0x03, // Varint for address length
+		0x01, 0x02, 0x03,
+	}
+
+	// Message that forces an error by having an address which exceeds the
+	// max allowed size.
+	tooLong := NewMsgAddrV2()
+	tooLong.AddAddress(&NetAddressV2{Network: NetworkID(0x42),
+		Addr: make([]byte, MaxNetAddressV2Size+1)})
+	tooLongEncoded := []byte{
+		0x01,                   // Varint for number of addresses
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01,             // Varint for services
+		0x42,             // Unknown network
+		0xfd, 0x01, 0x02, // Varint for address length (513)
+	}
+
+	tests := []struct {
+		in       *MsgAddrV2 // Value to encode
+		buf      []byte     // Wire encoding
+		pver     uint32     // Protocol version for wire encoding
+		max      int        // Max size of fixed buffer to induce errors
+		writeErr error      // Expected write error
+		readErr  error      // Expected read error
+	}{
+		// Latest protocol version with intentional read/write errors.
+		// Force error in addresses count
+		{baseAddr, baseAddrEncoded, pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error in timestamp.
+		{baseAddr, baseAddrEncoded, pver, 1, io.ErrShortWrite, io.EOF},
+		// Force error in services.
+		{baseAddr, baseAddrEncoded, pver, 5, io.ErrShortWrite, io.EOF},
+		// Force error in network id.
+		{baseAddr, baseAddrEncoded, pver, 6, io.ErrShortWrite, io.EOF},
+		// Force error in address.
+		{baseAddr, baseAddrEncoded, pver, 7, io.ErrShortWrite, io.EOF},
+		// Force error in port.
+		{baseAddr, baseAddrEncoded, pver, 12, io.ErrShortWrite, io.EOF},
+		// Force error due to unsupported protocol version.
+		{baseAddr, baseAddrEncoded, AddrV2Version - 1, 0, wireErr, wireErr},
+		// Force error with greater than max inventory vectors.
+		{maxAddr, maxAddrEncoded, pver, 3, wireErr, wireErr},
+		// Force error with known network of the wrong size.
+		{badSize, badSizeEncoded, pver, 100, nil, wireErr},
+		// Force error with address larger than the max allowed size.
+		{tooLong, tooLongEncoded, pver, 1000, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.BtcEncode(w, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("BtcEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.writeErr {
+				t.Errorf("BtcEncode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.writeErr)
+				continue
+			}
+		}
+
+		// Decode from wire format.
+		var msg MsgAddrV2
+		r := newFixedReader(test.max, test.buf)
+		err = msg.BtcDecode(r, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.readErr {
+				t.Errorf("BtcDecode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.readErr)
+				continue
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// MsgBlockTxn implements the Message interface and represents a bitcoin
+// blocktxn message.  It is used to deliver the transactions requested by a
+// getblocktxn message in the same order they were requested (BIP0152).
+//
+// This message was not added until protocol versions starting with
+// ShortIDsBlocksVersion.
+type MsgBlockTxn struct {
+	BlockHash    chainhash.Hash
+	Transactions []*MsgTx
+}
+
+// AddTransaction adds a transaction to the message.
+func (msg *MsgBlockTxn) AddTransaction(tx *MsgTx) {
+	msg.Transactions = append(msg.Transactions, tx)
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("blocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgBlockTxn.BtcDecode", str)
+	}
+
+	err := readElement(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	// Prevent more transactions than could possibly fit into a block.
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %d, max %d]", count, maxTxPerBlock)
+		return messageError("MsgBlockTxn.BtcDecode", str)
+	}
+
+	msg.Transactions = make([]*MsgTx, 0, count)
+	for i := uint64(0); i < count; i++ {
+		tx := MsgTx{}
+		if err := tx.BtcDecode(r, pver, enc); err != nil {
+			return err
+		}
+		msg.AddTransaction(&tx)
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("blocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgBlockTxn.BtcEncode", str)
+	}
+
+	count := len(msg.Transactions)
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %d, max %d]", count, maxTxPerBlock)
+		return messageError("MsgBlockTxn.BtcEncode", str)
+	}
+
+	err := writeElement(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range msg.Transactions {
+		if err := tx.BtcEncode(w, pver, enc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgBlockTxn) Command() string {
+	return CmdBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	return MaxBlockPayload
+}
+
+// NewMsgBlockTxn returns a new bitcoin blocktxn message that conforms to the
+// Message interface.  See MsgBlockTxn for details.
+func NewMsgBlockTxn(blockHash *chainhash.Hash) *MsgBlockTxn {
+	return &MsgBlockTxn{
+		BlockHash:    *blockHash,
+		Transactions: make([]*MsgTx, 0),
+	}
+}
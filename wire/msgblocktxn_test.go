@@ -0,0 +1,185 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestBlockTxn tests the MsgBlockTxn API.
+func TestBlockTxn(t *testing.T) {
+	pver := ProtocolVersion
+
+	hash := blockOne.BlockHash()
+	msg := NewMsgBlockTxn(&hash)
+	if !msg.BlockHash.IsEqual(&hash) {
+		t.Errorf("NewMsgBlockTxn: wrong block hash - got %v, want %v",
+			msg.BlockHash, hash)
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "blocktxn"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgBlockTxn: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	wantPayload := uint32(MaxBlockPayload)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure transactions are added properly.
+	msg.AddTransaction(multiTx)
+	if len(msg.Transactions) != 1 || msg.Transactions[0] != multiTx {
+		t.Errorf("AddTransaction: wrong transactions - got %v",
+			spew.Sdump(msg.Transactions))
+	}
+}
+
+// TestBlockTxnWire tests the MsgBlockTxn wire encode and decode for both the
+// base and witness encodings.
+func TestBlockTxnWire(t *testing.T) {
+	hash := blockOne.BlockHash()
+	msg := NewMsgBlockTxn(&hash)
+	msg.AddTransaction(multiWitnessTx)
+
+	tests := []struct {
+		enc    MessageEncoding // Message encoding format
+		txBuf  []byte          // Expected transaction encoding
+		stripW bool            // Whether witness data is lost
+	}{
+		{WitnessEncoding, multiWitnessTxEncoded, false},
+		{BaseEncoding, nil, true},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		var buf bytes.Buffer
+		err := msg.BtcEncode(&buf, ProtocolVersion, test.enc)
+		if err != nil {
+			t.Errorf("BtcEncode #%d error %v", i, err)
+			continue
+		}
+		if test.txBuf != nil {
+			want := append(hash[:0:0], hash[:]...)
+			want = append(want, 0x01)
+			want = append(want, test.txBuf...)
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("BtcEncode #%d\n got: %s want: %s", i,
+					spew.Sdump(buf.Bytes()), spew.Sdump(want))
+				continue
+			}
+		}
+
+		var readMsg MsgBlockTxn
+		err = readMsg.BtcDecode(&buf, ProtocolVersion, test.enc)
+		if err != nil {
+			t.Errorf("BtcDecode #%d error %v", i, err)
+			continue
+		}
+		if len(readMsg.Transactions) != 1 {
+			t.Errorf("BtcDecode #%d wrong number of transactions %d",
+				i, len(readMsg.Transactions))
+			continue
+		}
+		gotTx := readMsg.Transactions[0]
+		if gotTx.TxHash() != multiWitnessTx.TxHash() {
+			t.Errorf("BtcDecode #%d wrong transaction hash", i)
+		}
+		if gotTx.HasWitness() == test.stripW {
+			t.Errorf("BtcDecode #%d wrong witness state", i)
+		}
+	}
+}
+
+// TestBlockTxnWireErrors performs negative tests against wire encode and
+// decode of MsgBlockTxn to confirm error paths work correctly.
+func TestBlockTxnWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	wireErr := &MessageError{}
+
+	hash := blockOne.BlockHash()
+	baseBlockTxn := NewMsgBlockTxn(&hash)
+	baseBlockTxn.AddTransaction(multiTx)
+	baseBlockTxnEncoded := append(hash[:0:0], hash[:]...)
+	baseBlockTxnEncoded = append(baseBlockTxnEncoded, 0x01)
+	baseBlockTxnEncoded = append(baseBlockTxnEncoded, multiTxEncoded...)
+
+	// Too many transactions can't be decoded.
+	tooManyEncoded := append(hash[:0:0], hash[:]...)
+	tooManyEncoded = append(tooManyEncoded, 0xfe, 0xff, 0xff, 0xff, 0x00)
+
+	tests := []struct {
+		in       *MsgBlockTxn // Value to encode
+		buf      []byte       // Wire encoding
+		pver     uint32       // Protocol version for wire encoding
+		max      int          // Max size of fixed buffer to induce errors
+		writeErr error        // Expected write error
+		readErr  error        // Expected read error
+	}{
+		// Force error in block hash.
+		{baseBlockTxn, baseBlockTxnEncoded, pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error in transaction count.
+		{baseBlockTxn, baseBlockTxnEncoded, pver, 32, io.ErrShortWrite, io.EOF},
+		// Force error in transaction.
+		{baseBlockTxn, baseBlockTxnEncoded, pver, 33, io.ErrShortWrite, io.EOF},
+		// Force error due to unsupported protocol version.
+		{baseBlockTxn, baseBlockTxnEncoded, ShortIDsBlocksVersion - 1, 0, wireErr, wireErr},
+		// Force error due to too many transactions.
+		{baseBlockTxn, tooManyEncoded, pver, 100, io.ErrShortWrite, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.BtcEncode(w, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("BtcEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.writeErr {
+				t.Errorf("BtcEncode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.writeErr)
+				continue
+			}
+		}
+
+		// Decode from wire format.
+		var msg MsgBlockTxn
+		r := newFixedReader(test.max, test.buf)
+		err = msg.BtcDecode(r, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.readErr {
+				t.Errorf("BtcDecode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.readErr)
+				continue
+			}
+		}
+	}
+}
@@ -0,0 +1,344 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/aead/siphash"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	// ShortIDSize is the number of bytes a short transaction id occupies
+	// in a cmpctblock message.
+	ShortIDSize = 6
+
+	// shortIDMask masks a siphash output down to the ShortIDSize bytes
+	// which make up a short transaction id.
+	shortIDMask = 0xffffffffffff
+
+	// maxPrefilledIndex is the maximum absolute transaction index that may
+	// be referenced by a differentially encoded index in the compact
+	// block messages.  BIP0152 limits indexes to 16 bits.
+	maxPrefilledIndex = 0xffff
+)
+
+// PrefilledTx defines a transaction which is sent in full along with a
+// cmpctblock message since the sender expects the receiver does not have it,
+// such as the coinbase.  Index is the absolute position of the transaction in
+// the block.  The wire encoding of the index is differential, however that
+// detail is handled by the encode and decode functions.
+type PrefilledTx struct {
+	Index uint32
+	Tx    *MsgTx
+}
+
+// MsgCmpctBlock implements the Message interface and represents a bitcoin
+// cmpctblock message.  It is used to relay a block using short transaction
+// ids in place of the transactions the receiver is expected to already have
+// in its memory pool (BIP0152).
+//
+// This message was not added until protocol versions starting with
+// ShortIDsBlocksVersion.
+type MsgCmpctBlock struct {
+	Header       BlockHeader
+	Nonce        uint64
+	ShortIDs     []uint64
+	PrefilledTxs []PrefilledTx
+}
+
+// AddShortID adds a short transaction id to the message.
+func (msg *MsgCmpctBlock) AddShortID(id uint64) {
+	msg.ShortIDs = append(msg.ShortIDs, id&shortIDMask)
+}
+
+// AddPrefilledTx adds a transaction which lives at the passed absolute index
+// within the block to the message.  Prefilled transactions must be added in
+// increasing index order.
+func (msg *MsgCmpctBlock) AddPrefilledTx(index uint32, tx *MsgTx) {
+	msg.PrefilledTxs = append(msg.PrefilledTxs, PrefilledTx{
+		Index: index,
+		Tx:    tx,
+	})
+}
+
+// TxCount returns the total number of transactions in the block described by
+// the message.
+func (msg *MsgCmpctBlock) TxCount() int {
+	return len(msg.ShortIDs) + len(msg.PrefilledTxs)
+}
+
+// ShortIDKey returns the siphash key used to calculate the short transaction
+// ids of the message.  It is the first 16 bytes of the single SHA256 hash of
+// the serialized block header followed by the little-endian nonce.
+func (msg *MsgCmpctBlock) ShortIDKey() [16]byte {
+	return ShortIDKey(&msg.Header, msg.Nonce)
+}
+
+// ShortIDKey returns the siphash key used to calculate short transaction ids
+// for the passed block header and nonce as described by BIP0152.
+func ShortIDKey(header *BlockHeader, nonce uint64) [16]byte {
+	var buf bytes.Buffer
+	buf.Grow(MaxBlockHeaderPayload + 8)
+	writeBlockHeader(&buf, 0, header)
+	writeElement(&buf, nonce)
+
+	var key [16]byte
+	copy(key[:], chainhash.HashB(buf.Bytes()))
+	return key
+}
+
+// ShortID returns the short transaction id for the passed transaction hash
+// and siphash key.  Version 1 compact blocks use the transaction hash while
+// version 2 compact blocks use the witness transaction hash.
+func ShortID(key *[16]byte, hash *chainhash.Hash) uint64 {
+	return siphash.Sum64(hash[:], key) & shortIDMask
+}
+
+// readShortID reads a ShortIDSize byte little-endian short transaction id
+// from r.
+func readShortID(r io.Reader) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:ShortIDSize]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+// writeShortID writes the passed short transaction id to w as a ShortIDSize
+// byte little-endian value.
+func writeShortID(w io.Writer, id uint64) error {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], id)
+	_, err := w.Write(buf[:ShortIDSize])
+	return err
+}
+
+// readDiffIndexes reads count differentially encoded transaction indexes from
+// r and returns them as absolute indexes.  The caller is expected to have
+// already bounded count.
+func readDiffIndexes(r io.Reader, pver uint32, count uint64, op string) ([]uint32, error) {
+	indexes := make([]uint32, 0, count)
+	var next uint64
+	for i := uint64(0); i < count; i++ {
+		diff, err := ReadVarInt(r, pver)
+		if err != nil {
+			return nil, err
+		}
+		if diff > maxPrefilledIndex || next+diff > maxPrefilledIndex {
+			str := fmt.Sprintf("transaction index overflow "+
+				"[prev %d, diff %d]", next, diff)
+			return nil, messageError(op, str)
+		}
+		index := next + diff
+		indexes = append(indexes, uint32(index))
+		next = index + 1
+	}
+	return indexes, nil
+}
+
+// writeDiffIndex writes the passed absolute transaction index to w using the
+// differential encoding.  next is the lowest index allowed at this position
+// and is updated for the following index.
+func writeDiffIndex(w io.Writer, pver uint32, index uint32, next *uint64, op string) error {
+	if uint64(index) < *next || index > maxPrefilledIndex {
+		str := fmt.Sprintf("transaction index %d is out of order or "+
+			"too large", index)
+		return messageError(op, str)
+	}
+	if err := WriteVarInt(w, pver, uint64(index)-*next); err != nil {
+		return err
+	}
+	*next = uint64(index) + 1
+	return nil
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	err := readBlockHeader(r, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = readElement(r, &msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	// Prevent more short ids than could possibly fit into a block.
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many short ids for message "+
+			"[count %d, max %d]", count, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	msg.ShortIDs = make([]uint64, 0, count)
+	for i := uint64(0); i < count; i++ {
+		id, err := readShortID(r)
+		if err != nil {
+			return err
+		}
+		msg.ShortIDs = append(msg.ShortIDs, id)
+	}
+
+	prefilledCount, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if prefilledCount > maxTxPerBlock-count {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[short ids %d, prefilled %d, max %d]", count,
+			prefilledCount, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	msg.PrefilledTxs = make([]PrefilledTx, 0, prefilledCount)
+	var next uint64
+	for i := uint64(0); i < prefilledCount; i++ {
+		diff, err := ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		if diff > maxPrefilledIndex || next+diff > maxPrefilledIndex {
+			str := fmt.Sprintf("prefilled transaction index "+
+				"overflow [prev %d, diff %d]", next, diff)
+			return messageError("MsgCmpctBlock.BtcDecode", str)
+		}
+		index := next + diff
+		next = index + 1
+
+		tx := MsgTx{}
+		if err := tx.BtcDecode(r, pver, enc); err != nil {
+			return err
+		}
+		msg.AddPrefilledTx(uint32(index), &tx)
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcEncode", str)
+	}
+
+	count := len(msg.ShortIDs) + len(msg.PrefilledTxs)
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %d, max %d]", count, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcEncode", str)
+	}
+
+	err := writeBlockHeader(w, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = writeElement(w, msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.ShortIDs)))
+	if err != nil {
+		return err
+	}
+	for _, id := range msg.ShortIDs {
+		if err := writeShortID(w, id); err != nil {
+			return err
+		}
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.PrefilledTxs)))
+	if err != nil {
+		return err
+	}
+	var next uint64
+	for _, ptx := range msg.PrefilledTxs {
+		err := writeDiffIndex(w, pver, ptx.Index, &next,
+			"MsgCmpctBlock.BtcEncode")
+		if err != nil {
+			return err
+		}
+		if err := ptx.Tx.BtcEncode(w, pver, enc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCmpctBlock) Command() string {
+	return CmdCmpctBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint32 {
+	// A compact block is never larger than the full block it describes.
+	return MaxBlockPayload
+}
+
+// BlockHash computes the block identifier hash for the block described by the
+// message.
+func (msg *MsgCmpctBlock) BlockHash() chainhash.Hash {
+	return msg.Header.BlockHash()
+}
+
+// NewMsgCmpctBlock returns a new bitcoin cmpctblock message that conforms to
+// the Message interface.  See MsgCmpctBlock for details.
+func NewMsgCmpctBlock(header *BlockHeader, nonce uint64) *MsgCmpctBlock {
+	return &MsgCmpctBlock{
+		Header:       *header,
+		Nonce:        nonce,
+		ShortIDs:     make([]uint64, 0),
+		PrefilledTxs: make([]PrefilledTx, 0, 1),
+	}
+}
+
+// NewMsgCmpctBlockFromBlock returns a new bitcoin cmpctblock message which
+// describes the passed block.  The coinbase transaction is prefilled and all
+// other transactions are represented by their short ids.  When useWitness is
+// set, the short ids are calculated from the witness transaction hashes as
+// required by version 2 compact blocks.
+func NewMsgCmpctBlockFromBlock(block *MsgBlock, nonce uint64, useWitness bool) *MsgCmpctBlock {
+	msg := NewMsgCmpctBlock(&block.Header, nonce)
+	if len(block.Transactions) == 0 {
+		return msg
+	}
+
+	key := msg.ShortIDKey()
+	msg.AddPrefilledTx(0, block.Transactions[0])
+	msg.ShortIDs = make([]uint64, 0, len(block.Transactions)-1)
+	for _, tx := range block.Transactions[1:] {
+		var hash chainhash.Hash
+		if useWitness {
+			hash = tx.WitnessHash()
+		} else {
+			hash = tx.TxHash()
+		}
+		msg.AddShortID(ShortID(&key, &hash))
+	}
+	return msg
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestCmpctBlock tests the MsgCmpctBlock API.
+func TestCmpctBlock(t *testing.T) {
+	pver := ProtocolVersion
+
+	block := MsgBlock{Header: blockOne.Header}
+	block.AddTransaction(blockOne.Transactions[0])
+	block.AddTransaction(multiTx)
+	block.AddTransaction(multiWitnessTx)
+
+	// Ensure the command is expected value.
+	msg := NewMsgCmpctBlockFromBlock(&block, 0x0102030405060708, false)
+	wantCmd := "cmpctblock"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgCmpctBlock: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	wantPayload := uint32(MaxBlockPayload)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure the block hash and transaction count match the block.
+	if msg.BlockHash() != block.BlockHash() {
+		t.Errorf("BlockHash: wrong hash - got %v, want %v",
+			msg.BlockHash(), block.BlockHash())
+	}
+	if msg.TxCount() != len(block.Transactions) {
+		t.Errorf("TxCount: wrong count - got %v, want %v",
+			msg.TxCount(), len(block.Transactions))
+	}
+
+	// Ensure only the coinbase is prefilled.
+	if len(msg.PrefilledTxs) != 1 || msg.PrefilledTxs[0].Index != 0 {
+		t.Fatalf("NewMsgCmpctBlockFromBlock: unexpected prefilled "+
+			"transactions %v", spew.Sdump(msg.PrefilledTxs))
+	}
+
+	// Ensure the short ids are calculated from the transaction hashes for
+	// version 1 and the witness hashes for version 2 compact blocks.
+	key := ShortIDKey(&block.Header, msg.Nonce)
+	msgWitness := NewMsgCmpctBlockFromBlock(&block, msg.Nonce, true)
+	for i, tx := range block.Transactions[1:] {
+		txHash := tx.TxHash()
+		if id := ShortID(&key, &txHash); msg.ShortIDs[i] != id {
+			t.Errorf("ShortIDs #%d: got %x, want %x", i,
+				msg.ShortIDs[i], id)
+		}
+		wtxHash := tx.WitnessHash()
+		if id := ShortID(&key, &wtxHash); msgWitness.ShortIDs[i] != id {
+			t.Errorf("witness ShortIDs #%d: got %x, want %x", i,
+				msgWitness.ShortIDs[i], id)
+		}
+		if msg.ShortIDs[i] > shortIDMask {
+			t.Errorf("ShortIDs #%d: %x exceeds %d bytes", i,
+				msg.ShortIDs[i], ShortIDSize)
+		}
+	}
+
+	// The witness transaction must produce a different short id for each
+	// version while the non-witness transaction must not.
+	if msg.ShortIDs[0] != msgWitness.ShortIDs[0] {
+		t.Errorf("ShortIDs: non-witness transaction ids differ")
+	}
+	if msg.ShortIDs[1] == msgWitness.ShortIDs[1] {
+		t.Errorf("ShortIDs: witness transaction ids do not differ")
+	}
+
+	// Ensure a different nonce results in a different key.
+	if ShortIDKey(&block.Header, msg.Nonce+1) == key {
+		t.Errorf("ShortIDKey: key did not change with nonce")
+	}
+}
+
+// TestCmpctBlockWire tests the MsgCmpctBlock wire encode and decode.
+func TestCmpctBlockWire(t *testing.T) {
+	msg := NewMsgCmpctBlock(&blockOne.Header, 7)
+	msg.AddShortID(0x0000060504030201)
+	msg.AddShortID(0x00000c0b0a090807)
+	msg.AddPrefilledTx(0, blockOne.Transactions[0])
+	msg.AddPrefilledTx(3, multiTx)
+
+	var want bytes.Buffer
+	writeBlockHeader(&want, 0, &blockOne.Header)
+	want.Write([]byte{
+		0x07, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Nonce
+		0x02,                               // Varint for number of short ids
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, // Short id 1
+		0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, // Short id 2
+		0x02, // Varint for number of prefilled txns
+		0x00, // Differential index 0
+	})
+	blockOne.Transactions[0].BtcEncode(&want, 0, BaseEncoding)
+	want.WriteByte(0x02) // Differential index 3 - (0 + 1)
+	want.Write(multiTxEncoded)
+
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, ProtocolVersion, BaseEncoding)
+	if err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(want.Bytes()))
+	}
+
+	var readMsg MsgCmpctBlock
+	err = readMsg.BtcDecode(&buf, ProtocolVersion, BaseEncoding)
+	if err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(&readMsg),
+			spew.Sdump(msg))
+	}
+}
+
+// TestCmpctBlockWireErrors performs negative tests against wire encode and
+// decode of MsgCmpctBlock to confirm error paths work correctly.
+func TestCmpctBlockWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	wireErr := &MessageError{}
+
+	baseCmpctBlock := NewMsgCmpctBlock(&blockOne.Header, 7)
+	baseCmpctBlock.AddShortID(0x0000060504030201)
+	baseCmpctBlock.AddPrefilledTx(0, multiTx)
+	var encoded bytes.Buffer
+	baseCmpctBlock.BtcEncode(&encoded, pver, BaseEncoding)
+	baseCmpctBlockEncoded := encoded.Bytes()
+
+	// Out of order prefilled transactions can't be encoded.
+	unorderedCmpctBlock := NewMsgCmpctBlock(&blockOne.Header, 7)
+	unorderedCmpctBlock.AddPrefilledTx(1, multiTx)
+	unorderedCmpctBlock.AddPrefilledTx(1, multiTx)
+
+	// Prefilled indexes which overflow 16 bits can't be decoded.
+	overflowEncoded := make([]byte, 88)
+	copy(overflowEncoded, baseCmpctBlockEncoded[:88])
+	overflowEncoded = append(overflowEncoded, 0x00, 0x01, 0xfe, 0x00,
+		0x00, 0x01, 0x00)
+
+	// Too many short ids can't be decoded.
+	tooManyEncoded := make([]byte, 88)
+	copy(tooManyEncoded, baseCmpctBlockEncoded[:88])
+	tooManyEncoded = append(tooManyEncoded, 0xfe, 0xff, 0xff, 0xff, 0x00)
+
+	tests := []struct {
+		in       *MsgCmpctBlock // Value to encode
+		buf      []byte         // Wire encoding
+		pver     uint32         // Protocol version for wire encoding
+		max      int            // Max size of fixed buffer to induce errors
+		writeErr error          // Expected write error
+		readErr  error          // Expected read error
+	}{
+		// Force error in header.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error in nonce.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 80, io.ErrShortWrite, io.EOF},
+		// Force error in short id count.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 88, io.ErrShortWrite, io.EOF},
+		// Force error in short id.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 89, io.ErrShortWrite, io.EOF},
+		// Force error in prefilled count.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 95, io.ErrShortWrite, io.EOF},
+		// Force error in prefilled index.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 96, io.ErrShortWrite, io.EOF},
+		// Force error in prefilled transaction.
+		{baseCmpctBlock, baseCmpctBlockEncoded, pver, 97, io.ErrShortWrite, io.EOF},
+		// Force error due to unsupported protocol version.
+		{baseCmpctBlock, baseCmpctBlockEncoded, ShortIDsBlocksVersion - 1, 0, wireErr, wireErr},
+		// Force error due to out of order prefilled transactions and
+		// a prefilled index overflow.
+		{unorderedCmpctBlock, overflowEncoded, pver, 1000, wireErr, wireErr},
+		// Force error due to too many short ids.
+		{unorderedCmpctBlock, tooManyEncoded, pver, 1000, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.BtcEncode(w, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("BtcEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.writeErr {
+				t.Errorf("BtcEncode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.writeErr)
+				continue
+			}
+		}
+
+		// Decode from wire format.
+		var msg MsgCmpctBlock
+		r := newFixedReader(test.max, test.buf)
+		err = msg.BtcDecode(r, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.readErr {
+				t.Errorf("BtcDecode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.readErr)
+				continue
+			}
+		}
+	}
+}
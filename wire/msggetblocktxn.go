@@ -0,0 +1,126 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// MsgGetBlockTxn implements the Message interface and represents a bitcoin
+// getblocktxn message.  It is used to request the transactions of a block
+// previously announced with a cmpctblock message which could not be found in
+// the receiver's memory pool (BIP0152).  The peer responds with a blocktxn
+// message.
+//
+// Indexes holds the absolute positions of the requested transactions within
+// the block in increasing order.  The wire encoding of the indexes is
+// differential, however that detail is handled by the encode and decode
+// functions.
+//
+// This message was not added until protocol versions starting with
+// ShortIDsBlocksVersion.
+type MsgGetBlockTxn struct {
+	BlockHash chainhash.Hash
+	Indexes   []uint32
+}
+
+// AddIndex adds the passed absolute transaction index to the request.
+// Indexes must be added in increasing order.
+func (msg *MsgGetBlockTxn) AddIndex(index uint32) {
+	msg.Indexes = append(msg.Indexes, index)
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.BtcDecode", str)
+	}
+
+	err := readElement(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction indexes for message "+
+			"[count %d, max %d]", count, maxTxPerBlock)
+		return messageError("MsgGetBlockTxn.BtcDecode", str)
+	}
+
+	msg.Indexes, err = readDiffIndexes(r, pver, count,
+		"MsgGetBlockTxn.BtcDecode")
+	return err
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.BtcEncode", str)
+	}
+
+	count := len(msg.Indexes)
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction indexes for message "+
+			"[count %d, max %d]", count, maxTxPerBlock)
+		return messageError("MsgGetBlockTxn.BtcEncode", str)
+	}
+
+	err := writeElement(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+
+	var next uint64
+	for _, index := range msg.Indexes {
+		err := writeDiffIndex(w, pver, index, &next,
+			"MsgGetBlockTxn.BtcEncode")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Command() string {
+	return CmdGetBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	// Block hash + num indexes (varInt) + max indexes, each of which is
+	// at most a 3 byte varint since indexes are limited to 16 bits.
+	return chainhash.HashSize + MaxVarIntPayload + (maxTxPerBlock * 3)
+}
+
+// NewMsgGetBlockTxn returns a new bitcoin getblocktxn message that conforms
+// to the Message interface.  See MsgGetBlockTxn for details.
+func NewMsgGetBlockTxn(blockHash *chainhash.Hash) *MsgGetBlockTxn {
+	return &MsgGetBlockTxn{
+		BlockHash: *blockHash,
+		Indexes:   make([]uint32, 0),
+	}
+}
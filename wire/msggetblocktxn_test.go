@@ -0,0 +1,194 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestGetBlockTxn tests the MsgGetBlockTxn API.
+func TestGetBlockTxn(t *testing.T) {
+	pver := ProtocolVersion
+
+	hash := blockOne.BlockHash()
+	msg := NewMsgGetBlockTxn(&hash)
+	if !msg.BlockHash.IsEqual(&hash) {
+		t.Errorf("NewMsgGetBlockTxn: wrong block hash - got %v, want %v",
+			msg.BlockHash, hash)
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "getblocktxn"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgGetBlockTxn: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	// Block hash + num indexes (varInt) + max 3 byte indexes.
+	wantPayload := uint32(chainhash.HashSize + MaxVarIntPayload +
+		(maxTxPerBlock * 3))
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure indexes are added properly.
+	msg.AddIndex(1)
+	msg.AddIndex(5)
+	if !reflect.DeepEqual(msg.Indexes, []uint32{1, 5}) {
+		t.Errorf("AddIndex: wrong indexes - got %v", msg.Indexes)
+	}
+}
+
+// TestGetBlockTxnWire tests the MsgGetBlockTxn wire encode and decode.
+func TestGetBlockTxnWire(t *testing.T) {
+	hash := blockOne.BlockHash()
+	noIndexes := NewMsgGetBlockTxn(&hash)
+	noIndexesEncoded := append(hash[:0:0], hash[:]...)
+	noIndexesEncoded = append(noIndexesEncoded, 0x00)
+
+	multiIndexes := NewMsgGetBlockTxn(&hash)
+	multiIndexes.AddIndex(0)
+	multiIndexes.AddIndex(1)
+	multiIndexes.AddIndex(300)
+	multiIndexesEncoded := append(hash[:0:0], hash[:]...)
+	multiIndexesEncoded = append(multiIndexesEncoded,
+		0x03,             // Varint for number of indexes
+		0x00,             // Differential index 0
+		0x00,             // Differential index 1 - (0 + 1)
+		0xfd, 0x2a, 0x01, // Differential index 300 - (1 + 1)
+	)
+
+	tests := []struct {
+		in  *MsgGetBlockTxn // Message to encode
+		buf []byte          // Wire encoding
+	}{
+		{noIndexes, noIndexesEncoded},
+		{multiIndexes, multiIndexesEncoded},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.BtcEncode(&buf, ProtocolVersion, BaseEncoding)
+		if err != nil {
+			t.Errorf("BtcEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("BtcEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgGetBlockTxn
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.BtcDecode(rbuf, ProtocolVersion, BaseEncoding)
+		if err != nil {
+			t.Errorf("BtcDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.in) {
+			t.Errorf("BtcDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(&msg), spew.Sdump(test.in))
+			continue
+		}
+	}
+}
+
+// TestGetBlockTxnWireErrors performs negative tests against wire encode and
+// decode of MsgGetBlockTxn to confirm error paths work correctly.
+func TestGetBlockTxnWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	wireErr := &MessageError{}
+
+	hash := blockOne.BlockHash()
+	baseGetBlockTxn := NewMsgGetBlockTxn(&hash)
+	baseGetBlockTxn.AddIndex(2)
+	baseGetBlockTxnEncoded := append(hash[:0:0], hash[:]...)
+	baseGetBlockTxnEncoded = append(baseGetBlockTxnEncoded, 0x01, 0x02)
+
+	// Indexes which are not increasing can't be encoded and indexes which
+	// overflow 16 bits can't be decoded.
+	badIndexes := NewMsgGetBlockTxn(&hash)
+	badIndexes.AddIndex(2)
+	badIndexes.AddIndex(1)
+	badIndexesEncoded := append(hash[:0:0], hash[:]...)
+	badIndexesEncoded = append(badIndexesEncoded, 0x02, 0xfd, 0xff, 0xff,
+		0x00)
+
+	tests := []struct {
+		in       *MsgGetBlockTxn // Value to encode
+		buf      []byte          // Wire encoding
+		pver     uint32          // Protocol version for wire encoding
+		max      int             // Max size of fixed buffer to induce errors
+		writeErr error           // Expected write error
+		readErr  error           // Expected read error
+	}{
+		// Force error in block hash.
+		{baseGetBlockTxn, baseGetBlockTxnEncoded, pver, 0, io.ErrShortWrite, io.EOF},
+		// Force error in index count.
+		{baseGetBlockTxn, baseGetBlockTxnEncoded, pver, 32, io.ErrShortWrite, io.EOF},
+		// Force error in index.
+		{baseGetBlockTxn, baseGetBlockTxnEncoded, pver, 33, io.ErrShortWrite, io.EOF},
+		// Force error due to unsupported protocol version.
+		{baseGetBlockTxn, baseGetBlockTxnEncoded, ShortIDsBlocksVersion - 1, 34, wireErr, wireErr},
+		// Force error due to bad indexes.
+		{badIndexes, badIndexesEncoded, pver, 100, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.BtcEncode(w, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("BtcEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.writeErr {
+				t.Errorf("BtcEncode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.writeErr)
+				continue
+			}
+		}
+
+		// Decode from wire format.
+		var msg MsgGetBlockTxn
+		r := newFixedReader(test.max, test.buf)
+		err = msg.BtcDecode(r, test.pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+
+		// For errors which are not of type MessageError, check them for
+		// equality.
+		if _, ok := err.(*MessageError); !ok {
+			if err != test.readErr {
+				t.Errorf("BtcDecode #%d wrong error got: %v, "+
+					"want: %v", i, err, test.readErr)
+				continue
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgSendAddrV2 implements the Message interface and represents a bitcoin
+// sendaddrv2 message.  It is used to signal support for receiving addrv2
+// messages (BIP0155) and must be sent before the verack message.
+//
+// This message has no payload and was not added until protocol versions
+// starting with AddrV2Version.
+type MsgSendAddrV2 struct{}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSendAddrV2) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("sendaddrv2 message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendAddrV2.BtcDecode", str)
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSendAddrV2) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("sendaddrv2 message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendAddrV2.BtcEncode", str)
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSendAddrV2) Command() string {
+	return CmdSendAddrV2
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSendAddrV2) MaxPayloadLength(pver uint32) uint32 {
+	return 0
+}
+
+// NewMsgSendAddrV2 returns a new bitcoin sendaddrv2 message that conforms to
+// the Message interface.  See MsgSendAddrV2 for details.
+func NewMsgSendAddrV2() *MsgSendAddrV2 {
+	return &MsgSendAddrV2{}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// MsgSendCmpct implements the Message interface and represents a bitcoin
+// sendcmpct message.  It is used to signal support for compact block relay
+// (BIP0152) and, when Announce is set, to request that new blocks are
+// announced by sending a cmpctblock message directly rather than an inv or
+// headers message.
+//
+// The Version field selects the compact block encoding.  Version 1 short ids
+// are computed from transaction hashes while version 2 short ids are computed
+// from witness transaction hashes.
+//
+// This message was not added until protocol versions starting with
+// ShortIDsBlocksVersion.
+type MsgSendCmpct struct {
+	Announce bool
+	Version  uint64
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("sendcmpct message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendCmpct.BtcDecode", str)
+	}
+
+	return readElements(r, &msg.Announce, &msg.Version)
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < ShortIDsBlocksVersion {
+		str := fmt.Sprintf("sendcmpct message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendCmpct.BtcEncode", str)
+	}
+
+	return writeElements(w, msg.Announce, msg.Version)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSendCmpct) Command() string {
+	return CmdSendCmpct
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) MaxPayloadLength(pver uint32) uint32 {
+	// Announce flag 1 byte + version 8 bytes.
+	return 9
+}
+
+// NewMsgSendCmpct returns a new bitcoin sendcmpct message that conforms to
+// the Message interface.  See MsgSendCmpct for details.
+func NewMsgSendCmpct(announce bool, version uint64) *MsgSendCmpct {
+	return &MsgSendCmpct{
+		Announce: announce,
+		Version:  version,
+	}
+}
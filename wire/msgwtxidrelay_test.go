@@ -0,0 +1,70 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestWTxIdRelay tests the MsgWTxIdRelay API against the latest protocol
+// version.
+func TestWTxIdRelay(t *testing.T) {
+	pver := ProtocolVersion
+	enc := BaseEncoding
+
+	// Ensure the command is expected value.
+	wantCmd := "wtxidrelay"
+	msg := NewMsgWTxIdRelay()
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgWTxIdRelay: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(0)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Test encode with latest protocol version.
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, pver, enc)
+	if err != nil {
+		t.Errorf("encode of MsgWTxIdRelay failed %v err <%v>", msg,
+			err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("encode of MsgWTxIdRelay wrote %d bytes", buf.Len())
+	}
+
+	// Older protocol versions should fail encode since message didn't
+	// exist yet.
+	oldPver := WTxIdRelayVersion - 1
+	err = msg.BtcEncode(&buf, oldPver, enc)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("encode of MsgWTxIdRelay passed for old protocol "+
+			"version %v err <%v>", msg, err)
+	}
+
+	// Test decode with latest protocol version.
+	readmsg := NewMsgWTxIdRelay()
+	err = readmsg.BtcDecode(&buf, pver, enc)
+	if err != nil {
+		t.Errorf("decode of MsgWTxIdRelay failed [%v] err <%v>", buf,
+			err)
+	}
+
+	// Older protocol versions should fail decode since message didn't
+	// exist yet.
+	err = readmsg.BtcDecode(&buf, oldPver, enc)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("decode of MsgWTxIdRelay passed for old protocol "+
+			"version %v err <%v>", msg, err)
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// MaxNetAddressV2Size is the maximum number of bytes an address of any
+// network may occupy in a NetAddressV2 as defined by BIP0155.
+const MaxNetAddressV2Size = 512
+
+// maxNetAddressV2Payload is the max payload size for a bitcoin NetAddressV2.
+// Timestamp 4 bytes + services (varInt) + network id 1 byte + address length
+// (varInt) + max address bytes + port 2 bytes.
+const maxNetAddressV2Payload = 4 + MaxVarIntPayload + 1 + MaxVarIntPayload +
+	MaxNetAddressV2Size + 2
+
+// NetworkID identifies the network an address in a NetAddressV2 belongs to as
+// defined by BIP0155.
+type NetworkID uint8
+
+const (
+	// NetworkIPv4 identifies a 4 byte IPv4 address.
+	NetworkIPv4 NetworkID = 1
+
+	// NetworkIPv6 identifies a 16 byte IPv6 address.
+	NetworkIPv6 NetworkID = 2
+
+	// NetworkTorV2 identifies a 10 byte Tor v2 onion service address.
+	NetworkTorV2 NetworkID = 3
+
+	// NetworkTorV3 identifies a 32 byte Tor v3 onion service address which
+	// is the ed25519 public key of the service.
+	NetworkTorV3 NetworkID = 4
+
+	// NetworkI2P identifies a 32 byte I2P address which is the SHA256 of
+	// the destination.
+	NetworkI2P NetworkID = 5
+
+	// NetworkCJDNS identifies a 16 byte CJDNS address.
+	NetworkCJDNS NetworkID = 6
+)
+
+// networkAddrSizes maps each network known to this package to the exact size
+// its addresses must be.
+var networkAddrSizes = map[NetworkID]int{
+	NetworkIPv4:  net.IPv4len,
+	NetworkIPv6:  net.IPv6len,
+	NetworkTorV2: 10,
+	NetworkTorV3: 32,
+	NetworkI2P:   32,
+	NetworkCJDNS: net.IPv6len,
+}
+
+// Map of network ids back to their names for pretty printing.
+var networkIDStrings = map[NetworkID]string{
+	NetworkIPv4:  "IPv4",
+	NetworkIPv6:  "IPv6",
+	NetworkTorV2: "TorV2",
+	NetworkTorV3: "TorV3",
+	NetworkI2P:   "I2P",
+	NetworkCJDNS: "CJDNS",
+}
+
+// String returns the NetworkID in human-readable form.
+func (n NetworkID) String() string {
+	if s, ok := networkIDStrings[n]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown NetworkID (%d)", uint8(n))
+}
+
+// onionCatPrefix is the IPv6 prefix used to carry Tor v2 addresses in the
+// legacy 16 byte address field (fd87:d87e:eb43::/48).
+var onionCatPrefix = []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
+
+// NetAddressV2 defines information about a peer on the network including the
+// time it was last seen, the services it supports, its network address, and
+// port.  Unlike NetAddress, the address is variable length which allows it to
+// represent networks such as Tor v3, I2P and CJDNS as defined by BIP0155.
+type NetAddressV2 struct {
+	// Last time the address was seen.  This is encoded as a uint32 on the
+	// wire and therefore is limited to 2106.
+	Timestamp time.Time
+
+	// Bitfield which identifies the services supported by the address.
+	Services ServiceFlag
+
+	// Network the address belongs to.
+	Network NetworkID
+
+	// Addr is the raw address in the encoding of its network.
+	Addr []byte
+
+	// Port the peer is using.  This is encoded in big endian on the wire
+	// which differs from most everything else.
+	Port uint16
+}
+
+// HasService returns whether the specified service is supported by the address.
+func (na *NetAddressV2) HasService(service ServiceFlag) bool {
+	return na.Services&service == service
+}
+
+// AddService adds service as a supported service by the peer generating the
+// message.
+func (na *NetAddressV2) AddService(service ServiceFlag) {
+	na.Services |= service
+}
+
+// IsKnownNetwork returns whether the address belongs to a network known to
+// this package and is of the size that network requires.
+func (na *NetAddressV2) IsKnownNetwork() bool {
+	size, ok := networkAddrSizes[na.Network]
+	return ok && len(na.Addr) == size
+}
+
+// IP returns the address as an IP for the networks which can be represented
+// by one.  Tor v2 addresses are returned in the OnionCat range used by the
+// legacy address format.  Nil is returned for all other networks.
+func (na *NetAddressV2) IP() net.IP {
+	if !na.IsKnownNetwork() {
+		return nil
+	}
+
+	switch na.Network {
+	case NetworkIPv4, NetworkIPv6, NetworkCJDNS:
+		return net.IP(na.Addr).To16()
+
+	case NetworkTorV2:
+		ip := make(net.IP, 0, net.IPv6len)
+		ip = append(ip, onionCatPrefix...)
+		return append(ip, na.Addr...)
+	}
+
+	return nil
+}
+
+// ToLegacy returns the address as a NetAddress which can be sent in addr and
+// version messages.  Nil is returned when the address can not be represented
+// in the legacy format.  CJDNS addresses are not converted since they would be
+// mistaken for IPv6 addresses.
+func (na *NetAddressV2) ToLegacy() *NetAddress {
+	if na.Network == NetworkCJDNS {
+		return nil
+	}
+	ip := na.IP()
+	if ip == nil {
+		return nil
+	}
+
+	return &NetAddress{
+		Timestamp: na.Timestamp,
+		Services:  na.Services,
+		IP:        ip,
+		Port:      na.Port,
+	}
+}
+
+// ipNetwork returns the network id and raw address for the passed IP.  Tor v2
+// addresses in the OnionCat range are returned as such.
+func ipNetwork(ip net.IP) (NetworkID, []byte) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return NetworkIPv4, []byte(ip4)
+	}
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return NetworkIPv6, make([]byte, net.IPv6len)
+	}
+	if bytes.HasPrefix(ip16, onionCatPrefix) {
+		return NetworkTorV2, []byte(ip16[len(onionCatPrefix):])
+	}
+	return NetworkIPv6, []byte(ip16)
+}
+
+// NewNetAddressV2 returns a new NetAddressV2 using the provided network, raw
+// address, port, and supported services with defaults for the remaining
+// fields.
+func NewNetAddressV2(network NetworkID, addr []byte, port uint16,
+	services ServiceFlag) *NetAddressV2 {
+
+	return &NetAddressV2{
+		Timestamp: time.Unix(time.Now().Unix(), 0),
+		Services:  services,
+		Network:   network,
+		Addr:      addr,
+		Port:      port,
+	}
+}
+
+// NewNetAddressV2IPPort returns a new NetAddressV2 using the provided IP,
+// port, and supported services with defaults for the remaining fields.
+func NewNetAddressV2IPPort(ip net.IP, port uint16,
+	services ServiceFlag) *NetAddressV2 {
+
+	network, addr := ipNetwork(ip)
+	return NewNetAddressV2(network, addr, port, services)
+}
+
+// NetAddressV2FromLegacy returns a new NetAddressV2 holding the same
+// information as the passed legacy NetAddress.
+func NetAddressV2FromLegacy(na *NetAddress) *NetAddressV2 {
+	network, addr := ipNetwork(na.IP)
+	return &NetAddressV2{
+		Timestamp: na.Timestamp,
+		Services:  na.Services,
+		Network:   network,
+		Addr:      addr,
+		Port:      na.Port,
+	}
+}
+
+// readNetAddressV2 reads an encoded NetAddressV2 from r.  Addresses of unknown
+// networks are returned as is so the caller may ignore them, while addresses
+// of known networks with an invalid size are rejected.
+func readNetAddressV2(r io.Reader, pver uint32, na *NetAddressV2) error {
+	err := readElement(r, (*uint32Time)(&na.Timestamp))
+	if err != nil {
+		return err
+	}
+
+	services, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	network, err := binarySerializer.Uint8(r)
+	if err != nil {
+		return err
+	}
+
+	addr, err := ReadVarBytes(r, pver, MaxNetAddressV2Size, "address")
+	if err != nil {
+		return err
+	}
+	size, ok := networkAddrSizes[NetworkID(network)]
+	if ok && len(addr) != size {
+		str := fmt.Sprintf("invalid %v address size [got %d, want %d]",
+			NetworkID(network), len(addr), size)
+		return messageError("readNetAddressV2", str)
+	}
+
+	// Sigh.  Bitcoin protocol mixes little and big endian.
+	port, err := binarySerializer.Uint16(r, bigEndian)
+	if err != nil {
+		return err
+	}
+
+	*na = NetAddressV2{
+		Timestamp: na.Timestamp,
+		Services:  ServiceFlag(services),
+		Network:   NetworkID(network),
+		Addr:      addr,
+		Port:      port,
+	}
+	return nil
+}
+
+// writeNetAddressV2 serializes a NetAddressV2 to w.
+func writeNetAddressV2(w io.Writer, pver uint32, na *NetAddressV2) error {
+	if len(na.Addr) > MaxNetAddressV2Size {
+		str := fmt.Sprintf("address is larger than the max allowed "+
+			"size [count %d, max %d]", len(na.Addr),
+			MaxNetAddressV2Size)
+		return messageError("writeNetAddressV2", str)
+	}
+
+	err := writeElement(w, uint32(na.Timestamp.Unix()))
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(na.Services))
+	if err != nil {
+		return err
+	}
+
+	err = binarySerializer.PutUint8(w, uint8(na.Network))
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarBytes(w, pver, na.Addr)
+	if err != nil {
+		return err
+	}
+
+	// Sigh.  Bitcoin protocol mixes little and big endian.
+	return binary.Write(w, bigEndian, na.Port)
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+// TestNetAddressV2 tests the NetAddressV2 API.
+func TestNetAddressV2(t *testing.T) {
+	ip := net.ParseIP("127.0.0.1")
+	port := uint16(8333)
+
+	// Ensure IPv4 addresses are stored as 4 bytes.
+	na := NewNetAddressV2IPPort(ip, port, 0)
+	if na.Network != NetworkIPv4 || len(na.Addr) != net.IPv4len {
+		t.Errorf("NewNetAddressV2IPPort: wrong address - got %v %x",
+			na.Network, na.Addr)
+	}
+	if !na.IP().Equal(ip) {
+		t.Errorf("IP: wrong ip - got %v, want %v", na.IP(), ip)
+	}
+	if na.Port != port {
+		t.Errorf("NewNetAddressV2IPPort: wrong port - got %v, want %v",
+			na.Port, port)
+	}
+	if na.HasService(SFNodeNetwork) {
+		t.Errorf("HasService: SFNodeNetwork service is set")
+	}
+
+	// Ensure adding the full service node flag works.
+	na.AddService(SFNodeNetwork)
+	if !na.HasService(SFNodeNetwork) {
+		t.Errorf("HasService: SFNodeNetwork service not set")
+	}
+
+	// Ensure the legacy conversion round trips.
+	legacy := na.ToLegacy()
+	if legacy == nil || !legacy.IP.Equal(ip) || legacy.Port != port ||
+		legacy.Services != SFNodeNetwork {
+		t.Fatalf("ToLegacy: wrong address - got %v", legacy)
+	}
+	back := NetAddressV2FromLegacy(legacy)
+	if back.Network != na.Network || !bytes.Equal(back.Addr, na.Addr) {
+		t.Errorf("NetAddressV2FromLegacy: wrong address - got %v %x",
+			back.Network, back.Addr)
+	}
+
+	// Ensure IPv6 and OnionCat addresses are recognized.
+	ip6 := net.ParseIP("2001:db8::1")
+	if na := NewNetAddressV2IPPort(ip6, port, 0); na.Network != NetworkIPv6 {
+		t.Errorf("NewNetAddressV2IPPort: wrong network for %v - got %v",
+			ip6, na.Network)
+	}
+	onionCat := net.ParseIP("fd87:d87e:eb43:102:304:506:708:90a")
+	torV2 := NewNetAddressV2IPPort(onionCat, port, 0)
+	if torV2.Network != NetworkTorV2 || len(torV2.Addr) != 10 {
+		t.Errorf("NewNetAddressV2IPPort: wrong address for %v - got "+
+			"%v %x", onionCat, torV2.Network, torV2.Addr)
+	}
+	if !torV2.IP().Equal(onionCat) {
+		t.Errorf("IP: wrong ip - got %v, want %v", torV2.IP(), onionCat)
+	}
+
+	// Ensure addresses which can't be represented by the legacy format
+	// aren't converted.
+	tests := []struct {
+		na    *NetAddressV2
+		known bool
+	}{
+		{NewNetAddressV2(NetworkTorV3, make([]byte, 32), port, 0), true},
+		{NewNetAddressV2(NetworkI2P, make([]byte, 32), port, 0), true},
+		{NewNetAddressV2(NetworkCJDNS, net.ParseIP("fc00::1"), port, 0), true},
+		{NewNetAddressV2(NetworkTorV3, make([]byte, 16), port, 0), false},
+		{NewNetAddressV2(NetworkID(0x42), make([]byte, 16), port, 0), false},
+	}
+	for i, test := range tests {
+		if known := test.na.IsKnownNetwork(); known != test.known {
+			t.Errorf("IsKnownNetwork #%d: got %v, want %v", i, known,
+				test.known)
+		}
+		if legacy := test.na.ToLegacy(); legacy != nil {
+			t.Errorf("ToLegacy #%d: unexpected address %v", i, legacy)
+		}
+	}
+}
+
+// TestNetworkIDStringer tests the stringized output for network ids.
+func TestNetworkIDStringer(t *testing.T) {
+	tests := []struct {
+		in   NetworkID
+		want string
+	}{
+		{NetworkIPv4, "IPv4"},
+		{NetworkIPv6, "IPv6"},
+		{NetworkTorV2, "TorV2"},
+		{NetworkTorV3, "TorV3"},
+		{NetworkI2P, "I2P"},
+		{NetworkCJDNS, "CJDNS"},
+		{0xff, "Unknown NetworkID (255)"},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		result := test.in.String()
+		if result != test.want {
+			t.Errorf("String #%d\n got: %s want: %s", i, result,
+				test.want)
+			continue
+		}
+	}
+}
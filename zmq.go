@@ -0,0 +1,266 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/zmtp"
+	"github.com/btcsuite/btcutil"
+)
+
+// The ZMQ topics published by the zmqNotifier.  They use the same names and
+// message bodies as Bitcoin Core.
+const (
+	// zmqHashBlock publishes the hash of every block connected to the
+	// main chain.
+	zmqHashBlock = "hashblock"
+
+	// zmqRawBlock publishes every block connected to the main chain.
+	zmqRawBlock = "rawblock"
+
+	// zmqHashTx publishes the hash of every transaction accepted to the
+	// mempool or included in a connected or disconnected block.
+	zmqHashTx = "hashtx"
+
+	// zmqRawTx publishes every transaction accepted to the mempool or
+	// included in a connected or disconnected block.
+	zmqRawTx = "rawtx"
+
+	// zmqSequence publishes the hash of every connected and disconnected
+	// block and of every transaction added to or removed from the
+	// mempool, followed by a label for the event.
+	zmqSequence = "sequence"
+)
+
+// Labels of the events published on the sequence topic.
+const (
+	zmqBlockConnected    = 'C'
+	zmqBlockDisconnected = 'D'
+	zmqTxAdded           = 'A'
+	zmqTxRemoved         = 'R'
+)
+
+// zmqTopic is a topic published on a single ZMQ endpoint.
+type zmqTopic struct {
+	name      []byte
+	publisher *zmtp.Publisher
+
+	// sequence is the sequence number of the next message published on
+	// the topic at the endpoint.
+	sequence uint32
+}
+
+// zmqNotifier publishes blocks, transactions and mempool events to ZMQ
+// subscribers.  Every message consists of three frames: the topic, the body
+// and the sequence number of the message for the topic in little-endian byte
+// order, so consumers can detect dropped messages.
+type zmqNotifier struct {
+	mtx        sync.Mutex
+	publishers map[string]*zmtp.Publisher
+	topics     map[string][]*zmqTopic
+
+	// mempoolSequence is the number of mempool additions and removals
+	// which have been published on the sequence topic.
+	mempoolSequence uint64
+}
+
+// newZMQNotifier returns a new zmqNotifier publishing each topic on the
+// endpoints configured for it.  Topics which share an endpoint are published
+// by the same publisher.  It returns nil when no endpoints are configured.
+func newZMQNotifier() (*zmqNotifier, error) {
+	endpoints := []struct {
+		topic     string
+		endpoints []string
+	}{
+		{zmqHashBlock, cfg.ZMQPubHashBlock},
+		{zmqHashTx, cfg.ZMQPubHashTx},
+		{zmqRawBlock, cfg.ZMQPubRawBlock},
+		{zmqRawTx, cfg.ZMQPubRawTx},
+		{zmqSequence, cfg.ZMQPubSequence},
+	}
+
+	n := &zmqNotifier{
+		publishers: make(map[string]*zmtp.Publisher),
+		topics:     make(map[string][]*zmqTopic),
+	}
+	for _, topic := range endpoints {
+		for _, endpoint := range topic.endpoints {
+			publisher, ok := n.publishers[endpoint]
+			if !ok {
+				var err error
+				publisher, err = zmtp.Listen(endpoint)
+				if err != nil {
+					n.Stop()
+					return nil, err
+				}
+				n.publishers[endpoint] = publisher
+			}
+
+			zmqpLog.Infof("Publishing %s notifications on %s",
+				topic.topic, endpoint)
+			n.topics[topic.topic] = append(n.topics[topic.topic],
+				&zmqTopic{name: []byte(topic.topic), publisher: publisher})
+		}
+	}
+	if len(n.publishers) == 0 {
+		return nil, nil
+	}
+
+	return n, nil
+}
+
+// publish publishes a message on all of the endpoints of the passed topic.
+// The body is only created when the topic has subscribers at one of the
+// endpoints.
+//
+// This function MUST be called with the notifier lock held.
+func (n *zmqNotifier) publish(topic string, body func() []byte) {
+	var data []byte
+	for _, t := range n.topics[topic] {
+		var sequence [4]byte
+		binary.LittleEndian.PutUint32(sequence[:], t.sequence)
+		t.sequence++
+
+		if !t.publisher.Subscribed(t.name) {
+			continue
+		}
+		if data == nil {
+			data = body()
+		}
+		t.publisher.Publish([][]byte{t.name, data, sequence[:]})
+	}
+}
+
+// reverseHash returns the passed hash in the byte order it is displayed in,
+// which is how hashes are published.
+func reverseHash(hash *chainhash.Hash) []byte {
+	reversed := make([]byte, chainhash.HashSize)
+	for i, b := range hash {
+		reversed[chainhash.HashSize-1-i] = b
+	}
+	return reversed
+}
+
+// publishSequence publishes an event on the sequence topic.  Mempool events
+// also carry the mempool sequence number in little-endian byte order.
+//
+// This function MUST be called with the notifier lock held.
+func (n *zmqNotifier) publishSequence(hash *chainhash.Hash, label byte) {
+	mempoolEvent := label == zmqTxAdded || label == zmqTxRemoved
+	mempoolSequence := n.mempoolSequence
+	if mempoolEvent {
+		n.mempoolSequence++
+	}
+
+	n.publish(zmqSequence, func() []byte {
+		body := append(reverseHash(hash), label)
+		if mempoolEvent {
+			var sequence [8]byte
+			binary.LittleEndian.PutUint64(sequence[:], mempoolSequence)
+			body = append(body, sequence[:]...)
+		}
+		return body
+	})
+}
+
+// publishTransaction publishes a transaction on the hashtx and rawtx topics.
+//
+// This function MUST be called with the notifier lock held.
+func (n *zmqNotifier) publishTransaction(tx *btcutil.Tx) {
+	n.publish(zmqHashTx, func() []byte {
+		return reverseHash(tx.Hash())
+	})
+	n.publish(zmqRawTx, func() []byte {
+		var rawTx bytes.Buffer
+		rawTx.Grow(tx.MsgTx().SerializeSize())
+		if err := tx.MsgTx().Serialize(&rawTx); err != nil {
+			zmqpLog.Errorf("Failed to serialize transaction %v: %v",
+				tx.Hash(), err)
+		}
+		return rawTx.Bytes()
+	})
+}
+
+// handleBlockchainNotification publishes the transactions of blocks which
+// are connected to or disconnected from the main chain, followed by the event
+// on the sequence topic and, for connected blocks, the block itself.
+func (n *zmqNotifier) handleBlockchainNotification(notification *blockchain.Notification) {
+	switch notification.Type {
+	case blockchain.NTBlockConnected, blockchain.NTBlockDisconnected:
+	default:
+		return
+	}
+	block, ok := notification.Data.(*btcutil.Block)
+	if !ok {
+		zmqpLog.Warnf("Chain notification is not a block.")
+		return
+	}
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	for _, tx := range block.Transactions() {
+		n.publishTransaction(tx)
+	}
+
+	if notification.Type == blockchain.NTBlockDisconnected {
+		n.publishSequence(block.Hash(), zmqBlockDisconnected)
+		return
+	}
+	n.publishSequence(block.Hash(), zmqBlockConnected)
+	n.publish(zmqHashBlock, func() []byte {
+		return reverseHash(block.Hash())
+	})
+	n.publish(zmqRawBlock, func() []byte {
+		rawBlock, err := block.Bytes()
+		if err != nil {
+			zmqpLog.Errorf("Failed to serialize block %v: %v",
+				block.Hash(), err)
+		}
+		return rawBlock
+	})
+}
+
+// NotifyAddedTransaction publishes a transaction added to the mempool and its
+// addition to it.  It is called by the mempool with its lock held, so the
+// mempool sequence number follows the order in which transactions are added
+// to and removed from the mempool.
+//
+// This function is safe for concurrent access.
+func (n *zmqNotifier) NotifyAddedTransaction(txD *mempool.TxDesc) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.publishTransaction(txD.Tx)
+	n.publishSequence(txD.Tx.Hash(), zmqTxAdded)
+}
+
+// NotifyRemovedTransaction publishes the removal of a transaction from the
+// mempool for any reason other than being mined.  Like NotifyAddedTransaction,
+// it is called by the mempool with its lock held.
+//
+// This function is safe for concurrent access.
+func (n *zmqNotifier) NotifyRemovedTransaction(tx *btcutil.Tx) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.publishSequence(tx.Hash(), zmqTxRemoved)
+}
+
+// Stop closes all of the publishers of the notifier.
+func (n *zmqNotifier) Stop() {
+	for endpoint, publisher := range n.publishers {
+		if err := publisher.Close(); err != nil {
+			zmqpLog.Errorf("Failed to close ZMQ endpoint %s: %v",
+				endpoint, err)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package zmtp implements the publishing side of the ZeroMQ Message Transport
+Protocol (ZMTP) 3.0 in pure Go.
+
+Publisher Overview
+
+A Publisher listens on a ZeroMQ endpoint, such as tcp://127.0.0.1:28332, and
+behaves like a ZeroMQ PUB socket: SUB sockets of any ZeroMQ implementation can
+connect to it, subscribe to topic prefixes, and receive the multipart messages
+whose first frame starts with one of their subscriptions.  Only the NULL
+security mechanism is supported.  Like ZeroMQ, messages for subscribers which
+are too slow to keep up are dropped rather than blocking the publisher.
+*/
+package zmtp
@@ -0,0 +1,558 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmtp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// greetingSize is the size of the greeting each side sends once a
+	// connection is established.
+	greetingSize = 64
+
+	// Flags in the first byte of every frame.  flagMore is set on all but
+	// the last frame of a message, flagLong when the frame size is encoded
+	// in eight bytes instead of one, and flagCommand on command frames.
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+
+	// maxInboundFrameSize is the largest frame accepted from a subscriber.
+	// Subscribers only send commands and subscriptions, so larger frames
+	// are treated as a protocol error.
+	maxInboundFrameSize = 1 << 16
+
+	// handshakeTimeout is the time a subscriber has to complete the
+	// greeting and handshake after connecting.
+	handshakeTimeout = 10 * time.Second
+
+	// sendQueueSize is the number of messages queued for a subscriber
+	// before further messages to it are dropped.  It matches the default
+	// send high water mark of ZeroMQ.
+	sendQueueSize = 1000
+)
+
+// greeting is the greeting sent by the publisher.  It consists of the ZMTP
+// signature, the protocol version, the NULL security mechanism and the
+// as-server flag, which is unused by the NULL mechanism, followed by padding.
+var greeting = func() [greetingSize]byte {
+	var g [greetingSize]byte
+	g[0], g[9] = 0xff, 0x7f
+	g[10], g[11] = 3, 0
+	copy(g[12:32], "NULL")
+	return g
+}()
+
+// ParseEndpoint returns the network and address to listen on for a ZeroMQ
+// endpoint.  The tcp transport, such as tcp://127.0.0.1:28332 or tcp://*:28332
+// for all interfaces, and the ipc transport, such as ipc:///tmp/btcd.sock, are
+// supported.
+func ParseEndpoint(endpoint string) (string, string, error) {
+	i := strings.Index(endpoint, "://")
+	if i < 0 {
+		return "", "", fmt.Errorf("endpoint %q has no transport", endpoint)
+	}
+	transport, address := endpoint[:i], endpoint[i+3:]
+
+	switch transport {
+	case "tcp":
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid endpoint %q: %v",
+				endpoint, err)
+		}
+		if host == "*" {
+			host = ""
+		}
+		return "tcp", net.JoinHostPort(host, port), nil
+
+	case "ipc":
+		if address == "" {
+			return "", "", fmt.Errorf("endpoint %q has no path",
+				endpoint)
+		}
+		return "unix", address, nil
+	}
+
+	return "", "", fmt.Errorf("endpoint %q has unsupported transport %q",
+		endpoint, transport)
+}
+
+// writeFrame writes a frame with the passed flags and body to w.
+func writeFrame(w *bufio.Writer, flags byte, body []byte) error {
+	if len(body) > math.MaxUint8 {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(body)))
+		w.WriteByte(flags | flagLong)
+		w.Write(size[:])
+	} else {
+		w.WriteByte(flags)
+		w.WriteByte(byte(len(body)))
+	}
+
+	// Errors are sticky, so the last write reports any of them.
+	_, err := w.Write(body)
+	return err
+}
+
+// readFrame reads a frame from r and returns its flags and body.
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	flags, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var size uint64
+	if flags&flagLong != 0 {
+		var sizeBytes [8]byte
+		if _, err := io.ReadFull(r, sizeBytes[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(sizeBytes[:])
+	} else {
+		sizeByte, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(sizeByte)
+	}
+	if size > maxInboundFrameSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes exceeds the maximum "+
+			"of %d bytes", size, maxInboundFrameSize)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+// newCommand returns the body of a command frame with the passed name and
+// data.
+func newCommand(name string, data []byte) []byte {
+	body := make([]byte, 0, 1+len(name)+len(data))
+	body = append(body, byte(len(name)))
+	body = append(body, name...)
+	return append(body, data...)
+}
+
+// parseCommand returns the name and data of the passed command frame body.
+func parseCommand(body []byte) (string, []byte, error) {
+	if len(body) == 0 || len(body) < 1+int(body[0]) {
+		return "", nil, errors.New("malformed command")
+	}
+	nameLen := int(body[0])
+	return string(body[1 : 1+nameLen]), body[1+nameLen:], nil
+}
+
+// newProperty returns the encoding of a metadata property of the READY
+// command.
+func newProperty(name, value string) []byte {
+	property := make([]byte, 0, 5+len(name)+len(value))
+	property = append(property, byte(len(name)))
+	property = append(property, name...)
+	var valueLen [4]byte
+	binary.BigEndian.PutUint32(valueLen[:], uint32(len(value)))
+	property = append(property, valueLen[:]...)
+	return append(property, value...)
+}
+
+// parseProperties returns the metadata properties of a READY command keyed by
+// their lowercase names, since property names are case-insensitive.
+func parseProperties(data []byte) (map[string]string, error) {
+	properties := make(map[string]string)
+	for len(data) > 0 {
+		nameLen := int(data[0])
+		if len(data) < 1+nameLen+4 {
+			return nil, errors.New("malformed metadata property")
+		}
+		name := strings.ToLower(string(data[1 : 1+nameLen]))
+		data = data[1+nameLen:]
+
+		valueLen := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint64(len(data)) < uint64(valueLen) {
+			return nil, errors.New("malformed metadata property")
+		}
+		properties[name] = string(data[:valueLen])
+		data = data[valueLen:]
+	}
+	return properties, nil
+}
+
+// handshake exchanges the greeting and READY commands with a newly connected
+// peer and makes sure it is a SUB socket using the NULL security mechanism.
+func handshake(conn net.Conn, r *bufio.Reader, w *bufio.Writer) error {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	w.Write(greeting[:])
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var peerGreeting [greetingSize]byte
+	if _, err := io.ReadFull(r, peerGreeting[:]); err != nil {
+		return err
+	}
+	if peerGreeting[0] != 0xff || peerGreeting[9]&0x01 == 0 {
+		return errors.New("invalid greeting signature")
+	}
+	if peerGreeting[10] < 3 {
+		return fmt.Errorf("unsupported ZMTP version %d.%d",
+			peerGreeting[10], peerGreeting[11])
+	}
+	mechanism := string(bytes.TrimRight(peerGreeting[12:32], "\x00"))
+	if mechanism != "NULL" {
+		return fmt.Errorf("unsupported security mechanism %q", mechanism)
+	}
+
+	ready := newCommand("READY", newProperty("Socket-Type", "PUB"))
+	if err := writeFrame(w, flagCommand, ready); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	flags, body, err := readFrame(r)
+	if err != nil {
+		return err
+	}
+	if flags&flagCommand == 0 {
+		return errors.New("expected READY command")
+	}
+	name, data, err := parseCommand(body)
+	if err != nil {
+		return err
+	}
+	if name != "READY" {
+		return fmt.Errorf("expected READY command, got %q", name)
+	}
+	properties, err := parseProperties(data)
+	if err != nil {
+		return err
+	}
+	switch socketType := properties["socket-type"]; socketType {
+	case "SUB", "XSUB":
+	default:
+		return fmt.Errorf("incompatible socket type %q", socketType)
+	}
+
+	return nil
+}
+
+// subscriber houses a connection from a SUB socket.
+type subscriber struct {
+	conn net.Conn
+
+	// subscriptions counts the subscriptions to each topic prefix.  It is
+	// protected by the mutex of the publisher.
+	subscriptions map[string]int
+
+	sendQueue chan [][]byte
+	quit      chan struct{}
+}
+
+// subscribed returns whether the subscriber has subscribed to a prefix of the
+// passed topic.
+//
+// This function MUST be called with the publisher lock held.
+func (s *subscriber) subscribed(topic []byte) bool {
+	for prefix := range s.subscriptions {
+		if bytes.HasPrefix(topic, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Publisher is a ZeroMQ PUB socket listening on a single endpoint.
+type Publisher struct {
+	listener net.Listener
+
+	// conns holds all connections, including those still performing the
+	// handshake, so they can be closed along with the publisher.
+	mtx         sync.Mutex
+	conns       map[net.Conn]struct{}
+	subscribers map[*subscriber]struct{}
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// Listen returns a new Publisher listening on the passed ZeroMQ endpoint.  See
+// ParseEndpoint for the supported endpoints.
+func Listen(endpoint string) (*Publisher, error) {
+	network, address, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Publisher{
+		listener:    listener,
+		conns:       make(map[net.Conn]struct{}),
+		subscribers: make(map[*subscriber]struct{}),
+		quit:        make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.listenHandler()
+	return p, nil
+}
+
+// Addr returns the address the publisher is listening on.
+func (p *Publisher) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+// listenHandler accepts connections from subscribers until the publisher is
+// closed.  It must be run as a goroutine.
+func (p *Publisher) listenHandler() {
+	defer p.wg.Done()
+
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			select {
+			case <-p.quit:
+			default:
+				log.Errorf("Can't accept connection on %s: %v",
+					p.listener.Addr(), err)
+			}
+			return
+		}
+
+		p.mtx.Lock()
+		select {
+		case <-p.quit:
+			p.mtx.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		p.conns[conn] = struct{}{}
+		p.mtx.Unlock()
+
+		p.wg.Add(1)
+		go p.subscriberHandler(conn)
+	}
+}
+
+// subscriberHandler performs the handshake with a newly connected subscriber
+// and then handles its subscriptions until it disconnects.  It must be run as
+// a goroutine.
+func (p *Publisher) subscriberHandler(conn net.Conn) {
+	defer p.wg.Done()
+	defer func() {
+		conn.Close()
+		p.mtx.Lock()
+		delete(p.conns, conn)
+		p.mtx.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	if err := handshake(conn, r, w); err != nil {
+		log.Debugf("Handshake with %s failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	sub := &subscriber{
+		conn:          conn,
+		subscriptions: make(map[string]int),
+		sendQueue:     make(chan [][]byte, sendQueueSize),
+		quit:          make(chan struct{}),
+	}
+	p.mtx.Lock()
+	p.subscribers[sub] = struct{}{}
+	p.mtx.Unlock()
+	log.Debugf("New subscriber %s on %s", conn.RemoteAddr(), p.Addr())
+
+	p.wg.Add(1)
+	go p.sendHandler(sub, w)
+
+	err := p.readSubscriptions(sub, r)
+	log.Debugf("Subscriber %s disconnected: %v", conn.RemoteAddr(), err)
+
+	p.mtx.Lock()
+	delete(p.subscribers, sub)
+	p.mtx.Unlock()
+	close(sub.quit)
+}
+
+// readSubscriptions reads the subscriptions of a subscriber until it
+// disconnects.  ZMTP 3.0 subscribers send subscriptions as single frame
+// messages starting with 1 to subscribe or 0 to cancel a subscription, while
+// ZMTP 3.1 ones may also use SUBSCRIBE and CANCEL commands.  Any other
+// messages and commands are ignored.
+func (p *Publisher) readSubscriptions(sub *subscriber, r *bufio.Reader) error {
+	var continuation bool
+	for {
+		flags, body, err := readFrame(r)
+		if err != nil {
+			return err
+		}
+
+		if flags&flagCommand != 0 {
+			name, data, err := parseCommand(body)
+			if err != nil {
+				return err
+			}
+			switch name {
+			case "SUBSCRIBE":
+				p.subscribe(sub, data, true)
+			case "CANCEL":
+				p.subscribe(sub, data, false)
+			}
+			continue
+		}
+
+		// Skip all frames of multipart messages.
+		multipart := continuation || flags&flagMore != 0
+		continuation = flags&flagMore != 0
+		if multipart || len(body) == 0 {
+			continue
+		}
+		switch body[0] {
+		case 1:
+			p.subscribe(sub, body[1:], true)
+		case 0:
+			p.subscribe(sub, body[1:], false)
+		}
+	}
+}
+
+// subscribe adds or cancels a subscription of a subscriber to a topic prefix.
+// Like ZeroMQ, a subscription which was made several times must be canceled
+// as many times.
+func (p *Publisher) subscribe(sub *subscriber, prefix []byte, add bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	key := string(prefix)
+	if add {
+		sub.subscriptions[key]++
+		return
+	}
+	if sub.subscriptions[key] <= 1 {
+		delete(sub.subscriptions, key)
+		return
+	}
+	sub.subscriptions[key]--
+}
+
+// sendHandler writes the messages queued for a subscriber to its connection
+// until it disconnects or the publisher is closed.  It must be run as a
+// goroutine.
+func (p *Publisher) sendHandler(sub *subscriber, w *bufio.Writer) {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case msg := <-sub.sendQueue:
+			var err error
+			for i, frame := range msg {
+				var flags byte
+				if i < len(msg)-1 {
+					flags = flagMore
+				}
+				err = writeFrame(w, flags, frame)
+			}
+
+			// Only flush once the queue is drained so bursts of
+			// messages are written together.
+			if err == nil && len(sub.sendQueue) == 0 {
+				err = w.Flush()
+			}
+			if err != nil {
+				log.Debugf("Can't send to subscriber %s: %v",
+					sub.conn.RemoteAddr(), err)
+				sub.conn.Close()
+				return
+			}
+
+		case <-sub.quit:
+			return
+
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// Subscribed returns whether any subscriber has subscribed to a prefix of the
+// passed topic.  It can be used to avoid creating messages nobody receives.
+//
+// This function is safe for concurrent access.
+func (p *Publisher) Subscribed(topic []byte) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for sub := range p.subscribers {
+		if sub.subscribed(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish sends a multipart message to all subscribers which have subscribed
+// to a prefix of its first frame, the topic.  The message is dropped for
+// subscribers which already have too many messages queued.  The frames must
+// not be modified after they are passed.
+//
+// This function is safe for concurrent access.
+func (p *Publisher) Publish(msg [][]byte) {
+	if len(msg) == 0 {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for sub := range p.subscribers {
+		if !sub.subscribed(msg[0]) {
+			continue
+		}
+		select {
+		case sub.sendQueue <- msg:
+		default:
+			log.Debugf("Dropping message to slow subscriber %s",
+				sub.conn.RemoteAddr())
+		}
+	}
+}
+
+// Close stops listening, disconnects all subscribers and waits for all of the
+// goroutines of the publisher to finish.
+func (p *Publisher) Close() error {
+	close(p.quit)
+	err := p.listener.Close()
+
+	p.mtx.Lock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mtx.Unlock()
+
+	p.wg.Wait()
+	return err
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2018 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmtp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestParseEndpoint ensures ZeroMQ endpoints are converted to the network and
+// address to listen on and unsupported ones are rejected.
+func TestParseEndpoint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		endpoint string
+		network  string
+		address  string
+		valid    bool
+	}{
+		{"tcp://127.0.0.1:28332", "tcp", "127.0.0.1:28332", true},
+		{"tcp://*:28332", "tcp", ":28332", true},
+		{"tcp://[::1]:28332", "tcp", "[::1]:28332", true},
+		{"ipc:///tmp/btcd.sock", "unix", "/tmp/btcd.sock", true},
+		{"tcp://127.0.0.1", "", "", false},
+		{"ipc://", "", "", false},
+		{"udp://127.0.0.1:28332", "", "", false},
+		{"127.0.0.1:28332", "", "", false},
+	}
+	for _, test := range tests {
+		network, address, err := ParseEndpoint(test.endpoint)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseEndpoint(%q): unexpected error: %v",
+				test.endpoint, err)
+			continue
+		}
+		if network != test.network || address != test.address {
+			t.Errorf("ParseEndpoint(%q): got %s %s, want %s %s",
+				test.endpoint, network, address, test.network,
+				test.address)
+		}
+	}
+}
+
+// testSubscriber is a minimal ZMTP 3.0 SUB socket used to test the publisher.
+type testSubscriber struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// dialTestSubscriber connects a testSubscriber to the passed publisher and
+// performs the handshake.
+func dialTestSubscriber(t *testing.T, p *Publisher) *testSubscriber {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", p.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to connect to publisher: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	s := &testSubscriber{
+		t:    t,
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+
+	s.w.Write(greeting[:])
+	s.w.Flush()
+	var peerGreeting [greetingSize]byte
+	if _, err := io.ReadFull(s.r, peerGreeting[:]); err != nil {
+		t.Fatalf("unable to read greeting: %v", err)
+	}
+	if peerGreeting != greeting {
+		t.Fatalf("unexpected greeting %x", peerGreeting)
+	}
+
+	ready := newCommand("READY", newProperty("socket-type", "SUB"))
+	writeFrame(s.w, flagCommand, ready)
+	s.w.Flush()
+	flags, body, err := readFrame(s.r)
+	if err != nil {
+		t.Fatalf("unable to read READY command: %v", err)
+	}
+	name, data, err := parseCommand(body)
+	if err != nil || flags&flagCommand == 0 || name != "READY" {
+		t.Fatalf("unexpected frame %x instead of READY command", body)
+	}
+	properties, err := parseProperties(data)
+	if err != nil || properties["socket-type"] != "PUB" {
+		t.Fatalf("unexpected READY properties %v: %v", properties, err)
+	}
+	return s
+}
+
+// subscribe subscribes to the passed topic prefix and waits until the
+// publisher has processed the subscription.
+func (s *testSubscriber) subscribe(p *Publisher, prefix string) {
+	s.t.Helper()
+
+	writeFrame(s.w, 0, append([]byte{1}, prefix...))
+	s.w.Flush()
+	for i := 0; !p.Subscribed([]byte(prefix)); i++ {
+		if i == 100 {
+			s.t.Fatalf("subscription to %q was not processed", prefix)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// receive reads a multipart message.
+func (s *testSubscriber) receive() [][]byte {
+	s.t.Helper()
+
+	var msg [][]byte
+	for {
+		flags, body, err := readFrame(s.r)
+		if err != nil {
+			s.t.Fatalf("unable to read message: %v", err)
+		}
+		msg = append(msg, body)
+		if flags&flagMore == 0 {
+			return msg
+		}
+	}
+}
+
+// TestPublisher ensures subscribers only receive the messages whose topic
+// starts with one of their subscriptions, including messages with frames too
+// large for a short size.
+func TestPublisher(t *testing.T) {
+	t.Parallel()
+
+	p, err := Listen("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: unexpected error: %v", err)
+	}
+	defer p.Close()
+
+	if p.Subscribed([]byte("hashtx")) {
+		t.Fatalf("Subscribed: got subscription without subscribers")
+	}
+
+	hashSub := dialTestSubscriber(t, p)
+	defer hashSub.conn.Close()
+	hashSub.subscribe(p, "hash")
+	allSub := dialTestSubscriber(t, p)
+	defer allSub.conn.Close()
+	allSub.subscribe(p, "")
+
+	hashTx := [][]byte{[]byte("hashtx"), bytes.Repeat([]byte{1}, 32),
+		{0, 0, 0, 0}}
+	rawBlock := [][]byte{[]byte("rawblock"), bytes.Repeat([]byte{2}, 1000),
+		{0, 0, 0, 0}}
+	p.Publish(rawBlock)
+	p.Publish(hashTx)
+
+	if msg := hashSub.receive(); !equalMessages(msg, hashTx) {
+		t.Fatalf("subscriber to hash got %q, want %q", msg, hashTx)
+	}
+	for _, want := range [][][]byte{rawBlock, hashTx} {
+		if msg := allSub.receive(); !equalMessages(msg, want) {
+			t.Fatalf("subscriber to all topics got %q, want %q",
+				msg, want)
+		}
+	}
+}
+
+// equalMessages returns whether the passed multipart messages are the same.
+func equalMessages(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}